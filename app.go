@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// AppStatus describes the FortiClient app process. Responding is whether
+// it answered a state query through the bridge in time; a running app that
+// does not is wedged and worth restarting.
+type AppStatus struct {
+	Running        bool   `json:"running"`
+	PIDs           []int  `json:"pids,omitempty"`
+	StartedAt      string `json:"started_at,omitempty"`
+	Version        string `json:"version,omitempty"`
+	Responding     *bool  `json:"responding,omitempty"`
+	Connection     string `json:"connection,omitempty"`
+	UpgradePending string `json:"upgrade_pending,omitempty"`
+	Headless       bool   `json:"headless"`
+}
+
+func runApp(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, msg("error", msg("app.no_subcommand")))
+		return 2
+	}
+	switch args[0] {
+	case "status":
+		return runAppStatus(args[1:])
+	case "quit":
+		return runAppQuit(args[1:], false)
+	case "restart":
+		return runAppQuit(args[1:], true)
+	default:
+		fmt.Fprintln(os.Stderr, msg("error", msg("app.unknown", args[0])))
+		return 2
+	}
+}
+
+func fortiClientPIDs() []int {
+	out, err := exec.Command("pgrep", "-x", "FortiClient").Output()
+	if err != nil {
+		return nil
+	}
+	var pids []int
+	for _, field := range strings.Fields(string(out)) {
+		if pid, err := strconv.Atoi(field); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+func runAppStatus(args []string) int {
+	fs := flag.NewFlagSet("app status", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	timeoutSec := fs.Float64("timeout", 5, "Seconds the app gets to answer a state query before it counts as not responding.")
+	asJSON := outputFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+
+	status := AppStatus{PIDs: fortiClientPIDs(), Version: installedFortiClientVersion(), Headless: headlessSession()}
+	status.Running = len(status.PIDs) > 0
+	if started, err := fortiClientStartTime(); err == nil {
+		status.StartedAt = started.Format(time.RFC3339)
+	}
+	if reason, pending := pendingUpgrade(nil, cfg.Upgrade.Markers); pending {
+		status.UpgradePending = reason
+	}
+	if _, ok := activeBackend().(bridgeBackend); ok && status.Running {
+		if bridgeTimeout <= 0 || bridgeTimeout > seconds(*timeoutSec) {
+			bridgeTimeout = seconds(*timeoutSec)
+		}
+		state, err := freshTunnelState()
+		responding := err == nil
+		status.Responding = &responding
+		if responding && state.Connected() {
+			status.Connection = state.CurrentConnection()
+		}
+	}
+
+	if *asJSON {
+		if code := printJSON(status); code != 0 {
+			return code
+		}
+	} else {
+		if !status.Running {
+			fmt.Println(msg("app.not_running"))
+		} else {
+			pids := make([]string, 0, len(status.PIDs))
+			for _, pid := range status.PIDs {
+				pids = append(pids, strconv.Itoa(pid))
+			}
+			fmt.Println(msg("app.running", strings.Join(pids, ", "), emptyAsUnknown(status.StartedAt)))
+		}
+		fmt.Println(msg("app.version", emptyAsUnknown(status.Version)))
+		if status.Responding != nil {
+			if *status.Responding {
+				fmt.Println(msg("app.responding", emptyAsUnknown(status.Connection)))
+			} else {
+				fmt.Println(msg("app.not_responding"))
+			}
+		}
+		if status.UpgradePending != "" {
+			warnf("upgrade.pending", status.UpgradePending)
+		}
+	}
+	switch {
+	case !status.Running:
+		return 10
+	case status.Responding != nil && !*status.Responding:
+		return 1
+	}
+	return 0
+}
+
+// runAppQuit quits FortiClient, and starts it again when restart is set.
+// Quitting drops an active tunnel, so that is confirmed like a displacing
+// connect and honours the disconnect lock.
+func runAppQuit(args []string, restart bool) int {
+	name := "app quit"
+	if restart {
+		name = "app restart"
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	timeoutSec := fs.Float64("timeout", 15, "Seconds to wait for the app to quit, and again for it to start.")
+	kill := fs.Bool("kill", false, "Terminate the app when it does not quit within the timeout.")
+	force := fs.Bool("force", false, "Quit even while the disconnect lock is armed.")
+	yes := fs.Bool("yes", false, "Quit without asking when a tunnel is up.")
+	noInput := fs.Bool("no-input", false, "Never prompt; refuse to drop an active tunnel unless --yes is given.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if restart && headlessSession() {
+		return fail(fmt.Errorf("%w: FortiClient could not be started again from this session (SSH or CI?); restart it from the logged-in desktop", errHeadless))
+	}
+
+	release, err := acquireOperationLock(name)
+	if err != nil {
+		return fail(err)
+	}
+	defer release()
+
+	if fortiClientRunning() {
+		connection := ""
+		if _, ok := activeBackend().(bridgeBackend); ok {
+			if bridgeTimeout <= 0 || bridgeTimeout > 5*time.Second {
+				bridgeTimeout = 5 * time.Second
+			}
+			if state, err := freshTunnelState(); err == nil && state.Connected() {
+				connection = state.CurrentConnection()
+			}
+		}
+		if connection != "" {
+			if err := checkLock(fmt.Sprintf("quit FortiClient while %q is connected", connection), *force); err != nil {
+				return fail(err)
+			}
+			if err := confirmQuit(connection, *yes, *noInput); err != nil {
+				return fail(err)
+			}
+		}
+		progress.step("quit", "quitting FortiClient")
+		if err := quitFortiClient(seconds(*timeoutSec), *kill); err != nil {
+			return fail(err)
+		}
+		if connection != "" {
+			recordEvent(HistoryEvent{Event: eventDisconnected, Connection: connection, Source: "app", Reason: "FortiClient quit"})
+		}
+		fmt.Println(msg("app.quit"))
+	} else if !restart {
+		fmt.Println(msg("app.not_running"))
+		return 0
+	}
+
+	if !restart {
+		return 0
+	}
+	progress.step("launch", "starting FortiClient")
+	if err := launchFortiClient(seconds(*timeoutSec)); err != nil {
+		return fail(err)
+	}
+	fmt.Println(msg("app.started"))
+	return 0
+}
+
+func confirmQuit(connection string, yes, noInput bool) error {
+	if yes {
+		return nil
+	}
+	if noInput {
+		return fmt.Errorf("%w: %q is connected; pass --yes to quit FortiClient anyway", errDeclined, connection)
+	}
+	if !stdinIsTerminal() {
+		return nil
+	}
+	fmt.Fprint(os.Stderr, msg("app.confirm_quit", connection))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return fmt.Errorf("%w: kept FortiClient running", errDeclined)
+}
+
+// quitFortiClient asks the app to quit the way the Quit menu item does, and
+// with kill sends SIGTERM and then SIGKILL when it has not gone by wait.
+func quitFortiClient(wait time.Duration, kill bool) error {
+	if err := exec.Command("osascript", "-e", `quit app "FortiClient"`).Run(); err != nil && !kill {
+		return fmt.Errorf("failed to quit FortiClient: %w", err)
+	}
+	if waitForAppExit(wait) {
+		return nil
+	}
+	if !kill {
+		return fmt.Errorf("%w waiting for FortiClient to quit; pass --kill to terminate it", errTimedOut)
+	}
+	for _, sig := range []syscall.Signal{syscall.SIGTERM, syscall.SIGKILL} {
+		for _, pid := range fortiClientPIDs() {
+			_ = syscall.Kill(pid, sig)
+		}
+		if waitForAppExit(3 * time.Second) {
+			return nil
+		}
+	}
+	return fmt.Errorf("FortiClient is still running after SIGKILL")
+}
+
+func waitForAppExit(wait time.Duration) bool {
+	deadline := time.Now().Add(wait)
+	for fortiClientRunning() {
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	return true
+}
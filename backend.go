@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// Backend is how commands reach FortiClient. Commands go through
+// activeBackend rather than a particular transport, so other ways of
+// driving the client can be added without touching them.
+type Backend interface {
+	ListConnections() ([]Tunnel, error)
+	GetState() (TunnelState, error)
+	Connect(target Tunnel) error
+	Disconnect(state TunnelState) error
+}
+
+// activeBackend returns the backend selected by --backend, the config or
+// FORTIVPN_BACKEND. The node and electron backends both run the bridge
+// script; they differ only in the runtime (see bridgeRuntime).
+func activeBackend() Backend {
+	if selectedBackend == nil {
+		selectedBackend = selectBackend()
+	}
+	return selectedBackend
+}
+
+var selectedBackend Backend
+
+// selectBackend resolves "auto" by probing what is installed: the bridge
+// when FortiClient's GUI module is there, else Fortinet's CLI. With
+// neither, the bridge is used so its error explains what is missing.
+func selectBackend() Backend {
+	if bridgeReplay != nil {
+		return bridgeBackend{}
+	}
+	backend, _ := normalizeBackend(configuredBackend)
+	switch backend {
+	case backendForticli:
+		path, err := findForticli()
+		if err != nil {
+			return unavailableBackend{err}
+		}
+		return forticliBackend{path: path}
+	case backendMock:
+		backend, err := newMockBackend()
+		if err != nil {
+			return unavailableBackend{err}
+		}
+		return backend
+	case backendNode, backendElectron:
+		return bridgeBackend{}
+	case backendAuto:
+		// Without a GUI session the app cannot be launched for the bridge,
+		// so Fortinet's CLI wins when both are installed.
+		if headlessSession() && os.Getenv("FORTIVPN_MODULE_PATH") == "" {
+			if path, err := findForticli(); err == nil {
+				return forticliBackend{path: path}
+			}
+		}
+		if os.Getenv("FORTIVPN_MODULE_PATH") != "" {
+			return bridgeBackend{}
+		}
+		if _, err := os.Stat(fortiClientModule); err == nil {
+			return bridgeBackend{}
+		}
+		if path, err := findForticli(); err == nil {
+			return forticliBackend{path: path}
+		}
+		return bridgeBackend{}
+	}
+	path, err := findBackendPlugin(backend)
+	if err != nil {
+		return unavailableBackend{err}
+	}
+	return pluginBackend{name: backend, path: path}
+}
+
+// unavailableBackend reports why a forced backend cannot be used.
+type unavailableBackend struct {
+	err error
+}
+
+func (b unavailableBackend) ListConnections() ([]Tunnel, error) { return nil, b.err }
+func (b unavailableBackend) GetState() (TunnelState, error)     { return TunnelState{}, b.err }
+func (b unavailableBackend) Connect(Tunnel) error               { return b.err }
+func (b unavailableBackend) Disconnect(TunnelState) error       { return b.err }
+
+// bridgeBackend runs fortivpn-bridge.js, which loads FortiClient's GUI
+// module.
+type bridgeBackend struct{}
+
+func (bridgeBackend) ListConnections() ([]Tunnel, error) {
+	result, err := readBridge("list-connections")
+	if err != nil {
+		return nil, err
+	}
+	return decodeTunnels(result)
+}
+
+// lastConnectionList is the connection list as the bridge or a plugin last
+// sent it, with every field FortiClient reports rather than just the ones
+// Tunnel keeps.
+var lastConnectionList json.RawMessage
+
+func decodeTunnels(result json.RawMessage) ([]Tunnel, error) {
+	lastConnectionList = result
+	var tunnels []Tunnel
+	if len(result) == 0 || string(result) == "null" {
+		return tunnels, nil
+	}
+	if err := json.Unmarshal(result, &tunnels); err != nil {
+		return nil, fmt.Errorf("failed to decode tunnel list: %w", err)
+	}
+	return tunnels, nil
+}
+
+func (bridgeBackend) GetState() (TunnelState, error) {
+	result, err := readBridge("get-state")
+	if err != nil {
+		return TunnelState{}, err
+	}
+	return decodeTunnelState(result)
+}
+
+func decodeTunnelState(result json.RawMessage) (TunnelState, error) {
+	if len(result) == 0 || string(result) == "null" {
+		return TunnelState{}, nil
+	}
+
+	var state TunnelState
+	if err := json.Unmarshal(result, &state); err != nil {
+		return TunnelState{}, fmt.Errorf("failed to decode tunnel state: %w", err)
+	}
+	return state, nil
+}
+
+func (bridgeBackend) Connect(target Tunnel) error {
+	_, err := runBridge("connect", connectPayload(target))
+	return err
+}
+
+func (bridgeBackend) Disconnect(state TunnelState) error {
+	_, err := runBridge("disconnect", disconnectPayload(state))
+	return err
+}
+
+func connectPayload(target Tunnel) map[string]string {
+	return map[string]string{"connection_name": target.ConnectionName, "connection_type": target.Type}
+}
+
+func disconnectPayload(state TunnelState) map[string]string {
+	return map[string]string{"connection_name": state.CurrentConnection(), "connection_type": state.ConnectionType()}
+}
+
+// backendName is how --backend would name b.
+func backendName(b Backend) string {
+	switch b := b.(type) {
+	case bridgeBackend:
+		if backend, _ := normalizeBackend(configuredBackend); backend == backendElectron {
+			return backendElectron
+		}
+		// Under auto the bridge may be running on FortiClient's Electron.
+		if _, env, err := bridgeRuntime(); err == nil && slices.Equal(env, electronRuntimeEnv) {
+			return backendElectron
+		}
+		return backendNode
+	case forticliBackend:
+		return backendForticli
+	case mockBackend:
+		return backendMock
+	case pluginBackend:
+		return b.name
+	case unavailableBackend:
+		return "unavailable"
+	}
+	return "unknown"
+}
+
+// bridgeDetails runs one of the bridge's informational actions. Other
+// backends have no equivalent, so callers treat an error as "unknown".
+func bridgeDetails(action, connection string) (json.RawMessage, error) {
+	return bridgeAction(action, map[string]string{"connection_name": connection})
+}
+
+// bridgeAction runs an action only the bridge and plugins know, after
+// checking that the installed bridge script has it.
+func bridgeAction(action string, payload any) (json.RawMessage, error) {
+	backend := activeBackend()
+	if plugin, ok := backend.(pluginBackend); ok {
+		return plugin.call(action, payload)
+	}
+	if _, ok := backend.(bridgeBackend); !ok {
+		return nil, fmt.Errorf("%s is only available through the bridge", action)
+	}
+	version, err := bridgeVersion()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(version.Capabilities, action) {
+		return nil, fmt.Errorf("the bridge does not support %s", action)
+	}
+	return runBridge(action, payload)
+}
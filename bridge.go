@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//go:embed fortivpn-bridge.js
+var bridgeScript []byte
+
+// extractBridgeScript writes the embedded bridge to the user cache directory
+// under a name derived from its content, so upgrades never run a stale copy
+// and an unchanged binary reuses the file it wrote before. The .cjs suffix
+// makes deno load it as CommonJS like node and bun do.
+func extractBridgeScript() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate cache directory for the bridge: %w", err)
+	}
+	sum := sha256.Sum256(bridgeScript)
+	path := filepath.Join(dir, "fortivpn", "bridge-"+hex.EncodeToString(sum[:6])+".cjs")
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, bridgeScript) {
+		return path, nil
+	}
+	if err := writeFileAtomic(path, bridgeScript, 0o600); err != nil {
+		return "", fmt.Errorf("failed to extract the bridge to %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// The range of bridge protocol versions this binary speaks. Raise the
+// minimum when the Go side starts relying on a newer bridge.
+const (
+	bridgeProtocolMin = 1
+	bridgeProtocolMax = 1
+)
+
+// checkBridgeProtocol rejects a bridge this binary cannot trust to answer
+// in the shape it expects. Bridges from before the handshake report 0.
+func checkBridgeProtocol(protocol int) error {
+	switch {
+	case protocol < bridgeProtocolMin:
+		return fmt.Errorf("the bridge speaks protocol %d but this fortivpn needs at least %d; unset FORTIVPN_BRIDGE, re-run `fortivpn bridge install` or remove the installed copy to use the bridge built into fortivpn", protocol, bridgeProtocolMin)
+	case protocol > bridgeProtocolMax:
+		return fmt.Errorf("the bridge speaks protocol %d but this fortivpn supports at most %d; upgrade fortivpn", protocol, bridgeProtocolMax)
+	}
+	return nil
+}
+
+// BridgeVersion is the bridge's answer to the version handshake.
+type BridgeVersion struct {
+	Protocol     int      `json:"protocol"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// bridgeVersion asks the bridge which protocol and actions it supports.
+// The answer is kept for the rest of the command.
+func bridgeVersion() (BridgeVersion, error) {
+	if cachedBridgeVersion != nil {
+		return *cachedBridgeVersion, nil
+	}
+	raw, err := runBridge("version", nil)
+	if err != nil {
+		return BridgeVersion{}, err
+	}
+	var version BridgeVersion
+	if err := json.Unmarshal(raw, &version); err != nil {
+		return BridgeVersion{}, fmt.Errorf("invalid bridge version: %w", err)
+	}
+	cachedBridgeVersion = &version
+	return version, nil
+}
+
+var cachedBridgeVersion *BridgeVersion
+
+var (
+	errAuthRequired  = errors.New("authentication required")
+	errNotFound      = errors.New("not found")
+	errAppNotRunning = errors.New("FortiClient is not running")
+)
+
+// bridgeError is a failure reported by the bridge. Code is the bridge's
+// error_code, which maps the failure onto one of the errors above; Stderr
+// is whatever the runtime printed alongside it.
+type bridgeError struct {
+	Code    string
+	Message string
+	Stderr  string
+}
+
+func (e *bridgeError) Error() string {
+	return e.Message
+}
+
+func (e *bridgeError) Unwrap() error {
+	switch e.Code {
+	case "auth_required":
+		return errAuthRequired
+	case "not_found":
+		return errNotFound
+	case "app_not_running":
+		return errAppNotRunning
+	case "timeout":
+		return errBridgeTimedOut
+	}
+	return nil
+}
+
+// bridgeTrace receives a record of every bridge call when --debug-bridge
+// is given.
+var bridgeTrace io.Writer
+
+// openBridgeTrace starts tracing to stderr ("-", "1" or "true") or appends
+// to the named file.
+func openBridgeTrace(target string) (func(), error) {
+	switch strings.ToLower(target) {
+	case "-", "1", "true":
+		bridgeTrace = os.Stderr
+		return func() {}, nil
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bridge trace: %w", err)
+	}
+	bridgeTrace = file
+	return func() { file.Close() }, nil
+}
+
+// traceBridge writes what was sent, what came back on each stream, how the
+// answer was read and how long it took. The raw streams come from the
+// exchange rememberBridge kept, when the call got that far.
+func traceBridge(action string, payload any, start time.Time, result json.RawMessage, err error) {
+	body, _ := json.Marshal(payload)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s bridge %s payload=%s duration=%s\n", start.Format("15:04:05.000"), action, body, time.Since(start).Round(time.Millisecond))
+	if lastBridge.Action == action && !lastBridge.At.Before(start) {
+		fmt.Fprintf(&b, "  stdout: %s\n", strings.TrimSpace(lastBridge.Output))
+		if stderr := strings.TrimSpace(lastBridge.Stderr); stderr != "" {
+			fmt.Fprintf(&b, "  stderr: %s\n", strings.ReplaceAll(stderr, "\n", "\n          "))
+		}
+	}
+	var bridgeErr *bridgeError
+	if errors.As(err, &bridgeErr) && bridgeErr.Code != "" {
+		fmt.Fprintf(&b, "  error (%s): %v\n", bridgeErr.Code, err)
+	} else if err != nil {
+		fmt.Fprintf(&b, "  error: %v\n", err)
+	} else {
+		fmt.Fprintf(&b, "  result: %s\n", result)
+	}
+	fmt.Fprint(bridgeTrace, redact(b.String()))
+}
+
+const bridgeScriptName = "fortivpn-bridge.js"
+
+// bridgeInstallDirs are the standard places an installed bridge script is
+// looked up, in order: per-user, then system-wide and Homebrew.
+func bridgeInstallDirs() []string {
+	var dirs []string
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".local", "libexec", "fortivpn"))
+	}
+	if xdg := strings.TrimSpace(os.Getenv("XDG_DATA_HOME")); xdg != "" {
+		dirs = append(dirs, filepath.Join(xdg, "fortivpn"))
+	} else if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".local", "share", "fortivpn"))
+	}
+	return append(dirs,
+		"/usr/local/libexec/fortivpn",
+		"/opt/homebrew/share/fortivpn",
+		"/usr/local/share/fortivpn",
+	)
+}
+
+func runBridgeCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, msg("error", msg("bridge.no_subcommand")))
+		return 2
+	}
+	switch args[0] {
+	case "install":
+		return runBridgeInstall(args[1:])
+	case "ping":
+		return runBridgePing(args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, msg("error", msg("bridge.unknown", args[0])))
+		return 2
+	}
+}
+
+// runBridgeInstall copies the embedded bridge script to a standard location,
+// for setups that run it directly (a privileged helper, a shared install).
+func runBridgeInstall(args []string) int {
+	fs := flag.NewFlagSet("bridge install", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	dir := fs.String("dir", bridgeInstallDirs()[0], "Directory to install the bridge script into.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	path := filepath.Join(*dir, bridgeScriptName)
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return fail(err)
+	}
+	if err := writeFileAtomic(path, bridgeScript, 0o755); err != nil {
+		return fail(fmt.Errorf("failed to install the bridge: %w", err))
+	}
+	fmt.Println(msg("bridge.installed", path))
+	return 0
+}
+
+// BridgePing is the bridge's answer to a ping, plus how long the round trip
+// took.
+type BridgePing struct {
+	OK        bool   `json:"ok"`
+	Protocol  int    `json:"protocol"`
+	Runtime   string `json:"runtime"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+// runBridgePing checks that the bridge can be found and started and that it
+// answers with valid JSON within the deadline, without touching FortiClient.
+func runBridgePing(args []string) int {
+	fs := flag.NewFlagSet("bridge ping", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	asJSON := outputFlags(fs)
+	timeoutSec := fs.Float64("timeout", 5, "Deadline in seconds (0 waits indefinitely).")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	bridgeTimeout = seconds(*timeoutSec)
+	start := time.Now()
+	raw, err := runBridge("ping", nil)
+	if err != nil {
+		return fail(err)
+	}
+	ping := BridgePing{OK: true, LatencyMS: time.Since(start).Milliseconds()}
+	if err := json.Unmarshal(raw, &ping); err != nil {
+		return fail(fmt.Errorf("invalid bridge ping: %w", err))
+	}
+	if *asJSON {
+		return printJSON(ping)
+	}
+	fmt.Println(msg("bridge.pong", ping.Protocol, ping.Runtime, ping.LatencyMS))
+	return 0
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// statusCacheTTL, when positive, lets read-only bridge calls be answered
+// from a cache shared by every caller of the same user. Set by status
+// --max-age so prompts, tmux and editor plugins polling at once cost one
+// bridge call per window.
+var statusCacheTTL time.Duration
+
+type bridgeCacheEntry struct {
+	FetchedAt time.Time       `json:"fetched_at"`
+	Result    json.RawMessage `json:"result"`
+}
+
+// readCache remembers the connection list and tunnel state for a moment, so
+// the back-to-back reads one command makes (connect looks up the target,
+// then the current state) cost one backend call each. Anything that
+// changes the tunnel clears it.
+var readCache = &memoCache{ttl: time.Second}
+
+type memoCache struct {
+	ttl       time.Duration
+	tunnels   []Tunnel
+	tunnelsAt time.Time
+	state     TunnelState
+	stateAt   time.Time
+}
+
+func (c *memoCache) connections() ([]Tunnel, bool) {
+	if c.ttl <= 0 || c.tunnelsAt.IsZero() || time.Since(c.tunnelsAt) >= c.ttl {
+		return nil, false
+	}
+	return slices.Clone(c.tunnels), true
+}
+
+func (c *memoCache) storeConnections(tunnels []Tunnel) {
+	c.tunnels, c.tunnelsAt = slices.Clone(tunnels), time.Now()
+}
+
+func (c *memoCache) tunnelState() (TunnelState, bool) {
+	if c.ttl <= 0 || c.stateAt.IsZero() || time.Since(c.stateAt) >= c.ttl {
+		return TunnelState{}, false
+	}
+	return c.state, true
+}
+
+func (c *memoCache) storeState(state TunnelState) {
+	c.state, c.stateAt = state, time.Now()
+}
+
+func (c *memoCache) invalidate() {
+	c.stateAt = time.Time{}
+}
+
+// readBridge runs a read-only bridge action, through the cache when enabled.
+func readBridge(action string) (json.RawMessage, error) {
+	if statusCacheTTL <= 0 {
+		return runBridge(action, nil)
+	}
+	dir, err := stateDir()
+	if err != nil {
+		return runBridge(action, nil)
+	}
+	return cachedBridge(filepath.Join(dir, "cache"), action, statusCacheTTL)
+}
+
+// cachedBridge returns a cached result younger than ttl. Otherwise it takes
+// an exclusive lock so only one of many concurrent callers refreshes; the
+// others wait and then read what it wrote.
+func cachedBridge(dir, action string, ttl time.Duration) (json.RawMessage, error) {
+	path := filepath.Join(dir, action+".json")
+	if result, ok := readBridgeCache(path, ttl); ok {
+		return result, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return runBridge(action, nil)
+	}
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return runBridge(action, nil)
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return runBridge(action, nil)
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	if result, ok := readBridgeCache(path, ttl); ok {
+		return result, nil
+	}
+	result, err := runBridge(action, nil)
+	if err != nil {
+		return nil, err
+	}
+	if body, err := json.Marshal(bridgeCacheEntry{FetchedAt: time.Now(), Result: result}); err == nil {
+		_ = writeFileAtomic(path, body, 0o600)
+	}
+	return result, nil
+}
+
+func readBridgeCache(path string, ttl time.Duration) (json.RawMessage, bool) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var entry bridgeCacheEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil, false
+	}
+	age := time.Since(entry.FetchedAt)
+	if age < 0 || age >= ttl {
+		return nil, false
+	}
+	return entry.Result, true
+}
+
+// invalidateConnectionList drops the cached connection list after this
+// process added or removed a connection.
+func invalidateConnectionList() {
+	readCache.tunnelsAt = time.Time{}
+	if dir, err := stateDir(); err == nil {
+		_ = os.Remove(filepath.Join(dir, "cache", "list-connections.json"))
+	}
+}
+
+// invalidateBridgeCache drops cached state after this process changed it,
+// so a status or prompt right after connect or disconnect is not stale.
+func invalidateBridgeCache() {
+	dir, err := stateDir()
+	if err != nil {
+		return
+	}
+	_ = os.Remove(filepath.Join(dir, "cache", "get-state.json"))
+	_ = os.Remove(filepath.Join(dir, "cache", "prompt.json"))
+}
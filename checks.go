@@ -0,0 +1,463 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const defaultCheckTimeout = 5 * time.Second
+
+type CheckConfig struct {
+	Name          string  `json:"name"`
+	Type          string  `json:"type"`
+	Address       string  `json:"address,omitempty"`
+	URL           string  `json:"url,omitempty"`
+	Host          string  `json:"host,omitempty"`
+	ExpectStatus  int     `json:"expect_status,omitempty"`
+	ExpectAddress string  `json:"expect_address,omitempty"`
+	Family        string  `json:"family,omitempty"`
+	Timeout       float64 `json:"timeout,omitempty"`
+}
+
+type CheckResult struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Target    string `json:"target"`
+	Family    string `json:"family"`
+	OK        bool   `json:"ok"`
+	LatencyMS int64  `json:"latency_ms"`
+	Detail    string `json:"detail,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (c CheckConfig) validate() error {
+	if _, err := normalizeFamily(c.Family); err != nil {
+		return err
+	}
+	switch strings.ToLower(c.Type) {
+	case "tcp":
+		if _, _, err := net.SplitHostPort(c.Address); err != nil {
+			return fmt.Errorf("tcp check needs address host:port: %w", err)
+		}
+	case "http":
+		if !strings.HasPrefix(c.URL, "http://") && !strings.HasPrefix(c.URL, "https://") {
+			return errors.New("http check needs an http(s) url")
+		}
+	case "icmp":
+		if strings.TrimSpace(c.Host) == "" {
+			return errors.New("icmp check needs host")
+		}
+	case "dns":
+		if strings.TrimSpace(c.Host) == "" {
+			return errors.New("dns check needs host")
+		}
+		if c.ExpectAddress != "" && net.ParseIP(c.ExpectAddress) == nil {
+			return fmt.Errorf("expect_address %q is not an IP address", c.ExpectAddress)
+		}
+		if family, _ := normalizeFamily(c.Family); c.ExpectAddress != "" && !matchesFamily(net.ParseIP(c.ExpectAddress), family) {
+			return fmt.Errorf("expect_address %q does not match family %s", c.ExpectAddress, family)
+		}
+	default:
+		return fmt.Errorf("unknown check type %q (want tcp, http, icmp or dns)", c.Type)
+	}
+	return nil
+}
+
+func (c CheckConfig) target() string {
+	switch strings.ToLower(c.Type) {
+	case "tcp":
+		return c.Address
+	case "http":
+		return c.URL
+	default:
+		return c.Host
+	}
+}
+
+func runCheck(check CheckConfig) CheckResult {
+	family, _ := normalizeFamily(check.Family)
+	result := CheckResult{
+		Name:   check.Name,
+		Type:   strings.ToLower(check.Type),
+		Target: check.target(),
+		Family: family,
+	}
+
+	timeout := seconds(check.Timeout)
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+
+	start := time.Now()
+	var detail string
+	var err error
+	switch result.Type {
+	case "tcp":
+		detail, err = probeTCP(check.Address, family, timeout)
+	case "http":
+		detail, err = probeHTTP(check.URL, check.ExpectStatus, family, timeout)
+	case "icmp":
+		detail, err = probeICMP(check.Host, family, timeout)
+	case "dns":
+		detail, err = probeDNS(check.Host, check.ExpectAddress, family, timeout)
+	default:
+		err = fmt.Errorf("unknown check type %q", check.Type)
+	}
+	result.LatencyMS = time.Since(start).Milliseconds()
+	result.Detail = detail
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.OK = true
+	return result
+}
+
+func probeTCP(address, family string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn, err := dialFamily(ctx, "tcp", address, family)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return "connected to " + conn.RemoteAddr().String(), nil
+}
+
+func dialFamily(ctx context.Context, network, address, family string) (net.Conn, error) {
+	var dialer net.Dialer
+	if family != "prefer-ipv4" && family != "prefer-ipv6" {
+		return dialer.DialContext(ctx, familyNetwork(network, family), address)
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, ip := range orderByFamily(ips, family) {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func probeHTTP(url string, expectStatus int, family string, timeout time.Duration) (string, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		return dialFamily(ctx, network, address, family)
+	}
+	client := &http.Client{Timeout: timeout, Transport: transport}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	detail := fmt.Sprintf("status %d", resp.StatusCode)
+	if expectStatus != 0 {
+		if resp.StatusCode != expectStatus {
+			return detail, fmt.Errorf("expected status %d, got %d", expectStatus, resp.StatusCode)
+		}
+	} else if resp.StatusCode >= 400 {
+		return detail, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return detail, nil
+}
+
+var pingTimePattern = regexp.MustCompile(`time[=<]\s*([0-9.]+)\s*ms`)
+
+// probeICMP sends one echo request with the system ping, which is setuid or
+// uses unprivileged ICMP sockets, so the check does not need root.
+func probeICMP(host, family string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(interrupted, timeout)
+	defer cancel()
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, familyNetwork("ip", family), host)
+	if err != nil {
+		return "", err
+	}
+	ips = orderByFamily(ips, family)
+	if len(ips) == 0 {
+		return "", fmt.Errorf("no %s address for %s", family, host)
+	}
+	ip := ips[0]
+	name, args := "ping", []string{"-n", "-c", "1"}
+	if ip.To4() == nil {
+		if _, err := exec.LookPath("ping6"); err == nil {
+			name = "ping6"
+		} else {
+			args = append(args, "-6")
+		}
+	}
+	cmd := exec.CommandContext(ctx, name, append(args, ip.String())...)
+	cmd.WaitDelay = 100 * time.Millisecond
+	out, err := cmd.CombinedOutput()
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", fmt.Errorf("icmp checks need the system %s: %w", name, err)
+	}
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("no echo reply from %s within %s", ip, timeout)
+	}
+	if err != nil {
+		if line := lastLines(string(out), 1); line != "" {
+			return "", fmt.Errorf("no echo reply from %s: %s", ip, line)
+		}
+		return "", fmt.Errorf("no echo reply from %s: %w", ip, err)
+	}
+	if match := pingTimePattern.FindStringSubmatch(string(out)); match != nil {
+		return fmt.Sprintf("reply from %s in %s ms", ip, match[1]), nil
+	}
+	return "reply from " + ip.String(), nil
+}
+
+func probeDNS(host, expectAddress, family string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, familyNetwork("ip", family), host)
+	if err != nil {
+		return "", err
+	}
+	ips = orderByFamily(ips, family)
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, ip.String())
+	}
+	detail := strings.Join(addrs, ", ")
+	if expectAddress == "" {
+		return detail, nil
+	}
+
+	want := net.ParseIP(expectAddress)
+	for _, ip := range ips {
+		if ip.Equal(want) {
+			return detail, nil
+		}
+	}
+	return detail, fmt.Errorf("expected %s among resolved addresses", expectAddress)
+}
+
+func selectChecks(checks []CheckConfig, names []string) ([]CheckConfig, error) {
+	if len(names) == 0 {
+		return checks, nil
+	}
+
+	selected := make([]CheckConfig, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, check := range checks {
+			if strings.EqualFold(check.Name, name) {
+				selected = append(selected, check)
+				found = true
+				break
+			}
+		}
+		if !found {
+			available := make([]string, 0, len(checks))
+			for _, check := range checks {
+				available = append(available, check.Name)
+			}
+			return nil, fmt.Errorf("check %q not found; available: %s", name, strings.Join(available, ", "))
+		}
+	}
+	return selected, nil
+}
+
+func runChecks(checks []CheckConfig) []CheckResult {
+	results := make([]CheckResult, len(checks))
+	done := make(chan struct{})
+	for i, check := range checks {
+		go func() {
+			results[i] = runCheck(check)
+			done <- struct{}{}
+		}()
+	}
+	for range checks {
+		<-done
+	}
+	return results
+}
+
+func checksPassed(results []CheckResult) bool {
+	for _, result := range results {
+		if !result.OK {
+			return false
+		}
+	}
+	return true
+}
+
+func printCheckResults(results []CheckResult) {
+	for _, result := range results {
+		outcome := "ok"
+		message := result.Detail
+		if !result.OK {
+			outcome = "FAIL"
+			message = result.Error
+		}
+		target := result.Target
+		if result.Family != "" && result.Family != "any" {
+			target += " " + result.Family
+		}
+		fmt.Printf("%-4s %s [%s %s] %dms", outcome, result.Name, result.Type, target, result.LatencyMS)
+		if message != "" {
+			fmt.Printf(": %s", message)
+		}
+		fmt.Println()
+	}
+}
+
+func runCheckCommand(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	connectionArg := fs.String("connection", "", "Use the checks configured for this connection.")
+	asJSON := outputFlags(fs)
+	var tcpTargets, httpTargets, icmpTargets stringList
+	fs.Var(&tcpTargets, "tcp", "Probe this host:port instead of the configured checks; repeatable.")
+	fs.Var(&httpTargets, "http", "GET this URL instead of the configured checks; repeatable.")
+	fs.Var(&icmpTargets, "icmp", "Ping this host instead of the configured checks; repeatable.")
+	timeoutSec := fs.Float64("timeout", 0, "Timeout in seconds for each ad-hoc probe (default 5).")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	configured := cfg.Checks
+	adHoc := adHocChecks(tcpTargets, httpTargets, icmpTargets, *timeoutSec, cfg.IPFamily)
+	for _, check := range adHoc {
+		if err := check.validate(); err != nil {
+			fmt.Fprintln(os.Stderr, msg("error", err))
+			return 2
+		}
+	}
+	if len(adHoc) > 0 {
+		configured = adHoc
+	} else if strings.TrimSpace(*connectionArg) != "" {
+		tunnels, err := getConnections()
+		if err != nil {
+			return fail(err)
+		}
+		selection, err := resolveSelection(*connectionArg, tunnels, cfg)
+		if err != nil {
+			return fail(err)
+		}
+		target := selection.Primary()
+		if state, err := getTunnelState(); err == nil {
+			if active, ok := selection.ActiveMember(state); ok {
+				target = active
+			}
+		}
+		configured = cfg.forConnection(target.ConnectionName).Checks
+	}
+	if len(configured) == 0 {
+		return fail(errors.New("no checks configured"))
+	}
+	checks, err := selectChecks(configured, fs.Args())
+	if err != nil {
+		return fail(err)
+	}
+
+	results := runChecks(checks)
+	if *asJSON {
+		if code := printJSON(results); code != 0 {
+			return code
+		}
+	} else {
+		printCheckResults(results)
+		if needsIPv6(checks) {
+			if tunnel, err := detectTunnel(); err == nil && tunnel != nil && !tunnel.CarriesIPv6 {
+				fmt.Println(msg("warning", msg("check.ipv6_not_carried", tunnel.Interface)))
+			}
+		}
+	}
+
+	if checksPassed(results) {
+		return 0
+	}
+	return 1
+}
+
+// adHocChecks turns the --tcp, --http and --icmp targets of `check` into
+// checks named after their target.
+func adHocChecks(tcpTargets, httpTargets, icmpTargets []string, timeout float64, family string) []CheckConfig {
+	var checks []CheckConfig
+	for _, address := range tcpTargets {
+		checks = append(checks, CheckConfig{Name: address, Type: "tcp", Address: address, Timeout: timeout})
+	}
+	for _, url := range httpTargets {
+		checks = append(checks, CheckConfig{Name: url, Type: "http", URL: url, Timeout: timeout})
+	}
+	for _, host := range icmpTargets {
+		checks = append(checks, CheckConfig{Name: host, Type: "icmp", Host: host, Timeout: timeout})
+	}
+	return applyDefaultFamily(checks, family)
+}
+
+func checksLabel(results []CheckResult) string {
+	failed := make([]string, 0)
+	for _, result := range results {
+		if !result.OK {
+			failed = append(failed, result.Name)
+		}
+	}
+	if len(failed) == 0 {
+		return "passing"
+	}
+	return "failing(" + strings.Join(failed, ",") + ")"
+}
+
+func needsIPv6(checks []CheckConfig) bool {
+	for _, check := range checks {
+		if family, _ := normalizeFamily(check.Family); family == "ipv6" || family == "prefer-ipv6" {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyChecks returns the checks --verify should run for a connection. An
+// explicitly empty per-connection list turns verification into a no-op.
+func verifyChecks(verify bool, settings Settings) ([]CheckConfig, error) {
+	if !verify {
+		return nil, nil
+	}
+	if settings.Checks == nil {
+		return nil, errors.New("--verify requires checks in the config file")
+	}
+	return settings.Checks, nil
+}
+
+func capCheckTimeouts(checks []CheckConfig, limit time.Duration) []CheckConfig {
+	capped := make([]CheckConfig, len(checks))
+	for i, check := range checks {
+		timeout := seconds(check.Timeout)
+		if timeout <= 0 {
+			timeout = defaultCheckTimeout
+		}
+		check.Timeout = min(timeout, limit).Seconds()
+		capped[i] = check
+	}
+	return capped
+}
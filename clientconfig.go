@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// fortiClientVPNPlist is where FortiClient keeps its VPN profiles.
+const fortiClientVPNPlist = "/Library/Application Support/Fortinet/FortiClient/conf/vpn.plist"
+
+// plistNode is a parsed property list value: a dict (Keys and Values in
+// order), an array (Values) or a scalar (Text).
+type plistNode struct {
+	Kind   string
+	Text   string
+	Keys   []string
+	Values []*plistNode
+}
+
+func (n *plistNode) get(key string) *plistNode {
+	for i, k := range n.Keys {
+		if strings.EqualFold(k, key) {
+			return n.Values[i]
+		}
+	}
+	return nil
+}
+
+// readPlist parses an XML property list, converting binary ones with
+// plutil first.
+func readPlist(path string) (*plistNode, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(raw, []byte("bplist")) {
+		if raw, err = exec.Command("plutil", "-convert", "xml1", "-o", "-", path).Output(); err != nil {
+			return nil, fmt.Errorf("failed to convert %s: %w", path, err)
+		}
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid plist %s: %w", path, err)
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local != "plist" {
+			return decodePlistNode(decoder, start)
+		}
+	}
+}
+
+func decodePlistNode(decoder *xml.Decoder, start xml.StartElement) (*plistNode, error) {
+	node := &plistNode{Kind: start.Name.Local}
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "key" {
+				var key string
+				if err := decoder.DecodeElement(&key, &t); err != nil {
+					return nil, err
+				}
+				node.Keys = append(node.Keys, key)
+				continue
+			}
+			child, err := decodePlistNode(decoder, t)
+			if err != nil {
+				return nil, err
+			}
+			node.Values = append(node.Values, child)
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			node.Text = strings.TrimSpace(text.String())
+			if node.Kind == "dict" && len(node.Keys) != len(node.Values) {
+				return nil, errors.New("dict keys and values do not match")
+			}
+			return node, nil
+		}
+	}
+}
+
+// clientConfigConnections lists the tunnels in FortiClient's own
+// configuration without running the bridge. Profiles sit in a dict keyed
+// by connection name under a "Tunnels" or "Profiles" key; IPsec ones say so
+// in a "Type" or "VPNType" value. FortiClient builds that keep profiles in
+// SQLite instead are not read; callers fall back to the backend.
+func clientConfigConnections() ([]Tunnel, error) {
+	path := firstNonEmpty(strings.TrimSpace(os.Getenv("FORTIVPN_CLIENT_CONFIG")), fortiClientVPNPlist)
+	root, err := readPlist(path)
+	if err != nil {
+		return nil, err
+	}
+	var tunnels []Tunnel
+	for _, section := range []string{"Tunnels", "Profiles"} {
+		profiles := root.get(section)
+		if profiles == nil || profiles.Kind != "dict" {
+			continue
+		}
+		for i, name := range profiles.Keys {
+			tunnel := Tunnel{ConnectionName: name, Type: "ssl"}
+			profile := profiles.Values[i]
+			for _, key := range []string{"Type", "VPNType"} {
+				if value := profile.get(key); value != nil && strings.Contains(strings.ToLower(value.Text), "ipsec") {
+					tunnel.Type = "ipsec"
+				}
+			}
+			if !slices.ContainsFunc(tunnels, func(t Tunnel) bool { return t.ConnectionName == name }) {
+				tunnels = append(tunnels, tunnel)
+			}
+		}
+	}
+	if len(tunnels) == 0 {
+		return nil, fmt.Errorf("no VPN profiles found in %s", path)
+	}
+	return tunnels, nil
+}
+
+// connectionNames returns just the connection names, from FortiClient's
+// configuration when the bridge would have been asked and the file can be
+// read, and from the backend otherwise.
+func connectionNames() ([]string, error) {
+	var tunnels []Tunnel
+	err := errors.New("not using the bridge")
+	if _, ok := activeBackend().(bridgeBackend); ok {
+		tunnels, err = clientConfigConnections()
+	}
+	if err != nil {
+		if tunnels, err = getConnections(); err != nil {
+			return nil, err
+		}
+	}
+	names := make([]string, 0, len(tunnels))
+	for _, tunnel := range tunnels {
+		names = append(names, tunnel.ConnectionName)
+	}
+	return names, nil
+}
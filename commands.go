@@ -0,0 +1,227 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// usageText is the help output, and the one place commands and their flags
+// are listed: completion scripts and man pages are generated from it.
+const usageText = `fortivpn: FortiClient VPN helper CLI for macOS
+
+Usage:
+  fortivpn [--backend auto|node|electron|forticli|mock|PLUGIN] [--node-path PATH] [--bridge-timeout SEC] [--debug-bridge[=FILE]] [--record FILE|--replay FILE] [-q|--quiet] COMMAND ...
+  fortivpn connections [--names] [--max-age SEC] [--no-header] [--json|--output json|yaml|csv|tsv|--format TEMPLATE]
+  fortivpn connections export [--connection NAME]... [--file FILE] [--json|--output json|yaml]
+  fortivpn connections import FILE [--dry-run]
+  fortivpn connections add CONNECTION --gateway HOST[:PORT] [--port N] [--type ssl|ipsec] [--saml]
+  fortivpn connections remove NAME [--yes]
+  fortivpn status [--connection NAME]... [--max-age SEC] [--follow [--interval SEC]] [--json|--output json|yaml|--format TEMPLATE]
+  fortivpn tui [--interval SEC] [--auto]
+  fortivpn prompt [--format TEMPLATE] [--glyphs] [--color] [--shell SHELL] [--max-age SEC]
+  fortivpn connect [--connection NAME|GROUP] [--group GROUP] [--timeout SEC] [--interval SEC] [--verify] [--dismiss-dialogs] [--strict] [--force] [--yes|--no-input] [--precheck] [--no-wait] [--tag TAG]... [--json [--progress]|--output json|yaml|--format TEMPLATE]
+  fortivpn up [NAME] [CONNECT FLAGS...]
+  fortivpn down [DISCONNECT FLAGS...]
+  fortivpn show NAME [--json|--output json|yaml]
+  fortivpn set-default [NAME] [--clear]
+  fortivpn switch NAME [--timeout SEC] [--interval SEC] [--force] [--yes|--no-input] [--no-wait] [--json|--output json|yaml]
+  fortivpn disconnect [--connection NAME|GROUP] [--timeout SEC] [--interval SEC] [--force] [--no-wait] [--json|--output json|yaml]
+  fortivpn run [--connection NAME|GROUP] [--timeout SEC] [--disconnect-after] [--yes|--no-input] -- CMD [ARG...]
+  fortivpn watch [--connection NAME|GROUP] [--timeout SEC] [--interval SEC] [--verify] [--healthz ADDR] [--dismiss-dialogs] [--strict] [--restart-app] [--once] [--json]
+  fortivpn check [--connection NAME] [--tcp HOST:PORT] [--http URL] [--icmp HOST] [--timeout SEC] [--json|--output json|yaml] [NAME...]
+  fortivpn healthcheck [--connection NAME|GROUP] [--dns-host HOST] [--json|--output json|yaml]
+  fortivpn verify [--connection NAME|GROUP] [--strict] [--json|--output json|yaml]
+  fortivpn history [--since 7d] [--connection NAME] [--tag TAG] [--limit N] [--json|--output json|yaml|csv|tsv]
+  fortivpn stats [--since 30d] [--connection NAME] [--json|--output json|yaml|csv|tsv]
+  fortivpn report [--since 30d] [--out FILE.md|FILE.html] [--connection NAME] [--tag TAG]
+  fortivpn annotate [--tag TAG]... NOTE
+  fortivpn gateway-info [--connection NAME|GROUP] [--gateway HOST[:PORT]] [--warn-days N] [--trust] [--json|--output json|yaml]
+  fortivpn whoami [--json|--output json|yaml]
+  fortivpn logs [--lines N] [--attempt] [--connection NAME] [--file PATTERN] [--follow] [--list]
+  fortivpn proxy [--connection NAME|GROUP] [--json|--output json|yaml]
+  fortivpn ip [--connection NAME] [--url URL] [--no-egress] [--timeout SEC] [--json|--output json|yaml]
+  fortivpn ping [--connection NAME] [--host HOST:PORT] [--count N] [--json|--output json|yaml]
+  fortivpn speedtest [--url URL] [--upload-url URL] [--no-upload] [--duration SEC] [--samples N] [--json|--output json|yaml]
+  fortivpn dns [--name HOST] [--timeout SEC] [--no-test] [--json|--output json|yaml]
+  fortivpn split-tunnel [--json|--output json|yaml] [DESTINATION]
+  fortivpn simulate [--scenario flap|outage|slow|FILE] [--connection NAME|GROUP] [--duration SEC] [-- WATCH FLAGS...]
+  fortivpn doctor [--json|--output json|yaml]
+  fortivpn debug-bundle [--file FILE] [--log-lines N] [--trace FILE]
+  fortivpn completion bash|zsh|fish
+  fortivpn man [--dir DIR] [COMMAND]
+  fortivpn version [--no-bridge] [--json|--output json|yaml]
+  fortivpn self-update [--check-only [--json|--output json|yaml]] [--version TAG] [--force] [--insecure-skip-signature] [--timeout SEC]
+  fortivpn app status [--timeout SEC] [--json|--output json|yaml]
+  fortivpn app quit [--timeout SEC] [--kill] [--force] [--yes|--no-input]
+  fortivpn app restart [--timeout SEC] [--kill] [--force] [--yes|--no-input]
+  fortivpn bridge install [--dir DIR]
+  fortivpn bridge ping [--timeout SEC] [--json|--output json|yaml]
+  fortivpn lock [--reason TEXT] [--ttl DURATION] [--json|--output json|yaml]
+  fortivpn unlock
+  fortivpn service install [--connection NAME] [--log FILE] [--no-start] [-- WATCH-FLAGS]
+  fortivpn service uninstall
+  fortivpn service start
+  fortivpn service stop
+  fortivpn service status [--json|--output json|yaml]
+  fortivpn config init [--force]
+  fortivpn config validate
+  fortivpn config edit
+  fortivpn config show [--connection NAME]
+  fortivpn config encrypt-value [--method keychain|age] [--recipient R] [VALUE]
+  fortivpn config decrypt-value [VALUE]
+  fortivpn config messages
+`
+
+// commandUsage is one "fortivpn ..." line of usageText.
+type commandUsage struct {
+	Path     []string // "bridge", "ping"; empty for the global flags line
+	Synopsis string
+	Flags    []string
+	// Values maps the flags that take an argument to its placeholder:
+	// SEC, FILE, auto|node|...
+	Values map[string]string
+	// Args are the fixed values a positional argument can take, from
+	// "bash|zsh|fish".
+	Args []string
+	// TakesName is set when a bare connection NAME may follow the command.
+	TakesName bool
+	// Inherits names a command whose flags this one also accepts, from
+	// "[CONNECT FLAGS...]".
+	Inherits string
+}
+
+var (
+	usageFlag      = regexp.MustCompile(`--[a-z][a-z0-9-]*`)
+	usageInherited = regexp.MustCompile(`\[(?:-- )?([A-Z]+) FLAGS`)
+	usageChoice    = regexp.MustCompile(`^[a-z0-9-]+(\|[a-zA-Z0-9-]+)+$`)
+)
+
+// usageCommands parses usageText. The global flags come first.
+func usageCommands() []commandUsage {
+	var commands []commandUsage
+	for _, line := range strings.Split(usageText, "\n") {
+		synopsis, ok := strings.CutPrefix(line, "  fortivpn ")
+		if !ok {
+			continue
+		}
+		usage := commandUsage{Synopsis: synopsis, Values: map[string]string{}}
+		tokens := strings.Fields(synopsis)
+		for len(tokens) > 0 && usageFlag.FindString(tokens[0]) == "" && strings.ToLower(tokens[0]) == tokens[0] && !strings.ContainsAny(tokens[0], "[|") {
+			usage.Path = append(usage.Path, tokens[0])
+			tokens = tokens[1:]
+		}
+		for i := 0; i < len(tokens); i++ {
+			token := tokens[i]
+			flags := usageFlag.FindAllString(token, -1)
+			if len(flags) == 0 {
+				usage.TakesName = usage.TakesName || strings.Contains(token, "NAME")
+				usage.Args = append(usage.Args, usageChoices(strings.Trim(token, "[]"))...)
+				continue
+			}
+			for _, flag := range flags {
+				if !slices.Contains(usage.Flags, flag) {
+					usage.Flags = append(usage.Flags, flag)
+				}
+			}
+			// A flag takes a value when it ends its token and a value
+			// placeholder follows: "[--timeout SEC]", "FILE|--replay FILE]".
+			flag := flags[len(flags)-1]
+			if !strings.HasSuffix(token, flag) || i+1 >= len(tokens) {
+				continue
+			}
+			value, _, _ := strings.Cut(strings.TrimRight(tokens[i+1], "]."), "|--")
+			if value == "" || strings.HasPrefix(value, "[") || strings.HasPrefix(value, "--") {
+				continue
+			}
+			usage.Values[flag] = value
+			if !strings.Contains(tokens[i+1], "--") {
+				i++
+			}
+		}
+		if match := usageInherited.FindStringSubmatch(synopsis); match != nil {
+			usage.Inherits = strings.ToLower(match[1])
+		}
+		commands = append(commands, usage)
+	}
+	return commands
+}
+
+// usageChoices returns the fixed values of a placeholder like
+// "flap|outage|slow|FILE", leaving out the upper-case free-form ones.
+func usageChoices(placeholder string) []string {
+	if !usageChoice.MatchString(placeholder) {
+		return nil
+	}
+	var choices []string
+	for _, choice := range strings.Split(placeholder, "|") {
+		if strings.ToLower(choice) == choice {
+			choices = append(choices, choice)
+		}
+	}
+	return choices
+}
+
+// commandSummaries is the one-line description of each command in usageText,
+// used for the NAME section of its man page.
+var commandSummaries = map[string]string{
+	"connections":          "list the FortiClient VPN connections",
+	"connections export":   "write connection profiles as YAML or JSON",
+	"connections import":   "create the connections in a profile file",
+	"connections add":      "create a FortiClient VPN connection",
+	"connections remove":   "delete a FortiClient VPN connection",
+	"status":               "print the current connection status",
+	"prompt":               "print a fast status segment for shell prompts",
+	"tui":                  "interactive dashboard with connect and disconnect keys",
+	"connect":              "connect to a connection or group, idempotently",
+	"up":                   "alias for connect",
+	"down":                 "alias for disconnect",
+	"show":                 "print the details of one connection",
+	"set-default":          "set the connection used when none is given",
+	"switch":               "disconnect the active tunnel and connect another",
+	"disconnect":           "disconnect the active tunnel",
+	"run":                  "run a command with the VPN up",
+	"watch":                "keep a connection up, reconnecting when it drops",
+	"check":                "probe internal hosts through the tunnel",
+	"healthcheck":          "one pass/fail verdict for monitoring",
+	"verify":               "evaluate the configured expectations against the session",
+	"history":              "list connect, disconnect and drop events",
+	"stats":                "summarize connected time, drops and reconnects",
+	"report":               "summarize the connection history",
+	"annotate":             "add a note to the connection history",
+	"gateway-info":         "inspect the gateway's address and TLS certificate",
+	"whoami":               "show who the current session authenticated as",
+	"logs":                 "print or follow FortiClient's logs",
+	"proxy":                "show the system proxy settings",
+	"ip":                   "show the tunnel, gateway and public egress addresses",
+	"ping":                 "time the gateways and an internal host",
+	"speedtest":            "measure latency and throughput through the tunnel",
+	"dns":                  "show and test the DNS servers the VPN pushed",
+	"split-tunnel":         "show which destinations go through the tunnel",
+	"simulate":             "run watch against a scripted sequence of failures",
+	"doctor":               "diagnose the environment",
+	"debug-bundle":         "zip sanitized diagnostics for a bug report",
+	"completion":           "print a shell completion script",
+	"man":                  "print or install man pages",
+	"version":              "print version and build information",
+	"self-update":          "replace this binary with the latest verified release",
+	"app status":           "show whether the FortiClient app is running and responding",
+	"app quit":             "quit the FortiClient app",
+	"app restart":          "quit and relaunch the FortiClient app",
+	"bridge install":       "install the bridge script to a standard location",
+	"bridge ping":          "check that the bridge runs and answers",
+	"lock":                 "refuse disconnects until unlocked",
+	"unlock":               "remove the disconnect lock",
+	"service install":      "run watch as a LaunchAgent from login on",
+	"service uninstall":    "remove the LaunchAgent",
+	"service start":        "start the LaunchAgent",
+	"service stop":         "stop the LaunchAgent until the next login",
+	"service status":       "show whether the LaunchAgent is running",
+	"config init":          "write a commented starter config file",
+	"config validate":      "check the config file",
+	"config edit":          "edit the config file and check it before saving",
+	"config show":          "print the effective configuration",
+	"config encrypt-value": "encrypt a secret for the config file",
+	"config decrypt-value": "decrypt a secret from the config file",
+	"config messages":      "print the message catalog for translations",
+}
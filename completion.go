@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// completionNames is how the generated scripts list connection names: from
+// FortiClient's configuration when possible, else a bridge answer cached
+// for five minutes, so pressing tab does not start a bridge each time.
+const completionNames = "fortivpn connections --names --max-age 300 2>/dev/null"
+
+// completionModel is usageText arranged the way completion scripts need it.
+type completionModel struct {
+	globalFlags  []string
+	commands     []string
+	subcommands  map[string][]string
+	keys         []string
+	flags        map[string][]string
+	args         map[string][]string
+	nameCommands []string
+	values       map[string]string
+}
+
+func newCompletionModel() completionModel {
+	model := completionModel{subcommands: map[string][]string{}, flags: map[string][]string{}, args: map[string][]string{}, values: map[string]string{}}
+	usages := usageCommands()
+	byKey := map[string]commandUsage{}
+	for _, usage := range usages {
+		for flag, value := range usage.Values {
+			model.values[flag] = value
+		}
+		if len(usage.Path) == 0 {
+			model.globalFlags = append(model.globalFlags, usage.Flags...)
+			continue
+		}
+		key := strings.Join(usage.Path, " ")
+		byKey[key] = usage
+		model.keys = append(model.keys, key)
+		if !slices.Contains(model.commands, usage.Path[0]) {
+			model.commands = append(model.commands, usage.Path[0])
+		}
+		if len(usage.Path) > 1 {
+			model.subcommands[usage.Path[0]] = append(model.subcommands[usage.Path[0]], usage.Path[1])
+		}
+		if len(usage.Args) > 0 {
+			model.args[key] = usage.Args
+		}
+		if usage.TakesName {
+			model.nameCommands = append(model.nameCommands, key)
+		}
+	}
+	for key, usage := range byKey {
+		flags := slices.Clone(usage.Flags)
+		if inherited, ok := byKey[usage.Inherits]; ok {
+			for _, flag := range inherited.Flags {
+				if !slices.Contains(flags, flag) {
+					flags = append(flags, flag)
+				}
+			}
+		}
+		model.flags[key] = flags
+	}
+	return model
+}
+
+// valueFlags groups the flags that take an argument by how it completes.
+func (m completionModel) valueFlags() (names, files []string, choices map[string][]string, other []string) {
+	choices = map[string][]string{}
+	flags := make([]string, 0, len(m.values))
+	for flag := range m.values {
+		flags = append(flags, flag)
+	}
+	slices.Sort(flags)
+	for _, flag := range flags {
+		placeholder := m.values[flag]
+		switch {
+		case flag == "--connection":
+			names = append(names, flag)
+		case usageChoices(placeholder) != nil:
+			choices[flag] = usageChoices(placeholder)
+		case strings.Contains(placeholder, "FILE") || strings.Contains(placeholder, "DIR") || strings.Contains(placeholder, "PATH"):
+			files = append(files, flag)
+		default:
+			other = append(other, flag)
+		}
+	}
+	return names, files, choices, other
+}
+
+func (m completionModel) allValueFlags() []string {
+	flags := make([]string, 0, len(m.values))
+	for flag := range m.values {
+		flags = append(flags, flag)
+	}
+	slices.Sort(flags)
+	return flags
+}
+
+func (m completionModel) parents() []string {
+	parents := make([]string, 0, len(m.subcommands))
+	for parent := range m.subcommands {
+		parents = append(parents, parent)
+	}
+	slices.Sort(parents)
+	return parents
+}
+
+func runCompletion(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, msg("error", msg("completion.usage")))
+		return 2
+	}
+	model := newCompletionModel()
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion(model))
+	case "zsh":
+		fmt.Print(zshCompletion(model))
+	case "fish":
+		fmt.Print(fishCompletion(model))
+	default:
+		fmt.Fprintln(os.Stderr, msg("error", msg("completion.unknown_shell", args[0])))
+		return 2
+	}
+	return 0
+}
+
+func bashCompletion(m completionModel) string {
+	names, files, choices, other := m.valueFlags()
+	var b strings.Builder
+	b.WriteString("# bash completion for fortivpn. Load it with:\n#   source <(fortivpn completion bash)\n\n")
+	b.WriteString("_fortivpn() {\n")
+	b.WriteString("\tlocal cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}\n")
+	b.WriteString("\tlocal cmd= sub= words= i\n")
+	b.WriteString("\tlocal IFS=$'\\n'\n")
+	b.WriteString("\tfor ((i = 1; i < COMP_CWORD; i++)); do\n\t\tcase ${COMP_WORDS[i]} in\n")
+	fmt.Fprintf(&b, "\t\t%s) ((i++)) ;;\n", strings.Join(m.allValueFlags(), "|"))
+	b.WriteString("\t\t-*) ;;\n\t\t*)\n\t\t\tif [[ -z $cmd ]]; then cmd=${COMP_WORDS[i]}; elif [[ -z $sub ]]; then sub=${COMP_WORDS[i]}; fi ;;\n\t\tesac\n\tdone\n\n")
+
+	b.WriteString("\tcase $prev in\n")
+	fmt.Fprintf(&b, "\t%s)\n\t\tCOMPREPLY=($(compgen -W \"$(%s)\" -- \"$cur\"))\n\t\tCOMPREPLY=(\"${COMPREPLY[@]// /\\\\ }\")\n\t\treturn ;;\n", strings.Join(names, "|"), completionNames)
+	for _, flag := range sortedKeys(choices) {
+		fmt.Fprintf(&b, "\t%s)\n\t\tCOMPREPLY=($(compgen -W %s -- \"$cur\"))\n\t\treturn ;;\n", flag, bashWords(choices[flag]))
+	}
+	fmt.Fprintf(&b, "\t%s)\n\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n\t\treturn ;;\n", strings.Join(files, "|"))
+	fmt.Fprintf(&b, "\t%s)\n\t\treturn ;;\n", strings.Join(other, "|"))
+	b.WriteString("\tesac\n\n")
+
+	b.WriteString("\tlocal key=$cmd\n")
+	fmt.Fprintf(&b, "\tcase $cmd in\n\t%s) key=\"$cmd $sub\" ;;\n\tesac\n", strings.Join(m.parents(), "|"))
+	fmt.Fprintf(&b, "\tif [[ -z $cmd ]]; then\n\t\twords=%s\n", bashWords(append(slices.Clone(m.globalFlags), m.commands...)))
+	for _, parent := range m.parents() {
+		fmt.Fprintf(&b, "\telif [[ $cmd == %s && -z $sub ]]; then\n\t\twords=%s\n", parent, bashWords(append(slices.Clone(m.subcommands[parent]), m.flags[parent]...)))
+	}
+	b.WriteString("\telse\n\t\tcase $key in\n")
+	for _, key := range m.keys {
+		fmt.Fprintf(&b, "\t\t%q) words=%s ;;\n", key, bashWords(append(slices.Clone(m.flags[key]), m.args[key]...)))
+	}
+	b.WriteString("\t\tesac\n")
+	fmt.Fprintf(&b, "\t\tcase $key in\n\t\t%s)\n", shellQuoted(m.nameCommands))
+	fmt.Fprintf(&b, "\t\t\tif [[ $cur != -* ]]; then\n\t\t\t\tCOMPREPLY=($(compgen -W \"$(%s)\" -- \"$cur\"))\n\t\t\t\tCOMPREPLY=(\"${COMPREPLY[@]// /\\\\ }\")\n\t\t\t\treturn\n\t\t\tfi ;;\n\t\tesac\n", completionNames)
+	b.WriteString("\tfi\n\tCOMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n}\n\ncomplete -F _fortivpn fortivpn\n")
+	return b.String()
+}
+
+func zshCompletion(m completionModel) string {
+	names, files, choices, other := m.valueFlags()
+	var b strings.Builder
+	b.WriteString("#compdef fortivpn\n# zsh completion for fortivpn. Load it with:\n#   source <(fortivpn completion zsh)\n# or save it as _fortivpn in a directory on $fpath.\n\n")
+	b.WriteString("_fortivpn() {\n\tlocal cmd= sub= i\n")
+	b.WriteString("\tfor ((i = 2; i < CURRENT; i++)); do\n\t\tcase ${words[i]} in\n")
+	fmt.Fprintf(&b, "\t\t(%s) ((i++)) ;;\n", strings.Join(m.allValueFlags(), "|"))
+	b.WriteString("\t\t(-*) ;;\n\t\t(*)\n\t\t\tif [[ -z $cmd ]]; then cmd=${words[i]}; elif [[ -z $sub ]]; then sub=${words[i]}; fi ;;\n\t\tesac\n\tdone\n\n")
+
+	b.WriteString("\tlocal -a names\n\tcase ${words[CURRENT-1]} in\n")
+	fmt.Fprintf(&b, "\t(%s)\n\t\tnames=(${(f)\"$(%s)\"})\n\t\tcompadd -a names\n\t\treturn ;;\n", strings.Join(names, "|"), completionNames)
+	for _, flag := range sortedKeys(choices) {
+		fmt.Fprintf(&b, "\t(%s)\n\t\tcompadd -- %s\n\t\treturn ;;\n", flag, strings.Join(choices[flag], " "))
+	}
+	fmt.Fprintf(&b, "\t(%s)\n\t\t_files\n\t\treturn ;;\n", strings.Join(files, "|"))
+	fmt.Fprintf(&b, "\t(%s)\n\t\treturn ;;\n", strings.Join(other, "|"))
+	b.WriteString("\tesac\n\n")
+
+	fmt.Fprintf(&b, "\tif [[ -z $cmd ]]; then\n\t\tcompadd -- %s\n\t\treturn\n\tfi\n", strings.Join(append(slices.Clone(m.globalFlags), m.commands...), " "))
+	b.WriteString("\tlocal key=$cmd\n")
+	for _, parent := range m.parents() {
+		fmt.Fprintf(&b, "\tif [[ $cmd == %s ]]; then\n\t\tif [[ -z $sub ]]; then\n\t\t\tcompadd -- %s\n\t\t\treturn\n\t\tfi\n\t\tkey=\"$cmd $sub\"\n\tfi\n", parent, strings.Join(append(slices.Clone(m.subcommands[parent]), m.flags[parent]...), " "))
+	}
+	fmt.Fprintf(&b, "\tcase $key in\n\t(%s)\n", shellQuoted(m.nameCommands))
+	fmt.Fprintf(&b, "\t\tif [[ ${words[CURRENT]} != -* ]]; then\n\t\t\tnames=(${(f)\"$(%s)\"})\n\t\t\tcompadd -a names\n\t\t\treturn\n\t\tfi ;;\n\tesac\n", completionNames)
+	b.WriteString("\tcase $key in\n")
+	for _, key := range m.keys {
+		if words := append(slices.Clone(m.flags[key]), m.args[key]...); len(words) > 0 {
+			fmt.Fprintf(&b, "\t(%q) compadd -- %s ;;\n", key, strings.Join(words, " "))
+		}
+	}
+	b.WriteString("\tesac\n}\n\n")
+	b.WriteString("if [[ $zsh_eval_context[-1] == loadautofunc ]]; then\n\t_fortivpn \"$@\"\nelse\n\tcompdef _fortivpn fortivpn\nfi\n")
+	return b.String()
+}
+
+func fishCompletion(m completionModel) string {
+	names, files, choices, _ := m.valueFlags()
+	var b strings.Builder
+	b.WriteString("# fish completion for fortivpn. Load it with:\n#   fortivpn completion fish | source\n# or save it as ~/.config/fish/completions/fortivpn.fish.\n\n")
+	fmt.Fprintf(&b, "function __fortivpn_names\n\t%s\nend\n\n", completionNames)
+	b.WriteString("complete -c fortivpn -f\n")
+
+	flagLine := func(condition, flag string) {
+		line := fmt.Sprintf("complete -c fortivpn -n '%s' -l %s", condition, strings.TrimPrefix(flag, "--"))
+		if _, ok := m.values[flag]; ok {
+			switch {
+			case slices.Contains(names, flag):
+				line += " -x -a '(__fortivpn_names)'"
+			case choices[flag] != nil:
+				line += " -x -a '" + strings.Join(choices[flag], " ") + "'"
+			case slices.Contains(files, flag):
+				line += " -r -F"
+			default:
+				line += " -x"
+			}
+		}
+		b.WriteString(line + "\n")
+	}
+	for _, flag := range m.globalFlags {
+		flagLine("__fish_use_subcommand", flag)
+	}
+	fmt.Fprintf(&b, "complete -c fortivpn -n __fish_use_subcommand -a '%s'\n", strings.Join(m.commands, " "))
+	for _, parent := range m.parents() {
+		subs := strings.Join(m.subcommands[parent], " ")
+		fmt.Fprintf(&b, "complete -c fortivpn -n '__fish_seen_subcommand_from %s; and not __fish_seen_subcommand_from %s' -a '%s'\n", parent, subs, subs)
+	}
+	for _, key := range m.keys {
+		condition := "__fish_seen_subcommand_from " + key
+		if path := strings.Fields(key); len(path) > 1 {
+			condition = "__fish_seen_subcommand_from " + path[0] + "; and __fish_seen_subcommand_from " + path[1]
+		}
+		for _, flag := range m.flags[key] {
+			flagLine(condition, flag)
+		}
+		if args := m.args[key]; len(args) > 0 {
+			fmt.Fprintf(&b, "complete -c fortivpn -n '%s' -a '%s'\n", condition, strings.Join(args, " "))
+		}
+		if slices.Contains(m.nameCommands, key) {
+			fmt.Fprintf(&b, "complete -c fortivpn -n '%s' -a '(__fortivpn_names)'\n", condition)
+		}
+	}
+	return b.String()
+}
+
+func bashWords(words []string) string {
+	return "$'" + strings.Join(words, `\n`) + "'"
+}
+
+func shellQuoted(keys []string) string {
+	quoted := make([]string, len(keys))
+	for i, key := range keys {
+		quoted[i] = fmt.Sprintf("%q", key)
+	}
+	return strings.Join(quoted, "|")
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
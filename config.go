@@ -0,0 +1,543 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Config struct {
+	NodePath         string           `json:"node_path,omitempty"`
+	WSLWindowsBinary string           `json:"wsl_windows_binary,omitempty"`
+	IPFamily         string           `json:"ip_family,omitempty"`
+	Redaction        RedactionConfig  `json:"redaction,omitempty"`
+	Dialogs          DialogConfig     `json:"dialogs,omitempty"`
+	Locale           string           `json:"locale,omitempty"`
+	Upgrade          UpgradeConfig    `json:"upgrade,omitempty"`
+	ProxyCheck       string           `json:"proxy_check,omitempty"`
+	Backend          string           `json:"backend,omitempty"`
+	ForticliPath     string           `json:"forticli_path,omitempty"`
+	BridgeDaemon     bool             `json:"bridge_daemon,omitempty"`
+	BridgeGRPC       string           `json:"bridge_grpc,omitempty"`
+	BridgeGRPCToken  string           `json:"bridge_grpc_token,omitempty"`
+	BridgeTimeout    float64          `json:"bridge_timeout,omitempty"`
+	StateCacheTTL    *float64         `json:"state_cache_ttl,omitempty"`
+	Prompt           PromptConfig     `json:"prompt,omitempty"`
+	SelfUpdate       SelfUpdateConfig `json:"self_update,omitempty"`
+	// DefaultConnection is the connection or group used when a command is
+	// given none; see `fortivpn set-default`.
+	DefaultConnection string `json:"default_connection,omitempty"`
+	Settings
+	Connections map[string]Settings    `json:"connections,omitempty"`
+	Groups      map[string]GroupConfig `json:"groups,omitempty"`
+}
+
+// Settings holds the values that can be set globally and overridden per
+// connection. Zero numbers and nil lists mean "inherit"; an explicit empty
+// list (for example "checks": []) disables the inherited value.
+type Settings struct {
+	ConnectTimeout       float64          `json:"connect_timeout,omitempty"`
+	DisconnectTimeout    float64          `json:"disconnect_timeout,omitempty"`
+	PollInterval         float64          `json:"poll_interval,omitempty"`
+	WatchInterval        float64          `json:"watch_interval,omitempty"`
+	Checks               []CheckConfig    `json:"checks,omitempty"`
+	Hooks                Hooks            `json:"hooks,omitempty"`
+	Latency              *LatencyConfig   `json:"latency,omitempty"`
+	HealthcheckDNSHost   string           `json:"healthcheck_dns_host,omitempty"`
+	Expectations         []Expectation    `json:"expectations,omitempty"`
+	ExpectationsInterval float64          `json:"expectations_interval,omitempty"`
+	Gateway              string           `json:"gateway,omitempty"`
+	GatewayCertWarnDays  float64          `json:"gateway_cert_warn_days,omitempty"`
+	GatewayPinning       *PinConfig       `json:"gateway_pinning,omitempty"`
+	Fallback             *FallbackConfig  `json:"fallback,omitempty"`
+	Speedtest            *SpeedtestConfig `json:"speedtest,omitempty"`
+}
+
+type Hooks struct {
+	PostConnect    []string `json:"post_connect,omitempty"`
+	PostDisconnect []string `json:"post_disconnect,omitempty"`
+}
+
+func configPath() (string, error) {
+	if fromEnv := strings.TrimSpace(os.Getenv("FORTIVPN_CONFIG")); fromEnv != "" {
+		return fromEnv, nil
+	}
+	if xdg := strings.TrimSpace(os.Getenv("XDG_CONFIG_HOME")); xdg != "" {
+		return filepath.Join(xdg, "fortivpn", "config.json"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "fortivpn", "config.json"), nil
+}
+
+// loadConfig reads the config with every encrypted value decrypted.
+func loadConfig() (Config, error) {
+	path, raw, err := readConfigFile()
+	if raw == nil || err != nil {
+		return Config{}, err
+	}
+	return parseConfig(path, raw, true)
+}
+
+// loadPlainConfig reads the config without decrypting anything, for what
+// runs before every command and for prompt, which runs on every shell
+// prompt: neither needs a secret, and decrypting can spawn security or age.
+// An encrypted value would fail validation, so callers check the settings
+// they use themselves.
+func loadPlainConfig() (Config, error) {
+	path, raw, err := readConfigFile()
+	if raw == nil || err != nil {
+		return Config{}, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(stripJSONComments(raw), &cfg); err != nil {
+		return Config{}, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// readConfigFile returns the config file's contents, nil when there is
+// none.
+func readConfigFile() (string, []byte, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", nil, err
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return path, nil, nil
+	}
+	if err != nil {
+		return path, nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	return path, raw, nil
+}
+
+// parseConfig decodes and validates the config file's contents. Encrypted
+// values stay as written unless decrypt is set.
+func parseConfig(path string, raw []byte, decrypt bool) (Config, error) {
+	raw = stripJSONComments(raw)
+	if decrypt && bytes.Contains(raw, []byte(`"`+secretPrefix)) {
+		var doc any
+		err := json.Unmarshal(raw, &doc)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse config %s: %w", path, err)
+		}
+		doc, err = decryptConfigValues(doc)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to decrypt config %s: %w", path, err)
+		}
+		if raw, err = json.Marshal(doc); err != nil {
+			return Config{}, err
+		}
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return Config{}, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	cfg.Checks = applyDefaultFamily(cfg.Checks, cfg.IPFamily)
+	for name, settings := range cfg.Connections {
+		settings.Checks = applyDefaultFamily(settings.Checks, cfg.IPFamily)
+		cfg.Connections[name] = settings
+	}
+	return cfg, nil
+}
+
+// setConfigValue sets one top-level key of the config file, or removes it
+// when value is nil, leaving every other key as written, encrypted values
+// included (comments are not kept). The file is created when it does not
+// exist yet.
+func setConfigValue(key string, value any) (string, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	doc := map[string]json.RawMessage{}
+	raw, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	if len(bytes.TrimSpace(raw)) > 0 {
+		if err := json.Unmarshal(stripJSONComments(raw), &doc); err != nil {
+			return "", fmt.Errorf("failed to parse config %s: %w", path, err)
+		}
+	}
+	if value == nil {
+		delete(doc, key)
+	} else {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		doc[key] = encoded
+	}
+	body, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(path, append(body, '\n'), 0o600); err != nil {
+		return "", fmt.Errorf("failed to write config %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// stripJSONComments blanks out // and /* */ comments and drops trailing
+// commas, so the config may be written like a tsconfig. Line breaks are
+// kept, and string contents are left alone.
+func stripJSONComments(raw []byte) []byte {
+	out := make([]byte, 0, len(raw))
+	inString := false
+	pendingComma := -1
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case inString:
+			out = append(out, c)
+			if c == '\\' && i+1 < len(raw) {
+				i++
+				out = append(out, raw[i])
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		case c == '/' && i+1 < len(raw) && raw[i+1] == '/':
+			for i < len(raw) && raw[i] != '\n' {
+				i++
+			}
+			i--
+			continue
+		case c == '/' && i+1 < len(raw) && raw[i+1] == '*':
+			end := bytes.Index(raw[i+2:], []byte("*/"))
+			if end < 0 {
+				// Leave it for the JSON parser to report.
+				out = append(out, raw[i:]...)
+				return out
+			}
+			for _, b := range raw[i : i+2+end+2] {
+				if b == '\n' {
+					out = append(out, b)
+				}
+			}
+			i += 2 + end + 1
+			continue
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			out = append(out, c)
+			continue
+		case (c == '}' || c == ']') && pendingComma >= 0:
+			out[pendingComma] = ' '
+		}
+		pendingComma = -1
+		if c == ',' {
+			pendingComma = len(out)
+		}
+		if c == '"' {
+			inString = true
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func applyDefaultFamily(checks []CheckConfig, family string) []CheckConfig {
+	for i := range checks {
+		if strings.TrimSpace(checks[i].Family) == "" {
+			checks[i].Family = family
+		}
+	}
+	return checks
+}
+
+func (c Config) validate() error {
+	if _, err := normalizeFamily(c.IPFamily); err != nil {
+		return fmt.Errorf("ip_family: %w", err)
+	}
+	switch c.ProxyCheck {
+	case "", proxyCheckWarn, proxyCheckFail, proxyCheckOff:
+	default:
+		return fmt.Errorf("proxy_check: unknown value %q (want warn, fail or off)", c.ProxyCheck)
+	}
+	if _, err := normalizeBackend(c.Backend); err != nil {
+		return fmt.Errorf("backend: %w", err)
+	}
+	if c.BridgeTimeout < 0 {
+		return errors.New("bridge_timeout must not be negative")
+	}
+	if c.StateCacheTTL != nil && *c.StateCacheTTL < 0 {
+		return errors.New("state_cache_ttl must not be negative")
+	}
+	if err := c.Prompt.validate(); err != nil {
+		return fmt.Errorf("prompt: %w", err)
+	}
+	if err := c.SelfUpdate.validate(); err != nil {
+		return fmt.Errorf("self_update: %w", err)
+	}
+	if err := c.Settings.validate(); err != nil {
+		return err
+	}
+	if err := c.validateGroups(); err != nil {
+		return err
+	}
+	for name, settings := range c.Connections {
+		if strings.TrimSpace(name) == "" {
+			return errors.New("connections: empty connection name")
+		}
+		if err := settings.validate(); err != nil {
+			return fmt.Errorf("connections.%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (s Settings) validate() error {
+	for field, value := range map[string]float64{
+		"connect_timeout":        s.ConnectTimeout,
+		"disconnect_timeout":     s.DisconnectTimeout,
+		"poll_interval":          s.PollInterval,
+		"watch_interval":         s.WatchInterval,
+		"expectations_interval":  s.ExpectationsInterval,
+		"gateway_cert_warn_days": s.GatewayCertWarnDays,
+	} {
+		if value < 0 {
+			return fmt.Errorf("%s must not be negative", field)
+		}
+	}
+
+	if s.Latency != nil {
+		if err := s.Latency.validate(); err != nil {
+			return fmt.Errorf("latency: %w", err)
+		}
+	}
+	if s.GatewayPinning != nil {
+		if err := s.GatewayPinning.validate(); err != nil {
+			return fmt.Errorf("gateway_pinning: %w", err)
+		}
+	}
+	if s.Fallback != nil {
+		if err := s.Fallback.validate(); err != nil {
+			return fmt.Errorf("fallback: %w", err)
+		}
+	}
+	if s.Speedtest != nil {
+		if err := s.Speedtest.validate(); err != nil {
+			return fmt.Errorf("speedtest: %w", err)
+		}
+	}
+
+	for i, expectation := range s.Expectations {
+		if err := expectation.validate(); err != nil {
+			return fmt.Errorf("expectations[%d]: %w", i, err)
+		}
+	}
+
+	seen := map[string]bool{}
+	for i, check := range s.Checks {
+		name := strings.TrimSpace(check.Name)
+		if name == "" {
+			return fmt.Errorf("checks[%d]: name is required", i)
+		}
+		if seen[strings.ToLower(name)] {
+			return fmt.Errorf("checks[%d]: duplicate name %q", i, name)
+		}
+		seen[strings.ToLower(name)] = true
+		if err := check.validate(); err != nil {
+			return fmt.Errorf("check %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// forConnection merges the settings configured for connectionName over the
+// global ones. Keys match the connection name exactly or as a
+// case-insensitive substring (so "prod" applies to "Production VPN"); the
+// longest matching key wins.
+func (c Config) forConnection(connectionName string) Settings {
+	merged := c.Settings
+	key, ok := c.connectionKey(connectionName)
+	if !ok {
+		return merged
+	}
+
+	override := c.Connections[key]
+	if override.ConnectTimeout != 0 {
+		merged.ConnectTimeout = override.ConnectTimeout
+	}
+	if override.DisconnectTimeout != 0 {
+		merged.DisconnectTimeout = override.DisconnectTimeout
+	}
+	if override.PollInterval != 0 {
+		merged.PollInterval = override.PollInterval
+	}
+	if override.WatchInterval != 0 {
+		merged.WatchInterval = override.WatchInterval
+	}
+	if override.Checks != nil {
+		merged.Checks = override.Checks
+	}
+	if override.Hooks.PostConnect != nil {
+		merged.Hooks.PostConnect = override.Hooks.PostConnect
+	}
+	if override.Hooks.PostDisconnect != nil {
+		merged.Hooks.PostDisconnect = override.Hooks.PostDisconnect
+	}
+	if override.Latency != nil {
+		merged.Latency = override.Latency
+	}
+	if override.HealthcheckDNSHost != "" {
+		merged.HealthcheckDNSHost = override.HealthcheckDNSHost
+	}
+	if override.Expectations != nil {
+		merged.Expectations = override.Expectations
+	}
+	if override.ExpectationsInterval != 0 {
+		merged.ExpectationsInterval = override.ExpectationsInterval
+	}
+	if override.Gateway != "" {
+		merged.Gateway = override.Gateway
+	}
+	if override.GatewayCertWarnDays != 0 {
+		merged.GatewayCertWarnDays = override.GatewayCertWarnDays
+	}
+	if override.GatewayPinning != nil {
+		merged.GatewayPinning = override.GatewayPinning
+	}
+	if override.Fallback != nil {
+		merged.Fallback = override.Fallback
+	}
+	if override.Speedtest != nil {
+		merged.Speedtest = override.Speedtest
+	}
+	return merged
+}
+
+func (c Config) connectionKey(connectionName string) (string, bool) {
+	name := strings.ToLower(strings.TrimSpace(connectionName))
+	if name == "" {
+		return "", false
+	}
+
+	best := ""
+	for key := range c.Connections {
+		lower := strings.ToLower(strings.TrimSpace(key))
+		if lower == name {
+			return key, true
+		}
+		if strings.Contains(name, lower) && len(lower) > len(best) {
+			best = key
+		}
+	}
+	return best, best != ""
+}
+
+func flagWasSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// flagOrSetting returns the flag value when given on the command line, the
+// configured value when present, and the flag default otherwise.
+func flagOrSetting(fs *flag.FlagSet, name string, flagValue, configured float64) float64 {
+	if flagWasSet(fs, name) || configured == 0 {
+		return flagValue
+	}
+	return configured
+}
+
+func runConfig(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, msg("error", msg("config.no_subcommand")))
+		return 2
+	}
+
+	switch args[0] {
+	case "init":
+		return runConfigInit(args[1:])
+	case "validate":
+		return runConfigValidate(args[1:])
+	case "edit":
+		return runConfigEdit(args[1:])
+	case "show":
+		return runConfigShow(args[1:])
+	case "encrypt-value":
+		return runConfigEncryptValue(args[1:])
+	case "decrypt-value":
+		return runConfigDecryptValue(args[1:])
+	case "messages":
+		return runConfigMessages(args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, msg("error", msg("config.unknown", args[0])))
+		return 2
+	}
+}
+
+func runConfigEncryptValue(args []string) int {
+	fs := flag.NewFlagSet("config encrypt-value", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	method := fs.String("method", keychainSecretTag, "Encryption method: keychain or age.")
+	recipient := fs.String("recipient", "", "age recipient (required for --method age).")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	value, err := secretArgument(fs.Args())
+	if err != nil {
+		return fail(err)
+	}
+	encrypted, err := encryptSecret(*method, *recipient, value)
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Println(encrypted)
+	return 0
+}
+
+func runConfigDecryptValue(args []string) int {
+	fs := flag.NewFlagSet("config decrypt-value", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	value, err := secretArgument(fs.Args())
+	if err != nil {
+		return fail(err)
+	}
+	plain, err := decryptSecret(strings.TrimSpace(value))
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Println(plain)
+	return 0
+}
+
+// secretArgument takes the value from the single positional argument, or
+// from stdin when it is omitted or "-" so secrets stay out of shell history.
+func secretArgument(args []string) (string, error) {
+	if len(args) > 1 {
+		return "", errors.New("expected a single value")
+	}
+	if len(args) == 1 && args[0] != "-" {
+		return args[0], nil
+	}
+	raw, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(raw), "\r\n"), nil
+}
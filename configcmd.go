@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// starterConfig is what `config init` writes: every setting commented out,
+// so the file changes nothing until an entry is uncommented.
+const starterConfig = `// fortivpn configuration. Lines starting with // are comments, and a
+// trailing comma is fine. Uncomment what you need; see the Configuration
+// section of the README for every key. Check your edits with
+// "fortivpn config validate".
+{
+  // Connection or group used when a command is given none.
+  // "default_connection": "Office VPN",
+
+  // Seconds to wait for the tunnel to come up or go down, and between
+  // polls while waiting.
+  // "connect_timeout": 20,
+  // "disconnect_timeout": 10,
+  // "poll_interval": 1,
+
+  // Seconds between tunnel checks in "fortivpn watch".
+  // "watch_interval": 5,
+
+  // Probes run by "fortivpn check" and "connect --verify".
+  // "checks": [
+  //   { "name": "wiki", "type": "http", "url": "https://wiki.internal/", "expect_status": 200 },
+  //   { "name": "db", "type": "tcp", "address": "db.internal:5432", "timeout": 3 },
+  // ],
+
+  // Shell commands run after the tunnel comes up or goes down.
+  // "hooks": {
+  //   "post_connect": ["echo connected"],
+  //   "post_disconnect": [],
+  // },
+
+  // Connections tried in turn by connect and watch.
+  // "groups": {
+  //   "office": { "members": ["Office VPN", "Office VPN (backup)"], "strategy": "priority" },
+  // },
+
+  // Per-connection overrides of the settings above, matched by name or a
+  // case-insensitive part of it.
+  // "connections": {
+  //   "Office VPN": { "connect_timeout": 60 },
+  // },
+
+  // How FortiClient is reached: auto, node, electron or forticli.
+  // "backend": "auto",
+}
+`
+
+func runConfigInit(args []string) int {
+	fs := flag.NewFlagSet("config init", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	force := fs.Bool("force", false, "Overwrite an existing config file.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	path, err := configPath()
+	if err != nil {
+		return fail(err)
+	}
+	if _, err := os.Stat(path); err == nil && !*force {
+		fmt.Fprintln(os.Stderr, msg("error", msg("config.init_exists", path)))
+		return 1
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fail(err)
+	}
+	if err := writeFileAtomic(path, []byte(starterConfig), 0o600); err != nil {
+		return fail(fmt.Errorf("failed to write config %s: %w", path, err))
+	}
+	fmt.Println(msg("config.init_written", path))
+	return 0
+}
+
+func runConfigValidate(args []string) int {
+	fs := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	path, err := configPath()
+	if err != nil {
+		return fail(err)
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Println(msg("config.validate_missing", path))
+		return 0
+	}
+	if err != nil {
+		return fail(fmt.Errorf("failed to read config %s: %w", path, err))
+	}
+	if err := validateConfigFile(path, raw); err != nil {
+		fmt.Fprintln(os.Stderr, msg("error", err))
+		return 1
+	}
+	fmt.Println(msg("config.valid", path))
+	return 0
+}
+
+// validateConfigFile is stricter than loading: unknown keys, usually typos
+// that would otherwise be ignored silently, are errors too. Encrypted
+// values are not decrypted.
+func validateConfigFile(path string, raw []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(stripJSONComments(raw)))
+	decoder.DisallowUnknownFields()
+	var strict Config
+	if err := decoder.Decode(&strict); err != nil {
+		return fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	_, err := parseConfig(path, raw, false)
+	return err
+}
+
+// runConfigEdit opens a copy of the config in $VISUAL or $EDITOR and only
+// saves it once it validates, so a typo cannot break every other command.
+func runConfigEdit(args []string) int {
+	fs := flag.NewFlagSet("config edit", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	path, err := configPath()
+	if err != nil {
+		return fail(err)
+	}
+	original, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		original = []byte(starterConfig)
+	} else if err != nil {
+		return fail(fmt.Errorf("failed to read config %s: %w", path, err))
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fail(err)
+	}
+	draft, err := os.CreateTemp(filepath.Dir(path), "config-edit-*.json")
+	if err != nil {
+		return fail(err)
+	}
+	draftPath := draft.Name()
+	_, err = draft.Write(original)
+	if closeErr := draft.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(draftPath)
+		return fail(err)
+	}
+
+	editor := firstNonEmpty(strings.TrimSpace(os.Getenv("VISUAL")), strings.TrimSpace(os.Getenv("EDITOR")), "vi")
+	for {
+		// Through the shell, so an editor given with flags ("code --wait") works.
+		cmd := exec.Command("/bin/sh", "-c", editor+` "$1"`, "sh", draftPath)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, realStdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			os.Remove(draftPath)
+			return fail(fmt.Errorf("editor %q failed: %w", editor, err))
+		}
+		edited, err := os.ReadFile(draftPath)
+		if err != nil {
+			return fail(err)
+		}
+		if bytes.Equal(edited, original) {
+			os.Remove(draftPath)
+			fmt.Println(msg("config.edit_unchanged"))
+			return 0
+		}
+		err = validateConfigFile(path, edited)
+		if err == nil {
+			if err := writeFileAtomic(path, edited, 0o600); err != nil {
+				return fail(fmt.Errorf("failed to write config %s: %w", path, err))
+			}
+			os.Remove(draftPath)
+			fmt.Println(msg("config.edit_saved", path))
+			return 0
+		}
+		fmt.Fprintln(os.Stderr, msg("error", err))
+		if !stdinIsTerminal() {
+			break
+		}
+		fmt.Fprint(os.Stderr, msg("config.edit_again"))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "" && a != "y" && a != "yes" {
+			break
+		}
+	}
+	fmt.Fprintln(os.Stderr, msg("config.edit_kept", path, draftPath))
+	return 1
+}
+
+// runConfigShow prints the configuration commands actually run with: the
+// file merged with the FORTIVPN_* variables and global flags that override
+// it. Encrypted values are shown as written.
+func runConfigShow(args []string) int {
+	fs := flag.NewFlagSet("config show", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	connection := fs.String("connection", "", "Print the settings that apply to this connection, with its overrides merged in.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	path, err := configPath()
+	if err != nil {
+		return fail(err)
+	}
+	var cfg Config
+	raw, err := os.ReadFile(path)
+	if err == nil {
+		if cfg, err = parseConfig(path, raw, false); err != nil {
+			return fail(err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fail(fmt.Errorf("failed to read config %s: %w", path, err))
+	}
+	if *connection != "" {
+		return printJSON(cfg.forConnection(*connection))
+	}
+
+	cfg.NodePath = configuredNodePath
+	cfg.WSLWindowsBinary = configuredWindowsBinary
+	cfg.Backend = configuredBackend
+	cfg.ForticliPath = configuredForticliPath
+	cfg.BridgeDaemon = bridgeDaemonEnabled
+	cfg.BridgeGRPC = bridgeGRPCAddress
+	cfg.BridgeTimeout = bridgeTimeout.Seconds()
+	ttl := readCache.ttl.Seconds()
+	cfg.StateCacheTTL = &ttl
+	cfg.Locale = firstNonEmpty(strings.TrimSpace(os.Getenv("FORTIVPN_LANG")), cfg.Locale)
+	return printJSON(cfg)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var errDeclined = errors.New("declined")
+
+// stdinIsTerminal reports whether someone can answer a prompt. /dev/null is
+// a character device too, so it is ruled out explicitly.
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(info, null)
+}
+
+// confirmDisplace asks before connect tears down a different active tunnel,
+// which may be someone else's session on a shared host. Without a terminal
+// it proceeds as before, unless noInput asks to refuse instead of asking.
+func confirmDisplace(current, target string, yes, noInput bool) error {
+	if yes {
+		return nil
+	}
+	if noInput {
+		return fmt.Errorf("%w: %q is connected; pass --yes to disconnect it and connect %s", errDeclined, current, target)
+	}
+	if !stdinIsTerminal() {
+		return nil
+	}
+	fmt.Fprint(os.Stderr, msg("connect.confirm_displace", current, target))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return fmt.Errorf("%w: kept %q connected", errDeclined, current)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// lastBridge is the most recent bridge exchange, kept for crash reports.
+var lastBridge struct {
+	Action string
+	Input  string
+	Output string
+	Stderr string
+	At     time.Time
+}
+
+func rememberBridge(action string, input []string, output, stderr []byte) {
+	lastBridge.Action = action
+	lastBridge.Input = strings.Join(input, " ")
+	lastBridge.Output = string(output)
+	lastBridge.Stderr = string(stderr)
+	lastBridge.At = time.Now()
+}
+
+// runRecovered runs the command and turns a panic into a local crash report
+// instead of a bare stack trace. Nothing is sent anywhere.
+func runRecovered(args []string) (code int) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		stack := debug.Stack()
+		path, err := writeCrashReport(args, recovered, stack)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n%s", msg("error", fmt.Sprintf("internal error: %v", recovered)), stack)
+			code = 3
+			return
+		}
+		fmt.Fprintln(os.Stderr, msg("error", msg("crash.report", recovered, path)))
+		code = 3
+	}()
+	return run(args)
+}
+
+func writeCrashReport(args []string, recovered any, stack []byte) (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "crash")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "fortivpn crash report %s\n\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&b, "version: %s\n", buildVersion())
+	fmt.Fprintf(&b, "go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "command: fortivpn %s\n", strings.Join(args, " "))
+	fmt.Fprintf(&b, "panic: %v\n\n%s\n", recovered, stack)
+	if lastBridge.Action != "" {
+		fmt.Fprintf(&b, "last bridge exchange (%s):\n  action: %s\n  input: %s\n  output: %s\n  stderr: %s\n\n",
+			lastBridge.At.Format(time.RFC3339), lastBridge.Action, lastBridge.Input, strings.TrimSpace(lastBridge.Output), strings.TrimSpace(lastBridge.Stderr))
+	}
+	if cfg, err := loadConfig(); err != nil {
+		fmt.Fprintf(&b, "config: %v\n", err)
+	} else if body, err := json.MarshalIndent(cfg, "", "  "); err == nil {
+		fmt.Fprintf(&b, "effective config:\n%s\n", body)
+	}
+
+	path := filepath.Join(dir, "crash-"+time.Now().Format("20060102-150405")+".txt")
+	if err := os.WriteFile(path, []byte(redact(b.String())), 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
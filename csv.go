@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// csvOutput reports whether --output asked for csv or tsv.
+func csvOutput() bool {
+	return outputFormat == "csv" || outputFormat == "tsv"
+}
+
+// printCSV writes a slice of structs as CSV, or TSV after --output tsv,
+// with a header row of their JSON keys. Every field gets a column, even
+// one left out of the JSON when empty, so the columns stay the same from
+// run to run.
+func printCSV(rows any) int {
+	w := csv.NewWriter(os.Stdout)
+	if outputFormat == "tsv" {
+		w.Comma = '\t'
+	}
+	list := reflect.ValueOf(rows)
+	w.Write(csvColumns(list.Type().Elem()))
+	for i := 0; i < list.Len(); i++ {
+		w.Write(csvRecord(list.Index(i)))
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fail(err)
+	}
+	return 0
+}
+
+type csvField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// csvFields lists the exported fields of t by JSON name, flattening
+// embedded structs the way encoding/json does.
+func csvFields(t reflect.Type) []csvField {
+	var fields []csvField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for _, inner := range csvFields(field.Type) {
+				inner.index = append([]int{i}, inner.index...)
+				fields = append(fields, inner)
+			}
+			continue
+		}
+		fields = append(fields, csvField{name: firstNonEmpty(name, field.Name), index: []int{i}, omitEmpty: strings.Contains(options, "omitempty")})
+	}
+	return fields
+}
+
+func csvColumns(t reflect.Type) []string {
+	var names []string
+	for _, field := range csvFields(t) {
+		names = append(names, field.name)
+	}
+	return names
+}
+
+// csvRecord leaves a cell empty where the JSON would leave the key out.
+func csvRecord(row reflect.Value) []string {
+	fields := csvFields(row.Type())
+	record := make([]string, len(fields))
+	for i, field := range fields {
+		value := row.FieldByIndex(field.index)
+		if !(field.omitEmpty && value.IsZero()) {
+			record[i] = csvCell(value)
+		}
+	}
+	return record
+}
+
+// csvCell formats one value: times as RFC 3339, lists joined with ";",
+// anything nested as JSON.
+func csvCell(v reflect.Value) string {
+	switch value := v.Interface().(type) {
+	case time.Time:
+		if value.IsZero() {
+			return ""
+		}
+		return value.Format(time.RFC3339)
+	case []string:
+		return strings.Join(value, ";")
+	}
+	switch v.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		return fmt.Sprint(v.Interface())
+	case reflect.Pointer, reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return ""
+		}
+	}
+	body, _ := json.Marshal(v.Interface())
+	return string(body)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// bridgeDaemonEnabled routes bridge calls through a long-lived bridge
+// process instead of starting node for every call. Set by bridge_daemon in
+// the config or FORTIVPN_BRIDGE_DAEMON.
+var bridgeDaemonEnabled bool
+
+const bridgeDaemonStartWait = 5 * time.Second
+
+// errBridgeDaemonUnavailable means the request was never sent, so running
+// it through a one-shot bridge instead cannot repeat a connect.
+var errBridgeDaemonUnavailable = errors.New("bridge daemon unavailable")
+
+// bridgeSocketPath is per user and per runtime, script and module, so an
+// upgraded binary or a simulation never talks to a daemon serving something
+// else.
+func bridgeSocketPath(runtime, script string) (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(runtime + "\x00" + script + "\x00" + os.Getenv("FORTIVPN_MODULE_PATH")))
+	return filepath.Join(dir, "bridge-"+hex.EncodeToString(sum[:4])+".sock"), nil
+}
+
+func callBridgeDaemon(runtime string, env []string, script, action string, payload any) ([]byte, error) {
+	socket, err := bridgeSocketPath(runtime, script)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errBridgeDaemonUnavailable, err)
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		if conn, err = spawnBridgeDaemon(runtime, env, script, socket); err != nil {
+			return nil, fmt.Errorf("%w: %v", errBridgeDaemonUnavailable, err)
+		}
+	}
+	defer conn.Close()
+	// The daemon outlives a canceled command; only the request is abandoned.
+	stop := context.AfterFunc(interrupted, func() { conn.Close() })
+	defer stop()
+	if bridgeTimeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(bridgeTimeout))
+	}
+
+	request, err := json.Marshal(map[string]any{"action": action, "payload": payload})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(append(request, '\n')); err != nil {
+		return nil, fmt.Errorf("%w: %v", errBridgeDaemonUnavailable, err)
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if interrupted.Err() != nil {
+		return nil, errCanceled
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		stopBridgeDaemon(socket)
+		return nil, bridgeTimeoutError(action)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bridge daemon did not answer %s: %w", action, err)
+	}
+	return line, nil
+}
+
+// spawnBridgeDaemon starts the daemon in its own session so it outlives
+// this command. A lock keeps concurrent callers from starting several.
+func spawnBridgeDaemon(runtime string, env []string, script, socket string) (net.Conn, error) {
+	if err := os.MkdirAll(filepath.Dir(socket), 0o700); err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(socket+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return nil, err
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	if conn, err := net.Dial("unix", socket); err == nil {
+		return conn, nil
+	}
+	cmd := exec.Command(runtime, append(runtimeArgs(runtime), script, "serve", socket)...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+
+	deadline := time.Now().Add(bridgeDaemonStartWait)
+	for time.Now().Before(deadline) {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			return conn, nil
+		}
+		select {
+		case <-exited:
+			return nil, errors.New("bridge daemon exited on start")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	return nil, fmt.Errorf("bridge daemon did not listen on %s", socket)
+}
+
+// stopBridgeDaemon kills a daemon stuck inside the FortiClient module so the
+// next call starts a fresh one.
+func stopBridgeDaemon(socket string) {
+	if raw, err := os.ReadFile(socket + ".pid"); err == nil {
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(raw))); err == nil && pid > 0 {
+			_ = syscall.Kill(pid, syscall.SIGKILL)
+		}
+	}
+	_ = os.Remove(socket)
+	_ = os.Remove(socket + ".pid")
+}
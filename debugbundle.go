@@ -0,0 +1,333 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	debugBundleHistory = 200
+	debugBundleCrashes = 3
+)
+
+const debugBundleReadme = `fortivpn debug bundle, created %s
+
+version.json      fortivpn and bridge versions, platform and backend
+environment.txt   OS, session type and FORTIVPN_* settings
+doctor.json       the output of fortivpn doctor --json
+bridge-trace.txt  a traced ping, state query and connection list made now%s
+status.json       the tunnel state
+connections.json  the connection list
+config.json       the effective configuration
+history.jsonl     the last %d history events
+forticlient/      the last %d lines of each FortiClient log
+crash/            the latest crash reports
+
+Secrets, tokens and usernames are masked as in all fortivpn output. Every
+connection and group name is replaced by conn-<hash> and every gateway or
+server host by host-<hash>: the first 8 hex digits of the SHA-256 of the
+lowercased name, the same in every file.
+`
+
+// runDebugBundle zips what a bug report needs, sanitized so it can be
+// attached to a public issue.
+func runDebugBundle(args []string) int {
+	fs := flag.NewFlagSet("debug-bundle", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	output := fs.String("file", "", "Path of the zip file (default: fortivpn-debug-<time>.zip in the current directory).")
+	logLines := fs.Int("log-lines", 500, "Lines to include from the end of each FortiClient log (0 leaves the logs out).")
+	traceFile := fs.String("trace", "", "Also include a trace captured earlier with --debug-bridge=FILE.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	now := time.Now()
+	path := firstNonEmpty(*output, "fortivpn-debug-"+now.Format("20060102-150405")+".zip")
+
+	cfg, cfgErr := loadConfig()
+	var trace bytes.Buffer
+	_, bridged := activeBackend().(bridgeBackend)
+	if bridged {
+		bridgeTrace = &trace
+		defer func() { bridgeTrace = nil }()
+	}
+
+	info := buildMetadata()
+	info.Backend = backendName(activeBackend())
+	if bridged {
+		if bridge, err := bridgeVersion(); err != nil {
+			info.BridgeError = redact(err.Error())
+		} else {
+			info.BridgeProtocol = bridge.Protocol
+		}
+	}
+	doctor := buildDoctorReport()
+	state, stateErr := freshTunnelState()
+	tunnels, tunnelsErr := activeBackend().ListConnections()
+	bridgeTrace = nil
+
+	names := debugBundleNames(cfg, tunnels, state)
+	files := map[string][]byte{}
+	add := func(name string, body []byte) {
+		files[name] = []byte(names.sanitize(redact(string(body))))
+	}
+	addJSON := func(name string, v any) {
+		body, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			body = []byte(err.Error())
+		}
+		add(name, append(body, '\n'))
+	}
+	errorText := func(err error) map[string]string { return map[string]string{"error": err.Error()} }
+
+	addJSON("version.json", info)
+	add("environment.txt", []byte(debugBundleEnvironment()))
+	addJSON("doctor.json", doctor)
+	add("bridge-trace.txt", trace.Bytes())
+	if *traceFile != "" {
+		body, err := os.ReadFile(*traceFile)
+		if err != nil {
+			return fail(fmt.Errorf("failed to read the trace: %w", err))
+		}
+		add("bridge-trace-"+filepath.Base(*traceFile), body)
+	}
+	if stateErr != nil {
+		addJSON("status.json", errorText(stateErr))
+	} else {
+		addJSON("status.json", state)
+	}
+	if tunnelsErr != nil {
+		addJSON("connections.json", errorText(tunnelsErr))
+	} else {
+		addJSON("connections.json", tunnels)
+	}
+	if cfgErr != nil {
+		addJSON("config.json", errorText(cfgErr))
+	} else {
+		addJSON("config.json", cfg)
+	}
+
+	events, _ := loadHistory(time.Time{})
+	if len(events) > debugBundleHistory {
+		events = events[len(events)-debugBundleHistory:]
+	}
+	var history bytes.Buffer
+	for _, event := range events {
+		line, _ := json.Marshal(event)
+		history.Write(append(line, '\n'))
+	}
+	add("history.jsonl", history.Bytes())
+
+	if *logLines > 0 {
+		paths, _ := fortiClientLogFiles()
+		for _, logPath := range paths {
+			lines := tailLines(logPath, logTailBytes)
+			if len(lines) > *logLines {
+				lines = lines[len(lines)-*logLines:]
+			}
+			add("forticlient/"+filepath.Base(logPath), []byte(strings.Join(lines, "\n")+"\n"))
+		}
+	}
+	if dir, err := stateDir(); err == nil {
+		crashes, _ := filepath.Glob(filepath.Join(dir, "crash", "crash-*.txt"))
+		sort.Strings(crashes)
+		if len(crashes) > debugBundleCrashes {
+			crashes = crashes[len(crashes)-debugBundleCrashes:]
+		}
+		for _, crash := range crashes {
+			if body, err := os.ReadFile(crash); err == nil {
+				add("crash/"+filepath.Base(crash), body)
+			}
+		}
+	}
+	included := ""
+	if *traceFile != "" {
+		included = fmt.Sprintf("\nbridge-trace-%s  the trace given with --trace", filepath.Base(*traceFile))
+	}
+	files["README.txt"] = fmt.Appendf(nil, debugBundleReadme, now.Format(time.RFC3339), included, debugBundleHistory, *logLines)
+
+	if err := writeDebugBundle(path, files, now); err != nil {
+		return fail(err)
+	}
+	fmt.Println(msg("debug_bundle.written", path, len(files)))
+	return 0
+}
+
+func writeDebugBundle(path string, files map[string][]byte, modified time.Time) error {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: "fortivpn-debug/" + name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, buf.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+func debugBundleEnvironment() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	if out, err := exec.Command("sw_vers").Output(); err == nil {
+		b.Write(out)
+	} else if out, err := exec.Command("uname", "-srm").Output(); err == nil {
+		fmt.Fprintf(&b, "uname: %s", out)
+	}
+	fmt.Fprintf(&b, "headless session: %t\n", headlessSession())
+	fmt.Fprintf(&b, "wsl: %t\n", runningInWSL())
+	fmt.Fprintf(&b, "installed FortiClient: %s\n", emptyAsUnknown(installedFortiClientVersion()))
+	fmt.Fprintf(&b, "FortiClient running: %t\n", fortiClientRunning())
+	var env []string
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, "FORTIVPN_") {
+			env = append(env, kv)
+		}
+	}
+	sort.Strings(env)
+	for _, kv := range env {
+		fmt.Fprintln(&b, kv)
+	}
+	return b.String()
+}
+
+// debugNames replaces connection and group names with conn-<hash> and
+// gateway hosts with host-<hash>, longest first so a name that contains
+// another is replaced whole.
+type debugNames struct {
+	names *regexp.Regexp
+	hosts *regexp.Regexp
+}
+
+func debugBundleNames(cfg Config, tunnels []Tunnel, state TunnelState) debugNames {
+	var names, hosts debugWords
+	for _, tunnel := range tunnels {
+		names.add(tunnel.ConnectionName)
+		hosts.add(newConnectionDetail(tunnel, tunnels, cfg).Gateway)
+	}
+	names.add(state.ConnectionName)
+	names.add(state.SamlVPNName)
+	names.add(cfg.DefaultConnection)
+	hosts.addGateway(cfg.Gateway)
+	for name, settings := range cfg.Connections {
+		names.add(name)
+		hosts.addGateway(settings.Gateway)
+	}
+	for name, group := range cfg.Groups {
+		names.add(name)
+		for _, member := range group.Members {
+			names.add(member)
+		}
+	}
+	if cfg.Fallback != nil {
+		names.add(cfg.Fallback.Connection)
+	}
+	return debugNames{names: names.pattern(), hosts: hosts.pattern()}
+}
+
+// debugHostField is redact's gatewayPattern, also taking a URL's scheme.
+var debugHostField = regexp.MustCompile(`(?i)("?(?:gateway|server|remote_gateway|host)"?\s*[:=]\s*"?(?:https?://)?)([a-z0-9][a-z0-9.-]*[a-z0-9])`)
+
+// sanitize hashes the names and hosts in text. Hosts are masked whatever
+// the redaction settings say: the ones fortivpn knows of, and any value of
+// a gateway, server or host field.
+func (n debugNames) sanitize(text string) string {
+	text = debugHostField.ReplaceAllStringFunc(text, func(field string) string {
+		match := debugHostField.FindStringSubmatch(field)
+		if strings.HasPrefix(match[2], "host-") || strings.HasPrefix(match[2], "conn-") {
+			return field
+		}
+		return match[1] + debugHash("host-", match[2])
+	})
+	if n.hosts != nil {
+		text = n.hosts.ReplaceAllStringFunc(text, func(host string) string { return debugHash("host-", host) })
+	}
+	if n.names != nil {
+		text = n.names.ReplaceAllStringFunc(text, func(name string) string { return debugHash("conn-", name) })
+	}
+	return text
+}
+
+// debugHash is prefix and the first 8 hex digits of the SHA-256 of the
+// lowercased value, the same in every file of the bundle.
+func debugHash(prefix, value string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(value)))
+	return prefix + hex.EncodeToString(sum[:4])
+}
+
+// debugWords collects the distinct values one debugNames pattern masks.
+type debugWords struct {
+	seen  map[string]bool
+	words []string
+}
+
+func (w *debugWords) add(word string) {
+	word = strings.TrimSpace(word)
+	if word == "" || w.seen[strings.ToLower(word)] {
+		return
+	}
+	if w.seen == nil {
+		w.seen = map[string]bool{}
+	}
+	w.seen[strings.ToLower(word)] = true
+	w.words = append(w.words, word)
+}
+
+// addGateway adds the host of a configured gateway, which may carry a
+// scheme and a port.
+func (w *debugWords) addGateway(gateway string) {
+	if gateway == "" {
+		return
+	}
+	if host, _, err := net.SplitHostPort(gatewayAddress(gateway)); err == nil {
+		w.add(host)
+	}
+}
+
+func (w *debugWords) pattern() *regexp.Regexp {
+	if len(w.words) == 0 {
+		return nil
+	}
+	words := slices.Clone(w.words)
+	sort.Slice(words, func(i, j int) bool { return len(words[i]) > len(words[j]) })
+	quoted := make([]string, len(words))
+	wordChar := regexp.MustCompile(`^\w$`)
+	for i, word := range words {
+		// Whole words only, so a short name like "int" leaves "interface" be.
+		quoted[i] = regexp.QuoteMeta(word)
+		if wordChar.MatchString(word[:1]) {
+			quoted[i] = `\b` + quoted[i]
+		}
+		if wordChar.MatchString(word[len(word)-1:]) {
+			quoted[i] += `\b`
+		}
+	}
+	return regexp.MustCompile(`(?i)` + strings.Join(quoted, "|"))
+}
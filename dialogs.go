@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const dialogProbeTimeout = 3 * time.Second
+
+// readDialogsScript collects the static texts of FortiClient's dialogs and
+// sheets through System Events, one dialog per line with texts joined by
+// " | ". It needs the Accessibility permission for the calling terminal.
+const readDialogsScript = `
+tell application "System Events"
+	if not (exists process "FortiClient") then return ""
+	set output to ""
+	tell process "FortiClient"
+		repeat with w in windows
+			set targets to {}
+			try
+				if subrole of w is in {"AXDialog", "AXSystemDialog"} then set end of targets to w
+			end try
+			try
+				set targets to targets & (sheets of w)
+			end try
+			repeat with d in targets
+				set texts to {}
+				try
+					repeat with t in (static texts of d)
+						set v to value of t
+						if v is not missing value and v is not "" then set end of texts to v
+					end repeat
+				end try
+				if (count of texts) > 0 then
+					set AppleScript's text item delimiters to " | "
+					set output to output & (texts as text) & linefeed
+					set AppleScript's text item delimiters to ""
+				end if
+			end repeat
+		end repeat
+	end tell
+	return output
+end tell
+`
+
+type dialogError struct {
+	err     error
+	Message string
+}
+
+func (e *dialogError) Error() string {
+	return fmt.Sprintf("%v; FortiClient reports: %s", e.err, e.Message)
+}
+
+func (e *dialogError) Unwrap() error {
+	return e.err
+}
+
+func readErrorDialogs() []string {
+	ctx, cancel := context.WithTimeout(context.Background(), dialogProbeTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "osascript", "-e", readDialogsScript).Output()
+	if err != nil {
+		return nil
+	}
+	dialogs := make([]string, 0)
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			dialogs = append(dialogs, line)
+		}
+	}
+	return dialogs
+}
+
+// withDialogText attaches the text of any FortiClient error dialog to a
+// failed connect, since the real reason is otherwise only shown in the GUI.
+func withDialogText(err error) error {
+	if err == nil {
+		return nil
+	}
+	dialogs := readErrorDialogs()
+	if len(dialogs) == 0 {
+		return err
+	}
+	return &dialogError{err: err, Message: strings.Join(dialogs, "; ")}
+}
+
+// dismissDialogsScript presses the OK, Close or Dismiss button of the
+// FortiClient dialogs and sheets whose text contains its argument (case is
+// ignored) and returns how many it closed. A dialog without one of those
+// buttons is left alone, so a question is never answered for the user.
+const dismissDialogsScript = `
+on run argv
+set pattern to item 1 of argv
+tell application "System Events"
+	if not (exists process "FortiClient") then return 0
+	set closed to 0
+	tell process "FortiClient"
+		repeat with w in windows
+			set targets to {}
+			try
+				if subrole of w is in {"AXDialog", "AXSystemDialog"} then set end of targets to w
+			end try
+			try
+				set targets to targets & (sheets of w)
+			end try
+			repeat with d in targets
+				try
+					set texts to {}
+					repeat with t in (static texts of d)
+						set v to value of t
+						if v is not missing value then set end of texts to v
+					end repeat
+					set AppleScript's text item delimiters to " | "
+					set message to texts as text
+					set AppleScript's text item delimiters to ""
+					if message contains pattern then
+						repeat with b in (buttons of d)
+							if (name of b) is in {"OK", "Close", "Dismiss"} then
+								click b
+								set closed to closed + 1
+								exit repeat
+							end if
+						end repeat
+					end if
+				end try
+			end repeat
+		end repeat
+	end tell
+	return closed
+end tell
+end run
+`
+
+var defaultTransientDialogPatterns = []string{
+	"unable to establish the vpn connection",
+	"vpn connection was lost",
+	"connection timed out",
+	"(-14)",
+	"(-5)",
+}
+
+type DialogConfig struct {
+	Dismiss  bool     `json:"dismiss,omitempty"`
+	Retries  int      `json:"retries,omitempty"`
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+func (c DialogConfig) retries() int {
+	if c.Retries <= 0 {
+		return 1
+	}
+	return c.Retries
+}
+
+// transient returns the pattern message matches, or "" when it is not a
+// known transient error.
+func (c DialogConfig) transient(message string) string {
+	patterns := c.Patterns
+	if len(patterns) == 0 {
+		patterns = defaultTransientDialogPatterns
+	}
+	message = strings.ToLower(message)
+	for _, pattern := range patterns {
+		if pattern != "" && strings.Contains(message, strings.ToLower(pattern)) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// dismissErrorDialogs closes the dialogs whose text contains pattern.
+func dismissErrorDialogs(pattern string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dialogProbeTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "osascript", "-e", dismissDialogsScript, pattern).Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to dismiss FortiClient dialog: %w", err)
+	}
+	closed := 0
+	fmt.Sscanf(strings.TrimSpace(string(out)), "%d", &closed)
+	return closed, nil
+}
+
+// dismissTransientDialog closes a recognized transient error dialog behind
+// err so the connection can be retried; a stuck modal otherwise blocks
+// every later attempt. It reports whether a retry makes sense.
+func dismissTransientDialog(err error, cfg DialogConfig) bool {
+	var dialog *dialogError
+	if !cfg.Dismiss || !errors.As(err, &dialog) {
+		return false
+	}
+	pattern := cfg.transient(dialog.Message)
+	if pattern == "" {
+		return false
+	}
+	closed, dismissErr := dismissErrorDialogs(pattern)
+	if dismissErr != nil || closed == 0 {
+		return false
+	}
+	warnf("dialog.dismissed", redact(dialog.Message))
+	return true
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DNSResolver is one resolver entry from scutil --dns.
+type DNSResolver struct {
+	Interface     string   `json:"interface,omitempty"`
+	Domain        string   `json:"domain,omitempty"`
+	SearchDomains []string `json:"search_domains,omitempty"`
+	Nameservers   []string `json:"nameservers"`
+	// Scoped resolvers only answer queries bound to their interface; the
+	// unscoped ones are what ordinary lookups use.
+	Scoped bool `json:"scoped,omitempty"`
+}
+
+type DNSTestResult struct {
+	Nameserver string `json:"nameserver"`
+	Query      string `json:"query"`
+	OK         bool   `json:"ok"`
+	LatencyMS  int64  `json:"latency_ms"`
+	Detail     string `json:"detail,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type DNSReport struct {
+	Connection string          `json:"connection,omitempty"`
+	Interface  string          `json:"interface,omitempty"`
+	Resolvers  []DNSResolver   `json:"resolvers"`
+	System     *DNSResolver    `json:"system,omitempty"`
+	Tests      []DNSTestResult `json:"tests,omitempty"`
+	Effective  bool            `json:"effective"`
+	Warnings   []string        `json:"warnings,omitempty"`
+}
+
+var scutilIfIndex = regexp.MustCompile(`\(([^)]+)\)`)
+
+// parseScutilDNS reads the resolver blocks printed by scutil --dns. The
+// same resolver shows up again under the scoped-queries section, so
+// duplicates are dropped.
+func parseScutilDNS(out string) []DNSResolver {
+	var resolvers []DNSResolver
+	var current *DNSResolver
+	scoped := false
+	flush := func() {
+		if current == nil || len(current.Nameservers) == 0 {
+			return
+		}
+		for _, seen := range resolvers {
+			if seen.Interface == current.Interface && seen.Domain == current.Domain &&
+				slices.Equal(seen.Nameservers, current.Nameservers) && slices.Equal(seen.SearchDomains, current.SearchDomains) {
+				return
+			}
+		}
+		resolvers = append(resolvers, *current)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "resolver #") || strings.HasPrefix(line, "DNS configuration") {
+			flush()
+			current = nil
+			if strings.HasPrefix(line, "DNS configuration") {
+				scoped = strings.Contains(line, "scoped")
+			}
+			if strings.HasPrefix(line, "resolver #") {
+				current = &DNSResolver{Scoped: scoped}
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		key, value, ok := strings.Cut(line, " : ")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch {
+		case strings.HasPrefix(key, "nameserver["):
+			current.Nameservers = append(current.Nameservers, value)
+		case strings.HasPrefix(key, "search domain["):
+			current.SearchDomains = append(current.SearchDomains, value)
+		case key == "domain":
+			current.Domain = value
+		case key == "if_index":
+			if match := scutilIfIndex.FindStringSubmatch(value); match != nil {
+				current.Interface = match[1]
+			}
+		}
+	}
+	flush()
+	return resolvers
+}
+
+// systemResolvers returns every resolver scutil --dns lists.
+func systemResolvers() ([]DNSResolver, error) {
+	out, err := exec.Command("scutil", "--dns").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DNS configuration (scutil --dns): %w", err)
+	}
+	return parseScutilDNS(string(out)), nil
+}
+
+// defaultResolver is the unscoped resolver without a domain, the one every
+// name no other resolver claims goes to.
+func defaultResolver(resolvers []DNSResolver) *DNSResolver {
+	for i, resolver := range resolvers {
+		if !resolver.Scoped && resolver.Domain == "" {
+			return &resolvers[i]
+		}
+	}
+	return nil
+}
+
+// dnsWarnings says where the VPN's DNS did not take effect: the system
+// resolver does not use the tunnel's servers, and no unscoped resolver
+// sends a pushed domain to them either, so internal names go to the local
+// network's DNS.
+func dnsWarnings(tunnel, all []DNSResolver, system *DNSResolver) []string {
+	tunnelServers := map[string]bool{}
+	var domains []string
+	for _, resolver := range tunnel {
+		for _, nameserver := range resolver.Nameservers {
+			tunnelServers[nameserver] = true
+		}
+		for _, domain := range append([]string{resolver.Domain}, resolver.SearchDomains...) {
+			if domain != "" && !slices.Contains(domains, domain) {
+				domains = append(domains, domain)
+			}
+		}
+	}
+	usesTunnel := func(resolver DNSResolver) bool {
+		return slices.ContainsFunc(resolver.Nameservers, func(nameserver string) bool { return tunnelServers[nameserver] })
+	}
+	if system != nil && usesTunnel(*system) {
+		return nil
+	}
+	var warnings []string
+	for _, domain := range domains {
+		routed := slices.ContainsFunc(all, func(resolver DNSResolver) bool {
+			return !resolver.Scoped && resolver.Domain != "" && usesTunnel(resolver) &&
+				(strings.EqualFold(domain, resolver.Domain) || strings.HasSuffix(strings.ToLower(domain), "."+strings.ToLower(resolver.Domain)))
+		})
+		if !routed {
+			warnings = append(warnings, msg("dns.domain_not_routed", domain))
+		}
+	}
+	if len(domains) == 0 && len(tunnelServers) > 0 {
+		warnings = append(warnings, msg("dns.not_default"))
+	}
+	return warnings
+}
+
+// testResolver sends query straight to nameserver. A "no such host" answer
+// still proves the resolver is reachable and answering.
+func testResolver(nameserver, query string, timeout time.Duration) DNSTestResult {
+	result := DNSTestResult{Nameserver: nameserver, Query: query}
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, net.JoinHostPort(nameserver, "53"))
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	addrs, err := resolver.LookupHost(ctx, query)
+	result.LatencyMS = time.Since(start).Milliseconds()
+	var dnsErr *net.DNSError
+	switch {
+	case err == nil:
+		result.OK = true
+		result.Detail = strings.Join(addrs, ", ")
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		result.OK = true
+		result.Detail = "no such host"
+	case dnsErr != nil:
+		// The error names the system resolver, not the one dialed.
+		result.Error = dnsErr.Err
+	default:
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// dnsTestQuery picks the name to resolve: the first configured dns check,
+// else the first domain the VPN pushed.
+func dnsTestQuery(settings Settings, resolvers []DNSResolver) string {
+	for _, check := range settings.Checks {
+		if check.Type == "dns" && check.Host != "" {
+			return check.Host
+		}
+	}
+	for _, resolver := range resolvers {
+		if len(resolver.SearchDomains) > 0 {
+			return resolver.SearchDomains[0]
+		}
+		if resolver.Domain != "" {
+			return resolver.Domain
+		}
+	}
+	return ""
+}
+
+func runDNS(args []string) int {
+	fs := flag.NewFlagSet("dns", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	name := fs.String("name", "", "Internal name to resolve through each VPN resolver (default: first dns check, else a pushed domain).")
+	timeoutSec := fs.Float64("timeout", 3, "Per-resolver query timeout in seconds.")
+	noTest := fs.Bool("no-test", false, "Only list the resolvers, do not query them.")
+	asJSON := outputFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	state, err := getTunnelState()
+	if err != nil {
+		return fail(err)
+	}
+	if !state.Connected() {
+		fmt.Fprintln(os.Stderr, msg("error", msg("dns.not_connected")))
+		return 1
+	}
+	tunnel, err := detectTunnel()
+	if err != nil {
+		return fail(err)
+	}
+	if tunnel == nil {
+		return fail(errors.New("connected, but no tunnel interface was found"))
+	}
+
+	report := DNSReport{Connection: state.CurrentConnection(), Interface: tunnel.Interface}
+	all, err := systemResolvers()
+	if err != nil {
+		return fail(err)
+	}
+	for _, resolver := range all {
+		if resolver.Interface == tunnel.Interface {
+			report.Resolvers = append(report.Resolvers, resolver)
+		}
+	}
+	report.System = defaultResolver(all)
+	if len(report.Resolvers) > 0 {
+		report.Warnings = dnsWarnings(report.Resolvers, all, report.System)
+	}
+	query := strings.TrimSpace(*name)
+	if query == "" {
+		query = dnsTestQuery(cfg.forConnection(report.Connection), report.Resolvers)
+	}
+	if !*noTest && query != "" {
+		for _, resolver := range report.Resolvers {
+			for _, nameserver := range resolver.Nameservers {
+				report.Tests = append(report.Tests, testResolver(nameserver, query, seconds(*timeoutSec)))
+			}
+		}
+		if answered := slices.ContainsFunc(report.Tests, func(test DNSTestResult) bool { return test.OK && test.Detail != "no such host" }); answered {
+			if addrs, err := net.DefaultResolver.LookupHost(interrupted, query); err != nil || len(addrs) == 0 {
+				report.Warnings = append(report.Warnings, msg("dns.system_differs", query))
+			}
+		}
+	}
+	report.Effective = len(report.Resolvers) > 0 && len(report.Warnings) == 0
+
+	if *asJSON {
+		if code := printJSON(report); code != 0 {
+			return code
+		}
+	} else {
+		fmt.Println(msg("tunnel.interface", report.Interface))
+		if report.System != nil {
+			fmt.Println(msg("dns.system", strings.Join(report.System.Nameservers, ", ")))
+		}
+		if len(report.Resolvers) == 0 {
+			fmt.Println(msg("dns.none", report.Interface))
+		}
+		for _, resolver := range report.Resolvers {
+			fmt.Println(msg("dns.nameservers", strings.Join(resolver.Nameservers, ", ")))
+			if resolver.Domain != "" {
+				fmt.Println(msg("dns.domain", resolver.Domain))
+			}
+			if len(resolver.SearchDomains) > 0 {
+				fmt.Println(msg("dns.search", strings.Join(resolver.SearchDomains, ", ")))
+			}
+		}
+		if !*noTest && query == "" && len(report.Resolvers) > 0 {
+			fmt.Println(msg("dns.no_query"))
+		}
+		for _, test := range report.Tests {
+			if test.OK {
+				fmt.Printf("%-4s %s %s %dms: %s\n", "ok", test.Nameserver, test.Query, test.LatencyMS, test.Detail)
+			} else {
+				fmt.Printf("%-4s %s %s %dms: %s\n", "FAIL", test.Nameserver, test.Query, test.LatencyMS, test.Error)
+			}
+		}
+		for _, warning := range report.Warnings {
+			fmt.Println(msg("warning", warning))
+		}
+	}
+
+	if !report.Effective {
+		return 1
+	}
+	for _, test := range report.Tests {
+		if !test.OK {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DoctorCheck is one item of `fortivpn doctor`. Hint says what to do about
+// a failure.
+type DoctorCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+type DoctorReport struct {
+	OK      bool          `json:"ok"`
+	Backend string        `json:"backend"`
+	Checks  []DoctorCheck `json:"checks"`
+}
+
+// runDoctor walks the chain a command depends on, from FortiClient being
+// installed to the connection list coming back, and reports every link
+// instead of stopping at the first broken one.
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	asJSON := outputFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	report := buildDoctorReport()
+	if *asJSON {
+		if code := printJSON(report); code != 0 {
+			return code
+		}
+	} else {
+		fmt.Println(msg("doctor.backend", report.Backend))
+		for _, check := range report.Checks {
+			outcome := "PASS"
+			switch {
+			case check.Skipped:
+				outcome = "SKIP"
+			case !check.OK:
+				outcome = "FAIL"
+			}
+			fmt.Printf("%-4s %s: %s\n", outcome, check.Name, check.Detail)
+			if !check.OK && !check.Skipped && check.Hint != "" {
+				fmt.Printf("     %s\n", msg("doctor.hint", check.Hint))
+			}
+		}
+	}
+	if report.OK {
+		return 0
+	}
+	return 1
+}
+
+func buildDoctorReport() DoctorReport {
+	backend := activeBackend()
+	report := DoctorReport{OK: true, Backend: backendName(backend)}
+	add := func(check DoctorCheck) {
+		check.Detail = redact(check.Detail)
+		if !check.OK && !check.Skipped {
+			report.OK = false
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	add(doctorConfig())
+	add(doctorStateDir())
+	if unavailable, ok := backend.(unavailableBackend); ok {
+		add(DoctorCheck{Name: "backend", Detail: unavailable.err.Error(), Hint: "pick another backend with --backend or FORTIVPN_BACKEND"})
+	}
+	if _, ok := backend.(bridgeBackend); ok {
+		add(doctorInstalled())
+		add(doctorRunning())
+		add(doctorBridgeScript())
+		add(doctorRuntime())
+		add(doctorBridgePing())
+	}
+	add(doctorInterfaces())
+	add(doctorConnections())
+	return report
+}
+
+func doctorConfig() DoctorCheck {
+	check := DoctorCheck{Name: "config"}
+	path, err := configPath()
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return DoctorCheck{Name: "config", OK: true, Detail: path + " (not present; using defaults)"}
+	}
+	if _, err := loadConfig(); err != nil {
+		check.Detail = err.Error()
+		check.Hint = "run `fortivpn config edit` to fix it, or point FORTIVPN_CONFIG at a valid one"
+		return check
+	}
+	return DoctorCheck{Name: "config", OK: true, Detail: path}
+}
+
+// doctorStateDir checks that history, locks and the mock state can be
+// written.
+func doctorStateDir() DoctorCheck {
+	check := DoctorCheck{Name: "permissions"}
+	dir, err := stateDir()
+	if err == nil {
+		err = os.MkdirAll(dir, 0o700)
+	}
+	var probe *os.File
+	if err == nil {
+		probe, err = os.CreateTemp(dir, ".doctor-*")
+	}
+	if err != nil {
+		check.Detail = fmt.Sprintf("state directory %s is not writable: %v", dir, err)
+		check.Hint = "fix its ownership, or set XDG_STATE_HOME to a writable directory"
+		return check
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return DoctorCheck{Name: "permissions", OK: true, Detail: "state directory " + dir + " is writable"}
+}
+
+func doctorInstalled() DoctorCheck {
+	path := firstNonEmpty(os.Getenv("FORTIVPN_MODULE_PATH"), fortiClientModule)
+	if _, err := os.Stat(path); err != nil {
+		return DoctorCheck{Name: "forticlient", Detail: "FortiClient module not found at " + path, Hint: "install FortiClient, or use --backend forticli"}
+	}
+	detail := "installed"
+	if version := installedFortiClientVersion(); version != "" {
+		detail += " (" + version + ")"
+	}
+	return DoctorCheck{Name: "forticlient", OK: true, Detail: detail}
+}
+
+func doctorRunning() DoctorCheck {
+	if fortiClientRunning() {
+		return DoctorCheck{Name: "forticlient running", OK: true, Detail: "running"}
+	}
+	check := DoctorCheck{Name: "forticlient running", Skipped: true, Detail: "not running; commands start it when needed"}
+	if headlessSession() {
+		check = DoctorCheck{Name: "forticlient running", Detail: "not running, and this session cannot start it", Hint: "start FortiClient from the logged-in desktop, or use --backend forticli"}
+	}
+	return check
+}
+
+func doctorBridgeScript() DoctorCheck {
+	path, err := findBridgeScript()
+	if err != nil {
+		return DoctorCheck{Name: "bridge script", Detail: err.Error(), Hint: "unset FORTIVPN_BRIDGE or run `fortivpn bridge install`"}
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return DoctorCheck{Name: "bridge script", Detail: err.Error(), Hint: "fix the permissions of " + path}
+	}
+	file.Close()
+	return DoctorCheck{Name: "bridge script", OK: true, Detail: path}
+}
+
+func doctorRuntime() DoctorCheck {
+	runtime, _, err := bridgeRuntime()
+	if err != nil {
+		return DoctorCheck{Name: "runtime", Detail: err.Error(), Hint: "install Node.js, or pass --node-path"}
+	}
+	ctx, cancel := context.WithTimeout(interrupted, 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, runtime, "--version").Output()
+	if err != nil {
+		return DoctorCheck{Name: "runtime", Detail: fmt.Sprintf("%s does not run: %v", runtime, err), Hint: "reinstall it, or pass --node-path with a working one"}
+	}
+	version := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	return DoctorCheck{Name: "runtime", OK: true, Detail: fmt.Sprintf("%s (%s)", runtime, version)}
+}
+
+func doctorBridgePing() DoctorCheck {
+	start := time.Now()
+	raw, err := runBridge("ping", nil)
+	if err != nil {
+		return DoctorCheck{Name: "bridge", Detail: err.Error(), Hint: "run `fortivpn --debug-bridge bridge ping` to see what the bridge printed"}
+	}
+	var ping BridgePing
+	_ = json.Unmarshal(raw, &ping)
+	return DoctorCheck{Name: "bridge", OK: true, Detail: fmt.Sprintf("protocol %d, answered in %dms", ping.Protocol, time.Since(start).Milliseconds())}
+}
+
+// doctorInterfaces lists the tunnel-like interfaces that exist. Finding
+// none is normal while disconnected, so it never fails.
+func doctorInterfaces() DoctorCheck {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return DoctorCheck{Name: "interfaces", Skipped: true, Detail: err.Error()}
+	}
+	var found []string
+	for _, iface := range ifaces {
+		if !isTunnelInterfaceName(iface.Name) {
+			continue
+		}
+		state := "down"
+		if iface.Flags&net.FlagUp != 0 {
+			state = "up"
+		}
+		addrs, _ := iface.Addrs()
+		found = append(found, fmt.Sprintf("%s (%s, %d addresses)", iface.Name, state, len(addrs)))
+	}
+	if len(found) == 0 {
+		return DoctorCheck{Name: "interfaces", OK: true, Detail: "no tunnel interfaces"}
+	}
+	return DoctorCheck{Name: "interfaces", OK: true, Detail: strings.Join(found, ", ")}
+}
+
+func doctorConnections() DoctorCheck {
+	tunnels, err := getConnections()
+	if err != nil {
+		hint := "run `fortivpn --debug-bridge connections` for the full exchange"
+		if _, ok := activeBackend().(bridgeBackend); !ok {
+			hint = "check the " + backendName(activeBackend()) + " backend's own output"
+		}
+		return DoctorCheck{Name: "connections", Detail: err.Error(), Hint: hint}
+	}
+	if len(tunnels) == 0 {
+		return DoctorCheck{Name: "connections", Detail: "no VPN connections configured", Hint: "add a connection in FortiClient"}
+	}
+	names := make([]string, 0, len(tunnels))
+	for _, tunnel := range tunnels {
+		names = append(names, tunnel.ConnectionName)
+	}
+	return DoctorCheck{Name: "connections", OK: true, Detail: fmt.Sprintf("%d: %s", len(names), strings.Join(names, ", "))}
+}
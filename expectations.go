@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	severityWarn = "warn"
+	severityFail = "fail"
+
+	defaultEgressURL            = "https://api.ipify.org"
+	defaultExpectationsInterval = 60 * time.Second
+)
+
+type Expectation struct {
+	Name     string  `json:"name,omitempty"`
+	Type     string  `json:"type"`
+	CIDR     string  `json:"cidr,omitempty"`
+	Host     string  `json:"host,omitempty"`
+	Address  string  `json:"address,omitempty"`
+	URL      string  `json:"url,omitempty"`
+	Severity string  `json:"severity,omitempty"`
+	Timeout  float64 `json:"timeout,omitempty"`
+}
+
+type ExpectationResult struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Severity string `json:"severity"`
+	OK       bool   `json:"ok"`
+	Detail   string `json:"detail,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (e Expectation) validate() error {
+	switch strings.ToLower(e.Severity) {
+	case "", severityWarn, severityFail:
+	default:
+		return fmt.Errorf("unknown severity %q (want warn or fail)", e.Severity)
+	}
+
+	switch strings.ToLower(e.Type) {
+	case "route":
+		if _, _, err := net.ParseCIDR(e.CIDR); err != nil {
+			return fmt.Errorf("route expectation needs a cidr: %w", err)
+		}
+	case "dns":
+		if strings.TrimSpace(e.Host) == "" {
+			return errors.New("dns expectation needs host")
+		}
+	case "reachable":
+		if _, _, err := net.SplitHostPort(e.Address); err != nil {
+			return fmt.Errorf("reachable expectation needs address host:port: %w", err)
+		}
+	case "egress":
+		if _, _, err := net.ParseCIDR(e.CIDR); err != nil {
+			return fmt.Errorf("egress expectation needs a cidr: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown expectation type %q (want route, dns, reachable or egress)", e.Type)
+	}
+	return nil
+}
+
+func (e Expectation) label() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	switch strings.ToLower(e.Type) {
+	case "route", "egress":
+		return strings.ToLower(e.Type) + " " + e.CIDR
+	case "dns":
+		return "dns " + e.Host
+	default:
+		return strings.ToLower(e.Type) + " " + e.Address
+	}
+}
+
+func (e Expectation) severity() string {
+	if strings.EqualFold(e.Severity, severityFail) {
+		return severityFail
+	}
+	return severityWarn
+}
+
+func evaluateExpectations(expectations []Expectation) []ExpectationResult {
+	results := make([]ExpectationResult, len(expectations))
+	done := make(chan struct{})
+	for i, expectation := range expectations {
+		go func() {
+			results[i] = evaluateExpectation(expectation)
+			done <- struct{}{}
+		}()
+	}
+	for range expectations {
+		<-done
+	}
+	return results
+}
+
+func evaluateExpectation(e Expectation) ExpectationResult {
+	result := ExpectationResult{Name: e.label(), Type: strings.ToLower(e.Type), Severity: e.severity()}
+	timeout := seconds(e.Timeout)
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+
+	var detail string
+	var err error
+	switch result.Type {
+	case "route":
+		detail, err = expectRoute(e.CIDR)
+	case "dns":
+		detail, err = probeDNS(e.Host, "", "any", timeout)
+	case "reachable":
+		detail, err = probeTCP(e.Address, "any", timeout)
+	case "egress":
+		detail, err = expectEgress(firstNonEmpty(e.URL, defaultEgressURL), e.CIDR, timeout)
+	}
+	result.Detail = detail
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.OK = true
+	return result
+}
+
+// expectRoute checks that the first address of cidr is routed through the
+// tunnel interface.
+func expectRoute(cidr string) (string, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+	tunnel, err := detectTunnel()
+	if err != nil {
+		return "", err
+	}
+	if tunnel == nil {
+		return "", errors.New("no tunnel interface found")
+	}
+
+	iface, err := routeInterface(network.IP)
+	if err != nil {
+		return "", err
+	}
+	detail := fmt.Sprintf("%s via %s", network.IP, iface)
+	if iface != tunnel.Interface {
+		return detail, fmt.Errorf("%s is routed via %s, not the tunnel (%s)", network.IP, iface, tunnel.Interface)
+	}
+	return detail, nil
+}
+
+func routeInterface(ip net.IP) (string, error) {
+	args := []string{"-n", "get", ip.String()}
+	if ip.To4() == nil {
+		args = []string{"-n", "get", "-inet6", ip.String()}
+	}
+	out, err := exec.Command("route", args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to look up route for %s: %w", ip, err)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if ok && key == "interface" {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", fmt.Errorf("no route found for %s", ip)
+}
+
+func expectEgress(url, cidr string, timeout time.Duration) (string, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+	ip, err := egressIP(url, timeout)
+	if err != nil {
+		return "", err
+	}
+	if !network.Contains(ip) {
+		return ip.String(), fmt.Errorf("egress IP %s is outside %s", ip, cidr)
+	}
+	return ip.String(), nil
+}
+
+func egressIP(url string, timeout time.Duration) (net.IP, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil {
+		return nil, fmt.Errorf("%s did not return an IP address", url)
+	}
+	return ip, nil
+}
+
+func expectationsFailed(results []ExpectationResult) bool {
+	for _, result := range results {
+		if !result.OK && result.Severity == severityFail {
+			return true
+		}
+	}
+	return false
+}
+
+func expectationsLabel(results []ExpectationResult) string {
+	violated := make([]string, 0)
+	for _, result := range results {
+		if !result.OK {
+			violated = append(violated, result.Name)
+		}
+	}
+	if len(violated) == 0 {
+		return "met"
+	}
+	return "violated(" + strings.Join(violated, ",") + ")"
+}
+
+func reportExpectationViolations(results []ExpectationResult) {
+	for _, result := range results {
+		if result.OK {
+			continue
+		}
+		level := "warning"
+		if result.Severity == severityFail {
+			level = "error"
+		}
+		fmt.Fprintln(os.Stderr, msg(level, msg("expectation.not_met", result.Name, redact(result.Error))))
+	}
+}
+
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	connectionArg := fs.String("connection", "", "Use the expectations of this connection instead of the active one.")
+	strict := fs.Bool("strict", false, "Treat warn-level violations as failures.")
+	asJSON := outputFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	state, err := getTunnelState()
+	if err != nil {
+		return fail(err)
+	}
+	if !state.Connected() {
+		fmt.Fprintln(os.Stderr, msg("error", msg("verify.not_connected")))
+		return 1
+	}
+
+	connection := state.CurrentConnection()
+	if strings.TrimSpace(*connectionArg) != "" {
+		tunnels, err := getConnections()
+		if err != nil {
+			return fail(err)
+		}
+		selection, err := resolveSelection(*connectionArg, tunnels, cfg)
+		if err != nil {
+			return fail(err)
+		}
+		connection = selection.Primary().ConnectionName
+		if active, ok := selection.ActiveMember(state); ok {
+			connection = active.ConnectionName
+		}
+	}
+
+	expectations := cfg.forConnection(connection).Expectations
+	if len(expectations) == 0 {
+		return fail(fmt.Errorf("no expectations configured for %q", connection))
+	}
+	results := evaluateExpectations(expectations)
+
+	if *asJSON {
+		if code := printJSON(results); code != 0 {
+			return code
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, msg("verify.header"))
+		for _, result := range results {
+			outcome := "pass"
+			detail := result.Detail
+			if !result.OK {
+				outcome = "FAIL"
+				detail = result.Error
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", outcome, result.Severity, result.Name, redact(detail))
+		}
+		w.Flush()
+	}
+
+	for _, result := range results {
+		if !result.OK && (*strict || result.Severity == severityFail) {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	defaultFallbackAfter    = 3
+	defaultFailbackInterval = 5 * time.Minute
+)
+
+// FallbackConfig names a backup connection watch switches to after the
+// watched connection failed to reconnect After times in a row.
+type FallbackConfig struct {
+	Connection       string  `json:"connection"`
+	After            int     `json:"after,omitempty"`
+	FailbackInterval float64 `json:"failback_interval,omitempty"`
+}
+
+func (c FallbackConfig) validate() error {
+	if c.Connection == "" {
+		return errors.New("connection is required")
+	}
+	if c.After < 0 || c.FailbackInterval < 0 {
+		return errors.New("after and failback_interval must not be negative")
+	}
+	return nil
+}
+
+func (c FallbackConfig) after() int {
+	if c.After == 0 {
+		return defaultFallbackAfter
+	}
+	return c.After
+}
+
+func (c FallbackConfig) failbackInterval() time.Duration {
+	if c.FailbackInterval == 0 {
+		return defaultFailbackInterval
+	}
+	return seconds(c.FailbackInterval)
+}
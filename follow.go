@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// followStatus prints the status once and then again whenever it changes,
+// one line, one compact JSON object or one YAML document each, until
+// interrupted. Unlike watch it never reconnects. A failing state query is
+// reported once and polling goes on.
+func followStatus(snapshot func() (Status, error), interval time.Duration, asJSON bool, tmpl *template.Template) int {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	last, lastErr := "", ""
+	for {
+		status, err := snapshot()
+		switch {
+		case interrupted.Err() != nil:
+			return 130
+		case err != nil:
+			if err.Error() != lastErr {
+				fmt.Fprintln(os.Stderr, msg("error", redact(err.Error())))
+				lastErr, last = err.Error(), ""
+			}
+		case statusKey(status) != last:
+			last, lastErr = statusKey(status), ""
+			if asJSON && outputFormat == "yaml" {
+				// One YAML document per change.
+				fmt.Println("---")
+				if code := printJSON(status); code != 0 {
+					return code
+				}
+			} else if asJSON {
+				line, err := json.Marshal(status)
+				if err != nil {
+					return fail(err)
+				}
+				fmt.Println(string(line))
+			} else if tmpl != nil {
+				if err := writeFormat(tmpl, status); err != nil {
+					fmt.Fprintln(os.Stderr, msg("error", fmt.Errorf("--format: %w", err)))
+					return 2
+				}
+			} else {
+				fmt.Println(statusLine(status))
+			}
+		}
+		select {
+		case <-interrupted.Done():
+			return 130
+		case <-time.After(interval):
+		}
+	}
+}
+
+// statusKey is what a change is judged by; CheckedAt and the timings change
+// on every poll.
+func statusKey(status Status) string {
+	iface := ""
+	if status.Tunnel != nil {
+		iface = status.Tunnel.Interface
+	}
+	return strings.Join([]string{status.State, status.CurrentConnection, status.SelectedConnection, iface,
+		fmt.Sprint(status.Lock != nil), fmt.Sprint(status.UpgradePending != "")}, "\x00")
+}
+
+func statusLine(status Status) string {
+	line := fmt.Sprintf("%s %s %s", time.Unix(status.CheckedAt, 0).Format(time.RFC3339), status.State, emptyAsUnknown(status.CurrentConnection))
+	if status.Tunnel != nil {
+		line += fmt.Sprintf(" (%s %s)", status.Tunnel.Interface, strings.Join(append(status.Tunnel.IPv4, status.Tunnel.IPv6...), " "))
+	}
+	if status.Lock != nil {
+		line += " " + msg("status.lock", status.Lock.describe())
+	}
+	if status.UpgradePending != "" {
+		line += " " + msg("follow.upgrade_pending")
+	}
+	return line
+}
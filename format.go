@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// formatFuncs are the helpers --format templates get on top of the
+// text/template builtins. Like prompt's, the ones taking an argument take
+// it first so they read well in a pipeline: {{.Tags | join ","}}.
+var formatFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join":       func(sep string, items []string) string { return strings.Join(items, sep) },
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+}
+
+// parseFormat compiles a --format template. Fields use the Go names of the
+// JSON output: {{.State}} for "state", {{.ConnectionName}} for
+// "connection_name". An empty text means no template.
+func parseFormat(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("format").Funcs(formatFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --format: %w", err)
+	}
+	return tmpl, nil
+}
+
+// parseFormatFlag checks --format against --json before anything runs, so
+// a typo in a template fails fast with a usage error.
+func parseFormatFlag(text string, asJSON bool) (*template.Template, bool) {
+	if text != "" && asJSON {
+		fmt.Fprintln(os.Stderr, msg("error", msg("format.with_json")))
+		return nil, false
+	}
+	tmpl, err := parseFormat(text)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, msg("error", err))
+		return nil, false
+	}
+	return tmpl, true
+}
+
+// printFormat renders v with tmpl on its own line; a slice is rendered
+// once per element, like the text output of list commands.
+func printFormat(tmpl *template.Template, v any) int {
+	if err := writeFormat(tmpl, v); err != nil {
+		fmt.Fprintln(os.Stderr, msg("error", fmt.Errorf("--format: %w", err)))
+		return 2
+	}
+	return 0
+}
+
+func writeFormat(tmpl *template.Template, v any) error {
+	var buf bytes.Buffer
+	render := func(item any) error {
+		if err := tmpl.Execute(&buf, item); err != nil {
+			return err
+		}
+		if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+		return nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+		for i := 0; i < rv.Len(); i++ {
+			if err := render(rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+	} else if err := render(v); err != nil {
+		return err
+	}
+	_, err := os.Stdout.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// configuredForticliPath pins the Fortinet command-line client used by the
+// forticli backend (forticli_path in the config).
+var configuredForticliPath string
+
+var (
+	forticliNamePattern   = regexp.MustCompile(`(?i)\b(?:vpn name|connection name|connection|profile|name)\s*:\s*(.+?)(?:\s{2,}|\t|$)`)
+	forticliTypePattern   = regexp.MustCompile(`(?i)\btype\s*:\s*(\S+)`)
+	forticliStatusPattern = regexp.MustCompile(`(?i)\b(?:status|state)\s*:\s*(.+?)(?:\s{2,}|\t|$)`)
+)
+
+// findForticli locates Fortinet's own CLI, which Linux and some managed
+// macOS installs ship next to (or instead of) the GUI.
+func findForticli() (string, error) {
+	if configured := strings.TrimSpace(configuredForticliPath); configured != "" {
+		if isExecutableFile(configured) {
+			return configured, nil
+		}
+		return "", &runtimeNotFoundError{Runtime: "forticlient CLI", Looked: []string{"forticli_path=" + configured}, Hint: "fix forticli_path in the config file"}
+	}
+	if path, err := exec.LookPath("forticlient"); err == nil {
+		return path, nil
+	}
+	looked := []string{"$PATH"}
+	for _, candidate := range []string{"/opt/forticlient/forticlient", "/usr/local/bin/forticlient"} {
+		looked = append(looked, candidate)
+		if isExecutableFile(candidate) {
+			return candidate, nil
+		}
+	}
+	return "", &runtimeNotFoundError{Runtime: "forticlient CLI", Looked: looked, Hint: "set forticli_path in the config file to point at it"}
+}
+
+// forticliBackend drives "forticlient vpn list|status|connect|disconnect".
+// Its output is meant for people, so it is parsed leniently.
+type forticliBackend struct {
+	path string
+}
+
+func (b forticliBackend) run(args ...string) (string, error) {
+	defer timeBridge(time.Now())
+	ctx, cancel := bridgeContext()
+	defer cancel()
+	cmd := exec.CommandContext(ctx, b.path, append([]string{"vpn"}, args...)...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.CombinedOutput()
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return "", bridgeTimeoutError("forticlient vpn " + args[0])
+	case context.Canceled:
+		return "", errCanceled
+	}
+	if err != nil {
+		text := strings.TrimSpace(string(out))
+		if text == "" {
+			text = err.Error()
+		}
+		return "", fmt.Errorf("forticlient vpn %s: %w", args[0], &bridgeError{Message: redact(text)})
+	}
+	return string(out), nil
+}
+
+func (b forticliBackend) ListConnections() ([]Tunnel, error) {
+	out, err := b.run("list")
+	if err != nil {
+		return nil, err
+	}
+	return parseForticliList(out), nil
+}
+
+func parseForticliList(out string) []Tunnel {
+	var tunnels []Tunnel
+	var plain []Tunnel
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if match := forticliNamePattern.FindStringSubmatch(line); match != nil {
+			tunnel := Tunnel{ConnectionName: strings.TrimSpace(match[1]), Type: "ssl"}
+			if kind := forticliTypePattern.FindStringSubmatch(line); kind != nil && strings.Contains(strings.ToLower(kind[1]), "ipsec") {
+				tunnel.Type = "ipsec"
+			}
+			tunnels = append(tunnels, tunnel)
+			continue
+		}
+		// Plain listings print one name per line under a heading.
+		if strings.HasSuffix(line, ":") {
+			continue
+		}
+		name := strings.TrimSpace(strings.TrimLeft(line, "-*0123456789.) "))
+		if name != "" {
+			plain = append(plain, Tunnel{ConnectionName: name, Type: "ssl"})
+		}
+	}
+	if len(tunnels) > 0 {
+		return tunnels
+	}
+	return plain
+}
+
+func (b forticliBackend) GetState() (TunnelState, error) {
+	out, err := b.run("status")
+	if err != nil {
+		return TunnelState{}, err
+	}
+	return parseForticliStatus(out), nil
+}
+
+func parseForticliStatus(out string) TunnelState {
+	var state TunnelState
+	connected := false
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if match := forticliStatusPattern.FindStringSubmatch(line); match != nil {
+			value := strings.ToLower(match[1])
+			connected = strings.Contains(value, "connected") && !strings.Contains(value, "disconnected") && !strings.Contains(value, "not ")
+			continue
+		}
+		if match := forticliNamePattern.FindStringSubmatch(line); match != nil && state.ConnectionName == "" {
+			state.ConnectionName = strings.TrimSpace(match[1])
+		}
+	}
+	if !connected {
+		return TunnelState{}
+	}
+	state.SSLState = 1
+	return state
+}
+
+func (b forticliBackend) Connect(target Tunnel) error {
+	_, err := b.run("connect", target.ConnectionName)
+	return err
+}
+
+func (b forticliBackend) Disconnect(TunnelState) error {
+	_, err := b.run("disconnect")
+	return err
+}
@@ -4,6 +4,12 @@ const MODULE_PATH =
   process.env.FORTIVPN_MODULE_PATH ||
   '/Applications/FortiClient.app/Contents/Resources/app.asar.unpacked/assets/js/guimessenger_jyp.node';
 
+// PROTOCOL_VERSION changes whenever the request or response shape does; the
+// Go side refuses to talk to a bridge outside the range it supports.
+const PROTOCOL_VERSION = 1;
+
+const ACTIONS = ['version', 'ping', 'list-connections', 'get-state', 'connect', 'disconnect', 'get-identity', 'get-split-tunnel', 'add-connection', 'remove-connection'];
+
 function parsePayload(raw) {
   if (!raw) {
     return {};
@@ -28,22 +34,91 @@ async function normalize(value) {
   }
 }
 
-async function main() {
-  const action = process.argv[2];
-  if (!action) {
-    throw new Error('missing action');
+// stdout carries only the response; send the module's own logging to
+// stderr, where the CLI keeps it for diagnostics.
+console.log = console.error;
+console.info = console.error;
+
+const IDLE_EXIT_MS = Number(process.env.FORTIVPN_BRIDGE_IDLE_MS || 5 * 60 * 1000);
+
+// VERIFIED_PROFILE_CALLS lists, per FortiClient version, the module calls
+// that add-connection and remove-connection may use. FortiClient documents
+// none of them, so an entry goes in only once the call and its JSON argument
+// have been checked against that exact build; any other version is refused
+// rather than handed to a call whose signature was guessed. Entries look
+// like '7.4.0': { 'add-connection': 'AddVPNConnection', ... }.
+const VERIFIED_PROFILE_CALLS = {};
+
+function verifiedProfileCall(version, action) {
+  const calls = VERIFIED_PROFILE_CALLS[version || ''];
+  if (!calls || !calls[action]) {
+    throw new Error(`${action} is not verified for FortiClient ${version || '(unknown version)'}; create or delete the connection in the FortiClient app`);
   }
+  return calls[action];
+}
+
+// errorCode classifies a failure so the CLI can react to it without
+// parsing FortiClient's wording: auth_required, not_found, app_not_running
+// or timeout. Unrecognised failures get no code.
+function errorCode(err) {
+  if (err && err.code && ERROR_CODES.includes(err.code)) {
+    return err.code;
+  }
+  const message = String(err && err.message ? err.message : err).toLowerCase();
+  if (/auth|credential|password|saml|login|certificate required/.test(message)) {
+    return 'auth_required';
+  }
+  if (/not found|no such|unknown connection|does not exist/.test(message)) {
+    return 'not_found';
+  }
+  if (/timed? ?out/.test(message)) {
+    return 'timeout';
+  }
+  if (/not running|econnrefused|enoent|ipc|service unavailable/.test(message)) {
+    return 'app_not_running';
+  }
+  return undefined;
+}
+
+const ERROR_CODES = ['auth_required', 'not_found', 'app_not_running', 'timeout'];
 
-  let api;
+function failure(err) {
+  return {
+    ok: false,
+    protocol: PROTOCOL_VERSION,
+    error: err && err.message ? err.message : String(err),
+    error_code: errorCode(err),
+  };
+}
+
+function loadModule() {
   try {
-    api = require(MODULE_PATH);
+    return require(MODULE_PATH);
   } catch (err) {
-    throw new Error(`failed to load FortiClient module: ${err.message}`);
+    const wrapped = new Error(`failed to load FortiClient module: ${err.message}`);
+    wrapped.code = 'app_not_running';
+    throw wrapped;
   }
+}
 
-  const payload = parsePayload(process.argv[3]);
+function runtimeName() {
+  if (typeof Deno !== 'undefined') {
+    return `deno ${Deno.version.deno}`;
+  }
+  if (process.versions.bun) {
+    return `bun ${process.versions.bun}`;
+  }
+  return `node ${process.version}`;
+}
 
+async function handle(api, action, payload) {
   switch (action) {
+    case 'version': {
+      return { protocol: PROTOCOL_VERSION, capabilities: ACTIONS };
+    }
+    case 'ping': {
+      return { protocol: PROTOCOL_VERSION, runtime: runtimeName() };
+    }
     case 'list-connections': {
       return normalize(api.GetVPNConnectionList());
     }
@@ -64,18 +139,303 @@ async function main() {
       };
       return normalize(api.DisconnectTunnel(JSON.stringify(request)));
     }
+    case 'get-identity': {
+      // The GUI module has no documented identity call; return the raw state
+      // plus whatever the known info getters of this FortiClient build report.
+      const request = JSON.stringify({ connection_name: payload.connection_name || '' });
+      const details = {};
+      for (const name of ['GetVPNConnectionInfo', 'GetConnectionInfo', 'GetVPNStatus', 'getVPNInfo']) {
+        if (typeof api[name] === 'function') {
+          try {
+            details[name] = await normalize(api[name](request));
+          } catch {
+            // Not every build accepts a request argument; skip the getter.
+          }
+        }
+      }
+      return { state: await normalize(api.getConnectionState()), details };
+    }
+    case 'get-split-tunnel': {
+      // Like get-identity: report whatever split-tunnel getters this build has.
+      const request = JSON.stringify({ connection_name: payload.connection_name || '' });
+      const details = {};
+      for (const name of ['GetSplitTunnelInfo', 'GetSplitTunnelConfig', 'GetVPNSplitTunnel', 'getSplitTunnel']) {
+        if (typeof api[name] === 'function') {
+          try {
+            details[name] = await normalize(api[name](request));
+          } catch {
+            // Not every build accepts a request argument; skip the getter.
+          }
+        }
+      }
+      return details;
+    }
+    case 'add-connection':
+    case 'remove-connection': {
+      const call = verifiedProfileCall(payload.forticlient_version, action);
+      const request = action === 'add-connection'
+        ? {
+          connection_name: payload.connection_name || '',
+          connection_type: payload.connection_type || 'ssl',
+          server: payload.server || '',
+          port: payload.port || 443,
+          saml: Boolean(payload.saml),
+        }
+        : {
+          connection_name: payload.connection_name || '',
+          connection_type: payload.connection_type || 'ssl',
+        };
+      if (typeof api[call] !== 'function') {
+        throw new Error(`this FortiClient build lacks ${call}, which ${action} was verified against`);
+      }
+      return normalize(api[call](JSON.stringify(request)));
+    }
     default:
       throw new Error(`unknown action: ${action}`);
   }
 }
 
+// serve keeps the module loaded and answers newline-delimited JSON requests
+// ({"action": ..., "payload": ...}) on a Unix socket, exiting when idle.
+function serve(api, socketPath) {
+  const fs = require('fs');
+  const net = require('net');
+  let idleTimer;
+  const resetIdle = () => {
+    clearTimeout(idleTimer);
+    idleTimer = setTimeout(() => {
+      server.close();
+      process.exit(0);
+    }, IDLE_EXIT_MS);
+  };
+
+  const server = net.createServer((socket) => {
+    resetIdle();
+    let buffer = '';
+    socket.on('data', async (chunk) => {
+      buffer += chunk;
+      let newline;
+      while ((newline = buffer.indexOf('\n')) >= 0) {
+        const line = buffer.slice(0, newline);
+        buffer = buffer.slice(newline + 1);
+        let response;
+        try {
+          const request = JSON.parse(line);
+          response = { ok: true, protocol: PROTOCOL_VERSION, result: await handle(api, request.action, request.payload || {}) };
+        } catch (err) {
+          response = failure(err);
+        }
+        resetIdle();
+        socket.write(JSON.stringify(response) + '\n');
+      }
+    });
+    socket.on('error', () => {});
+  });
+
+  try {
+    fs.unlinkSync(socketPath);
+  } catch {
+    // No stale socket to remove.
+  }
+  server.listen(socketPath, () => {
+    fs.chmodSync(socketPath, 0o600);
+    fs.writeFileSync(`${socketPath}.pid`, String(process.pid), { mode: 0o600 });
+    resetIdle();
+  });
+  const cleanup = () => {
+    try {
+      fs.unlinkSync(socketPath);
+    } catch {
+      // Already gone.
+    }
+    process.exit(0);
+  };
+  process.on('SIGTERM', cleanup);
+  process.on('SIGINT', cleanup);
+  process.on('exit', () => {
+    for (const path of [socketPath, `${socketPath}.pid`]) {
+      try {
+        fs.unlinkSync(path);
+      } catch {
+        // Already gone.
+      }
+    }
+  });
+}
+
+// Minimal protobuf helpers for the two string-field messages in
+// proto/fortivpn_bridge.proto.
+function readVarint(buf, offset) {
+  let value = 0;
+  let shift = 0;
+  for (;;) {
+    if (offset >= buf.length) {
+      throw new Error('truncated varint');
+    }
+    const byte = buf[offset++];
+    value += (byte & 0x7f) * 2 ** shift;
+    if (byte < 0x80) {
+      return [value, offset];
+    }
+    shift += 7;
+  }
+}
+
+function decodeStrings(buf) {
+  const fields = {};
+  let offset = 0;
+  while (offset < buf.length) {
+    let key;
+    [key, offset] = readVarint(buf, offset);
+    const wireType = key & 7;
+    if (wireType === 2) {
+      let length;
+      [length, offset] = readVarint(buf, offset);
+      fields[Math.floor(key / 8)] = buf.subarray(offset, offset + length).toString('utf8');
+      offset += length;
+    } else if (wireType === 0) {
+      [, offset] = readVarint(buf, offset);
+    } else if (wireType === 1 || wireType === 5) {
+      offset += wireType === 1 ? 8 : 4;
+    } else {
+      throw new Error(`unsupported wire type ${wireType}`);
+    }
+  }
+  return fields;
+}
+
+function encodeString(field, value) {
+  const bytes = Buffer.from(value, 'utf8');
+  const varint = (n) => {
+    const out = [];
+    while (n > 0x7f) {
+      out.push((n & 0x7f) | 0x80);
+      n = Math.floor(n / 128);
+    }
+    out.push(n);
+    return out;
+  };
+  return Buffer.concat([Buffer.from(varint(field * 8 + 2)), Buffer.from(varint(bytes.length)), bytes]);
+}
+
+// serveGRPC answers Bridge.Call over cleartext HTTP/2 on a Unix socket
+// ("unix:///path") or a loopback host:port. Unlike serve, it does not exit
+// when idle: it is meant to run as a service, possibly with more rights
+// than its callers, so every call must carry the token from
+// FORTIVPN_BRIDGE_GRPC_TOKEN, and the socket is only open to its owner (and
+// the group in FORTIVPN_BRIDGE_GRPC_GID, when set).
+function serveGRPC(api, address) {
+  const crypto = require('crypto');
+  const fs = require('fs');
+  const http2 = require('http2');
+  const net = require('net');
+  const token = process.env.FORTIVPN_BRIDGE_GRPC_TOKEN || '';
+  if (token.length < 16) {
+    throw new Error('serve-grpc needs FORTIVPN_BRIDGE_GRPC_TOKEN set to a secret of at least 16 characters');
+  }
+  const expected = Buffer.from(`Bearer ${token}`);
+  const authorized = (header) => {
+    const given = Buffer.from(String(header || ''));
+    return given.length === expected.length && crypto.timingSafeEqual(given, expected);
+  };
+
+  const server = http2.createServer();
+  server.on('stream', (stream, headers) => {
+    const reply = (status, message, body) => {
+      stream.respond({ ':status': 200, 'content-type': 'application/grpc' }, { waitForTrailers: true });
+      stream.on('wantTrailers', () => stream.sendTrailers({ 'grpc-status': String(status), 'grpc-message': message }));
+      stream.end(body);
+    };
+    if (!authorized(headers.authorization)) {
+      reply(16, 'missing or wrong bridge token');
+      return;
+    }
+    if (headers[':path'] !== '/fortivpn.bridge.v1.Bridge/Call') {
+      reply(12, 'unknown method');
+      return;
+    }
+    const chunks = [];
+    stream.on('data', (chunk) => chunks.push(chunk));
+    stream.on('end', async () => {
+      let response;
+      try {
+        const frame = Buffer.concat(chunks);
+        if (frame.length < 5 || frame[0] !== 0) {
+          throw new Error('unsupported request frame');
+        }
+        const fields = decodeStrings(frame.subarray(5, 5 + frame.readUInt32BE(1)));
+        const payload = fields[2] ? JSON.parse(fields[2]) : null;
+        response = { ok: true, protocol: PROTOCOL_VERSION, result: await handle(api, fields[1], payload || {}) };
+      } catch (err) {
+        response = failure(err);
+      }
+      const message = encodeString(1, JSON.stringify(response));
+      const header = Buffer.alloc(5);
+      header.writeUInt32BE(message.length, 1);
+      reply(0, '', Buffer.concat([header, message]));
+    });
+  });
+
+  if (address.startsWith('unix://')) {
+    const socketPath = address.slice('unix://'.length);
+    try {
+      fs.unlinkSync(socketPath);
+    } catch {
+      // No stale socket to remove.
+    }
+    // Nobody else may connect between listen and chmod.
+    const umask = process.umask(0o177);
+    server.listen(socketPath, () => {
+      process.umask(umask);
+      const gid = process.env.FORTIVPN_BRIDGE_GRPC_GID;
+      if (gid) {
+        fs.chownSync(socketPath, process.getuid(), Number(gid));
+        fs.chmodSync(socketPath, 0o660);
+      } else {
+        fs.chmodSync(socketPath, 0o600);
+      }
+    });
+    return;
+  }
+  const separator = address.lastIndexOf(':');
+  const host = address.slice(0, separator).replace(/^\[|\]$/g, '') || 'localhost';
+  const loopback = host === 'localhost' || (net.isIPv4(host) && host.startsWith('127.')) || host === '::1';
+  if (!loopback) {
+    throw new Error(`serve-grpc only listens on loopback addresses, not ${host}; use a Unix socket or 127.0.0.1`);
+  }
+  server.listen(Number(address.slice(separator + 1)), host);
+}
+
+async function main() {
+  const action = process.argv[2];
+  if (!action) {
+    throw new Error('missing action');
+  }
+  if (action === 'version' || action === 'ping') {
+    // Answer the handshake even when the FortiClient module cannot load.
+    return handle(null, action, {});
+  }
+  const api = loadModule();
+  if (action === 'serve') {
+    serve(api, process.argv[3]);
+    return undefined;
+  }
+  if (action === 'serve-grpc') {
+    serveGRPC(api, process.argv[3]);
+    return undefined;
+  }
+  return handle(api, action, parsePayload(process.argv[3]));
+}
+
 (async () => {
   try {
     const result = await main();
-    process.stdout.write(JSON.stringify({ ok: true, result }));
+    if (process.argv[2] === 'serve' || process.argv[2] === 'serve-grpc') {
+      return;
+    }
+    process.stdout.write(JSON.stringify({ ok: true, protocol: PROTOCOL_VERSION, result }));
   } catch (err) {
-    const message = err && err.message ? err.message : String(err);
-    process.stdout.write(JSON.stringify({ ok: false, error: message }));
+    process.stdout.write(JSON.stringify(failure(err)));
     process.exitCode = 1;
   }
 })();
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultGatewayCertWarnDays = 30
+	precheckTimeout            = 3 * time.Second
+)
+
+type GatewayCert struct {
+	Subject         string    `json:"subject"`
+	Issuer          string    `json:"issuer"`
+	DNSNames        []string  `json:"dns_names,omitempty"`
+	NotBefore       time.Time `json:"not_before"`
+	NotAfter        time.Time `json:"not_after"`
+	DaysLeft        int       `json:"days_left"`
+	SHA256          string    `json:"sha256"`
+	PublicKeySHA256 string    `json:"public_key_sha256"`
+}
+
+type GatewayInfo struct {
+	Connection  string        `json:"connection,omitempty"`
+	Gateway     string        `json:"gateway"`
+	Addresses   []string      `json:"addresses"`
+	TLSVersion  string        `json:"tls_version"`
+	CipherSuite string        `json:"cipher_suite"`
+	Trusted     bool          `json:"trusted"`
+	TrustError  string        `json:"trust_error,omitempty"`
+	Chain       []GatewayCert `json:"chain"`
+	Pin         string        `json:"pin,omitempty"`
+	Warnings    []string      `json:"warnings,omitempty"`
+}
+
+// gatewayAddress adds the default HTTPS port FortiGate SSL VPN listens on
+// when the configured gateway has none.
+func gatewayAddress(gateway string) string {
+	gateway = strings.TrimSpace(gateway)
+	gateway = strings.TrimPrefix(gateway, "https://")
+	gateway = strings.TrimSuffix(gateway, "/")
+	if _, _, err := net.SplitHostPort(gateway); err == nil {
+		return gateway
+	}
+	return net.JoinHostPort(strings.Trim(gateway, "[]"), "443")
+}
+
+// precheckGateway TCP-probes the gateway so a network that blocks the port
+// fails in seconds instead of after the full connect timeout.
+func precheckGateway(gateway, family string, timeout time.Duration) error {
+	if gateway == "" {
+		return nil
+	}
+	address := gatewayAddress(gateway)
+	if _, err := probeTCP(address, family, timeout); err != nil {
+		return fmt.Errorf("gateway unreachable from this network: %s: %w", address, err)
+	}
+	return nil
+}
+
+// inspectGateway resolves the gateway and fetches its certificate chain
+// without verifying it, so expired or untrusted certificates can still be
+// reported; trust is evaluated separately against the system roots.
+func inspectGateway(gateway string, timeout time.Duration) (GatewayInfo, error) {
+	address := gatewayAddress(gateway)
+	host, _, _ := net.SplitHostPort(address)
+	info := GatewayInfo{Gateway: address}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return info, fmt.Errorf("failed to resolve gateway %s: %w", host, err)
+	}
+	info.Addresses = addrs
+
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: timeout},
+		Config:    &tls.Config{ServerName: host, InsecureSkipVerify: true},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return info, fmt.Errorf("failed to connect to gateway %s: %w", address, err)
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	info.TLSVersion = tls.VersionName(state.Version)
+	info.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+	if len(state.PeerCertificates) == 0 {
+		return info, errors.New("gateway presented no certificate")
+	}
+
+	now := time.Now()
+	for _, cert := range state.PeerCertificates {
+		info.Chain = append(info.Chain, describeCert(cert, now))
+	}
+
+	leaf := state.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Intermediates: intermediates}); err != nil {
+		info.TrustError = err.Error()
+	} else {
+		info.Trusted = true
+	}
+	return info, nil
+}
+
+func describeCert(cert *x509.Certificate, now time.Time) GatewayCert {
+	fingerprint := sha256.Sum256(cert.Raw)
+	publicKey := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return GatewayCert{
+		Subject:         cert.Subject.String(),
+		Issuer:          cert.Issuer.String(),
+		DNSNames:        cert.DNSNames,
+		NotBefore:       cert.NotBefore,
+		NotAfter:        cert.NotAfter,
+		DaysLeft:        int(cert.NotAfter.Sub(now).Hours() / 24),
+		SHA256:          hex.EncodeToString(fingerprint[:]),
+		PublicKeySHA256: hex.EncodeToString(publicKey[:]),
+	}
+}
+
+// gatewayWarnings flags certificates in the chain that expire within
+// warnDays, and an untrusted chain.
+func gatewayWarnings(info GatewayInfo, warnDays int) []string {
+	warnings := make([]string, 0)
+	if !info.Trusted {
+		warnings = append(warnings, "certificate chain is not trusted: "+info.TrustError)
+	}
+	for _, cert := range info.Chain {
+		switch {
+		case cert.DaysLeft < 0:
+			warnings = append(warnings, fmt.Sprintf("certificate %q expired on %s", cert.Subject, cert.NotAfter.Format("2006-01-02")))
+		case cert.DaysLeft < warnDays:
+			warnings = append(warnings, fmt.Sprintf("certificate %q expires in %d days (%s)", cert.Subject, cert.DaysLeft, cert.NotAfter.Format("2006-01-02")))
+		}
+	}
+	return warnings
+}
+
+// configuredGateway returns the gateway configured for the selected (or
+// active) connection.
+func configuredGateway(connectionArg string, cfg Config) (string, string, error) {
+	tunnels, err := getConnections()
+	if err != nil {
+		return "", "", err
+	}
+	selection, err := resolveSelection(connectionArg, tunnels, cfg)
+	if err != nil {
+		return "", "", err
+	}
+	connection := selection.Primary().ConnectionName
+	if state, err := getTunnelState(); err == nil {
+		if active, ok := selection.ActiveMember(state); ok {
+			connection = active.ConnectionName
+		}
+	}
+	gateway := cfg.forConnection(connection).Gateway
+	if gateway == "" {
+		return connection, "", fmt.Errorf("no gateway configured for %q (set \"gateway\" under connections or pass --gateway)", connection)
+	}
+	return connection, gateway, nil
+}
+
+func runGatewayInfo(args []string) int {
+	fs := flag.NewFlagSet("gateway-info", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	connectionArg := fs.String("connection", "", "VPN connection or group name, e.g. prod/int.")
+	gatewayArg := fs.String("gateway", "", "Inspect this gateway (host[:port]) instead of the configured one.")
+	warnDays := fs.Float64("warn-days", defaultGatewayCertWarnDays, "Warn when a certificate expires within this many days.")
+	timeoutSec := fs.Float64("timeout", 10, "Resolve and TLS handshake timeout in seconds.")
+	trust := fs.Bool("trust", false, "Remember the presented key as the trusted one for TOFU pinning.")
+	asJSON := outputFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	connection := ""
+	gateway := strings.TrimSpace(*gatewayArg)
+	if gateway == "" {
+		if connection, gateway, err = configuredGateway(*connectionArg, cfg); err != nil {
+			return fail(err)
+		}
+	}
+	settings := cfg.forConnection(connection)
+	days := int(flagOrSetting(fs, "warn-days", *warnDays, settings.GatewayCertWarnDays))
+
+	info, err := inspectGateway(gateway, seconds(*timeoutSec))
+	if err != nil {
+		return fail(err)
+	}
+	info.Connection = connection
+	info.Warnings = gatewayWarnings(info, days)
+	if settings.GatewayPinning != nil {
+		info.Pin = "ok"
+		if err := matchGatewayPin(info, *settings.GatewayPinning, *trust); err != nil {
+			info.Pin = "mismatch"
+			info.Warnings = append(info.Warnings, err.Error())
+		}
+	}
+
+	if *asJSON {
+		if code := printJSON(info); code != 0 {
+			return code
+		}
+	} else {
+		printGatewayInfo(info)
+	}
+	if len(info.Warnings) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printGatewayInfo(info GatewayInfo) {
+	if info.Connection != "" {
+		fmt.Println(msg("gateway.connection", info.Connection))
+	}
+	fmt.Println(msg("gateway.address", info.Gateway))
+	fmt.Println(msg("gateway.resolved", strings.Join(info.Addresses, ", ")))
+	fmt.Println(msg("gateway.tls", info.TLSVersion, info.CipherSuite))
+	if info.Pin == "ok" {
+		fmt.Println(msg("gateway.pin_ok"))
+	}
+	if info.Trusted {
+		fmt.Println(msg("gateway.trusted"))
+	} else {
+		fmt.Println(msg("gateway.untrusted", info.TrustError))
+	}
+	for i, cert := range info.Chain {
+		fmt.Println(msg("gateway.cert", i, cert.Subject))
+		fmt.Println(msg("gateway.cert_issuer", cert.Issuer))
+		if len(cert.DNSNames) > 0 {
+			fmt.Println(msg("gateway.cert_names", strings.Join(cert.DNSNames, ", ")))
+		}
+		fmt.Println(msg("gateway.cert_validity", cert.NotBefore.Format("2006-01-02"), cert.NotAfter.Format("2006-01-02"), cert.DaysLeft))
+		fmt.Println(msg("gateway.cert_sha256", cert.SHA256))
+		fmt.Println(msg("gateway.cert_key_sha256", cert.PublicKeySHA256))
+	}
+	for _, warning := range info.Warnings {
+		warnf("gateway.warning", warning)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Selection is what a --connection argument resolved to: a single
+// connection, or the members of a configured group in priority order.
+type Selection struct {
+	Group    string
+	Strategy string
+	Members  []Tunnel
+}
+
+const (
+	strategyPriority   = "priority"
+	strategyRoundRobin = "round-robin"
+	strategyLRU        = "lru"
+)
+
+// GroupConfig is either a plain list of members (tried in priority order)
+// or an object with members and a selection strategy.
+type GroupConfig struct {
+	Members  []string `json:"members"`
+	Strategy string   `json:"strategy,omitempty"`
+}
+
+func (g *GroupConfig) UnmarshalJSON(raw []byte) error {
+	var members []string
+	if err := json.Unmarshal(raw, &members); err == nil {
+		*g = GroupConfig{Members: members}
+		return nil
+	}
+
+	type plain GroupConfig
+	var decoded plain
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return err
+	}
+	*g = GroupConfig(decoded)
+	return nil
+}
+
+func normalizeStrategy(strategy string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(strategy)) {
+	case "", strategyPriority:
+		return strategyPriority, nil
+	case strategyRoundRobin, "roundrobin", "rr":
+		return strategyRoundRobin, nil
+	case strategyLRU, "least-recently-used":
+		return strategyLRU, nil
+	default:
+		return "", fmt.Errorf("unknown strategy %q (want priority, round-robin or lru)", strategy)
+	}
+}
+
+// resolveSelection picks what target names, falling back to the configured
+// default connection and then to the first tunnel when target is empty.
+func resolveSelection(target string, tunnels []Tunnel, cfg Config) (Selection, error) {
+	if strings.TrimSpace(target) == "" {
+		target = cfg.DefaultConnection
+	}
+	if group, groupConfig, ok := cfg.group(target); ok {
+		if len(groupConfig.Members) == 0 {
+			return Selection{}, fmt.Errorf("group %q has no members", group)
+		}
+		strategy, err := normalizeStrategy(groupConfig.Strategy)
+		if err != nil {
+			return Selection{}, fmt.Errorf("group %q: %w", group, err)
+		}
+		selection := Selection{Group: group, Strategy: strategy}
+		for _, member := range groupConfig.Members {
+			tunnel, err := resolveTunnel(member, tunnels)
+			if err != nil {
+				return Selection{}, fmt.Errorf("group %q: %w", group, err)
+			}
+			selection.Members = append(selection.Members, tunnel)
+		}
+		return selection, nil
+	}
+
+	tunnel, err := resolveTunnel(target, tunnels)
+	if err != nil {
+		return Selection{}, err
+	}
+	return Selection{Members: []Tunnel{tunnel}}, nil
+}
+
+// requireGroup resolves name to a configured group for --group, which,
+// unlike --connection, never falls back to a connection of that name.
+func (c Config) requireGroup(name string) (string, error) {
+	if group, _, ok := c.group(name); ok {
+		return group, nil
+	}
+	if len(c.Groups) == 0 {
+		return "", fmt.Errorf("group %q %w; no groups are configured", name, errNotFound)
+	}
+	names := make([]string, 0, len(c.Groups))
+	for group := range c.Groups {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+	return "", fmt.Errorf("group %q %w; configured: %s", name, errNotFound, strings.Join(names, ", "))
+}
+
+func (c Config) group(name string) (string, GroupConfig, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", GroupConfig{}, false
+	}
+	for key, group := range c.Groups {
+		if strings.EqualFold(key, name) {
+			return key, group, true
+		}
+	}
+	return "", GroupConfig{}, false
+}
+
+func (s Selection) Primary() Tunnel {
+	return s.Members[0]
+}
+
+func (s Selection) Label() string {
+	if s.Group != "" {
+		return s.Group
+	}
+	return s.Primary().ConnectionName
+}
+
+func (s Selection) Names() []string {
+	names := make([]string, 0, len(s.Members))
+	for _, member := range s.Members {
+		names = append(names, member.ConnectionName)
+	}
+	return names
+}
+
+func (s Selection) ActiveMember(state TunnelState) (Tunnel, bool) {
+	if !state.Connected() {
+		return Tunnel{}, false
+	}
+	for _, member := range s.Members {
+		if strings.EqualFold(state.CurrentConnection(), member.ConnectionName) {
+			return member, true
+		}
+	}
+	return Tunnel{}, false
+}
+
+func (s Selection) Status(state TunnelState) Status {
+	var status Status
+	if s.Group == "" {
+		status = buildStatus(state, s.Primary().ConnectionName)
+	} else {
+		status = buildStatusAny(state, s.Names())
+		status.Group = s.Group
+	}
+	return status
+}
+
+func (c Config) validateGroups() error {
+	for name, group := range c.Groups {
+		if strings.TrimSpace(name) == "" {
+			return errors.New("groups: empty group name")
+		}
+		if len(group.Members) == 0 {
+			return fmt.Errorf("groups.%s: needs at least one member", name)
+		}
+		if _, err := normalizeStrategy(group.Strategy); err != nil {
+			return fmt.Errorf("groups.%s: %w", name, err)
+		}
+		for i, member := range group.Members {
+			if strings.TrimSpace(member) == "" {
+				return fmt.Errorf("groups.%s[%d]: empty member name", name, i)
+			}
+		}
+	}
+	return nil
+}
+
+// AttemptOrder returns the members in the order they should be tried, as
+// decided by the group strategy and the recorded usage.
+func (s Selection) AttemptOrder() []Tunnel {
+	if s.Group == "" || s.Strategy == strategyPriority || len(s.Members) < 2 {
+		return s.Members
+	}
+	state, err := loadState()
+	if err != nil {
+		return s.Members
+	}
+	usage := state.Groups[s.Group]
+
+	ordered := make([]Tunnel, 0, len(s.Members))
+	switch s.Strategy {
+	case strategyRoundRobin:
+		next := 0
+		for i, member := range s.Members {
+			if strings.EqualFold(member.ConnectionName, usage.LastMember) {
+				next = i + 1
+				break
+			}
+		}
+		for i := range s.Members {
+			ordered = append(ordered, s.Members[(next+i)%len(s.Members)])
+		}
+	case strategyLRU:
+		ordered = append(ordered, s.Members...)
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return usage.LastUsed[ordered[i].ConnectionName] < usage.LastUsed[ordered[j].ConnectionName]
+		})
+	}
+	return ordered
+}
+
+// RecordUse remembers which member was brought up so the next attempt can
+// rotate away from it.
+func (s Selection) RecordUse(member Tunnel) {
+	if s.Group == "" {
+		return
+	}
+	state, err := loadState()
+	if err != nil {
+		return
+	}
+	if state.Groups == nil {
+		state.Groups = map[string]GroupState{}
+	}
+	usage := state.Groups[s.Group]
+	if usage.LastUsed == nil {
+		usage.LastUsed = map[string]int64{}
+	}
+	usage.LastMember = member.ConnectionName
+	usage.LastUsed[member.ConnectionName] = time.Now().UnixNano()
+	state.Groups[s.Group] = usage
+	if err := saveState(state); err != nil {
+		warnf("group.record_failed", err)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// bridgeGRPCAddress, when set (bridge_grpc in the config or
+// FORTIVPN_BRIDGE_GRPC), sends every bridge call to a bridge already
+// serving gRPC there, typically a privileged helper, instead of starting
+// one. "unix:///path" is a Unix socket, anything else host:port.
+var bridgeGRPCAddress string
+
+// bridgeGRPCToken is the secret the gRPC bridge was started with
+// (bridge_grpc_token in the config, best kept encrypted, or
+// FORTIVPN_BRIDGE_GRPC_TOKEN); every call presents it.
+var bridgeGRPCToken string
+
+const (
+	// bridgeGRPCMethod is Bridge.Call from proto/fortivpn_bridge.proto.
+	bridgeGRPCMethod = "/fortivpn.bridge.v1.Bridge/Call"
+	// grpcDialTimeout keeps an unreachable helper from hanging a command
+	// even when the bridge timeout is disabled.
+	grpcDialTimeout = 5 * time.Second
+)
+
+// callBridgeGRPC makes one unary Bridge.Call over cleartext HTTP/2 and
+// returns the bridge response it carries. The messages are two string
+// fields each, so they are encoded by hand instead of pulling in a gRPC
+// library.
+func callBridgeGRPC(action string, payload any) ([]byte, error) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	message := appendProtoString(nil, 1, action)
+	message = appendProtoString(message, 2, string(payloadJSON))
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	frame = append(frame, message...)
+
+	network, address := "tcp", bridgeGRPCAddress
+	if path, ok := strings.CutPrefix(bridgeGRPCAddress, "unix://"); ok {
+		network, address = "unix", path
+	}
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{
+		Protocols: protocols,
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			dialer := net.Dialer{Timeout: grpcDialTimeout}
+			return dialer.DialContext(ctx, network, address)
+		},
+	}}
+	defer client.CloseIdleConnections()
+
+	ctx, cancel := bridgeContext()
+	defer cancel()
+	host := "localhost"
+	if network == "tcp" {
+		host = address
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+host+bridgeGRPCMethod, bytes.NewReader(frame))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("Authorization", "Bearer "+bridgeGRPCToken)
+	resp, err := client.Do(req)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	var body []byte
+	if err == nil {
+		body, err = io.ReadAll(resp.Body)
+	}
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return nil, bridgeTimeoutError(action)
+	case ctx.Err() == context.Canceled:
+		return nil, errCanceled
+	case err != nil:
+		return nil, fmt.Errorf("bridge gRPC call to %s failed: %w", bridgeGRPCAddress, err)
+	}
+
+	// A trailers-only response carries the status in the headers.
+	status := firstNonEmpty(resp.Trailer.Get("Grpc-Status"), resp.Header.Get("Grpc-Status"))
+	if status == "16" {
+		return nil, fmt.Errorf("the gRPC bridge at %s refused the call: set bridge_grpc_token (or FORTIVPN_BRIDGE_GRPC_TOKEN) to the token it was started with", bridgeGRPCAddress)
+	}
+	if status != "0" {
+		message := firstNonEmpty(resp.Trailer.Get("Grpc-Message"), resp.Header.Get("Grpc-Message"), resp.Status)
+		return nil, fmt.Errorf("bridge gRPC call failed with status %s: %s", firstNonEmpty(status, "unknown"), message)
+	}
+	if len(body) < 5 || body[0] != 0 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+		return nil, errors.New("invalid bridge gRPC response frame")
+	}
+	response, err := protoString(body[5:], 1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bridge gRPC response: %w", err)
+	}
+	return []byte(response), nil
+}
+
+func appendProtoString(b []byte, field int, value string) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+// protoString returns the string field number field of a protobuf message,
+// skipping any others.
+func protoString(b []byte, field int) (string, error) {
+	var value string
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return "", errors.New("bad field key")
+		}
+		b = b[n:]
+		switch key & 7 {
+		case 0:
+			if _, n = binary.Uvarint(b); n <= 0 {
+				return "", errors.New("bad varint")
+			}
+			b = b[n:]
+		case 1, 5:
+			size := 8
+			if key&7 == 5 {
+				size = 4
+			}
+			if len(b) < size {
+				return "", io.ErrUnexpectedEOF
+			}
+			b = b[size:]
+		case 2:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				return "", io.ErrUnexpectedEOF
+			}
+			if int(key>>3) == field {
+				value = string(b[n : n+int(length)])
+			}
+			b = b[n+int(length):]
+		default:
+			return "", fmt.Errorf("unsupported wire type %d", key&7)
+		}
+	}
+	return value, nil
+}
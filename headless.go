@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+var errHeadless = errors.New("no GUI session")
+
+var headless *bool
+
+// headlessSession reports whether this process runs outside the logged-in
+// user's GUI session (SSH, CI agents), where FortiClient cannot be
+// launched. launchctl names the session "Aqua" only inside the GUI.
+// FORTIVPN_HEADLESS=1 or 0 overrides the detection.
+func headlessSession() bool {
+	if headless != nil {
+		return *headless
+	}
+	result := false
+	if value := strings.TrimSpace(os.Getenv("FORTIVPN_HEADLESS")); value != "" {
+		result = value != "0" && value != "false"
+	} else if runtime.GOOS == "darwin" {
+		out, err := exec.Command("launchctl", "managername").Output()
+		result = err == nil && strings.TrimSpace(string(out)) != "Aqua"
+	}
+	headless = &result
+	return result
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+type HealthComponent struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+type HealthReport struct {
+	OK         bool              `json:"ok"`
+	Summary    string            `json:"summary"`
+	Connection string            `json:"connection,omitempty"`
+	Components []HealthComponent `json:"components"`
+	Checks     []CheckResult     `json:"checks,omitempty"`
+	CheckedAt  int64             `json:"checked_at"`
+}
+
+func runHealthcheck(args []string) int {
+	fs := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	connectionArg := fs.String("connection", "", "Require this connection or group to be the active one.")
+	dnsHost := fs.String("dns-host", "", "Host name that must resolve while connected.")
+	asJSON := outputFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	state, err := getTunnelState()
+	if err != nil {
+		return fail(err)
+	}
+
+	report := HealthReport{CheckedAt: time.Now().Unix(), Connection: state.CurrentConnection()}
+	tunnel := HealthComponent{Name: "tunnel", OK: state.Connected(), Detail: emptyAsUnknown(state.CurrentConnection())}
+	if strings.TrimSpace(*connectionArg) != "" {
+		tunnels, err := getConnections()
+		if err != nil {
+			return fail(err)
+		}
+		selection, err := resolveSelection(*connectionArg, tunnels, cfg)
+		if err != nil {
+			return fail(err)
+		}
+		if _, ok := selection.ActiveMember(state); !ok {
+			tunnel.OK = false
+			tunnel.Detail = fmt.Sprintf("want %s, have %s", selection.Label(), emptyAsUnknown(state.CurrentConnection()))
+		}
+	}
+	report.Components = append(report.Components, tunnel)
+	report.Components = append(report.Components, routeComponent(state))
+
+	settings := cfg.forConnection(state.CurrentConnection())
+	host := firstNonEmpty(*dnsHost, settings.HealthcheckDNSHost)
+	report.Components = append(report.Components, dnsComponent(host, state.Connected()))
+
+	probes := HealthComponent{Name: "checks", OK: true, Skipped: true, Detail: "none configured"}
+	if !state.Connected() {
+		probes.Detail = "not connected"
+	} else if len(settings.Checks) > 0 {
+		report.Checks = runChecks(settings.Checks)
+		passed := 0
+		for _, result := range report.Checks {
+			if result.OK {
+				passed++
+			}
+		}
+		probes = HealthComponent{Name: "checks", OK: passed == len(report.Checks), Detail: fmt.Sprintf("%d/%d passed", passed, len(report.Checks))}
+	}
+	report.Components = append(report.Components, probes)
+
+	report.OK = true
+	parts := make([]string, 0, len(report.Components))
+	for _, component := range report.Components {
+		outcome := "ok"
+		switch {
+		case component.Skipped:
+			outcome = "skip"
+		case !component.OK:
+			outcome = "fail"
+			report.OK = false
+		}
+		parts = append(parts, component.Name+"="+outcome)
+	}
+	report.Summary = strings.Join(parts, " ")
+
+	if *asJSON {
+		if code := printJSON(report); code != 0 {
+			return code
+		}
+	} else {
+		verdict := "HEALTHY"
+		if !report.OK {
+			verdict = "UNHEALTHY"
+		}
+		fmt.Printf("%s %s\n", verdict, report.Summary)
+		for _, component := range report.Components {
+			if !component.OK && component.Detail != "" {
+				fmt.Printf("  %s: %s\n", component.Name, component.Detail)
+			}
+		}
+		for _, result := range report.Checks {
+			if !result.OK {
+				fmt.Printf("  check %s: %s\n", result.Name, result.Error)
+			}
+		}
+	}
+
+	if report.OK {
+		return 0
+	}
+	return 1
+}
+
+func routeComponent(state TunnelState) HealthComponent {
+	component := HealthComponent{Name: "routes"}
+	if !state.Connected() {
+		component.Detail = "not connected"
+		return component
+	}
+	info, err := detectTunnel()
+	if err != nil {
+		component.Detail = err.Error()
+		return component
+	}
+	if info == nil {
+		component.Detail = "no tunnel interface with a routable address"
+		return component
+	}
+	routes := info.IPv4Routes + info.IPv6Routes
+	component.OK = routes > 0
+	component.Detail = fmt.Sprintf("%s: %d ipv4 / %d ipv6 routes", info.Interface, info.IPv4Routes, info.IPv6Routes)
+	return component
+}
+
+func dnsComponent(host string, connected bool) HealthComponent {
+	component := HealthComponent{Name: "dns", OK: true, Skipped: true, Detail: "no dns host configured"}
+	if host == "" {
+		return component
+	}
+	if !connected {
+		return HealthComponent{Name: "dns", Detail: "not connected"}
+	}
+	detail, err := probeDNS(host, "", "any", defaultCheckTimeout)
+	if err != nil {
+		return HealthComponent{Name: "dns", Detail: err.Error()}
+	}
+	return HealthComponent{Name: "dns", OK: true, Detail: host + " -> " + detail}
+}
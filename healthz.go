@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// watchHealth is the watcher's state as exposed on --healthz. All methods
+// are safe on a nil receiver so the loop can call them unconditionally.
+type watchHealth struct {
+	mu        sync.Mutex
+	target    string
+	staleness time.Duration
+	started   time.Time
+	status    Status
+	lastPoll  time.Time
+	lastEvent time.Time
+	message   string
+}
+
+type healthzResponse struct {
+	Healthy           bool    `json:"healthy"`
+	State             string  `json:"state"`
+	Connected         bool    `json:"connected"`
+	Target            string  `json:"target"`
+	CurrentConnection string  `json:"current_connection"`
+	LastEvent         string  `json:"last_event,omitempty"`
+	LastEventAgeSec   float64 `json:"last_event_age_sec"`
+	LastPollAgeSec    float64 `json:"last_poll_age_sec"`
+	UptimeSec         float64 `json:"uptime_sec"`
+}
+
+func newWatchHealth(target string, staleness time.Duration) *watchHealth {
+	now := time.Now()
+	return &watchHealth{target: target, staleness: staleness, started: now, lastEvent: now, message: "watch started"}
+}
+
+func (h *watchHealth) observe(status Status) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status = status
+	h.lastPoll = time.Now()
+}
+
+func (h *watchHealth) event(message string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastEvent = time.Now()
+	h.message = message
+}
+
+func (h *watchHealth) snapshot() healthzResponse {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	pollAge := now.Sub(h.started)
+	if !h.lastPoll.IsZero() {
+		pollAge = now.Sub(h.lastPoll)
+	}
+	return healthzResponse{
+		Healthy:           h.status.Connected && pollAge <= h.staleness,
+		State:             h.status.State,
+		Connected:         h.status.Connected,
+		Target:            h.target,
+		CurrentConnection: h.status.CurrentConnection,
+		LastEvent:         redact(h.message),
+		LastEventAgeSec:   now.Sub(h.lastEvent).Seconds(),
+		LastPollAgeSec:    pollAge.Seconds(),
+		UptimeSec:         now.Sub(h.started).Seconds(),
+	}
+}
+
+func (h *watchHealth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	snapshot := h.snapshot()
+	w.Header().Set("Content-Type", "application/json")
+	if !snapshot.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(snapshot)
+}
+
+// serveHealthz starts the listener in the background; it answers 200 while
+// the tunnel is up and the loop is polling, 503 otherwise.
+func serveHealthz(addr string, health *watchHealth) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", health)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	return nil
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	eventConnected     = "connected"
+	eventConnectFailed = "connect_failed"
+	eventDisconnected  = "disconnected"
+	eventDropped       = "dropped"
+	eventAnnotation    = "annotation"
+	eventFailover      = "failover"
+)
+
+// HistoryEvent is one line of the session journal.
+type HistoryEvent struct {
+	At         time.Time `json:"at"`
+	Event      string    `json:"event"`
+	Connection string    `json:"connection,omitempty"`
+	Source     string    `json:"source"`
+	DurationMS int64     `json:"duration_ms,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Tags       []string  `json:"tags,omitempty"`
+	Note       string    `json:"note,omitempty"`
+}
+
+// SessionTags are the labels given to the current session with connect
+// --tag; every event recorded for that connection carries them until the
+// session is ended by a disconnect or a connect to something else.
+type SessionTags struct {
+	Connection string   `json:"connection"`
+	Tags       []string `json:"tags"`
+}
+
+func (e HistoryEvent) hasTag(tag string) bool {
+	for _, t := range e.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func historyPath() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.jsonl"), nil
+}
+
+// recordEvent appends to the journal. Failing to record never fails the
+// command; it only prints a warning.
+func recordEvent(event HistoryEvent) {
+	if err := appendHistoryWithSession(event); err != nil {
+		warnf("history.record_failed", err)
+	}
+}
+
+func appendHistoryWithSession(event HistoryEvent) error {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+	event.Reason = redact(event.Reason)
+	event.Note = redact(event.Note)
+	if state, err := loadState(); err == nil && state.Session != nil && strings.EqualFold(state.Session.Connection, event.Connection) {
+		event.Tags = mergeTags(state.Session.Tags, event.Tags)
+	}
+	return appendHistory(event)
+}
+
+// startSession replaces the session tags; no tags ends the previous ones.
+func startSession(connection string, tags []string) {
+	state, err := loadState()
+	if err != nil {
+		return
+	}
+	state.Session = nil
+	if len(tags) > 0 {
+		state.Session = &SessionTags{Connection: connection, Tags: mergeTags(nil, tags)}
+	}
+	if err := saveState(state); err != nil {
+		warnf("history.record_failed", err)
+	}
+}
+
+func mergeTags(base, extra []string) []string {
+	merged := make([]string, 0, len(base)+len(extra))
+	for _, tag := range append(append([]string{}, base...), extra...) {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || slices.ContainsFunc(merged, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			continue
+		}
+		merged = append(merged, tag)
+	}
+	return merged
+}
+
+func appendHistory(event HistoryEvent) error {
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(body, '\n'))
+	return err
+}
+
+func loadHistory(since time.Time) ([]HistoryEvent, error) {
+	path, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	defer file.Close()
+
+	events := make([]HistoryEvent, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var event HistoryEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			continue
+		}
+		if event.At.Before(since) {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+// parseSince accepts a look-back like 30d, 12h or 90m (any Go duration
+// works too) or an absolute date in YYYY-MM-DD or RFC 3339 form.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if strings.HasSuffix(value, "d") || strings.HasSuffix(value, "w") {
+		n, err := strconv.Atoi(value[:len(value)-1])
+		if err == nil && n >= 0 {
+			days := n
+			if strings.HasSuffix(value, "w") {
+				days *= 7
+			}
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q (use e.g. 30d, 12h or 2024-05-01)", value)
+}
+
+func runAnnotate(args []string) int {
+	fs := flag.NewFlagSet("annotate", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	var tags stringList
+	fs.Var(&tags, "tag", "Label for the annotation; repeat for several.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	note := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if note == "" {
+		fmt.Fprintln(os.Stderr, msg("error", msg("annotate.needs_note")))
+		return 2
+	}
+
+	event := HistoryEvent{Event: eventAnnotation, Source: "annotate", Note: note, Tags: tags}
+	if state, err := getTunnelState(); err == nil && state.Connected() {
+		event.Connection = state.CurrentConnection()
+	}
+	if err := appendHistoryWithSession(event); err != nil {
+		return fail(err)
+	}
+	fmt.Println(msg("annotate.recorded", emptyAsUnknown(event.Connection)))
+	return 0
+}
+
+// HistoryEntry is a journal event as `fortivpn history` shows it. Session
+// is how long the tunnel had been up when a disconnect or drop ended it.
+type HistoryEntry struct {
+	HistoryEvent
+	SessionMS int64 `json:"session_ms,omitempty"`
+}
+
+func runHistory(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	sinceArg := fs.String("since", "7d", "Only events after this, e.g. 1d, 12h or 2024-05-01; empty for all.")
+	connection := fs.String("connection", "", "Only events for connections whose name contains this.")
+	tag := fs.String("tag", "", "Only events of sessions tagged with this label.")
+	limit := fs.Int("limit", 0, "Only the last N matching events (0 for all).")
+	asJSON := outputFlags(fs, "csv", "tsv")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	since, err := parseSince(*sinceArg, time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, msg("error", err))
+		return 2
+	}
+
+	// Load everything so a session that started before the window still
+	// gets its length.
+	events, err := loadHistory(time.Time{})
+	if err != nil {
+		return fail(err)
+	}
+	upSince := map[string]time.Time{}
+	entries := make([]HistoryEntry, 0)
+	for _, event := range events {
+		entry := HistoryEntry{HistoryEvent: event}
+		key := strings.ToLower(event.Connection)
+		switch event.Event {
+		case eventConnected, eventFailover:
+			if _, up := upSince[key]; !up {
+				upSince[key] = event.At
+			}
+		case eventDisconnected, eventDropped:
+			if start, up := upSince[key]; up {
+				entry.SessionMS = event.At.Sub(start).Milliseconds()
+				delete(upSince, key)
+			}
+		}
+		if event.At.Before(since) ||
+			(*connection != "" && !strings.Contains(strings.ToLower(event.Connection), strings.ToLower(*connection))) ||
+			(*tag != "" && !event.hasTag(*tag)) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if *limit > 0 && len(entries) > *limit {
+		entries = entries[len(entries)-*limit:]
+	}
+
+	if *asJSON {
+		return printJSON(entries)
+	}
+	if csvOutput() {
+		return printCSV(entries)
+	}
+	if len(entries) == 0 {
+		fmt.Println(msg("history.none"))
+		return 0
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, msg("history.header"))
+	for _, entry := range entries {
+		duration := ""
+		switch {
+		case entry.SessionMS > 0:
+			duration = "up " + historyDuration(entry.SessionMS)
+		case entry.DurationMS > 0:
+			duration = historyDuration(entry.DurationMS)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", entry.At.Local().Format("2006-01-02 15:04:05"), entry.Event, emptyAsUnknown(entry.Connection), firstNonEmpty(duration, "-"), firstNonEmpty(entry.Reason, entry.Note, entry.Source))
+	}
+	w.Flush()
+	return 0
+}
+
+func historyDuration(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	if d < time.Minute {
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+func runHooks(event, connection string, commands []string) {
+	for _, command := range commands {
+		cmd := exec.Command("/bin/sh", "-c", command)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(),
+			"FORTIVPN_EVENT="+event,
+			"FORTIVPN_CONNECTION="+connection,
+		)
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintln(os.Stderr, msg("warning", redact(msg("hook.failed", event, command, err))))
+		}
+	}
+}
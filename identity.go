@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultFortiClientLogDir = "/Library/Application Support/Fortinet/FortiClient/Logs"
+	logTailBytes             = 512 * 1024
+)
+
+type Identity struct {
+	Connection string `json:"connection"`
+	User       string `json:"user,omitempty"`
+	AuthMethod string `json:"auth_method,omitempty"`
+	Source     string `json:"source,omitempty"`
+}
+
+var (
+	identityUserKey = regexp.MustCompile(`(?i)^(user|username|user_name|login|login_name|account|saml_user)$`)
+	identityAuthKey = regexp.MustCompile(`(?i)^(auth|auth_method|auth_type|authentication|login_type)$`)
+	logUserPattern  = regexp.MustCompile(`(?i)\buser(?:name)?\s*[=:]\s*"?([^"\s,;]+)`)
+)
+
+// bridgeIdentity looks for user and auth fields anywhere in what the bridge
+// reports for the current session.
+func bridgeIdentity(connection string) (string, string) {
+	raw, err := bridgeDetails("get-identity", connection)
+	if err != nil {
+		return "", ""
+	}
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return "", ""
+	}
+	user, auth := "", ""
+	walkJSON(doc, func(key string, value string) {
+		switch {
+		case user == "" && identityUserKey.MatchString(key):
+			user = value
+		case auth == "" && identityAuthKey.MatchString(key):
+			auth = value
+		case auth == "" && key == "saml_vpn_name":
+			auth = "saml"
+		}
+	})
+	return user, normalizeAuthMethod(auth)
+}
+
+func walkJSON(v any, visit func(key, value string)) {
+	switch node := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(node))
+		for key := range node {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if s, ok := node[key].(string); ok && strings.TrimSpace(s) != "" {
+				visit(key, strings.TrimSpace(s))
+				continue
+			}
+			walkJSON(node[key], visit)
+		}
+	case []any:
+		for _, item := range node {
+			walkJSON(item, visit)
+		}
+	}
+}
+
+// logIdentity scans the tail of the most recently written FortiClient log
+// for the last line that names a user.
+func logIdentity() (string, string) {
+	dir := firstNonEmpty(os.Getenv("FORTIVPN_LOG_DIR"), defaultFortiClientLogDir)
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	sort.Slice(paths, func(i, j int) bool { return modTime(paths[i]) > modTime(paths[j]) })
+	for _, path := range paths {
+		lines := tailLines(path, logTailBytes)
+		for i := len(lines) - 1; i >= 0; i-- {
+			if match := logUserPattern.FindStringSubmatch(lines[i]); match != nil {
+				return match[1], normalizeAuthMethod(lines[i])
+			}
+		}
+	}
+	return "", ""
+}
+
+func modTime(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.ModTime().UnixNano()
+}
+
+func tailLines(path string, limit int64) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	if info, err := file.Stat(); err == nil && info.Size() > limit {
+		if _, err := file.Seek(-limit, io.SeekEnd); err != nil {
+			return nil
+		}
+	}
+	raw, err := io.ReadAll(file)
+	if err != nil {
+		return nil
+	}
+	return strings.Split(string(raw), "\n")
+}
+
+func normalizeAuthMethod(text string) string {
+	lower := strings.ToLower(text)
+	switch {
+	case strings.Contains(lower, "saml"):
+		return "saml"
+	case strings.Contains(lower, "ldap"):
+		return "ldap"
+	case strings.Contains(lower, "radius"):
+		return "radius"
+	case strings.Contains(lower, "cert"):
+		return "certificate"
+	case strings.Contains(lower, "local"), strings.Contains(lower, "password"):
+		return "local"
+	}
+	return ""
+}
+
+func runWhoami(args []string) int {
+	fs := flag.NewFlagSet("whoami", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	asJSON := outputFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	state, err := getTunnelState()
+	if err != nil {
+		return fail(err)
+	}
+	if !state.Connected() {
+		fmt.Fprintln(os.Stderr, msg("error", msg("whoami.not_connected")))
+		return 1
+	}
+
+	identity := Identity{Connection: state.CurrentConnection()}
+	if user, auth := bridgeIdentity(identity.Connection); user != "" {
+		identity.User, identity.AuthMethod, identity.Source = user, auth, "bridge"
+	} else if user, logAuth := logIdentity(); user != "" {
+		identity.User, identity.AuthMethod, identity.Source = user, firstNonEmpty(auth, logAuth), "log"
+	} else {
+		identity.AuthMethod = auth
+	}
+
+	if *asJSON {
+		if code := printJSON(identity); code != 0 {
+			return code
+		}
+	} else {
+		fmt.Println(msg("status.current", identity.Connection))
+		fmt.Println(msg("whoami.user", emptyAsUnknown(identity.User)))
+		fmt.Println(msg("whoami.auth", emptyAsUnknown(identity.AuthMethod)))
+		if identity.Source != "" {
+			fmt.Println(msg("whoami.source", identity.Source))
+		}
+	}
+	if identity.User == "" {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IPReport is the addressing of the current tunnel: what the tunnel
+// interface was given, where the gateway is, and which public address the
+// internet sees traffic come from.
+type IPReport struct {
+	Connection       string      `json:"connection,omitempty"`
+	Connected        bool        `json:"connected"`
+	Tunnel           *TunnelInfo `json:"tunnel,omitempty"`
+	Gateway          string      `json:"gateway,omitempty"`
+	GatewayAddresses []string    `json:"gateway_addresses,omitempty"`
+	Egress           *EgressInfo `json:"egress,omitempty"`
+}
+
+// EgressInfo is the public IP as an echo service reports it, and the
+// interface the request to that service was routed through.
+type EgressInfo struct {
+	IP        string `json:"ip,omitempty"`
+	URL       string `json:"url"`
+	Interface string `json:"interface,omitempty"`
+	ViaTunnel bool   `json:"via_tunnel"`
+	Error     string `json:"error,omitempty"`
+}
+
+func runIP(args []string) int {
+	fs := flag.NewFlagSet("ip", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	connectionArg := fs.String("connection", "", "Report the gateway of this connection when none is active.")
+	egressURL := fs.String("url", defaultEgressURL, "Service that answers with the caller's public IP in plain text.")
+	noEgress := fs.Bool("no-egress", false, "Do not ask for the public egress IP.")
+	timeoutSec := fs.Float64("timeout", 5, "Timeout in seconds for the egress query.")
+	asJSON := outputFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	state, err := getTunnelState()
+	if err != nil {
+		return fail(err)
+	}
+	report := IPReport{Connected: state.Connected(), Connection: state.CurrentConnection()}
+	if report.Connected {
+		if report.Tunnel, err = detectTunnel(); err != nil {
+			return fail(err)
+		}
+	}
+	if tunnels, err := getConnections(); err == nil {
+		if report.Connection == "" {
+			if selection, err := resolveSelection(*connectionArg, tunnels, cfg); err == nil {
+				report.Connection = selection.Primary().ConnectionName
+			}
+		}
+		detail := ConnectionDetail{ConnectionName: report.Connection}
+		detail.fillProfile(readConnectionProfiles(), cfg)
+		if detail.Gateway != "" {
+			report.Gateway = net.JoinHostPort(detail.Gateway, strconv.Itoa(detail.Port))
+			if ips, err := net.LookupIP(detail.Gateway); err == nil {
+				for _, ip := range ips {
+					report.GatewayAddresses = append(report.GatewayAddresses, ip.String())
+				}
+			}
+		}
+	}
+	if !*noEgress {
+		report.Egress = queryEgress(*egressURL, report.Tunnel, seconds(*timeoutSec))
+	}
+
+	if *asJSON {
+		if code := printJSON(report); code != 0 {
+			return code
+		}
+	} else {
+		printIPReport(report)
+	}
+	if !report.Connected {
+		return 1
+	}
+	return 0
+}
+
+func queryEgress(rawURL string, tunnel *TunnelInfo, timeout time.Duration) *EgressInfo {
+	egress := &EgressInfo{URL: rawURL}
+	if parsed, err := url.Parse(rawURL); err == nil && parsed.Hostname() != "" {
+		if ips, err := net.LookupIP(parsed.Hostname()); err == nil && len(ips) > 0 {
+			if iface, err := routeInterface(ips[0]); err == nil {
+				egress.Interface = iface
+				egress.ViaTunnel = tunnel != nil && iface == tunnel.Interface
+			}
+		}
+	}
+	ip, err := egressIP(rawURL, timeout)
+	if err != nil {
+		egress.Error = err.Error()
+		return egress
+	}
+	egress.IP = ip.String()
+	return egress
+}
+
+func printIPReport(report IPReport) {
+	if report.Connected {
+		fmt.Println(msg("status.current", report.Connection))
+	} else {
+		fmt.Println(msg("ip.not_connected"))
+	}
+	if report.Tunnel != nil {
+		printTunnelInfo(report.Tunnel)
+	}
+	if report.Gateway != "" {
+		addresses := strings.Join(report.GatewayAddresses, ", ")
+		fmt.Println(msg("ip.gateway", report.Gateway, firstNonEmpty(addresses, "unresolved")))
+	} else if report.Connection != "" {
+		fmt.Println(msg("ip.no_gateway", report.Connection))
+	}
+	switch egress := report.Egress; {
+	case egress == nil:
+	case egress.Error != "":
+		fmt.Println(msg("ip.egress_failed", egress.URL, egress.Error))
+	case egress.ViaTunnel:
+		fmt.Println(msg("ip.egress_tunnel", egress.IP, egress.Interface))
+	default:
+		fmt.Println(msg("ip.egress_outside", egress.IP, firstNonEmpty(egress.Interface, "unknown interface")))
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	latencyActionLog      = "log"
+	latencyActionRebounce = "rebounce"
+	latencyActionFailover = "failover"
+)
+
+type LatencyConfig struct {
+	Target      string  `json:"target"`
+	ThresholdMS int64   `json:"threshold_ms,omitempty"`
+	LossPercent float64 `json:"loss_percent,omitempty"`
+	Samples     int     `json:"samples,omitempty"`
+	Sustain     float64 `json:"sustain,omitempty"`
+	Action      string  `json:"action,omitempty"`
+}
+
+type LatencySample struct {
+	AvgMS       int64   `json:"avg_ms"`
+	MaxMS       int64   `json:"max_ms"`
+	LossPercent float64 `json:"loss_percent"`
+}
+
+func (c LatencyConfig) validate() error {
+	if _, _, err := net.SplitHostPort(c.Target); err != nil {
+		return fmt.Errorf("target must be host:port: %w", err)
+	}
+	if c.ThresholdMS <= 0 && c.LossPercent <= 0 {
+		return errors.New("set threshold_ms and/or loss_percent")
+	}
+	if c.LossPercent < 0 || c.LossPercent > 100 {
+		return errors.New("loss_percent must be between 0 and 100")
+	}
+	if c.Samples < 0 || c.Sustain < 0 {
+		return errors.New("samples and sustain must not be negative")
+	}
+	switch strings.ToLower(c.Action) {
+	case "", latencyActionLog, latencyActionRebounce, latencyActionFailover:
+		return nil
+	default:
+		return fmt.Errorf("unknown action %q (want log, rebounce or failover)", c.Action)
+	}
+}
+
+func (c LatencyConfig) action() string {
+	if c.Action == "" {
+		return latencyActionLog
+	}
+	return strings.ToLower(c.Action)
+}
+
+func (c LatencyConfig) sustain() time.Duration {
+	if c.Sustain <= 0 {
+		return 60 * time.Second
+	}
+	return seconds(c.Sustain)
+}
+
+// measureLatency times TCP handshakes to the target; failed or timed-out
+// handshakes count as loss.
+func measureLatency(cfg LatencyConfig) LatencySample {
+	samples := cfg.Samples
+	if samples <= 0 {
+		samples = 3
+	}
+	timeout := 2 * time.Second
+	if cfg.ThresholdMS > 0 {
+		timeout = max(timeout, 4*time.Duration(cfg.ThresholdMS)*time.Millisecond)
+	}
+
+	var total, worst time.Duration
+	lost := 0
+	for range samples {
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", cfg.Target, timeout)
+		if err != nil {
+			lost++
+			continue
+		}
+		rtt := time.Since(start)
+		conn.Close()
+		total += rtt
+		worst = max(worst, rtt)
+	}
+
+	sample := LatencySample{
+		MaxMS:       worst.Milliseconds(),
+		LossPercent: float64(lost) * 100 / float64(samples),
+	}
+	if received := samples - lost; received > 0 {
+		sample.AvgMS = (total / time.Duration(received)).Milliseconds()
+	}
+	return sample
+}
+
+func (c LatencyConfig) degraded(sample LatencySample) bool {
+	if c.LossPercent > 0 && sample.LossPercent >= c.LossPercent {
+		return true
+	}
+	if sample.LossPercent >= 100 {
+		return true
+	}
+	return c.ThresholdMS > 0 && sample.AvgMS > c.ThresholdMS
+}
+
+// latencyMonitor tracks how long the link has been degraded and says when
+// the configured action is due.
+type latencyMonitor struct {
+	cfg           LatencyConfig
+	degradedSince time.Time
+	reported      bool
+}
+
+// The transitions observe reports, named as watch's events; the configured
+// action is due on latencyDegraded.
+const (
+	latencyDegraded  = "latency_degraded"
+	latencyRecovered = "latency_recovered"
+)
+
+// observe returns the transition sample makes, if any, and a line
+// describing it.
+func (m *latencyMonitor) observe(sample LatencySample, at time.Time) (transition, event string) {
+	if !m.cfg.degraded(sample) {
+		wasReported := m.reported
+		m.degradedSince = time.Time{}
+		m.reported = false
+		if wasReported {
+			return latencyRecovered, fmt.Sprintf("latency recovered rtt=%dms loss=%.0f%%", sample.AvgMS, sample.LossPercent)
+		}
+		return "", ""
+	}
+
+	if m.degradedSince.IsZero() {
+		m.degradedSince = at
+	}
+	if m.reported || at.Sub(m.degradedSince) < m.cfg.sustain() {
+		return "", ""
+	}
+	m.reported = true
+	return latencyDegraded, fmt.Sprintf("latency degraded rtt=%dms max=%dms loss=%.0f%% for %s target=%s", sample.AvgMS, sample.MaxMS, sample.LossPercent, at.Sub(m.degradedSince).Round(time.Second), m.cfg.Target)
+}
+
+func (m *latencyMonitor) reset() {
+	m.degradedSince = time.Time{}
+	m.reported = false
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// logAttemptPattern marks the start of a connection attempt in FortiClient's
+// logs; `logs --attempt` prints from the last such line.
+var logAttemptPattern = regexp.MustCompile(`(?i)(connecting to|connect(ion)? request|start(ing)? (the )?(ssl ?vpn|ipsec|vpn|tunnel)|saml (login|auth)|begin(ning)? connect)`)
+
+// fortiClientLogFiles lists FortiClient's log files, oldest first.
+func fortiClientLogFiles() ([]string, error) {
+	dirs := []string{defaultFortiClientLogDir}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, defaultFortiClientLogDir))
+	}
+	if dir := strings.TrimSpace(os.Getenv("FORTIVPN_LOG_DIR")); dir != "" {
+		dirs = []string{dir}
+	}
+	var paths []string
+	for _, dir := range dirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+		paths = append(paths, matches...)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%w: no FortiClient logs in %s; set FORTIVPN_LOG_DIR to where they are", errNotFound, strings.Join(dirs, ", "))
+	}
+	sort.Slice(paths, func(i, j int) bool { return modTime(paths[i]) < modTime(paths[j]) })
+	return paths, nil
+}
+
+type logFilter struct {
+	connection string
+}
+
+func (f logFilter) match(line string) bool {
+	return strings.TrimSpace(line) != "" && (f.connection == "" || strings.Contains(strings.ToLower(line), strings.ToLower(f.connection)))
+}
+
+func runLogs(args []string) int {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	lines := fs.Int("lines", 50, "Lines to print from the end of each log (0 for all that was read).")
+	follow := fs.Bool("follow", false, "Keep printing lines as they are written.")
+	attempt := fs.Bool("attempt", false, "Start at the last connection attempt instead of --lines from the end.")
+	connectionArg := fs.String("connection", "", "Only lines that mention this connection.")
+	fileArg := fs.String("file", "", "Only logs whose name matches this pattern, e.g. sslvpn*.")
+	list := fs.Bool("list", false, "List the log files instead of printing them.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	paths, err := fortiClientLogFiles()
+	if err != nil {
+		return fail(err)
+	}
+	if *fileArg != "" {
+		paths = slices.DeleteFunc(paths, func(path string) bool {
+			ok, _ := filepath.Match(*fileArg, filepath.Base(path))
+			return !ok
+		})
+		if len(paths) == 0 {
+			return fail(fmt.Errorf("%w: no FortiClient log matches %q", errNotFound, *fileArg))
+		}
+	}
+	if *list {
+		for _, path := range paths {
+			if info, err := os.Stat(path); err == nil {
+				fmt.Printf("%s\t%d\t%s\n", info.ModTime().Format(time.RFC3339), info.Size(), path)
+			}
+		}
+		return 0
+	}
+
+	// The name is matched as written, without asking the backend, so the
+	// logs stay readable when FortiClient is what is broken.
+	filter := logFilter{connection: strings.TrimSpace(*connectionArg)}
+	offsets := make(map[string]int64, len(paths))
+	for _, path := range paths {
+		tail := tailLines(path, logTailBytes)
+		if *attempt {
+			tail = sinceLastAttempt(tail, filter)
+		}
+		var matched []string
+		for _, line := range tail {
+			if filter.match(line) {
+				matched = append(matched, line)
+			}
+		}
+		if !*attempt && *lines > 0 && len(matched) > *lines {
+			matched = matched[len(matched)-*lines:]
+		}
+		printLogLines(path, matched, len(paths) > 1)
+		if info, err := os.Stat(path); err == nil {
+			offsets[path] = info.Size()
+		}
+	}
+	if !*follow {
+		return 0
+	}
+	return followLogs(paths, offsets, filter, len(paths) > 1)
+}
+
+// sinceLastAttempt drops everything before the last line that starts a
+// connection attempt, for the wanted connection when there is one.
+func sinceLastAttempt(lines []string, filter logFilter) []string {
+	for i := len(lines) - 1; i >= 0; i-- {
+		if logAttemptPattern.MatchString(lines[i]) && filter.match(lines[i]) {
+			return lines[i:]
+		}
+	}
+	return nil
+}
+
+func printLogLines(path string, lines []string, prefix bool) {
+	for _, line := range lines {
+		line = redact(strings.TrimRight(line, "\r"))
+		if prefix {
+			fmt.Printf("%s: %s\n", filepath.Base(path), line)
+		} else {
+			fmt.Println(line)
+		}
+	}
+}
+
+// followLogs polls the logs for growth, starting over at the beginning of
+// a file that shrank because FortiClient rotated it, until interrupted.
+func followLogs(paths []string, offsets map[string]int64, filter logFilter, prefix bool) int {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	partial := map[string]string{}
+	for {
+		select {
+		case <-interrupted.Done():
+			return 130
+		case <-ticker.C:
+		}
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			if info.Size() < offsets[path] {
+				offsets[path], partial[path] = 0, ""
+			}
+			if info.Size() == offsets[path] {
+				continue
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			_, err = file.Seek(offsets[path], io.SeekStart)
+			var raw []byte
+			if err == nil {
+				raw, err = io.ReadAll(file)
+			}
+			file.Close()
+			if err != nil {
+				continue
+			}
+			offsets[path] += int64(len(raw))
+			text := partial[path] + string(raw)
+			complete := strings.Split(text, "\n")
+			partial[path] = complete[len(complete)-1]
+			var matched []string
+			for _, line := range complete[:len(complete)-1] {
+				if filter.match(line) {
+					matched = append(matched, line)
+				}
+			}
+			printLogLines(path, matched, prefix)
+		}
+	}
+}
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 )
 
@@ -28,25 +34,155 @@ type TunnelState struct {
 }
 
 type Status struct {
-	State              string `json:"state"`
-	Connected          bool   `json:"connected"`
-	CurrentConnection  string `json:"current_connection"`
-	SelectedConnection string `json:"selected_connection,omitempty"`
-	CheckedAt          int64  `json:"checked_at"`
+	State              string              `json:"state"`
+	Connected          bool                `json:"connected"`
+	CurrentConnection  string              `json:"current_connection"`
+	SelectedConnection string              `json:"selected_connection,omitempty"`
+	Group              string              `json:"group,omitempty"`
+	CheckedAt          int64               `json:"checked_at"`
+	Tunnel             *TunnelInfo         `json:"tunnel,omitempty"`
+	Checks             []CheckResult       `json:"checks,omitempty"`
+	Candidates         []Candidate         `json:"candidates,omitempty"`
+	Expectations       []ExpectationResult `json:"expectations,omitempty"`
+	UpgradePending     string              `json:"upgrade_pending,omitempty"`
+	Lock               *DisconnectLock     `json:"lock,omitempty"`
+	Timings            *Timings            `json:"timings,omitempty"`
+}
+
+type Candidate struct {
+	Connection string `json:"connection"`
+	Active     bool   `json:"active"`
 }
 
 type bridgeResponse struct {
-	OK     bool            `json:"ok"`
-	Result json.RawMessage `json:"result"`
-	Error  string          `json:"error"`
+	OK        bool            `json:"ok"`
+	Protocol  int             `json:"protocol"`
+	Result    json.RawMessage `json:"result"`
+	Error     string          `json:"error"`
+	ErrorCode string          `json:"error_code,omitempty"`
 }
 
 func main() {
-	code := run(os.Args[1:])
+	handleSignals()
+	code := runRecovered(os.Args[1:])
 	os.Exit(code)
 }
 
 func run(args []string) int {
+	if cfg, err := loadPlainConfig(); err == nil {
+		for i, value := range cfg.Redaction.Values {
+			cfg.Redaction.Values[i] = revealSetting(value)
+		}
+		configureRedaction(cfg.Redaction)
+		configureLocale(revealSetting(cfg.Locale))
+		configuredNodePath = revealSetting(cfg.NodePath)
+		configuredWindowsBinary = revealSetting(cfg.WSLWindowsBinary)
+		configuredBackend = revealSetting(cfg.Backend)
+		configuredForticliPath = revealSetting(cfg.ForticliPath)
+		bridgeDaemonEnabled = cfg.BridgeDaemon
+		bridgeGRPCAddress = revealSetting(cfg.BridgeGRPC)
+		bridgeGRPCToken = revealSetting(cfg.BridgeGRPCToken)
+		if cfg.StateCacheTTL != nil {
+			readCache.ttl = seconds(*cfg.StateCacheTTL)
+		}
+		if cfg.BridgeTimeout > 0 {
+			bridgeTimeout = seconds(cfg.BridgeTimeout)
+		}
+	}
+	if address := strings.TrimSpace(os.Getenv("FORTIVPN_BRIDGE_GRPC")); address != "" {
+		bridgeGRPCAddress = address
+	}
+	if token := strings.TrimSpace(os.Getenv("FORTIVPN_BRIDGE_GRPC_TOKEN")); token != "" {
+		bridgeGRPCToken = token
+	}
+	addSensitiveValue(bridgeGRPCToken)
+	if daemon := strings.TrimSpace(os.Getenv("FORTIVPN_BRIDGE_DAEMON")); daemon != "" {
+		bridgeDaemonEnabled = daemon != "0" && daemon != "false"
+	}
+	if backend := strings.TrimSpace(os.Getenv("FORTIVPN_BACKEND")); backend != "" {
+		configuredBackend = backend
+	}
+	if node := strings.TrimSpace(os.Getenv("FORTIVPN_NODE")); node != "" {
+		configuredNodePath = node
+	}
+	debugBridge := strings.TrimSpace(os.Getenv("FORTIVPN_DEBUG_BRIDGE"))
+	args = stripQuiet(args)
+	if quiet {
+		if null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+			stdout := os.Stdout
+			os.Stdout = null
+			defer func() {
+				os.Stdout = stdout
+				null.Close()
+			}()
+		}
+	}
+	for len(args) > 0 {
+		name, value, hasValue := strings.Cut(args[0], "=")
+		if name == "--debug-bridge" {
+			// The file is optional, so it has to be given with "=".
+			debugBridge = firstNonEmpty(value, "-")
+			args = args[1:]
+			continue
+		}
+		if name != "--backend" && name != "--bridge-timeout" && name != "--node-path" && name != "--record" && name != "--replay" {
+			break
+		}
+		if !hasValue {
+			if len(args) < 2 {
+				printUsage()
+				return 2
+			}
+			value, args = args[1], args[1:]
+		}
+		args = args[1:]
+		switch name {
+		case "--backend":
+			configuredBackend = value
+		case "--node-path":
+			configuredNodePath = value
+		case "--record":
+			closeRecording, err := openBridgeRecording(value)
+			if err != nil {
+				return fail(err)
+			}
+			defer closeRecording()
+		case "--replay":
+			if err := openBridgeReplay(value); err != nil {
+				return fail(err)
+			}
+		case "--bridge-timeout":
+			sec, err := strconv.ParseFloat(value, 64)
+			if err != nil || sec < 0 {
+				fmt.Fprintln(os.Stderr, msg("error", msg("bridge.invalid_timeout", value)))
+				return 2
+			}
+			bridgeTimeout = seconds(sec)
+		}
+	}
+	backend, err := normalizeBackend(configuredBackend)
+	if err != nil {
+		return fail(err)
+	}
+	// Only bridge calls are recorded; other backends would leave the file
+	// silently empty.
+	if _, bridged := activeBackend().(bridgeBackend); bridgeRecording != nil && !bridged {
+		if backend == backendAuto {
+			backend = backendName(activeBackend())
+		}
+		return fail(fmt.Errorf("--record only covers the bridge backends (node, electron), not %s", backend))
+	}
+	if debugBridge != "" {
+		closeTrace, err := openBridgeTrace(debugBridge)
+		if err != nil {
+			return fail(err)
+		}
+		defer closeTrace()
+	}
+	if code, proxied := proxyToWindows(args); proxied {
+		return code
+	}
+
 	if len(args) == 0 {
 		printUsage()
 		return 2
@@ -57,119 +193,464 @@ func run(args []string) int {
 		return runConnections(args[1:])
 	case "status":
 		return runStatus(args[1:])
+	case "prompt":
+		return runPrompt(args[1:])
+	case "tui":
+		return runTUI(args[1:])
 	case "connect":
 		return runConnect(args[1:])
+	case "up":
+		return runConnect(connectionAsFlag(args[1:]))
+	case "down":
+		return runDisconnect(args[1:])
+	case "show":
+		return runShow(args[1:])
+	case "set-default":
+		return runSetDefault(args[1:])
+	case "switch":
+		return runSwitch(args[1:])
 	case "disconnect":
 		return runDisconnect(args[1:])
 	case "watch":
 		return runWatch(args[1:])
+	case "check":
+		return runCheckCommand(args[1:])
+	case "config":
+		return runConfig(args[1:])
+	case "service":
+		return runService(args[1:])
+	case "healthcheck":
+		return runHealthcheck(args[1:])
+	case "verify":
+		return runVerify(args[1:])
+	case "history":
+		return runHistory(args[1:])
+	case "stats":
+		return runStats(args[1:])
+	case "report":
+		return runReport(args[1:])
+	case "gateway-info":
+		return runGatewayInfo(args[1:])
+	case "whoami":
+		return runWhoami(args[1:])
+	case "annotate":
+		return runAnnotate(args[1:])
+	case "proxy":
+		return runProxy(args[1:])
+	case "ip":
+		return runIP(args[1:])
+	case "ping":
+		return runPing(args[1:])
+	case "speedtest":
+		return runSpeedtest(args[1:])
+	case "dns":
+		return runDNS(args[1:])
+	case "split-tunnel":
+		return runSplitTunnel(args[1:])
+	case "simulate":
+		return runSimulate(args[1:])
+	case "app":
+		return runApp(args[1:])
+	case "bridge":
+		return runBridgeCommand(args[1:])
+	case "lock":
+		return runLock(args[1:])
+	case "unlock":
+		return runUnlock(args[1:])
+	case "logs":
+		return runLogs(args[1:])
+	case "run":
+		return runRun(args[1:])
+	case "man":
+		return runMan(args[1:])
+	case "completion":
+		return runCompletion(args[1:])
+	case "doctor":
+		return runDoctor(args[1:])
+	case "debug-bundle":
+		return runDebugBundle(args[1:])
+	case "version", "--version":
+		return runVersion(args[1:])
+	case "self-update":
+		return runSelfUpdate(args[1:])
 	case "help", "-h", "--help":
 		printUsage()
 		return 0
 	default:
-		fmt.Fprintf(os.Stderr, "error: unknown command %q\n\n", args[0])
+		fmt.Fprintf(os.Stderr, "%s\n\n", msg("error", msg("usage.unknown_command", args[0])))
 		printUsage()
 		return 2
 	}
 }
 
-func printUsage() {
-	fmt.Print(`fortivpn: FortiClient VPN helper CLI for macOS
+// quiet is set by -q/--quiet: stdout goes to /dev/null and warnings are
+// dropped, leaving errors and the exit code. realStdout is kept for what
+// fortivpn runs on the user's behalf, such as the command of `run`.
+var (
+	quiet      bool
+	realStdout = os.Stdout
+)
+
+// stripQuiet takes -q and --quiet out of the flags before the command and
+// those right after the command (or subcommand), so `fortivpn status -q`
+// works as well as `fortivpn -q status`. The first positional argument or
+// "--" ends the search, and the value of a flag that takes one is skipped,
+// so `--tag -q` and a child's `-q` are left alone. Which flags take a value
+// is looked up for the command path reached so far only: `self-update
+// --version TAG` does not make the global `--version -q` swallow the -q.
+func stripQuiet(args []string) []string {
+	usages := usageCommands()
+	usage := newCompletionModel()
+	kept := make([]string, 0, len(args))
+	var path []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+			continue
+		case arg == "--":
+			return append(kept, args[i:]...)
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			kept = append(kept, arg)
+			if takesValue(usages, path, arg) && i+1 < len(args) {
+				i++
+				kept = append(kept, args[i])
+			}
+		case len(path) == 0 || len(path) == 1 && slices.Contains(usage.subcommands[path[0]], arg):
+			path = append(path, arg)
+			kept = append(kept, arg)
+		default:
+			return append(kept, args[i:]...)
+		}
+	}
+	return kept
+}
 
-Usage:
-  fortivpn connections [--json]
-  fortivpn status [--connection NAME] [--json]
-  fortivpn connect [--connection NAME] [--timeout SEC] [--interval SEC] [--json]
-  fortivpn disconnect [--timeout SEC] [--interval SEC] [--json]
-  fortivpn watch [--connection NAME] [--timeout SEC] [--interval SEC]
-`)
+// takesValue reports whether flag takes an argument on the command at path
+// (the global flags when path is empty), counting the flags it inherits.
+func takesValue(usages []commandUsage, path []string, flag string) bool {
+	key := strings.Join(path, " ")
+	var inherits string
+	for _, usage := range usages {
+		if strings.Join(usage.Path, " ") != key {
+			continue
+		}
+		if _, ok := usage.Values[flag]; ok {
+			return true
+		}
+		inherits = firstNonEmpty(inherits, usage.Inherits)
+	}
+	if inherits == "" || inherits == key {
+		return false
+	}
+	return takesValue(usages, strings.Fields(inherits), flag)
+}
+
+func printUsage() {
+	fmt.Print(usageText)
 }
 
 func runConnections(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "export":
+			return runConnectionsExport(args[1:])
+		case "import":
+			return runConnectionsImport(args[1:])
+		case "add":
+			return runConnectionsAdd(args[1:])
+		case "remove":
+			return runConnectionsRemove(args[1:])
+		}
+	}
 	fs := flag.NewFlagSet("connections", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
-	asJSON := fs.Bool("json", false, "Emit JSON output.")
+	asJSON := outputFlags(fs, "csv", "tsv")
+	namesOnly := fs.Bool("names", false, "Print only the names, read from FortiClient's configuration when possible (no bridge call).")
+	maxAge := fs.Float64("max-age", 0, "Accept a cached answer up to this many seconds old, shared with concurrent callers.")
+	format := fs.String("format", "", "Print each connection with a Go template, e.g. '{{.ConnectionName}} {{.Type}}'.")
+	noHeader := fs.Bool("no-header", false, "Leave out the header row of the table.")
 	if err := fs.Parse(args); err != nil {
 		return 2
 	}
+	tmpl, ok := parseFormatFlag(*format, *asJSON || csvOutput())
+	if !ok {
+		return 2
+	}
+	statusCacheTTL = seconds(*maxAge)
+
+	if *namesOnly {
+		names, err := connectionNames()
+		if err != nil {
+			return fail(err)
+		}
+		if len(names) == 0 {
+			fmt.Println(msg("connections.none"))
+			return 1
+		}
+		if *asJSON {
+			return printJSON(names)
+		}
+		if csvOutput() {
+			rows := make([]struct {
+				ConnectionName string `json:"connection_name"`
+			}, len(names))
+			for i, name := range names {
+				rows[i].ConnectionName = name
+			}
+			return printCSV(rows)
+		}
+		if tmpl != nil {
+			return printFormat(tmpl, names)
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return 0
+	}
 
 	tunnels, err := getConnections()
 	if err != nil {
 		return fail(err)
 	}
 	if len(tunnels) == 0 {
-		fmt.Println("No FortiClient VPN connections found.")
+		fmt.Println(msg("connections.none"))
 		return 1
 	}
 
+	// The list itself does not need the config; without a valid one only
+	// the gateways set there and the default are missing.
+	cfg, err := loadConfig()
+	if err != nil {
+		warnf("connections.config_invalid", err)
+		cfg = Config{}
+	}
+	details := newConnectionDetails(tunnels, tunnels, cfg)
+	if state, err := getTunnelState(); err == nil && state.Connected() {
+		for i := range details {
+			details[i].Active = strings.EqualFold(state.CurrentConnection(), details[i].ConnectionName)
+		}
+	}
+
 	if *asJSON {
-		return printJSON(tunnels)
+		return printJSON(details)
 	}
-	for _, tunnel := range tunnels {
-		fmt.Printf("%s [type=%s]\n", tunnel.ConnectionName, tunnel.Type)
+	if csvOutput() {
+		return printCSV(details)
+	}
+	if tmpl != nil {
+		return printFormat(tmpl, details)
 	}
+	rows := make([][]string, 0, len(details))
+	for _, detail := range details {
+		gateway := "-"
+		if detail.Gateway != "" {
+			gateway = net.JoinHostPort(detail.Gateway, strconv.Itoa(detail.Port))
+		}
+		rows = append(rows, []string{detail.ConnectionName, detail.Type, yesNo(detail.Default), yesNo(detail.Corporate), yesNo(detail.CloudVPN), gateway})
+	}
+	// Only the name and the gateway can get long.
+	printTable(msg("connections.header"), rows, !*noHeader, 0, 5)
 	return 0
 }
 
 func runStatus(args []string) int {
 	fs := flag.NewFlagSet("status", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
-	connectionArg := fs.String("connection", "", "VPN connection name, e.g. prod/int.")
-	asJSON := fs.Bool("json", false, "Emit JSON output.")
+	var connectionArgs stringList
+	fs.Var(&connectionArgs, "connection", "VPN connection name, e.g. prod/int; repeat to accept any of several.")
+	asJSON := outputFlags(fs)
+	maxAge := fs.Float64("max-age", 0, "Accept a cached answer up to this many seconds old, shared with concurrent callers.")
+	follow := fs.Bool("follow", false, "Keep running and print the status again every time it changes.")
+	intervalSec := fs.Float64("interval", 2, "Polling interval in seconds for --follow.")
+	format := fs.String("format", "", "Print the status with a Go template, e.g. '{{.State}} {{.CurrentConnection}}'.")
 	if err := fs.Parse(args); err != nil {
 		return 2
 	}
+	tmpl, ok := parseFormatFlag(*format, *asJSON)
+	if !ok {
+		return 2
+	}
+	statusCacheTTL = seconds(*maxAge)
 
-	tunnels, err := getConnections()
+	cfg, err := loadConfig()
 	if err != nil {
 		return fail(err)
 	}
 
-	selectedName := ""
-	if strings.TrimSpace(*connectionArg) != "" {
-		tunnel, err := resolveTunnel(*connectionArg, tunnels)
+	if len(connectionArgs) == 0 && cfg.DefaultConnection != "" {
+		connectionArgs = stringList{cfg.DefaultConnection}
+	}
+	group := ""
+	selectedNames := make([]string, 0, len(connectionArgs))
+	var tunnels []Tunnel
+	for _, arg := range connectionArgs {
+		if strings.TrimSpace(arg) == "" {
+			continue
+		}
+		if tunnels == nil {
+			if tunnels, err = getConnections(); err != nil {
+				return fail(err)
+			}
+		}
+		selection, err := resolveSelection(arg, tunnels, cfg)
 		if err != nil {
 			return fail(err)
 		}
-		selectedName = tunnel.ConnectionName
+		if len(connectionArgs) == 1 {
+			group = selection.Group
+		}
+		for _, name := range selection.Names() {
+			if !slices.Contains(selectedNames, name) {
+				selectedNames = append(selectedNames, name)
+			}
+		}
 	}
 
-	state, err := getTunnelState()
+	snapshot := func() (Status, error) {
+		state, err := getTunnelState()
+		if err != nil {
+			return Status{}, err
+		}
+		status := buildStatusAny(state, selectedNames)
+		status.Group = group
+		if reason, pending := pendingUpgrade(nil, cfg.Upgrade.Markers); pending {
+			status.UpgradePending = reason
+		}
+		status.Lock = activeLock()
+		if state.Connected() {
+			if tunnel, err := detectTunnel(); err == nil {
+				status.Tunnel = tunnel
+			}
+		}
+		return status, nil
+	}
+	if *follow {
+		return followStatus(snapshot, seconds(*intervalSec), *asJSON, tmpl)
+	}
+
+	status, err := snapshot()
 	if err != nil {
 		return fail(err)
 	}
-
-	status := buildStatus(state, selectedName)
+	if *asJSON || tmpl != nil {
+		status.Timings = currentTimings()
+	}
 	if *asJSON {
 		if code := printJSON(status); code != 0 {
 			return code
 		}
+	} else if tmpl != nil {
+		if code := printFormat(tmpl, status); code != 0 {
+			return code
+		}
 	} else {
-		fmt.Printf("state: %s\n", status.State)
-		fmt.Printf("current connection: %s\n", emptyAsUnknown(status.CurrentConnection))
+		fmt.Println(msg("status.state", status.State))
+		fmt.Println(msg("status.current", emptyAsUnknown(status.CurrentConnection)))
+		if status.Group != "" {
+			fmt.Println(msg("status.group", status.Group))
+		}
 		if status.SelectedConnection != "" {
-			fmt.Printf("selected connection: %s\n", status.SelectedConnection)
+			fmt.Println(msg("status.selected", status.SelectedConnection))
+		}
+		for _, candidate := range status.Candidates {
+			fmt.Printf("  %s: %s\n", candidate.Connection, connectedLabel(candidate.Active))
+		}
+		printTunnelInfo(status.Tunnel)
+		if status.Lock != nil {
+			fmt.Println(msg("status.lock", status.Lock.describe()))
+		}
+		if status.UpgradePending != "" {
+			warnf("upgrade.pending", status.UpgradePending)
 		}
 	}
 
 	if status.Connected {
 		return 0
 	}
+	if status.State == stateConnectedOther {
+		return 5
+	}
 	return 1
 }
 
+// connectionAsFlag turns the NAME of `up NAME` into --connection NAME so the
+// alias shares connect's flags.
+func connectionAsFlag(args []string) []string {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		return append([]string{"--connection", args[0]}, args[1:]...)
+	}
+	return args
+}
+
 func runConnect(args []string) int {
 	fs := flag.NewFlagSet("connect", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
-	connectionArg := fs.String("connection", "", "VPN connection name, e.g. prod/int.")
-	asJSON := fs.Bool("json", false, "Emit JSON output.")
-	timeoutSec := fs.Float64("timeout", 20, "Wait timeout in seconds.")
+	connectionArg := fs.String("connection", "", "VPN connection or group name, e.g. prod/int.")
+	groupArg := fs.String("group", "", "Configured group to connect; members are tried in order until one succeeds.")
+	asJSON := outputFlags(fs)
+	timeoutSec := fs.Float64("timeout", 20, "Wait timeout in seconds (0 waits indefinitely).")
 	intervalSec := fs.Float64("interval", 1, "Polling interval in seconds.")
+	verify := fs.Bool("verify", false, "Run configured health checks after connecting.")
+	dismissDialogs := fs.Bool("dismiss-dialogs", false, "Dismiss known transient FortiClient error dialogs and retry.")
+	showProgress := fs.Bool("progress", false, "With --json, emit NDJSON progress events before the final status.")
+	strict := fs.Bool("strict", false, "Refuse to connect when the gateway certificate does not match its pin.")
+	force := fs.Bool("force", false, "Switch connections even while the disconnect lock is armed.")
+	yes := fs.Bool("yes", false, "Disconnect a different active connection without asking.")
+	noInput := fs.Bool("no-input", false, "Never prompt; refuse to disconnect a different active connection unless --yes is given.")
+	precheck := fs.Bool("precheck", false, "TCP-probe the configured gateway first and fail fast when it is unreachable.")
+	noWait := fs.Bool("no-wait", false, "Fail instead of waiting when another connect or disconnect is in progress.")
+	format := fs.String("format", "", "Print the final status with a Go template, e.g. '{{.State}} {{.CurrentConnection}}'.")
+	var tags stringList
+	fs.Var(&tags, "tag", "Label the session in the history, e.g. incident-1234; repeat for several.")
 	if err := fs.Parse(args); err != nil {
 		return 2
 	}
+	tmpl, ok := parseFormatFlag(*format, *asJSON)
+	if !ok {
+		return 2
+	}
+	if *showProgress {
+		if !*asJSON || outputFormat != "json" {
+			fmt.Fprintln(os.Stderr, msg("error", msg("connect.progress_needs_json")))
+			return 2
+		}
+		progress = newProgressReporter(os.Stdout)
+	}
+	if *groupArg != "" && *connectionArg != "" {
+		fmt.Fprintln(os.Stderr, msg("error", msg("connect.group_and_connection")))
+		return 2
+	}
 
-	if err := ensureFortiClientRunning(5 * time.Second); err != nil {
+	start := time.Now()
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	if *groupArg != "" {
+		group, err := cfg.requireGroup(*groupArg)
+		if err != nil {
+			return fail(err)
+		}
+		*connectionArg = group
+	}
+	if *dismissDialogs {
+		cfg.Dialogs.Dismiss = true
+	}
+	operationNoWait = *noWait
+	release, err := acquireOperationLock("connect")
+	if err != nil {
+		return fail(err)
+	}
+	defer release()
+
+	launchWait := 5 * time.Second
+	if flagWasSet(fs, "timeout") && *timeoutSec > 0 {
+		launchWait = min(launchWait, seconds(*timeoutSec))
+	}
+	progress.step("launch", "ensuring the FortiClient app is running")
+	if err := ensureFortiClientRunning(launchWait); err != nil {
 		return fail(err)
 	}
 
@@ -177,102 +658,319 @@ func runConnect(args []string) int {
 	if err != nil {
 		return fail(err)
 	}
-	target, err := resolveTunnel(*connectionArg, tunnels)
+	selection, err := resolveSelection(*connectionArg, tunnels, cfg)
 	if err != nil {
 		return fail(err)
 	}
+	progress.step("resolve", "selected %s", selection.Label())
+	if _, err := verifyChecks(*verify, cfg.forConnection(selection.Primary().ConnectionName)); err != nil {
+		return fail(err)
+	}
 
 	currentState, err := getTunnelState()
 	if err != nil {
 		return fail(err)
 	}
-	if currentState.Connected() && strings.EqualFold(currentState.CurrentConnection(), target.ConnectionName) {
-		status := buildStatus(currentState, target.ConnectionName)
-		return printConnectResult(status, *asJSON)
+	if _, ok := selection.ActiveMember(currentState); currentState.Connected() && !ok {
+		if err := checkLock(fmt.Sprintf("switch away from %q", currentState.CurrentConnection()), *force); err != nil {
+			return fail(err)
+		}
+		if err := confirmDisplace(currentState.CurrentConnection(), selection.Label(), *yes, *noInput); err != nil {
+			return fail(err)
+		}
+	}
+
+	var lastErr error
+	members := selection.AttemptOrder()
+	if active, ok := selection.ActiveMember(currentState); ok {
+		// Any member that is already up satisfies a group.
+		members = []Tunnel{active}
 	}
-	if currentState.Connected() && !strings.EqualFold(currentState.CurrentConnection(), target.ConnectionName) {
-		disconnectPayload := map[string]string{
-			"connection_name": currentState.CurrentConnection(),
-			"connection_type": currentState.ConnectionType(),
+	for i, target := range members {
+		settings := cfg.forConnection(target.ConnectionName)
+		attemptStart := start
+		if i > 0 {
+			attemptStart = time.Now()
 		}
-		if _, err := runBridge("disconnect", disconnectPayload); err != nil {
-			return fail(fmt.Errorf("failed to disconnect %q before switching to %q: %w", currentState.CurrentConnection(), target.ConnectionName, err))
+		deadline := deadlineAfter(attemptStart, seconds(flagOrSetting(fs, "timeout", *timeoutSec, settings.ConnectTimeout)))
+		interval := seconds(flagOrSetting(fs, "interval", *intervalSec, settings.PollInterval))
+
+		if !strings.EqualFold(currentState.CurrentConnection(), target.ConnectionName) {
+			if err := checkProxy(settings, cfg.ProxyCheck); err != nil {
+				lastErr = err
+				continue
+			}
+			if *precheck {
+				if settings.Gateway == "" {
+					warnf("connect.precheck_no_gateway", target.ConnectionName)
+				}
+				progress.step("precheck", "probing the gateway of %q", target.ConnectionName)
+				if err := precheckGateway(settings.Gateway, cfg.IPFamily, precheckTimeout); err != nil {
+					lastErr = err
+					recordEvent(HistoryEvent{Event: eventConnectFailed, Connection: target.ConnectionName, Source: "connect", Reason: err.Error()})
+					if i < len(members)-1 {
+						warnf("connect.trying_next", redact(err.Error()), members[i+1].ConnectionName)
+					}
+					continue
+				}
+			}
+			progress.step("gateway", "checking the gateway certificate of %q", target.ConnectionName)
+			if err := checkGatewayPin(settings); err != nil {
+				if pinRefuses(err, settings, *strict) {
+					lastErr = fmt.Errorf("refusing to connect %q: %w", target.ConnectionName, err)
+					recordEvent(HistoryEvent{Event: eventConnectFailed, Connection: target.ConnectionName, Source: "connect", Reason: err.Error()})
+					if i < len(members)-1 {
+						warnf("connect.trying_next", redact(lastErr.Error()), members[i+1].ConnectionName)
+					}
+					continue
+				}
+				warnf("gateway.pin", err)
+			}
 		}
 
-		afterDisconnect, err := waitForTunnelState("", false, seconds(*timeoutSec), seconds(*intervalSec))
+		finalState, err := connectTunnel(target, currentState, cfg, deadline, interval)
+		for retry := 0; err != nil && retry < cfg.Dialogs.retries() && dismissTransientDialog(err, cfg.Dialogs); retry++ {
+			retryState, stateErr := getTunnelState()
+			if stateErr != nil {
+				return fail(stateErr)
+			}
+			progress.step("retry", "dismissed a FortiClient dialog; retrying %q", target.ConnectionName)
+			// Retries share the attempt's deadline so --timeout stays an
+			// upper bound.
+			finalState, err = connectTunnel(target, retryState, cfg, deadline, interval)
+		}
+		if err != nil {
+			lastErr = err
+			recordEvent(HistoryEvent{Event: eventConnectFailed, Connection: target.ConnectionName, Source: "connect", Reason: err.Error()})
+			if i < len(members)-1 {
+				progress.step("failover", "%s; trying %q", err, members[i+1].ConnectionName)
+				warnf("connect.trying_next", redact(err.Error()), members[i+1].ConnectionName)
+				if currentState, err = getTunnelState(); err != nil {
+					return fail(err)
+				}
+			}
+			continue
+		}
+
+		switched := !strings.EqualFold(currentState.CurrentConnection(), target.ConnectionName)
+		if switched || len(tags) > 0 {
+			startSession(target.ConnectionName, tags)
+		}
+		if switched {
+			selection.RecordUse(target)
+			recordEvent(HistoryEvent{Event: eventConnected, Connection: target.ConnectionName, Source: "connect", DurationMS: time.Since(attemptStart).Milliseconds()})
+		}
+		status := selection.Status(finalState)
+		progress.step("connected", "%s", emptyAsUnknown(status.CurrentConnection))
+		checks, err := verifyChecks(*verify, settings)
 		if err != nil {
 			return fail(err)
 		}
-		if afterDisconnect.Connected() {
-			return fail(fmt.Errorf("failed to disconnect %q before switching to %q", currentState.CurrentConnection(), target.ConnectionName))
+		if len(checks) > 0 {
+			progress.step("verify", "running %d checks", len(checks))
+		}
+		verifyStart := time.Now()
+		if err := verifyStatus(&status, checks, deadline); err != nil {
+			return fail(err)
 		}
+		if status.Connected && len(settings.Expectations) > 0 {
+			progress.step("expectations", "evaluating %d expectations", len(settings.Expectations))
+			status.Expectations = evaluateExpectations(settings.Expectations)
+			reportExpectationViolations(status.Expectations)
+		}
+		timeVerify(verifyStart)
+		return printConnectResult(status, *asJSON, tmpl)
 	}
 
-	payload := map[string]string{
-		"connection_name": target.ConnectionName,
-		"connection_type": target.Type,
+	lastErr = withUpgradeReason(lastErr, cfg.Upgrade.Markers)
+	if selection.Group != "" {
+		return fail(fmt.Errorf("no member of group %q connected: %w", selection.Group, lastErr))
 	}
-	if _, err := runBridge("connect", payload); err != nil {
-		return fail(err)
+	return fail(lastErr)
+}
+
+// connectTunnel brings target up, first disconnecting any other active
+// connection. It is a no-op when target is already connected.
+func connectTunnel(target Tunnel, currentState TunnelState, cfg Config, deadline time.Time, interval time.Duration) (TunnelState, error) {
+	if currentState.Connected() && strings.EqualFold(currentState.CurrentConnection(), target.ConnectionName) {
+		return currentState, nil
+	}
+	if currentState.Connected() {
+		progress.step("disconnect", "disconnecting %q before switching to %q", currentState.CurrentConnection(), target.ConnectionName)
+		if err := disconnectTunnel(currentState); err != nil {
+			return TunnelState{}, fmt.Errorf("failed to disconnect %q before switching to %q: %w", currentState.CurrentConnection(), target.ConnectionName, err)
+		}
+
+		afterDisconnect, err := waitForTunnelState("", false, deadline, interval)
+		if err != nil {
+			return TunnelState{}, err
+		}
+		if afterDisconnect.Connected() {
+			return TunnelState{}, fmt.Errorf("failed to disconnect %q before switching to %q", currentState.CurrentConnection(), target.ConnectionName)
+		}
+		recordEvent(HistoryEvent{Event: eventDisconnected, Connection: currentState.CurrentConnection(), Source: "connect", Reason: "switched to " + target.ConnectionName})
+		runHooks("post_disconnect", currentState.CurrentConnection(), cfg.forConnection(currentState.CurrentConnection()).Hooks.PostDisconnect)
 	}
 
-	finalState, err := waitForTunnelState(target.ConnectionName, true, seconds(*timeoutSec), seconds(*intervalSec))
+	finalState, err := startConnect(target, deadline, interval)
 	if err != nil {
-		return fail(err)
+		return TunnelState{}, err
+	}
+	runHooks("post_connect", target.ConnectionName, cfg.forConnection(target.ConnectionName).Hooks.PostConnect)
+	return finalState, nil
+}
+
+func disconnectTunnel(state TunnelState) error {
+	release, err := acquireOperationLock("disconnect " + state.CurrentConnection())
+	if err != nil {
+		return err
+	}
+	defer release()
+	readCache.invalidate()
+	return activeBackend().Disconnect(state)
+}
+
+// preferOthers moves avoid to the end of the attempt order so a failover
+// tries the remaining members first.
+func preferOthers(members []Tunnel, avoid string) []Tunnel {
+	if avoid == "" {
+		return members
+	}
+	ordered := make([]Tunnel, 0, len(members))
+	var last []Tunnel
+	for _, member := range members {
+		if strings.EqualFold(member.ConnectionName, avoid) {
+			last = append(last, member)
+			continue
+		}
+		ordered = append(ordered, member)
 	}
+	return append(ordered, last...)
+}
 
-	status := buildStatus(finalState, target.ConnectionName)
-	return printConnectResult(status, *asJSON)
+// startConnect asks the backend to connect target and waits until it is up.
+func startConnect(target Tunnel, deadline time.Time, interval time.Duration) (TunnelState, error) {
+	progress.step("connect", "requesting %q", target.ConnectionName)
+	release, err := acquireOperationLock("connect " + target.ConnectionName)
+	if err != nil {
+		return TunnelState{}, err
+	}
+	defer release()
+	readCache.invalidate()
+	if err := activeBackend().Connect(target); err != nil {
+		return TunnelState{}, withDialogText(err)
+	}
+	progress.step("wait", "waiting for %q to come up", target.ConnectionName)
+	state, err := waitForTunnelState(target.ConnectionName, true, deadline, interval)
+	if err != nil {
+		return state, withDialogText(err)
+	}
+	return state, nil
 }
 
 func runDisconnect(args []string) int {
 	fs := flag.NewFlagSet("disconnect", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
-	asJSON := fs.Bool("json", false, "Emit JSON output.")
-	timeoutSec := fs.Float64("timeout", 10, "Wait timeout in seconds.")
+	asJSON := outputFlags(fs)
+	timeoutSec := fs.Float64("timeout", 10, "Wait timeout in seconds (0 waits indefinitely).")
 	intervalSec := fs.Float64("interval", 1, "Polling interval in seconds.")
+	force := fs.Bool("force", false, "Disconnect even while the disconnect lock is armed.")
+	noWait := fs.Bool("no-wait", false, "Fail instead of waiting when another connect or disconnect is in progress.")
+	connectionArg := fs.String("connection", "", "Only disconnect when this connection (or a member of this group) is the active one.")
 	if err := fs.Parse(args); err != nil {
 		return 2
 	}
+	operationNoWait = *noWait
+	release, err := acquireOperationLock("disconnect")
+	if err != nil {
+		return fail(err)
+	}
+	defer release()
+
+	var selection Selection
+	targeted := *connectionArg != ""
+	if targeted {
+		cfg, err := loadConfig()
+		if err != nil {
+			return fail(err)
+		}
+		tunnels, err := getConnections()
+		if err != nil {
+			return fail(err)
+		}
+		if selection, err = resolveSelection(*connectionArg, tunnels, cfg); err != nil {
+			return fail(err)
+		}
+	}
 
 	state, err := getTunnelState()
 	if err != nil {
 		return fail(err)
 	}
+	if _, ok := selection.ActiveMember(state); targeted && state.Connected() && !ok {
+		// Leave a tunnel the caller did not name alone.
+		status := selection.Status(state)
+		if *asJSON {
+			status.Timings = currentTimings()
+			if code := printJSON(status); code != 0 {
+				return code
+			}
+		} else {
+			fmt.Println(msg("status.state", status.State))
+			fmt.Println(msg("status.current", emptyAsUnknown(status.CurrentConnection)))
+			warnf("disconnect.other_active", state.CurrentConnection(), selection.Label())
+		}
+		return 5
+	}
 	if !state.Connected() {
 		status := buildStatus(state, "")
 		if *asJSON {
+			status.Timings = currentTimings()
 			if code := printJSON(status); code != 0 {
 				return code
 			}
 		} else {
-			fmt.Printf("state: %s\n", status.State)
-			fmt.Printf("current connection: %s\n", emptyAsUnknown(status.CurrentConnection))
+			fmt.Println(msg("status.state", status.State))
+			fmt.Println(msg("status.current", emptyAsUnknown(status.CurrentConnection)))
 		}
 		return 0
 	}
 
-	payload := map[string]string{
-		"connection_name": state.CurrentConnection(),
-		"connection_type": state.ConnectionType(),
+	if err := checkLock(fmt.Sprintf("disconnect %q", state.CurrentConnection()), *force); err != nil {
+		return fail(err)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
 	}
-	if _, err := runBridge("disconnect", payload); err != nil {
+	settings := cfg.forConnection(state.CurrentConnection())
+	deadline := deadlineAfter(time.Now(), seconds(flagOrSetting(fs, "timeout", *timeoutSec, settings.DisconnectTimeout)))
+	interval := seconds(flagOrSetting(fs, "interval", *intervalSec, settings.PollInterval))
+
+	if err := disconnectTunnel(state); err != nil {
 		return fail(err)
 	}
 
-	finalState, err := waitForTunnelState("", false, seconds(*timeoutSec), seconds(*intervalSec))
+	finalState, err := waitForTunnelState("", false, deadline, interval)
 	if err != nil {
 		return fail(err)
 	}
 	status := buildStatus(finalState, "")
+	if !status.Connected {
+		recordEvent(HistoryEvent{Event: eventDisconnected, Connection: state.CurrentConnection(), Source: "disconnect", Reason: "user disconnect"})
+		startSession("", nil)
+		runHooks("post_disconnect", state.CurrentConnection(), settings.Hooks.PostDisconnect)
+	}
 
 	if *asJSON {
+		status.Timings = currentTimings()
 		if code := printJSON(status); code != 0 {
 			return code
 		}
 	} else {
-		fmt.Printf("state: %s\n", status.State)
-		fmt.Printf("current connection: %s\n", emptyAsUnknown(status.CurrentConnection))
+		fmt.Println(msg("status.state", status.State))
+		fmt.Println(msg("status.current", emptyAsUnknown(status.CurrentConnection)))
 	}
 
 	if !status.Connected {
@@ -284,58 +982,320 @@ func runDisconnect(args []string) int {
 func runWatch(args []string) int {
 	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
-	connectionArg := fs.String("connection", "", "VPN connection name, e.g. prod/int.")
-	timeoutSec := fs.Float64("timeout", 20, "Reconnect wait timeout in seconds.")
+	connectionArg := fs.String("connection", "", "VPN connection or group name, e.g. prod/int.")
+	timeoutSec := fs.Float64("timeout", 20, "Reconnect wait timeout in seconds (0 waits indefinitely).")
 	intervalSec := fs.Float64("interval", 5, "Polling interval in seconds.")
+	verify := fs.Bool("verify", false, "Run configured health checks while connected.")
+	healthzAddr := fs.String("healthz", "", "Serve watcher health over HTTP on this address, e.g. :9123.")
+	dismissDialogs := fs.Bool("dismiss-dialogs", false, "Dismiss known transient FortiClient error dialogs between attempts.")
+	strict := fs.Bool("strict", false, "Refuse to reconnect when the gateway certificate does not match its pin.")
+	restartApp := fs.Bool("restart-app", false, "Restart FortiClient while disconnected when a pending upgrade blocks reconnects.")
+	once := fs.Bool("once", false, "Check and reconnect once, then exit (for cron or launchd).")
+	fs.BoolVar(&watchJSON, "json", false, "Print one JSON object per event (NDJSON) instead of log lines.")
 	if err := fs.Parse(args); err != nil {
 		return 2
 	}
+	if *once && *healthzAddr != "" {
+		fmt.Fprintln(os.Stderr, msg("error", "--once and --healthz cannot be combined"))
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	if *dismissDialogs {
+		cfg.Dialogs.Dismiss = true
+	}
+	if *restartApp {
+		cfg.Upgrade.RestartApp = true
+	}
 
 	tunnels, err := getConnections()
 	if err != nil {
 		return fail(err)
 	}
-	target, err := resolveTunnel(*connectionArg, tunnels)
+	selection, err := resolveSelection(*connectionArg, tunnels, cfg)
 	if err != nil {
 		return fail(err)
 	}
 
-	interval := seconds(*intervalSec)
+	settings := cfg.forConnection(selection.Primary().ConnectionName)
+	var backup Tunnel
+	if settings.Fallback != nil {
+		if backup, err = resolveTunnel(settings.Fallback.Connection, tunnels); err != nil {
+			return fail(fmt.Errorf("fallback: %w", err))
+		}
+	}
+	// Every connection watch may end up on needs checks for --verify, so
+	// a bad setup fails now instead of silently checking nothing later.
+	for _, name := range append(selection.Names(), backup.ConnectionName) {
+		if name == "" {
+			continue
+		}
+		if _, err := verifyChecks(*verify, cfg.forConnection(name)); err != nil {
+			return fail(fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	interval := seconds(flagOrSetting(fs, "interval", *intervalSec, settings.WatchInterval))
 	if interval <= 0 {
 		interval = 1 * time.Second
 	}
-	timeout := seconds(*timeoutSec)
-	fmt.Printf("Watching %q. interval=%s reconnect-timeout=%s\n", target.ConnectionName, interval, timeout)
+	timeout := seconds(flagOrSetting(fs, "timeout", *timeoutSec, settings.ConnectTimeout))
+	if *once {
+		return watchOnce(selection, cfg, settings, backup, timeout, interval, *verify, *strict)
+	}
+	var health *watchHealth
+	if *healthzAddr != "" {
+		staleness := 3*interval + max(timeout, 30*time.Second)
+		health = newWatchHealth(selection.Label(), staleness)
+		if err := serveHealthz(*healthzAddr, health); err != nil {
+			return fail(err)
+		}
+	}
+	event := func(e WatchEvent, format string, args ...any) {
+		watchLog(e, format, args...)
+		health.event(fmt.Sprintf(format, args...))
+	}
+
+	start := WatchEvent{Type: "start", Connection: selection.Label()}
+	message := msg("watch.single", selection.Label(), interval, timeout)
+	if selection.Group != "" {
+		start = WatchEvent{Type: "start", Group: selection.Group}
+		message = msg("watch.group", selection.Group, strings.Join(selection.Names(), ", "), interval, timeout)
+	}
+	if watchJSON {
+		watchLog(start, "%s", message)
+	} else {
+		fmt.Println(message)
+	}
 
 	lastStatus := ""
+	lastChecks := ""
+	lastActive := ""
+	avoidMember := ""
+	lastExpectations := ""
+	dropReason := ""
+	failures := 0
+	onBackup := false
+	var droppedAt, lastRestart, failbackDue, bridgeDownSince time.Time
+	lastBridgeError := ""
+	var expectationsDue time.Time
+	var monitor *latencyMonitor
 	for {
 		state, err := getTunnelState()
 		if err != nil {
-			return fail(err)
+			if bridgeDownSince.IsZero() {
+				bridgeDownSince = time.Now()
+			}
+			if fortiClientRunning() {
+				if err.Error() != lastBridgeError {
+					event(WatchEvent{Type: "bridge_error", Error: err.Error()}, "bridge error: %v", err)
+					lastBridgeError = err.Error()
+				}
+			} else {
+				if lastBridgeError != "app not running" {
+					event(WatchEvent{Type: "app_not_running"}, "FortiClient is not running; waiting for it to restart")
+					lastBridgeError = "app not running"
+				}
+				if time.Since(bridgeDownSince) >= appRestartGrace {
+					event(WatchEvent{Type: "app_starting"}, "starting FortiClient")
+					if err := ensureFortiClientRunning(max(timeout, 30*time.Second)); err != nil {
+						event(WatchEvent{Type: "app_start_failed", Error: err.Error()}, "failed to start FortiClient: %v", err)
+					}
+				}
+			}
+			time.Sleep(interval)
+			continue
+		}
+		if !bridgeDownSince.IsZero() {
+			event(WatchEvent{Type: "app_restarted"}, "FortiClient app restarted; resuming after %s", time.Since(bridgeDownSince).Round(time.Second))
+			if lastActive != "" {
+				dropReason = "FortiClient app restarted"
+			}
+			// The restarted app may list its connections differently.
+			if refreshed, err := getConnections(); err == nil {
+				if reselected, err := resolveSelection(*connectionArg, refreshed, cfg); err == nil {
+					selection = reselected
+				}
+			}
+			bridgeDownSince = time.Time{}
+			lastBridgeError = ""
 		}
 
-		status := buildStatus(state, target.ConnectionName)
+		status := selection.Status(state)
+		health.observe(status)
 		label := fmt.Sprintf("%s (%s)", status.State, emptyAsUnknown(status.CurrentConnection))
 		if label != lastStatus {
-			fmt.Printf("%s state=%s connection=%s\n", now(), status.State, emptyAsUnknown(status.CurrentConnection))
+			event(WatchEvent{Type: "state", State: status.State, Connection: status.CurrentConnection}, "state=%s connection=%s", status.State, emptyAsUnknown(status.CurrentConnection))
+			if lastActive != "" && !status.Connected {
+				droppedAt = time.Now()
+				recordEvent(HistoryEvent{Event: eventDropped, Connection: lastActive, Source: "watch", Reason: firstNonEmpty(dropReason, "tunnel lost")})
+				dropReason = ""
+				runHooks("post_disconnect", lastActive, cfg.forConnection(lastActive).Hooks.PostDisconnect)
+			}
 			lastStatus = label
 		}
 
-		shouldReconnect := !state.Connected() || !strings.EqualFold(state.CurrentConnection(), target.ConnectionName)
-		if shouldReconnect {
-			fmt.Printf("%s reconnecting to %q...\n", now(), target.ConnectionName)
-			payload := map[string]string{
-				"connection_name": target.ConnectionName,
-				"connection_type": target.Type,
+		active, ok := selection.ActiveMember(state)
+		if !ok && onBackup && state.Connected() && strings.EqualFold(state.CurrentConnection(), backup.ConnectionName) {
+			if time.Now().Before(failbackDue) {
+				time.Sleep(interval)
+				continue
 			}
-			if _, err := runBridge("connect", payload); err != nil {
-				fmt.Printf("%s reconnect start failed: %v\n", now(), err)
-			} else {
-				outcome, err := waitForTunnelState(target.ConnectionName, true, timeout, interval)
+			event(WatchEvent{Type: "failback", Connection: backup.ConnectionName}, "failback: disconnecting backup %q to retry %s", backup.ConnectionName, selection.Label())
+			recordEvent(HistoryEvent{Event: eventDisconnected, Connection: backup.ConnectionName, Source: "watch", Reason: "failback to " + selection.Label()})
+			if err := disconnectTunnel(state); err != nil {
+				event(WatchEvent{Type: "failback_failed", Connection: backup.ConnectionName, Error: err.Error()}, "failback failed: %v", err)
+				failbackDue = time.Now().Add(settings.Fallback.failbackInterval())
+				time.Sleep(interval)
+				continue
+			}
+			if state, err = waitForTunnelState("", false, deadlineAfter(time.Now(), timeout), interval); err != nil {
+				event(WatchEvent{Type: "failback_failed", Connection: backup.ConnectionName, Error: err.Error()}, "failback failed: %v", err)
+			}
+			droppedAt = time.Now()
+		}
+		if !ok || active.ConnectionName != lastActive {
+			monitor = nil
+			if ok {
+				if err := checkGatewayPin(cfg.forConnection(active.ConnectionName)); err != nil {
+					event(WatchEvent{Type: "pin_mismatch", Connection: active.ConnectionName, Error: err.Error()}, "warning: %v", err)
+				}
+			}
+		}
+		lastActive = ""
+		if ok {
+			lastActive = active.ConnectionName
+			activeSettings := cfg.forConnection(active.ConnectionName)
+			if activeSettings.Latency != nil {
+				if monitor == nil {
+					monitor = &latencyMonitor{cfg: *activeSettings.Latency}
+				}
+				transition, change := monitor.observe(measureLatency(monitor.cfg), time.Now())
+				if transition != "" {
+					event(WatchEvent{Type: transition, Connection: active.ConnectionName}, "%s", change)
+				}
+				if transition == latencyDegraded && monitor.cfg.action() != latencyActionLog {
+					if monitor.cfg.action() == latencyActionFailover && len(selection.Members) > 1 {
+						avoidMember = active.ConnectionName
+					}
+					event(WatchEvent{Type: "latency_action", Connection: active.ConnectionName, Action: monitor.cfg.action()}, "%s: disconnecting %q", monitor.cfg.action(), active.ConnectionName)
+					dropReason = "latency " + monitor.cfg.action()
+					if err := disconnectTunnel(state); err != nil {
+						event(WatchEvent{Type: "latency_action_failed", Connection: active.ConnectionName, Action: monitor.cfg.action(), Error: err.Error()}, "%s failed: %v", monitor.cfg.action(), err)
+					}
+					monitor.reset()
+					time.Sleep(interval)
+					continue
+				}
+			}
+			if len(activeSettings.Expectations) > 0 && !time.Now().Before(expectationsDue) {
+				results := evaluateExpectations(activeSettings.Expectations)
+				label := expectationsLabel(results)
+				if label != lastExpectations {
+					event(WatchEvent{Type: "expectations", Connection: active.ConnectionName, Result: label, Expectations: results}, "expectations=%s", label)
+					reportExpectationViolations(results)
+					lastExpectations = label
+				}
+				every := seconds(activeSettings.ExpectationsInterval)
+				if every <= 0 {
+					every = defaultExpectationsInterval
+				}
+				expectationsDue = time.Now().Add(every)
+			}
+			checks, err := verifyChecks(*verify, activeSettings)
+			if err != nil && lastChecks != "error" {
+				event(WatchEvent{Type: "checks", Connection: active.ConnectionName, Result: "error", Error: err.Error()}, "checks=error: %v", err)
+				lastChecks = "error"
+			}
+			if len(checks) > 0 {
+				results := runChecks(checks)
+				label := checksLabel(results)
+				if label != lastChecks {
+					event(WatchEvent{Type: "checks", Connection: active.ConnectionName, Result: label, Checks: results}, "checks=%s", label)
+					if !checksPassed(results) && !watchJSON {
+						printCheckResults(results)
+					}
+					lastChecks = label
+				}
+			}
+		} else {
+			lastChecks = ""
+			lastExpectations = ""
+			expectationsDue = time.Time{}
+			reconnected := false
+			for _, member := range preferOthers(selection.AttemptOrder(), avoidMember) {
+				memberSettings := cfg.forConnection(member.ConnectionName)
+				if err := checkGatewayPin(memberSettings); err != nil {
+					if pinRefuses(err, memberSettings, *strict) {
+						event(WatchEvent{Type: "pin_refused", Connection: member.ConnectionName, Error: err.Error()}, "refusing to connect %q: %v", member.ConnectionName, err)
+						continue
+					}
+					event(WatchEvent{Type: "pin_mismatch", Connection: member.ConnectionName, Error: err.Error()}, "warning: %v", err)
+				}
+				event(WatchEvent{Type: "reconnect_attempt", Connection: member.ConnectionName}, "reconnecting to %q...", member.ConnectionName)
+				attemptStart := time.Now()
+				outcome, err := startConnect(member, deadlineAfter(attemptStart, timeout), interval)
 				if err != nil {
-					fmt.Printf("%s reconnect failed: %v\n", now(), err)
+					event(WatchEvent{Type: "reconnect_failed", Connection: member.ConnectionName, Error: err.Error()}, "reconnect failed: %v", err)
+					recordEvent(HistoryEvent{Event: eventConnectFailed, Connection: member.ConnectionName, Source: "watch", Reason: err.Error()})
+					if dismissTransientDialog(err, cfg.Dialogs) {
+						event(WatchEvent{Type: "dialog_dismissed", Connection: member.ConnectionName}, "dismissed FortiClient error dialog before the next attempt")
+					}
+					if reason, pending := pendingUpgrade(err, cfg.Upgrade.Markers); pending {
+						event(WatchEvent{Type: "upgrade_pending", Error: reason}, "FortiClient upgrade pending: %s", reason)
+						if cfg.Upgrade.RestartApp && time.Since(lastRestart) >= minRestartGap {
+							lastRestart = time.Now()
+							event(WatchEvent{Type: "app_restarting"}, "restarting FortiClient to apply the upgrade")
+							if err := restartFortiClient(max(timeout, 30*time.Second)); err != nil {
+								event(WatchEvent{Type: "app_restart_failed", Error: err.Error()}, "restart failed: %v", err)
+							}
+						}
+						break
+					}
+					continue
+				}
+				event(WatchEvent{Type: "reconnect_result", Connection: outcome.CurrentConnection(), Result: connectedLabel(outcome.Connected())}, "reconnect result=%s connection=%s", connectedLabel(outcome.Connected()), emptyAsUnknown(outcome.CurrentConnection()))
+				if droppedAt.IsZero() {
+					droppedAt = attemptStart
+				}
+				recordEvent(HistoryEvent{Event: eventConnected, Connection: member.ConnectionName, Source: "watch", DurationMS: time.Since(droppedAt).Milliseconds()})
+				droppedAt = time.Time{}
+				runHooks("post_connect", member.ConnectionName, cfg.forConnection(member.ConnectionName).Hooks.PostConnect)
+				selection.RecordUse(member)
+				avoidMember = ""
+				if selection.Group != "" {
+					event(WatchEvent{Type: "group_member", Group: selection.Group, Connection: member.ConnectionName}, "group %q active member=%s", selection.Group, member.ConnectionName)
+				}
+				if onBackup {
+					event(WatchEvent{Type: "failed_back", Connection: member.ConnectionName}, "failed back from %q to %q", backup.ConnectionName, member.ConnectionName)
+					onBackup = false
+				}
+				failures = 0
+				reconnected = true
+				lastStatus = ""
+				break
+			}
+			if !reconnected {
+				failures++
+			}
+			if !reconnected && settings.Fallback != nil && failures >= settings.Fallback.after() {
+				event(WatchEvent{Type: "failover", Connection: backup.ConnectionName, Failures: failures}, "failover: %d consecutive reconnects of %s failed; connecting backup %q", failures, selection.Label(), backup.ConnectionName)
+				attemptStart := time.Now()
+				if _, err := startConnect(backup, deadlineAfter(attemptStart, timeout), interval); err != nil {
+					event(WatchEvent{Type: "failover_failed", Connection: backup.ConnectionName, Error: err.Error()}, "failover failed: %v", err)
+					recordEvent(HistoryEvent{Event: eventConnectFailed, Connection: backup.ConnectionName, Source: "watch", Reason: err.Error()})
 				} else {
-					fmt.Printf("%s reconnect result=%s connection=%s\n", now(), connectedLabel(outcome.Connected()), emptyAsUnknown(outcome.CurrentConnection()))
+					if droppedAt.IsZero() {
+						droppedAt = attemptStart
+					}
+					recordEvent(HistoryEvent{Event: eventFailover, Connection: backup.ConnectionName, Source: "watch", DurationMS: time.Since(droppedAt).Milliseconds(),
+						Reason: fmt.Sprintf("%d consecutive reconnect failures of %s", failures, selection.Label())})
+					droppedAt = time.Time{}
+					runHooks("post_connect", backup.ConnectionName, cfg.forConnection(backup.ConnectionName).Hooks.PostConnect)
+					onBackup = true
+					failbackDue = time.Now().Add(settings.Fallback.failbackInterval())
 					lastStatus = ""
 				}
 			}
@@ -346,56 +1306,51 @@ func runWatch(args []string) int {
 }
 
 func getConnections() ([]Tunnel, error) {
-	result, err := runBridge("list-connections", nil)
-	if err != nil {
-		return nil, err
-	}
-
-	var tunnels []Tunnel
-	if len(result) == 0 || string(result) == "null" {
+	if tunnels, ok := readCache.connections(); ok {
 		return tunnels, nil
 	}
-	if err := json.Unmarshal(result, &tunnels); err != nil {
-		return nil, fmt.Errorf("failed to decode tunnel list: %w", err)
+	tunnels, err := activeBackend().ListConnections()
+	if err == nil {
+		readCache.storeConnections(tunnels)
 	}
-	return tunnels, nil
+	return tunnels, err
 }
 
 func getTunnelState() (TunnelState, error) {
-	result, err := runBridge("get-state", nil)
-	if err != nil {
-		return TunnelState{}, err
-	}
-	if len(result) == 0 || string(result) == "null" {
-		return TunnelState{}, nil
+	if state, ok := readCache.tunnelState(); ok {
+		return state, nil
 	}
+	return freshTunnelState()
+}
 
-	var state TunnelState
-	if err := json.Unmarshal(result, &state); err != nil {
-		return TunnelState{}, fmt.Errorf("failed to decode tunnel state: %w", err)
+// freshTunnelState always asks the backend, for loops that poll for a
+// change faster than the read cache expires.
+func freshTunnelState() (TunnelState, error) {
+	state, err := activeBackend().GetState()
+	if err == nil {
+		readCache.storeState(state)
 	}
-	return state, nil
+	return state, err
 }
 
-func waitForTunnelState(expectedConnection string, shouldBeConnected bool, timeout, interval time.Duration) (TunnelState, error) {
+const initialPollInterval = 250 * time.Millisecond
+
+// waitForTunnelState polls until the tunnel reaches the wanted state. A zero
+// deadline waits indefinitely; passing the deadline returns errTimedOut
+// together with the last observed state.
+func waitForTunnelState(expectedConnection string, shouldBeConnected bool, deadline time.Time, interval time.Duration) (TunnelState, error) {
 	if interval <= 0 {
 		interval = 1 * time.Second
 	}
-	if timeout < 0 {
-		timeout = 0
-	}
 
-	deadline := time.Now().Add(timeout)
-	last, err := getTunnelState()
-	if err != nil {
-		return TunnelState{}, err
-	}
-
-	for !time.Now().After(deadline) {
-		last, err = getTunnelState()
+	defer timeWait(time.Now())
+	delay := min(initialPollInterval, interval)
+	for {
+		last, err := freshTunnelState()
 		if err != nil {
 			return TunnelState{}, err
 		}
+		progress.observe(last)
 
 		if shouldBeConnected {
 			if last.Connected() {
@@ -411,10 +1366,25 @@ func waitForTunnelState(expectedConnection string, shouldBeConnected bool, timeo
 			return last, nil
 		}
 
-		time.Sleep(interval)
+		if deadline.IsZero() {
+			time.Sleep(delay)
+			delay = nextPollDelay(delay, interval)
+			continue
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return last, timeoutWaitingFor(expectedConnection, shouldBeConnected)
+		}
+		time.Sleep(min(delay, remaining))
+		delay = nextPollDelay(delay, interval)
 	}
+}
 
-	return last, nil
+// nextPollDelay backs off from the fast initial poll toward the configured
+// interval so quick transitions are noticed early without hammering the
+// bridge during slow ones.
+func nextPollDelay(delay, interval time.Duration) time.Duration {
+	return min(delay*3/2, interval)
 }
 
 func resolveTunnel(target string, tunnels []Tunnel) (Tunnel, error) {
@@ -465,10 +1435,43 @@ func resolveTunnel(target string, tunnels []Tunnel) (Tunnel, error) {
 	for _, tunnel := range tunnels {
 		available = append(available, tunnel.ConnectionName)
 	}
-	return Tunnel{}, fmt.Errorf("connection %q not found; available: %s", target, strings.Join(available, ", "))
+	return Tunnel{}, fmt.Errorf("connection %q %w; available: %s", target, errNotFound, strings.Join(available, ", "))
 }
 
 func runBridge(action string, payload any) (json.RawMessage, error) {
+	start := time.Now()
+	var result json.RawMessage
+	var err error
+	if bridgeReplay != nil {
+		result, err = bridgeReplay.call(action, payload)
+	} else {
+		result, err = callBridge(action, payload)
+	}
+	if bridgeRecording != nil {
+		recordBridge(action, payload, start, result, err)
+	}
+	if bridgeTrace != nil {
+		traceBridge(action, payload, start, result, err)
+	}
+	return result, err
+}
+
+func callBridge(action string, payload any) (json.RawMessage, error) {
+	bridgesInFlight.Add(1)
+	defer bridgesInFlight.Add(-1)
+	if bridgeGRPCAddress != "" {
+		bridgeStart := time.Now()
+		out, err := callBridgeGRPC(action, payload)
+		timeBridge(bridgeStart)
+		rememberBridge(action, []string{bridgeGRPCAddress}, out, nil)
+		if action == "connect" || action == "disconnect" {
+			invalidateBridgeCache()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return parseBridgeOutput(action, out, nil, nil)
+	}
 	bridge, err := findBridgeScript()
 	if err != nil {
 		return nil, err
@@ -483,89 +1486,130 @@ func runBridge(action string, payload any) (json.RawMessage, error) {
 		args = append(args, string(body))
 	}
 
-	cmd := exec.Command("node", args...)
-	out, err := cmd.CombinedOutput()
+	runtime, env, err := bridgeRuntime()
 	if err != nil {
-		msg := strings.TrimSpace(string(out))
-		if msg == "" {
-			msg = err.Error()
+		return nil, err
+	}
+
+	bridgeStart := time.Now()
+	var out, stderr []byte
+	err = errBridgeDaemonUnavailable
+	if bridgeDaemonEnabled {
+		out, err = callBridgeDaemon(runtime, env, bridge, action, payload)
+	}
+	if errors.Is(err, errBridgeDaemonUnavailable) {
+		ctx, cancel := bridgeContext()
+		defer cancel()
+		cmd := exec.CommandContext(ctx, runtime, append(runtimeArgs(runtime), args...)...)
+		cmd.WaitDelay = time.Second
+		if env != nil {
+			cmd.Env = append(os.Environ(), env...)
+		}
+		// Only stdout carries the response; runtime warnings and anything
+		// the module logs go to stderr and are kept for diagnostics.
+		var errBuf bytes.Buffer
+		cmd.Stderr = &errBuf
+		out, err = cmd.Output()
+		stderr = bytes.TrimSpace(errBuf.Bytes())
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			err = bridgeTimeoutError(action)
+		case context.Canceled:
+			err = errCanceled
 		}
-		return nil, errors.New(msg)
+	}
+	timeBridge(bridgeStart)
+	rememberBridge(action, args[2:], out, stderr)
+	if action == "connect" || action == "disconnect" {
+		invalidateBridgeCache()
+	}
+	if errors.Is(err, errBridgeTimedOut) || errors.Is(err, errCanceled) {
+		return nil, err
 	}
 
+	return parseBridgeOutput(action, out, stderr, err)
+}
+
+// parseBridgeOutput turns what a bridge process printed into its result or
+// error. A failing bridge still exits non-zero after printing its response,
+// so the process error is only used when there is no response to read.
+func parseBridgeOutput(action string, out, stderr []byte, err error) (json.RawMessage, error) {
 	var resp bridgeResponse
-	if err := decodeBridgeResponse(out, &resp); err != nil {
-		return nil, fmt.Errorf("invalid bridge response: %s", strings.TrimSpace(string(out)))
+	if decodeErr := decodeBridgeResponse(out, &resp); decodeErr != nil {
+		if err == nil {
+			err = fmt.Errorf("invalid bridge response: %w", decodeErr)
+		} else {
+			err = fmt.Errorf("bridge %s failed: %w", action, err)
+		}
+		if len(stderr) > 0 {
+			return nil, fmt.Errorf("%s: %s", redact(err.Error()), redact(lastLines(string(stderr), 5)))
+		}
+		return nil, errors.New(redact(err.Error()))
+	}
+	if err := checkBridgeProtocol(resp.Protocol); err != nil {
+		return nil, err
 	}
 	if !resp.OK {
-		if strings.TrimSpace(resp.Error) == "" {
-			return nil, errors.New("bridge call failed")
-		}
-		return nil, errors.New(resp.Error)
+		return nil, &bridgeError{Code: resp.ErrorCode, Message: firstNonEmpty(redact(strings.TrimSpace(resp.Error)), "bridge call failed"), Stderr: redact(string(stderr))}
 	}
 	return resp.Result, nil
 }
 
+// decodeBridgeResponse reads the response the bridge prints as the last
+// line of its stdout. A native module may print to stdout itself, so
+// earlier lines are ignored.
 func decodeBridgeResponse(raw []byte, out *bridgeResponse) error {
 	trimmed := strings.TrimSpace(string(raw))
 	if trimmed == "" {
 		return errors.New("empty output")
 	}
-
-	if err := json.Unmarshal([]byte(trimmed), out); err == nil {
-		return nil
+	last := trimmed[strings.LastIndex(trimmed, "\n")+1:]
+	if err := json.Unmarshal([]byte(last), out); err != nil {
+		return fmt.Errorf("no json response found in %q", last)
 	}
+	return nil
+}
 
-	lines := strings.Split(trimmed, "\n")
-	for i := len(lines) - 1; i >= 0; i-- {
-		candidate := strings.TrimSpace(lines[i])
-		if !strings.HasPrefix(candidate, "{") {
-			continue
-		}
-		if err := json.Unmarshal([]byte(candidate), out); err == nil {
-			return nil
-		}
+// lastLines returns the last n lines of text, which is where runtimes put
+// the actual error after their stack traces and warnings.
+func lastLines(text string, n int) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
 	}
-
-	lastObj := strings.LastIndex(trimmed, "{")
-	if lastObj >= 0 {
-		candidate := trimmed[lastObj:]
-		if err := json.Unmarshal([]byte(candidate), out); err == nil {
-			return nil
-		}
-	}
-
-	return errors.New("no json response found")
+	return strings.Join(lines, "\n")
 }
 
+// findBridgeScript prefers FORTIVPN_BRIDGE, then a copy installed in one
+// of the standard locations (see bridgeInstallDirs), and finally the
+// script embedded in the binary.
 func findBridgeScript() (string, error) {
-	candidates := []string{}
 	if fromEnv := strings.TrimSpace(os.Getenv("FORTIVPN_BRIDGE")); fromEnv != "" {
-		candidates = append(candidates, fromEnv)
-	}
-
-	if exe, err := os.Executable(); err == nil {
-		candidates = append(candidates, filepath.Join(filepath.Dir(exe), "fortivpn-bridge.js"))
-	}
-	if wd, err := os.Getwd(); err == nil {
-		candidates = append(candidates, filepath.Join(wd, "fortivpn-bridge.js"))
+		if stat, err := os.Stat(fromEnv); err != nil || stat.IsDir() {
+			return "", fmt.Errorf("FORTIVPN_BRIDGE=%s is not a file", fromEnv)
+		}
+		return fromEnv, nil
 	}
-
-	for _, candidate := range candidates {
-		if stat, err := os.Stat(candidate); err == nil && !stat.IsDir() {
-			return candidate, nil
+	for _, dir := range bridgeInstallDirs() {
+		path := filepath.Join(dir, bridgeScriptName)
+		if stat, err := os.Stat(path); err == nil && !stat.IsDir() {
+			return path, nil
 		}
 	}
-	return "", errors.New("could not find fortivpn-bridge.js")
+	return extractBridgeScript()
 }
 
+const stateConnectedOther = "ConnectedOther"
+
 func buildStatus(state TunnelState, selectedConnection string) Status {
 	connected := state.Connected()
-	if selectedConnection != "" {
-		connected = connected && strings.EqualFold(state.CurrentConnection(), selectedConnection)
+	label := connectedLabel(connected)
+	if selectedConnection != "" && connected && !strings.EqualFold(state.CurrentConnection(), selectedConnection) {
+		connected = false
+		label = stateConnectedOther
 	}
 	return Status{
-		State:              connectedLabel(connected),
+		State:              label,
 		Connected:          connected,
 		CurrentConnection:  state.CurrentConnection(),
 		SelectedConnection: selectedConnection,
@@ -573,6 +1617,36 @@ func buildStatus(state TunnelState, selectedConnection string) Status {
 	}
 }
 
+// buildStatusAny reports Connected when the tunnel is up on any of the
+// selected connections; with more than one name it also lists each one.
+func buildStatusAny(state TunnelState, selectedConnections []string) Status {
+	if len(selectedConnections) <= 1 {
+		selected := ""
+		if len(selectedConnections) == 1 {
+			selected = selectedConnections[0]
+		}
+		return buildStatus(state, selected)
+	}
+
+	status := buildStatus(state, "")
+	matched := ""
+	candidates := make([]Candidate, 0, len(selectedConnections))
+	for _, name := range selectedConnections {
+		active := state.Connected() && strings.EqualFold(state.CurrentConnection(), name)
+		if active && matched == "" {
+			matched = name
+		}
+		candidates = append(candidates, Candidate{Connection: name, Active: active})
+	}
+	status.Candidates = candidates
+	status.SelectedConnection = matched
+	if state.Connected() && matched == "" {
+		status.Connected = false
+		status.State = stateConnectedOther
+	}
+	return status
+}
+
 func (s TunnelState) Connected() bool {
 	return s.SSLState != 0 || s.IPSecState != 0
 }
@@ -601,39 +1675,172 @@ func connectedLabel(connected bool) string {
 	return "Disconnected"
 }
 
-func printConnectResult(status Status, asJSON bool) int {
+// verifyStatus runs the --verify checks for a connected status, bounded by
+// what is left of the overall connect deadline.
+func verifyStatus(status *Status, checks []CheckConfig, deadline time.Time) error {
+	if !status.Connected || len(checks) == 0 {
+		return nil
+	}
+	if !deadline.IsZero() {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("%w before running checks", errTimedOut)
+		}
+		checks = capCheckTimeouts(checks, remaining)
+	}
+	status.Checks = runChecks(checks)
+	return nil
+}
+
+func printConnectResult(status Status, asJSON bool, tmpl *template.Template) int {
 	if asJSON {
+		status.Timings = currentTimings()
 		if code := printJSON(status); code != 0 {
 			return code
 		}
+	} else if tmpl != nil {
+		status.Timings = currentTimings()
+		if code := printFormat(tmpl, status); code != 0 {
+			return code
+		}
 	} else {
-		fmt.Printf("state: %s\n", status.State)
-		fmt.Printf("current connection: %s\n", emptyAsUnknown(status.CurrentConnection))
+		fmt.Println(msg("status.state", status.State))
+		fmt.Println(msg("status.current", emptyAsUnknown(status.CurrentConnection)))
+		if status.Group != "" {
+			fmt.Println(msg("status.group", status.Group))
+		}
 		if status.SelectedConnection != "" {
-			fmt.Printf("selected connection: %s\n", status.SelectedConnection)
+			fmt.Println(msg("status.selected", status.SelectedConnection))
 		}
+		printCheckResults(status.Checks)
 	}
 
-	if status.Connected {
-		return 0
+	if !status.Connected {
+		return 2
 	}
-	return 2
+	if !checksPassed(status.Checks) || expectationsFailed(status.Expectations) {
+		return 1
+	}
+	return 0
+}
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// outputFormat is what printJSON writes: "json", or "yaml" after
+// --output yaml. "csv" and "tsv" are for printCSV.
+var outputFormat = "json"
+
+// outputFlags registers --json and --output json|yaml on fs. Either one
+// turns machine-readable output on. The list commands also accept the
+// table formats in tables, which set outputFormat without it.
+func outputFlags(fs *flag.FlagSet, tables ...string) *bool {
+	asJSON := fs.Bool("json", false, "Emit JSON output.")
+	formats := append([]string{"json", "yaml"}, tables...)
+	fs.Func("output", "Emit machine-readable output: "+strings.Join(formats, "|")+".", func(value string) error {
+		if !slices.Contains(formats, value) {
+			return fmt.Errorf("unknown output %q (want %s)", value, strings.Join(formats, "|"))
+		}
+		outputFormat = value
+		*asJSON = !slices.Contains(tables, value)
+		return nil
+	})
+	return asJSON
 }
 
 func printJSON(v any) int {
+	if outputFormat == "yaml" {
+		body, err := encodeYAML(v)
+		if err == nil {
+			_, err = os.Stdout.Write(body)
+		}
+		if err != nil {
+			return fail(err)
+		}
+		return 0
+	}
 	enc := json.NewEncoder(os.Stdout)
-	enc.SetIndent("", "  ")
+	if progress == nil {
+		enc.SetIndent("", "  ")
+	}
 	if err := enc.Encode(v); err != nil {
 		return fail(err)
 	}
 	return 0
 }
 
+var errTimedOut = errors.New("timed out")
+
+var errBridgeTimedOut = fmt.Errorf("bridge %w", errTimedOut)
+
 func fail(err error) int {
-	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	progress.step("failed", "%s", err)
+	fmt.Fprintln(os.Stderr, msg("error", redact(err.Error())))
+	return exitCodeFor(err)
+}
+
+func exitCodeFor(err error) int {
+	if errors.Is(err, errUpgradePending) {
+		return 6
+	}
+	if errors.Is(err, errDeclined) {
+		return 7
+	}
+	if errors.Is(err, errTimedOut) {
+		return 4
+	}
+	if errors.Is(err, errAuthRequired) {
+		return 8
+	}
+	if errors.Is(err, errNotFound) {
+		return 9
+	}
+	if errors.Is(err, errAppNotRunning) {
+		return 10
+	}
+	if errors.Is(err, errBusy) {
+		return 11
+	}
+	if errors.Is(err, errHeadless) {
+		return 12
+	}
+	if errors.Is(err, errCanceled) {
+		return 130
+	}
 	return 3
 }
 
+func timeoutWaitingFor(expectedConnection string, shouldBeConnected bool) error {
+	if !shouldBeConnected {
+		return fmt.Errorf("%w waiting for the tunnel to disconnect", errTimedOut)
+	}
+	if expectedConnection == "" {
+		return fmt.Errorf("%w waiting for the tunnel to connect", errTimedOut)
+	}
+	return fmt.Errorf("%w waiting for %q to connect", errTimedOut, expectedConnection)
+}
+
+// deadlineAfter returns the deadline for a timeout measured from start; a
+// zero timeout means no deadline.
+func deadlineAfter(start time.Time, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return start.Add(timeout)
+}
+
+func logf(format string, args ...any) {
+	fmt.Printf("%s %s\n", now(), redact(fmt.Sprintf(format, args...)))
+}
+
 func seconds(v float64) time.Duration {
 	if v <= 0 {
 		return 0
@@ -647,16 +1854,28 @@ func now() string {
 
 func emptyAsUnknown(v string) string {
 	if strings.TrimSpace(v) == "" {
-		return "<none>"
+		return msg("none")
 	}
 	return v
 }
 
+// ensureFortiClientRunning launches the FortiClient app the bridge talks
+// to. Other backends do not need it.
 func ensureFortiClientRunning(wait time.Duration) error {
+	if _, ok := activeBackend().(bridgeBackend); !ok || bridgeReplay != nil {
+		return nil
+	}
 	if fortiClientRunning() {
 		return nil
 	}
+	if headlessSession() {
+		return fmt.Errorf("%w: FortiClient is not running and cannot be started from this session (SSH or CI?); start it from the logged-in desktop, or use --backend forticli", errHeadless)
+	}
+	return launchFortiClient(wait)
+}
 
+// launchFortiClient starts the app and waits up to wait for its process.
+func launchFortiClient(wait time.Duration) error {
 	if err := exec.Command("open", "-a", "FortiClient").Run(); err != nil {
 		return fmt.Errorf("failed to start FortiClient app: %w", err)
 	}
@@ -669,7 +1888,7 @@ func ensureFortiClientRunning(wait time.Duration) error {
 		time.Sleep(500 * time.Millisecond)
 	}
 
-	return errors.New("FortiClient app did not start in time")
+	return fmt.Errorf("%w waiting for the FortiClient app to start", errTimedOut)
 }
 
 func fortiClientRunning() bool {
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestStripQuiet(t *testing.T) {
+	tests := []struct {
+		args  []string
+		want  []string
+		quiet bool
+	}{
+		{[]string{"--version", "-q"}, []string{"--version"}, true},
+		{[]string{"-q", "status"}, []string{"status"}, true},
+		{[]string{"status", "--quiet"}, []string{"status"}, true},
+		{[]string{"--bridge-timeout", "5", "-q", "status"}, []string{"--bridge-timeout", "5", "status"}, true},
+		{[]string{"history", "--tag", "-q"}, []string{"history", "--tag", "-q"}, false},
+		{[]string{"up", "--tag", "-q"}, []string{"up", "--tag", "-q"}, false},
+		{[]string{"self-update", "--version", "-q"}, []string{"self-update", "--version", "-q"}, false},
+		{[]string{"run", "--", "echo", "-q"}, []string{"run", "--", "echo", "-q"}, false},
+	}
+	for _, tt := range tests {
+		quiet = false
+		got := stripQuiet(tt.args)
+		if !slices.Equal(got, tt.want) || quiet != tt.quiet {
+			t.Errorf("stripQuiet(%q) = %q, quiet %v; want %q, quiet %v", tt.args, got, quiet, tt.want, tt.quiet)
+		}
+	}
+	quiet = false
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// globalFlagHelp describes the flags run() parses itself, before the
+// command's own flag set.
+var globalFlagHelp = map[string]string{
+	"--backend":        "Backend to drive FortiClient with: the bridge (node, electron), Fortinet's CLI (forticli), a fixture (mock), a fortivpn-backend-PLUGIN on PATH, or auto.",
+	"--node-path":      "JavaScript runtime to run the bridge with.",
+	"--bridge-timeout": "Bound every bridge call to this many seconds (0 disables the bound).",
+	"--debug-bridge":   "Trace every bridge call to stderr, or append the trace to FILE.",
+	"--record":         "Append every bridge call and its answer to FILE.",
+	"--replay":         "Answer bridge calls from a recording instead of running the bridge.",
+	"--quiet":          "Print nothing but errors; only the exit code tells the outcome. Also -q, and accepted among the command's flags too.",
+}
+
+var exitStatuses = [][2]string{
+	{"0", "success"},
+	{"1", "not connected, or a check failed"},
+	{"2", "usage error, or the tunnel did not reach the requested state"},
+	{"3", "other errors"},
+	{"4", "timed out"},
+	{"5", "connected to a different connection than the one asked for"},
+	{"6", "FortiClient has a pending upgrade and must be restarted"},
+	{"7", "a confirmation was declined"},
+	{"8", "FortiClient needs authentication"},
+	{"9", "the connection was not found"},
+	{"10", "FortiClient is not running"},
+	{"11", "another connect or disconnect is in progress"},
+	{"12", "FortiClient is not running and this session cannot start it"},
+	{"130", "interrupted"},
+}
+
+// flagHelp is one flag as its command's -h output describes it.
+type flagHelp struct {
+	Name        string
+	Placeholder string
+	Usage       string
+}
+
+// commandFlagHelp runs `fortivpn COMMAND -h` and parses the flag defaults
+// it prints, so man pages describe flags in the words -h uses. Every
+// command parses its flags before doing anything else, so -h is harmless.
+func commandFlagHelp(path []string) []flagHelp {
+	stdout, stderr := os.Stdout, os.Stderr
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil
+	}
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		return nil
+	}
+	defer null.Close()
+	os.Stdout, os.Stderr = null, writer
+	captured := make(chan string)
+	go func() {
+		raw, _ := io.ReadAll(reader)
+		captured <- string(raw)
+	}()
+	run(append(append([]string{}, path...), "-h"))
+	os.Stdout, os.Stderr = stdout, stderr
+	writer.Close()
+	text := <-captured
+	reader.Close()
+
+	var flags []flagHelp
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if rest, ok := strings.CutPrefix(line, "  -"); ok {
+			name, placeholder, _ := strings.Cut(rest, " ")
+			flags = append(flags, flagHelp{Name: "--" + name, Placeholder: placeholder})
+			continue
+		}
+		if usage, ok := strings.CutPrefix(line, "    \t"); ok && len(flags) > 0 {
+			last := &flags[len(flags)-1]
+			last.Usage = strings.TrimSpace(last.Usage + " " + usage)
+		}
+	}
+	return flags
+}
+
+func runMan(args []string) int {
+	fs := flag.NewFlagSet("man", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	dir := fs.String("dir", "", "Write every page to DIR (e.g. /usr/local/share/man/man1) instead of printing one.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	usages := usageCommands()
+	if *dir != "" {
+		if fs.NArg() > 0 {
+			fmt.Fprintln(os.Stderr, msg("error", msg("man.dir_and_command")))
+			return 2
+		}
+		if err := os.MkdirAll(*dir, 0o755); err != nil {
+			return fail(err)
+		}
+		pages := map[string]string{"fortivpn.1": mainManPage(usages)}
+		for _, usage := range usages[1:] {
+			pages[manPageName(usage.Path)+".1"] = commandManPage(usage)
+		}
+		for name, page := range pages {
+			if err := os.WriteFile(filepath.Join(*dir, name), []byte(page), 0o644); err != nil {
+				return fail(err)
+			}
+		}
+		fmt.Println(msg("man.written", len(pages), *dir))
+		return 0
+	}
+
+	if fs.NArg() == 0 {
+		fmt.Print(mainManPage(usages))
+		return 0
+	}
+	for _, usage := range usages[1:] {
+		if strings.Join(usage.Path, " ") == strings.Join(fs.Args(), " ") {
+			fmt.Print(commandManPage(usage))
+			return 0
+		}
+	}
+	fmt.Fprintln(os.Stderr, msg("error", msg("usage.unknown_command", strings.Join(fs.Args(), " "))))
+	return 2
+}
+
+func manPageName(path []string) string {
+	return "fortivpn-" + strings.Join(path, "-")
+}
+
+func manHeader(b *strings.Builder, title string) {
+	info := buildMetadata()
+	date := ""
+	if info.BuildDate != "unknown" {
+		date, _, _ = strings.Cut(info.BuildDate, "T")
+	}
+	fmt.Fprintf(b, ".TH %s 1 %q %q \"User Commands\"\n", strings.ToUpper(title), date, "fortivpn "+info.Version)
+}
+
+func mainManPage(usages []commandUsage) string {
+	var b strings.Builder
+	manHeader(&b, "fortivpn")
+	b.WriteString(".SH NAME\nfortivpn \\- FortiClient VPN helper CLI for macOS\n")
+	b.WriteString(".SH SYNOPSIS\n")
+	fmt.Fprintf(&b, ".B fortivpn\n%s\n", roff(usages[0].Synopsis))
+	b.WriteString(".SH DESCRIPTION\nfortivpn connects, disconnects and watches FortiClient VPN tunnels from the command line. Each command has its own page, listed below.\n")
+	b.WriteString(".SH GLOBAL OPTIONS\nThese go before the command.\n")
+	for _, flag := range usages[0].Flags {
+		writeManFlag(&b, flag, usages[0].Values[flag], globalFlagHelp[flag])
+	}
+	b.WriteString(".SH COMMANDS\n")
+	for _, usage := range usages[1:] {
+		key := strings.Join(usage.Path, " ")
+		fmt.Fprintf(&b, ".TP\n.B %s\n%s; see\n.BR %s (1).\n", roff(key), roff(commandSummaries[key]), roff(manPageName(usage.Path)))
+	}
+	writeExitStatus(&b)
+	return b.String()
+}
+
+func commandManPage(usage commandUsage) string {
+	var b strings.Builder
+	key := strings.Join(usage.Path, " ")
+	manHeader(&b, manPageName(usage.Path))
+	fmt.Fprintf(&b, ".SH NAME\n%s \\- %s\n", roff(manPageName(usage.Path)), roff(firstNonEmpty(commandSummaries[key], key)))
+	fmt.Fprintf(&b, ".SH SYNOPSIS\n.B fortivpn %s\n%s\n", roff(key), roff(strings.TrimSpace(strings.TrimPrefix(usage.Synopsis, key))))
+	if flags := commandFlagHelp(usage.Path); len(flags) > 0 {
+		b.WriteString(".SH OPTIONS\n")
+		for _, flag := range flags {
+			writeManFlag(&b, flag.Name, firstNonEmpty(usage.Values[flag.Name], strings.ToUpper(flag.Placeholder)), flag.Usage)
+		}
+	}
+	writeExitStatus(&b)
+	b.WriteString(".SH SEE ALSO\n.BR fortivpn (1)\n")
+	return b.String()
+}
+
+func writeManFlag(b *strings.Builder, name, placeholder, usage string) {
+	if placeholder != "" {
+		fmt.Fprintf(b, ".TP\n.BI %s \" %s\"\n", roff(name), roff(placeholder))
+	} else {
+		fmt.Fprintf(b, ".TP\n.B %s\n", roff(name))
+	}
+	b.WriteString(roff(usage) + "\n")
+}
+
+func writeExitStatus(b *strings.Builder) {
+	b.WriteString(".SH EXIT STATUS\n")
+	for _, status := range exitStatuses {
+		fmt.Fprintf(b, ".TP\n.B %s\n%s\n", status[0], roff(status[1]))
+	}
+}
+
+// roff escapes text for a man page line.
+func roff(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\e`)
+	text = strings.ReplaceAll(text, "-", `\-`)
+	if strings.HasPrefix(text, ".") || strings.HasPrefix(text, "'") {
+		text = `\&` + text
+	}
+	return text
+}
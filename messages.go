@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// messages is the built-in English catalog for human-readable output. A
+// translation is a JSON object mapping the same IDs to format strings with
+// the same verbs, stored as <config dir>/locales/<locale>.json; IDs it does
+// not cover fall back to English. JSON output is never translated.
+var messages = map[string]string{
+	"error":                           "error: %s",
+	"warning":                         "warning: %s",
+	"none":                            "<none>",
+	"usage.unknown_command":           "unknown command %q",
+	"connections.header":              "NAME\tTYPE\tDEFAULT\tCORPORATE\tCLOUD\tGATEWAY",
+	"connections.none":                "No FortiClient VPN connections found.",
+	"status.state":                    "state: %s",
+	"status.current":                  "current connection: %s",
+	"status.group":                    "group: %s",
+	"status.selected":                 "selected connection: %s",
+	"connect.trying_next":             "%s; trying %q",
+	"connect.progress_needs_json":     "--progress requires --json",
+	"connect.group_and_connection":    "--group and --connection cannot be combined",
+	"connect.confirm_displace":        "disconnect %s and connect %s? [y/N] ",
+	"connect.precheck_no_gateway":     "no gateway configured for %q; skipping the reachability precheck",
+	"watch.group":                     "Watching group %q (%s). interval=%s reconnect-timeout=%s",
+	"watch.single":                    "Watching %q. interval=%s reconnect-timeout=%s",
+	"check.ipv6_not_carried":          "tunnel %s does not carry IPv6; ipv6 checks go over the local network",
+	"tunnel.interface":                "tunnel interface: %s",
+	"tunnel.ipv4":                     "tunnel ipv4: %s (%d routes)",
+	"tunnel.ipv6":                     "tunnel ipv6: %s (%d routes)",
+	"tunnel.ipv6_not_carried":         "tunnel ipv6: not carried",
+	"hook.failed":                     "%s hook %q failed: %v",
+	"dialog.dismissed":                "dismissed FortiClient dialog %q; retrying",
+	"expectation.not_met":             "expectation %s not met: %s",
+	"verify.not_connected":            "not connected; nothing to verify",
+	"verify.header":                   "RESULT\tSEVERITY\tEXPECTATION\tDETAIL",
+	"bridge.installed":                "installed the bridge script to %s",
+	"switch.usage":                    "switch needs exactly one connection name",
+	"switch.phase_ok":                 "%s %s: ok (%dms)",
+	"switch.phase_skipped":            "%s %s: skipped",
+	"switch.phase_failed":             "%s %s: failed after %dms",
+	"version.version":                 "fortivpn %s",
+	"version.commit":                  "commit: %s",
+	"version.date":                    "built: %s",
+	"version.go":                      "go: %s %s",
+	"version.backend":                 "backend: %s",
+	"version.bridge":                  "bridge protocol: %d (supported %s)",
+	"version.bridge_error":            "bridge protocol: unavailable: %s (supported %s)",
+	"completion.usage":                "completion needs a shell: bash, zsh or fish",
+	"completion.unknown_shell":        "unknown shell %q; use bash, zsh or fish",
+	"run.no_command":                  "run needs a command, e.g. fortivpn run -- make deploy",
+	"run.disconnect_failed":           "disconnecting after the command failed (exit %d)",
+	"man.written":                     "wrote %d man pages to %s",
+	"man.dir_and_command":             "--dir writes every page; leave out the command",
+	"doctor.backend":                  "backend: %s",
+	"doctor.hint":                     "hint: %s",
+	"show.usage":                      "usage: fortivpn show NAME [--json]",
+	"show.name":                       "name: %s",
+	"show.type":                       "type: %s",
+	"show.gateway":                    "gateway: %s",
+	"show.saml":                       "saml: %s",
+	"show.corporate":                  "corporate: %s",
+	"show.cloud":                      "cloud vpn: %s",
+	"show.default":                    "default: %s",
+	"show.active":                     "active: %s",
+	"set_default.usage":               "usage: fortivpn set-default [NAME | --clear]",
+	"set_default.set":                 "default connection is now %q (saved to %s)",
+	"set_default.cleared":             "default connection cleared (saved to %s); the first connection is used",
+	"set_default.none":                "no default connection set; the first connection is used",
+	"history.none":                    "no matching events in the history",
+	"history.header":                  "TIME\tEVENT\tCONNECTION\tDURATION\tDETAIL",
+	"ip.not_connected":                "not connected",
+	"ip.gateway":                      "gateway: %s (%s)",
+	"ip.no_gateway":                   "gateway: unknown for %q (set \"gateway\" in the config file)",
+	"ip.egress_tunnel":                "public egress ip: %s (through the tunnel, %s)",
+	"ip.egress_outside":               "public egress ip: %s (not through the tunnel, %s)",
+	"ip.egress_failed":                "public egress ip: unknown (%s: %s)",
+	"speedtest.not_connected":         "not connected; connect first so the test runs through the tunnel",
+	"speedtest.outside_tunnel":        "%s is not routed through the tunnel; the results measure the local network",
+	"speedtest.header":                "%s (%s) to %s",
+	"speedtest.latency":               "latency: avg %dms, max %dms, loss %.0f%%",
+	"speedtest.throughput":            "%s: %.1f Mbit/s (%.1f MB in %.1fs)",
+	"speedtest.failed":                "%s: failed: %s",
+	"ping.header":                     "KIND\tCONNECTION\tADDRESS\tAVG\tMAX\tLOSS",
+	"ping.host_needs_tunnel":          "not connected; skipping %s, which is only timed through the tunnel",
+	"ping.no_answer":                  "no target answered",
+	"app.no_subcommand":               "missing app subcommand: status, quit or restart",
+	"app.unknown":                     "unknown app subcommand %q",
+	"app.not_running":                 "FortiClient is not running",
+	"app.running":                     "FortiClient is running (pid %s, started %s)",
+	"app.version":                     "installed version: %s",
+	"app.responding":                  "responding (current connection: %s)",
+	"app.not_responding":              "not responding to state queries; `fortivpn app restart` usually fixes a wedged app",
+	"app.confirm_quit":                "quitting FortiClient disconnects %s; continue? [y/N] ",
+	"app.quit":                        "FortiClient quit",
+	"app.started":                     "FortiClient started",
+	"follow.upgrade_pending":          "(upgrade pending)",
+	"disconnect.other_active":         "%q is connected, not %s; leaving it up",
+	"tui.needs_terminal":              "tui needs an interactive terminal",
+	"tui.uptime":                      "uptime: %s",
+	"tui.tunnel":                      "tunnel: %s %s",
+	"tui.auto":                        "auto-reconnect: %s",
+	"tui.connections":                 "Connections",
+	"tui.active":                      "(active)",
+	"tui.events":                      "Recent events",
+	"tui.busy":                        "%s...",
+	"tui.done":                        "%s: done",
+	"tui.failed":                      "%s failed (exit %d): %s",
+	"tui.keys":                        "up/down select  enter connect  d disconnect  a auto-reconnect  r refresh  q quit",
+	"self_update.available":           "fortivpn %s is available (installed: %s): %s",
+	"self_update.current":             "fortivpn %s is up to date (latest release: %s)",
+	"self_update.dev_build":           "this is a development build; use --force to replace it with release %s",
+	"self_update.downloading":         "downloading %s (%s)",
+	"self_update.updated":             "updated %s from %s to %s",
+	"self_update.unsigned":            "--insecure-skip-signature: only the checksum is verified",
+	"self_update.key_ignored":         "self_update.public_key is ignored: this build has a release key built in",
+	"self_update.bridge_failed":       "failed to update the bridge in %s: %s",
+	"debug_bundle.written":            "wrote %s (%d files); look through it before attaching it to a bug report",
+	"service.no_subcommand":           "service needs a subcommand: install, uninstall, start, stop, status",
+	"service.unknown":                 "unknown service subcommand %q",
+	"service.unsupported":             "service needs launchd (macOS); launchctl was not found",
+	"service.installed":               "installed %s: runs `fortivpn %s`, logging to %s",
+	"service.started":                 "service started",
+	"service.stopped":                 "service stopped; it starts again at the next login unless uninstalled",
+	"service.uninstalled":             "removed %s",
+	"service.not_installed":           "service is not installed; see `fortivpn service install`",
+	"service.not_running":             "service is not running",
+	"service.status_plist":            "Plist: %s",
+	"service.status_state":            "State: %s",
+	"service.status_connection":       "Connection: %s",
+	"service.status_last_exit":        "Last exit code: %d",
+	"service.status_log":              "Log: %s",
+	"service.state_running":           "running (pid %d)",
+	"service.state_loaded":            "loaded, not running",
+	"service.state_unloaded":          "not loaded",
+	"service.default_connection":      "(default)",
+	"connections.config_invalid":      "ignoring the config: %v",
+	"connections.export_no_gateway":   "%q: no gateway found; set \"gateway\" for it in the config or fill it in before importing",
+	"connections.exported":            "exported %d connections to %s",
+	"connections.import_usage":        "usage: fortivpn connections import FILE [--dry-run] (FILE may be - for stdin)",
+	"connections.import_present":      "%s: already present, skipped",
+	"connections.import_would_create": "%s: would create (%s)",
+	"connections.import_created":      "%s: created (%s)",
+	"connections.import_failed":       "%s: %v",
+	"connections.import_dry_summary":  "%d to create, %d already present",
+	"connections.import_summary":      "%d created, %d already present, %d failed",
+	"connections.add_usage":           "usage: fortivpn connections add CONNECTION --gateway HOST[:PORT] [--port N] [--type ssl|ipsec] [--saml]",
+	"connections.added":               "%s: created (%s)",
+	"connections.remove_usage":        "usage: fortivpn connections remove NAME [--yes]",
+	"connections.confirm_remove":      "Remove %q from FortiClient? [y/N] ",
+	"connections.removed":             "%s: removed",
+	"connections.still_configured":    "%q is still named in the config (%s)",
+	"format.with_json":                "--format cannot be combined with --json or --output",
+	"bridge.pong":                     "bridge ok: protocol %d, %s, %dms",
+	"bridge.no_subcommand":            "bridge needs a subcommand: install or ping",
+	"bridge.unknown":                  "unknown bridge subcommand %q",
+	"config.no_subcommand":            "config needs a subcommand: init, validate, edit, show, encrypt-value, decrypt-value, messages",
+	"config.init_exists":              "%s already exists; pass --force to overwrite it",
+	"config.init_written":             "wrote %s",
+	"config.validate_missing":         "no config file at %s; the defaults apply",
+	"config.valid":                    "%s is valid",
+	"config.edit_unchanged":           "no changes",
+	"config.edit_saved":               "saved %s",
+	"config.edit_again":               "edit again? [Y/n] ",
+	"config.edit_kept":                "%s was left unchanged; your edits are in %s",
+	"config.setting_undecryptable":    "ignoring an encrypted setting: %v",
+	"config.unknown":                  "unknown config subcommand %q",
+	"config.messages_args":            "config messages takes no arguments",
+	"group.record_failed":             "failed to record group usage: %v",
+	"history.record_failed":           "failed to record history: %v",
+	"report.wrote":                    "wrote %s",
+	"report.unknown_format":           "unknown --format %q (want md or html)",
+	"gateway.connection":              "connection: %s",
+	"gateway.address":                 "gateway: %s",
+	"gateway.resolved":                "addresses: %s",
+	"gateway.tls":                     "tls: %s %s",
+	"gateway.trusted":                 "trusted: yes",
+	"gateway.untrusted":               "trusted: no (%s)",
+	"gateway.cert":                    "certificate %d: %s",
+	"gateway.cert_issuer":             "  issuer: %s",
+	"gateway.cert_names":              "  names: %s",
+	"gateway.cert_validity":           "  valid: %s to %s (%d days left)",
+	"gateway.cert_sha256":             "  sha256: %s",
+	"gateway.cert_key_sha256":         "  public key sha256: %s",
+	"gateway.warning":                 "%s",
+	"gateway.pin":                     "%v",
+	"gateway.pin_ok":                  "pin: ok",
+	"whoami.not_connected":            "not connected; no VPN identity",
+	"whoami.user":                     "user: %s",
+	"whoami.auth":                     "auth method: %s",
+	"whoami.source":                   "source: %s",
+	"upgrade.pending":                 "FortiClient upgrade pending: %s; restart the app before connecting",
+	"lock.armed":                      "disconnect lock armed: %s",
+	"lock.released":                   "disconnect lock released (was %s)",
+	"lock.none":                       "no disconnect lock armed",
+	"lock.overridden":                 "forcing %s despite the disconnect lock: %s",
+	"lock.negative_ttl":               "--ttl must not be negative",
+	"status.lock":                     "lock: %s",
+	"annotate.needs_note":             "annotate needs a note, e.g. fortivpn annotate \"gateway maintenance\"",
+	"annotate.recorded":               "annotation recorded (connection: %s)",
+	"proxy.none":                      "no system or environment proxy configured",
+	"proxy.entry":                     "%s: %s",
+	"proxy.affects_gateway":           "%s; connects may time out (add the gateway to the proxy exceptions)",
+	"dns.not_connected":               "not connected",
+	"dns.none":                        "no DNS resolvers are scoped to %s; names resolve through the local network",
+	"dns.nameservers":                 "nameservers: %s",
+	"dns.domain":                      "  domain: %s",
+	"dns.search":                      "  search domains: %s",
+	"dns.system":                      "system resolver: %s",
+	"dns.domain_not_routed":           "%s was pushed, but neither the system resolver nor a resolver for that domain uses the tunnel's servers; its names resolve through the local network",
+	"dns.not_default":                 "the tunnel's nameservers are not the system resolver and no domain is sent to them; the VPN's DNS is not in use",
+	"dns.system_differs":              "the tunnel's nameservers resolve %s but the system resolver does not; the VPN's DNS did not take effect",
+	"dns.no_query":                    "no name to test with; pass --name or configure a dns check",
+	"split.not_connected":             "not connected",
+	"split.one_destination":           "split-tunnel takes at most one destination",
+	"split.mode":                      "mode: %s",
+	"split.header":                    "ROUTE\tKIND\tDESTINATION\tSOURCE",
+	"split.via_tunnel":                "%s (%s) goes through the tunnel (%s)",
+	"split.outside_tunnel":            "%s (%s) bypasses the tunnel, via %s",
+	"simulate.start":                  "Simulating %q with %s for %s; no real tunnel is touched.",
+	"simulate.done":                   "Simulation finished after %s.",
+	"crash.report":                    "internal error: %v; a diagnostic report was written to %s (secrets redacted; nothing was sent)",
+	"bridge.invalid_timeout":          "invalid --bridge-timeout %q (want seconds, 0 for none)",
+	"oplock.waiting":                  "waiting for another fortivpn operation to finish (%s)",
+	"proxy.gateway_clear":             "gateway %s is not affected by the proxy settings",
+	"translation.ignored":             "ignoring translation %s: %v",
+}
+
+var translations map[string]string
+
+// configureLocale loads the first translation found for FORTIVPN_LANG, the
+// configured locale, or the usual LC_ALL / LC_MESSAGES / LANG variables.
+// English needs no file; a missing or broken translation leaves English.
+func configureLocale(configured string) {
+	translations = nil
+	locale := firstNonEmpty(os.Getenv("FORTIVPN_LANG"), configured, os.Getenv("LC_ALL"), os.Getenv("LC_MESSAGES"), os.Getenv("LANG"))
+	for _, candidate := range localeCandidates(locale) {
+		loaded, err := loadTranslation(candidate)
+		if err == nil {
+			translations = loaded
+			return
+		}
+	}
+}
+
+// localeCandidates turns "pt_BR.UTF-8" into ["pt_BR", "pt"].
+func localeCandidates(locale string) []string {
+	locale, _, _ = strings.Cut(strings.TrimSpace(locale), ".")
+	locale, _, _ = strings.Cut(locale, "@")
+	locale = strings.ReplaceAll(locale, "-", "_")
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return nil
+	}
+	language, _, _ := strings.Cut(locale, "_")
+	if strings.EqualFold(language, "en") {
+		return nil
+	}
+	if language == locale {
+		return []string{locale}
+	}
+	return []string{locale, language}
+}
+
+func loadTranslation(locale string) (map[string]string, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(filepath.Join(filepath.Dir(path), "locales", locale+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var loaded map[string]string
+	if err := json.Unmarshal(raw, &loaded); err != nil {
+		warnf("translation.ignored", locale, err)
+		return nil, err
+	}
+	return loaded, nil
+}
+
+// msg formats the message id in the active locale. A translation whose
+// verbs do not match the English original is ignored for that message.
+func msg(id string, args ...any) string {
+	if format, ok := translations[id]; ok {
+		if text := fmt.Sprintf(format, args...); !strings.Contains(text, "%!") {
+			return text
+		}
+	}
+	format, ok := messages[id]
+	if !ok {
+		format = id
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+func warnf(id string, args ...any) {
+	if quiet {
+		return
+	}
+	fmt.Fprintln(os.Stderr, msg("warning", msg(id, args...)))
+}
+
+// runConfigMessages prints the message catalog, merged with the active
+// translation, as a starting point for a new locales/<locale>.json.
+func runConfigMessages(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, msg("error", msg("config.messages_args")))
+		return 2
+	}
+	catalog := make(map[string]string, len(messages))
+	for id, text := range messages {
+		catalog[id] = text
+		if translated, ok := translations[id]; ok {
+			catalog[id] = translated
+		}
+	}
+	return printJSON(catalog)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MockFixture describes what the mock backend pretends FortiClient has:
+// its connection list, the tunnel it starts on and how it behaves when
+// asked to connect.
+type MockFixture struct {
+	Connections    []Tunnel `json:"connections"`
+	Connected      string   `json:"connected,omitempty"`
+	ConnectDelayMS int64    `json:"connect_delay_ms,omitempty"`
+	DropAfterMS    int64    `json:"drop_after_ms,omitempty"`
+	FailConnect    []string `json:"fail_connect,omitempty"`
+}
+
+func (f MockFixture) failsConnect(name string) bool {
+	return slices.Contains(f.FailConnect, "*") || slices.Contains(f.FailConnect, name)
+}
+
+// mockState is what changed since the fixture was loaded. It lives in the
+// state directory so successive commands see each other's transitions.
+type mockState struct {
+	Fixture    string `json:"fixture"`
+	Connection string `json:"connection"`
+	UpAtMS     int64  `json:"up_at_ms"`
+}
+
+// mockBackend serves FORTIVPN_MOCK_FIXTURE instead of FortiClient, for
+// scripting against the CLI in CI and for demos.
+type mockBackend struct {
+	path string
+}
+
+func newMockBackend() (Backend, error) {
+	path := strings.TrimSpace(os.Getenv("FORTIVPN_MOCK_FIXTURE"))
+	if path == "" {
+		return nil, errors.New("the mock backend needs FORTIVPN_MOCK_FIXTURE pointing at a JSON fixture")
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return mockBackend{path: abs}, nil
+}
+
+func (b mockBackend) fixture() (MockFixture, error) {
+	raw, err := os.ReadFile(b.path)
+	if err != nil {
+		return MockFixture{}, fmt.Errorf("failed to read mock fixture: %w", err)
+	}
+	var fixture MockFixture
+	if err := json.Unmarshal(raw, &fixture); err != nil {
+		return MockFixture{}, fmt.Errorf("invalid mock fixture %s: %w", b.path, err)
+	}
+	for i, tunnel := range fixture.Connections {
+		if tunnel.Type == "" {
+			fixture.Connections[i].Type = "ssl"
+		}
+	}
+	return fixture, nil
+}
+
+func mockStatePath() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mock-state.json"), nil
+}
+
+// load returns the fixture and the current mock state, starting over from
+// the fixture's "connected" when the fixture file changes.
+func (b mockBackend) load() (MockFixture, mockState, error) {
+	fixture, err := b.fixture()
+	if err != nil {
+		return MockFixture{}, mockState{}, err
+	}
+	path, err := mockStatePath()
+	if err != nil {
+		return MockFixture{}, mockState{}, err
+	}
+	var state mockState
+	if raw, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(raw, &state)
+	}
+	if state.Fixture != b.path {
+		state = mockState{Fixture: b.path, Connection: fixture.Connected, UpAtMS: time.Now().UnixMilli()}
+	}
+	return fixture, state, nil
+}
+
+func (b mockBackend) save(state mockState) error {
+	path, err := mockStatePath()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, body, 0o600)
+}
+
+func (b mockBackend) ListConnections() ([]Tunnel, error) {
+	fixture, err := b.fixture()
+	if err != nil {
+		return nil, err
+	}
+	return fixture.Connections, nil
+}
+
+func (b mockBackend) GetState() (TunnelState, error) {
+	fixture, state, err := b.load()
+	if err != nil {
+		return TunnelState{}, err
+	}
+	now := time.Now().UnixMilli()
+	if state.Connection != "" && fixture.DropAfterMS > 0 && now >= state.UpAtMS+fixture.DropAfterMS {
+		state.Connection = ""
+		if err := b.save(state); err != nil {
+			return TunnelState{}, err
+		}
+	}
+	if state.Connection == "" || now < state.UpAtMS {
+		return TunnelState{}, nil
+	}
+	result := TunnelState{ConnectionName: state.Connection, SSLState: 1}
+	for _, tunnel := range fixture.Connections {
+		if tunnel.ConnectionName == state.Connection && tunnel.Type == "ipsec" {
+			result = TunnelState{ConnectionName: state.Connection, IPSecState: 1}
+		}
+	}
+	return result, nil
+}
+
+func (b mockBackend) Connect(target Tunnel) error {
+	fixture, state, err := b.load()
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(fixture.Connections, func(t Tunnel) bool { return t.ConnectionName == target.ConnectionName }) {
+		return fmt.Errorf("mock: no connection named %q in the fixture", target.ConnectionName)
+	}
+	if fixture.failsConnect(target.ConnectionName) {
+		return fmt.Errorf("mock: connecting %s failed", target.ConnectionName)
+	}
+	state.Connection = target.ConnectionName
+	state.UpAtMS = time.Now().UnixMilli() + fixture.ConnectDelayMS
+	return b.save(state)
+}
+
+func (b mockBackend) Disconnect(TunnelState) error {
+	_, state, err := b.load()
+	if err != nil {
+		return err
+	}
+	state.Connection = ""
+	return b.save(state)
+}
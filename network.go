@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+type TunnelInfo struct {
+	Interface   string   `json:"interface"`
+	IPv4        []string `json:"ipv4,omitempty"`
+	IPv6        []string `json:"ipv6,omitempty"`
+	IPv4Routes  int      `json:"ipv4_routes"`
+	IPv6Routes  int      `json:"ipv6_routes"`
+	CarriesIPv6 bool     `json:"carries_ipv6"`
+}
+
+func normalizeFamily(family string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(family)) {
+	case "", "any", "dual":
+		return "any", nil
+	case "4", "ipv4", "inet":
+		return "ipv4", nil
+	case "6", "ipv6", "inet6":
+		return "ipv6", nil
+	case "prefer-ipv4":
+		return "prefer-ipv4", nil
+	case "prefer-ipv6":
+		return "prefer-ipv6", nil
+	default:
+		return "", fmt.Errorf("unknown address family %q (want any, ipv4, ipv6, prefer-ipv4 or prefer-ipv6)", family)
+	}
+}
+
+func familyNetwork(base, family string) string {
+	switch family {
+	case "ipv4":
+		return base + "4"
+	case "ipv6":
+		return base + "6"
+	default:
+		return base
+	}
+}
+
+func orderByFamily(ips []net.IP, family string) []net.IP {
+	if family != "prefer-ipv4" && family != "prefer-ipv6" {
+		return ips
+	}
+	wantV4 := family == "prefer-ipv4"
+	preferred := make([]net.IP, 0, len(ips))
+	rest := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		if (ip.To4() != nil) == wantV4 {
+			preferred = append(preferred, ip)
+		} else {
+			rest = append(rest, ip)
+		}
+	}
+	return append(preferred, rest...)
+}
+
+func matchesFamily(ip net.IP, family string) bool {
+	switch family {
+	case "ipv4":
+		return ip.To4() != nil
+	case "ipv6":
+		return ip.To4() == nil
+	default:
+		return true
+	}
+}
+
+func detectTunnel() (*TunnelInfo, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list network interfaces: %w", err)
+	}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || !isTunnelInterfaceName(iface.Name) {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		info := &TunnelInfo{Interface: iface.Name}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLinkLocalUnicast() || ipNet.IP.IsLoopback() {
+				continue
+			}
+			if ipNet.IP.To4() != nil {
+				info.IPv4 = append(info.IPv4, ipNet.IP.String())
+			} else {
+				info.IPv6 = append(info.IPv6, ipNet.IP.String())
+			}
+		}
+		// Idle system utuns (iCloud relay and friends) only carry link-local
+		// addresses; the VPN tunnel always gets a routable address.
+		if len(info.IPv4) == 0 && len(info.IPv6) == 0 {
+			continue
+		}
+
+		info.IPv4Routes = countInterfaceRoutes("inet", iface.Name)
+		info.IPv6Routes = countInterfaceRoutes("inet6", iface.Name)
+		info.CarriesIPv6 = len(info.IPv6) > 0 || info.IPv6Routes > 0
+		return info, nil
+	}
+	return nil, nil
+}
+
+func isTunnelInterfaceName(name string) bool {
+	return strings.HasPrefix(name, "utun") || strings.HasPrefix(name, "ppp") || strings.HasPrefix(name, "tun")
+}
+
+func countInterfaceRoutes(family, iface string) int {
+	out, err := exec.Command("netstat", "-rn", "-f", family).Output()
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if fields[len(fields)-1] == iface || (len(fields) > 3 && fields[3] == iface) {
+			count++
+		}
+	}
+	return count
+}
+
+func printTunnelInfo(info *TunnelInfo) {
+	if info == nil {
+		return
+	}
+	fmt.Println(msg("tunnel.interface", info.Interface))
+	if len(info.IPv4) > 0 {
+		fmt.Println(msg("tunnel.ipv4", strings.Join(info.IPv4, ", "), info.IPv4Routes))
+	}
+	if info.CarriesIPv6 {
+		fmt.Println(msg("tunnel.ipv6", emptyAsUnknown(strings.Join(info.IPv6, ", ")), info.IPv6Routes))
+	} else {
+		fmt.Println(msg("tunnel.ipv6_not_carried"))
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+var errBusy = errors.New("another fortivpn operation is in progress")
+
+// operationLock serializes everything that changes the tunnel across
+// fortivpn processes of the same user. It is reentrant within a process, so
+// connect can hold it for the whole command while the disconnect and
+// connect steps inside take it again; watch takes it per reconnect. The
+// kernel drops it when a process dies, so a crash never leaves it stuck.
+var operationLock struct {
+	file  *os.File
+	depth int
+}
+
+// operationNoWait makes a held lock fail fast with errBusy instead of
+// queueing behind it.
+var operationNoWait bool
+
+func acquireOperationLock(operation string) (func(), error) {
+	if operationLock.depth > 0 {
+		operationLock.depth++
+		return releaseOperationLock, nil
+	}
+	dir, err := stateDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, "operation.lock"), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the operation lock: %w", err)
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		holder, _ := io.ReadAll(file)
+		description := firstNonEmpty(strings.TrimSpace(string(holder)), "unknown")
+		if operationNoWait || !errors.Is(err, syscall.EWOULDBLOCK) {
+			file.Close()
+			return nil, fmt.Errorf("%w (%s)", errBusy, description)
+		}
+		warnf("oplock.waiting", description)
+		if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to take the operation lock: %w", err)
+		}
+	}
+	_ = file.Truncate(0)
+	_, _ = file.WriteAt([]byte(fmt.Sprintf("pid %d: %s\n", os.Getpid(), operation)), 0)
+	operationLock.file = file
+	operationLock.depth = 1
+	return releaseOperationLock, nil
+}
+
+func releaseOperationLock() {
+	operationLock.depth--
+	if operationLock.depth > 0 {
+		return
+	}
+	_ = operationLock.file.Truncate(0)
+	_ = syscall.Flock(int(operationLock.file.Fd()), syscall.LOCK_UN)
+	operationLock.file.Close()
+	operationLock.file = nil
+}
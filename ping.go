@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// PingTarget is the round-trip time to one gateway or internal host,
+// measured with TCP handshakes because FortiGates commonly drop ICMP.
+type PingTarget struct {
+	Kind       string        `json:"kind"`
+	Connection string        `json:"connection,omitempty"`
+	Address    string        `json:"address"`
+	Latency    LatencySample `json:"latency"`
+	Fastest    bool          `json:"fastest,omitempty"`
+}
+
+func runPing(args []string) int {
+	fs := flag.NewFlagSet("ping", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	connectionArg := fs.String("connection", "", "Only this connection's (or group's) gateway; default: every connection with a known gateway.")
+	host := fs.String("host", "", "Internal host:port to time while connected (default: the latency target, else the first tcp check).")
+	count := fs.Int("count", 5, "Handshakes per target.")
+	asJSON := outputFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *count <= 0 {
+		fmt.Fprintln(os.Stderr, msg("error", "--count must be positive"))
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	tunnels, err := getConnections()
+	if err != nil {
+		return fail(err)
+	}
+	candidates := tunnels
+	if strings.TrimSpace(*connectionArg) != "" {
+		selection, err := resolveSelection(*connectionArg, tunnels, cfg)
+		if err != nil {
+			return fail(err)
+		}
+		candidates = selection.Members
+	}
+
+	var targets []PingTarget
+	profiles := readConnectionProfiles()
+	for _, tunnel := range candidates {
+		detail := ConnectionDetail{ConnectionName: tunnel.ConnectionName}
+		detail.fillProfile(profiles, cfg)
+		if detail.Gateway == "" {
+			continue
+		}
+		address := net.JoinHostPort(detail.Gateway, strconv.Itoa(detail.Port))
+		progress.step("gateway", "timing %s (%s)", address, tunnel.ConnectionName)
+		targets = append(targets, PingTarget{Kind: "gateway", Connection: tunnel.ConnectionName, Address: address,
+			Latency: measureLatency(LatencyConfig{Target: address, Samples: *count})})
+	}
+	fastest := -1
+	for i, target := range targets {
+		if target.Latency.LossPercent < 100 && (fastest < 0 || target.Latency.AvgMS < targets[fastest].Latency.AvgMS) {
+			fastest = i
+		}
+	}
+	if fastest >= 0 && len(targets) > 1 {
+		targets[fastest].Fastest = true
+	}
+
+	if state, err := getTunnelState(); err == nil && state.Connected() {
+		settings := cfg.forConnection(state.CurrentConnection())
+		address := strings.TrimSpace(*host)
+		if address == "" && settings.Latency != nil {
+			address = settings.Latency.Target
+		}
+		if address == "" {
+			if i := slices.IndexFunc(settings.Checks, func(check CheckConfig) bool { return strings.EqualFold(check.Type, "tcp") }); i >= 0 {
+				address = settings.Checks[i].Address
+			}
+		}
+		if address != "" {
+			progress.step("internal", "timing %s through the tunnel", address)
+			targets = append(targets, PingTarget{Kind: "internal", Connection: state.CurrentConnection(), Address: address,
+				Latency: measureLatency(LatencyConfig{Target: address, Samples: *count})})
+		}
+	} else if *host != "" {
+		warnf("ping.host_needs_tunnel", *host)
+	}
+	if len(targets) == 0 {
+		return fail(fmt.Errorf("%w: no gateway configured for any selected connection (set \"gateway\" in the config file)", errNotFound))
+	}
+
+	if *asJSON {
+		if code := printJSON(targets); code != 0 {
+			return code
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, msg("ping.header"))
+		for _, target := range targets {
+			mark := ""
+			if target.Fastest {
+				mark = " *"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%dms\t%dms\t%.0f%%%s\n", target.Kind, target.Connection, target.Address,
+				target.Latency.AvgMS, target.Latency.MaxMS, target.Latency.LossPercent, mark)
+		}
+		w.Flush()
+	}
+	if !slices.ContainsFunc(targets, func(target PingTarget) bool { return target.Latency.LossPercent < 100 }) {
+		fmt.Fprintln(os.Stderr, msg("error", msg("ping.no_answer")))
+		return 1
+	}
+	return 0
+}
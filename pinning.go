@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var errGatewayPinMismatch = errors.New("gateway certificate does not match the pin")
+
+// PinConfig pins a connection's gateway certificate. Pins are hex SHA-256
+// fingerprints of a certificate or of its public key (SPKI), as printed by
+// gateway-info; any certificate in the presented chain may match. With TOFU
+// the first public key seen is remembered and later changes are flagged.
+type PinConfig struct {
+	Pins   []string `json:"pins,omitempty"`
+	TOFU   bool     `json:"tofu,omitempty"`
+	Strict bool     `json:"strict,omitempty"`
+}
+
+type GatewayPinState struct {
+	PublicKeySHA256 string `json:"public_key_sha256"`
+	FirstSeen       int64  `json:"first_seen"`
+}
+
+func (c PinConfig) validate() error {
+	if len(c.Pins) == 0 && !c.TOFU {
+		return errors.New("needs pins or tofu")
+	}
+	for _, pin := range c.Pins {
+		if _, err := hex.DecodeString(normalizePin(pin)); err != nil || len(normalizePin(pin)) != 64 {
+			return fmt.Errorf("pin %q is not a hex SHA-256 fingerprint", pin)
+		}
+	}
+	return nil
+}
+
+func normalizePin(pin string) string {
+	pin = strings.ToLower(strings.TrimSpace(pin))
+	pin = strings.TrimPrefix(pin, "sha256:")
+	pin = strings.TrimPrefix(pin, "sha256/")
+	return strings.ReplaceAll(pin, ":", "")
+}
+
+// checkGatewayPin inspects the connection's gateway and compares it with the
+// configured pins or the remembered key. It returns nil when no pinning is
+// configured, and an error wrapping errGatewayPinMismatch on a change.
+func checkGatewayPin(settings Settings) error {
+	if settings.GatewayPinning == nil || settings.Gateway == "" {
+		return nil
+	}
+	info, err := inspectGateway(settings.Gateway, defaultCheckTimeout)
+	if err != nil {
+		return fmt.Errorf("could not verify gateway pin: %w", err)
+	}
+	return matchGatewayPin(info, *settings.GatewayPinning, false)
+}
+
+// pinRefuses reports whether a pin error should block the connection: only
+// mismatches do, and only in strict mode.
+func pinRefuses(err error, settings Settings, strict bool) bool {
+	if !errors.Is(err, errGatewayPinMismatch) {
+		return false
+	}
+	return strict || (settings.GatewayPinning != nil && settings.GatewayPinning.Strict)
+}
+
+// matchGatewayPin checks info against pins and, for TOFU, the stored key.
+// With trust, a changed TOFU key replaces the stored one instead of failing.
+func matchGatewayPin(info GatewayInfo, pinning PinConfig, trust bool) error {
+	if len(info.Chain) == 0 {
+		return fmt.Errorf("%w: no certificate presented", errGatewayPinMismatch)
+	}
+	leaf := info.Chain[0]
+
+	if len(pinning.Pins) > 0 {
+		for _, pin := range pinning.Pins {
+			for _, cert := range info.Chain {
+				if normalizePin(pin) == cert.SHA256 || normalizePin(pin) == cert.PublicKeySHA256 {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("%w: %s presented %q with key %s", errGatewayPinMismatch, info.Gateway, leaf.Subject, leaf.PublicKeySHA256)
+	}
+
+	state, err := loadState()
+	if err != nil {
+		return err
+	}
+	known, ok := state.Gateways[info.Gateway]
+	if ok && known.PublicKeySHA256 == leaf.PublicKeySHA256 {
+		return nil
+	}
+	if ok && !trust {
+		return fmt.Errorf("%w: %s changed its key from %s (first seen %s) to %s; run gateway-info --trust if this is expected",
+			errGatewayPinMismatch, info.Gateway, known.PublicKeySHA256, time.Unix(known.FirstSeen, 0).Format("2006-01-02"), leaf.PublicKeySHA256)
+	}
+	if state.Gateways == nil {
+		state.Gateways = map[string]GatewayPinState{}
+	}
+	state.Gateways[info.Gateway] = GatewayPinState{PublicKeySHA256: leaf.PublicKeySHA256, FirstSeen: time.Now().Unix()}
+	return saveState(state)
+}
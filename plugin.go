@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// backendPluginPrefix names executables that provide a backend, like
+// kubectl plugins: fortivpn-backend-corp on PATH is --backend corp.
+const backendPluginPrefix = "fortivpn-backend-"
+
+func findBackendPlugin(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", errors.New("invalid backend plugin name")
+	}
+	return exec.LookPath(backendPluginPrefix + name)
+}
+
+// backendPlugins lists the plugin names found on PATH.
+func backendPlugins() []string {
+	var names []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		matches, _ := filepath.Glob(filepath.Join(dir, backendPluginPrefix+"*"))
+		for _, match := range matches {
+			name := strings.TrimPrefix(filepath.Base(match), backendPluginPrefix)
+			if isExecutableFile(match) && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// pluginBackend runs a backend plugin once per call. It gets the same
+// request the bridge daemon does, {"action": ..., "payload": ...}, as one
+// line on stdin and answers with a bridge response on stdout, so a plugin
+// supports the same actions and error codes as the bridge.
+type pluginBackend struct {
+	name string
+	path string
+}
+
+func (b pluginBackend) call(action string, payload any) (json.RawMessage, error) {
+	if bridgeTrace == nil {
+		return b.run(action, payload)
+	}
+	start := time.Now()
+	result, err := b.run(action, payload)
+	traceBridge(action, payload, start, result, err)
+	return result, err
+}
+
+func (b pluginBackend) run(action string, payload any) (json.RawMessage, error) {
+	bridgesInFlight.Add(1)
+	defer bridgesInFlight.Add(-1)
+	request, err := json.Marshal(map[string]any{"action": action, "payload": payload})
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	ctx, cancel := bridgeContext()
+	defer cancel()
+	cmd := exec.CommandContext(ctx, b.path)
+	cmd.WaitDelay = time.Second
+	cmd.Stdin = bytes.NewReader(append(request, '\n'))
+	var errBuf bytes.Buffer
+	cmd.Stderr = &errBuf
+	out, err := cmd.Output()
+	stderr := bytes.TrimSpace(errBuf.Bytes())
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		err = bridgeTimeoutError(b.name + " " + action)
+	case context.Canceled:
+		err = errCanceled
+	}
+	timeBridge(start)
+	rememberBridge(action, []string{string(request)}, out, stderr)
+	if errors.Is(err, errBridgeTimedOut) || errors.Is(err, errCanceled) {
+		return nil, err
+	}
+	return parseBridgeOutput(b.name+" "+action, out, stderr, err)
+}
+
+func (b pluginBackend) ListConnections() ([]Tunnel, error) {
+	result, err := b.call("list-connections", nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTunnels(result)
+}
+
+func (b pluginBackend) GetState() (TunnelState, error) {
+	result, err := b.call("get-state", nil)
+	if err != nil {
+		return TunnelState{}, err
+	}
+	return decodeTunnelState(result)
+}
+
+func (b pluginBackend) Connect(target Tunnel) error {
+	_, err := b.call("connect", connectPayload(target))
+	return err
+}
+
+func (b pluginBackend) Disconnect(state TunnelState) error {
+	_, err := b.call("disconnect", disconnectPayload(state))
+	return err
+}
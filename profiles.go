@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const profilesVersion = 1
+
+// ConnectionProfile is a tunnel definition as `connections export` writes
+// it and `connections import` creates it. Credentials are never part of it.
+type ConnectionProfile struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Gateway string `json:"gateway"`
+	Port    int    `json:"port,omitempty"`
+	SAML    bool   `json:"saml,omitempty"`
+}
+
+type profileFile struct {
+	Version     int                 `json:"version"`
+	Connections []ConnectionProfile `json:"connections"`
+}
+
+func (p ConnectionProfile) validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("name is required")
+	}
+	switch p.Type {
+	case "ssl", "ipsec":
+	default:
+		return fmt.Errorf("type: unknown value %q (want ssl or ipsec)", p.Type)
+	}
+	if p.Port < 0 || p.Port > 65535 {
+		return fmt.Errorf("port %d is out of range", p.Port)
+	}
+	return nil
+}
+
+// addConnection creates a FortiClient tunnel through the bridge. An export
+// may lack the gateway (FortiClient did not report it), so that is checked
+// here rather than when the file is read.
+func addConnection(profile ConnectionProfile) error {
+	if strings.TrimSpace(profile.Gateway) == "" {
+		return errors.New("gateway is required")
+	}
+	defer invalidateConnectionList()
+	_, err := bridgeAction("add-connection", map[string]any{
+		"connection_name":     profile.Name,
+		"connection_type":     profile.Type,
+		"server":              profile.Gateway,
+		"port":                profile.Port,
+		"saml":                profile.SAML,
+		"forticlient_version": installedFortiClientVersion(),
+	})
+	return err
+}
+
+// removeConnection deletes a FortiClient tunnel through the bridge.
+func removeConnection(tunnel Tunnel) error {
+	defer invalidateConnectionList()
+	_, err := bridgeAction("remove-connection", map[string]string{
+		"connection_name":     tunnel.ConnectionName,
+		"connection_type":     tunnel.Type,
+		"forticlient_version": installedFortiClientVersion(),
+	})
+	return err
+}
+
+func runConnectionsAdd(args []string) int {
+	fs := flag.NewFlagSet("connections add", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	gateway := fs.String("gateway", "", "Gateway host, optionally with :PORT (required).")
+	port := fs.Int("port", 0, "Gateway port (default: the one in --gateway, else 443).")
+	tunnelType := fs.String("type", "ssl", "Tunnel type: ssl or ipsec.")
+	saml := fs.Bool("saml", false, "Sign in with SAML single sign-on.")
+	name, args := leadingArgument(args)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if name == "" && fs.NArg() > 0 {
+		name = fs.Arg(0)
+	}
+	if name == "" || fs.NArg() > 1 || strings.TrimSpace(*gateway) == "" {
+		fmt.Fprintln(os.Stderr, msg("error", msg("connections.add_usage")))
+		return 2
+	}
+
+	profile := ConnectionProfile{Name: strings.TrimSpace(name), Type: strings.ToLower(*tunnelType), Gateway: strings.TrimSpace(*gateway), Port: *port}
+	if host, portText, err := net.SplitHostPort(strings.TrimSuffix(strings.TrimPrefix(profile.Gateway, "https://"), "/")); err == nil {
+		profile.Gateway = host
+		if profile.Port == 0 {
+			profile.Port, _ = strconv.Atoi(portText)
+		}
+	}
+	profile.SAML = *saml
+	if err := profile.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, msg("error", err))
+		return 2
+	}
+	tunnels, err := getConnections()
+	if err != nil {
+		return fail(err)
+	}
+	if containsFold(tunnelNames(tunnels), profile.Name) {
+		return fail(fmt.Errorf("connection %q already exists", profile.Name))
+	}
+	if err := addConnection(profile); err != nil {
+		return fail(err)
+	}
+	fmt.Println(msg("connections.added", profile.Name, profileLabel(profile)))
+	return 0
+}
+
+// runConnectionsRemove deletes a connection by its exact name; a partial
+// match such as "prod" is fine for connecting but not for deleting.
+func runConnectionsRemove(args []string) int {
+	fs := flag.NewFlagSet("connections remove", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	yes := fs.Bool("yes", false, "Remove without asking.")
+	name, args := leadingArgument(args)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if name == "" && fs.NArg() > 0 {
+		name = fs.Arg(0)
+	}
+	if name == "" || fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, msg("error", msg("connections.remove_usage")))
+		return 2
+	}
+
+	tunnels, err := getConnections()
+	if err != nil {
+		return fail(err)
+	}
+	index := slices.IndexFunc(tunnels, func(t Tunnel) bool { return strings.EqualFold(t.ConnectionName, strings.TrimSpace(name)) })
+	if index < 0 {
+		return fail(fmt.Errorf("connection %q %w; available: %s", name, errNotFound, strings.Join(tunnelNames(tunnels), ", ")))
+	}
+	tunnel := tunnels[index]
+	if state, err := getTunnelState(); err == nil && state.Connected() && strings.EqualFold(state.CurrentConnection(), tunnel.ConnectionName) {
+		return fail(fmt.Errorf("%q is connected; disconnect it first", tunnel.ConnectionName))
+	}
+	if !*yes {
+		if !stdinIsTerminal() {
+			return fail(fmt.Errorf("%w: pass --yes to remove %q", errDeclined, tunnel.ConnectionName))
+		}
+		fmt.Fprint(os.Stderr, msg("connections.confirm_remove", tunnel.ConnectionName))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			return fail(fmt.Errorf("%w: kept %q", errDeclined, tunnel.ConnectionName))
+		}
+	}
+	if err := removeConnection(tunnel); err != nil {
+		return fail(err)
+	}
+	fmt.Println(msg("connections.removed", tunnel.ConnectionName))
+	if cfg, err := loadConfig(); err == nil {
+		for _, place := range configReferences(cfg, tunnel.ConnectionName) {
+			warnf("connections.still_configured", tunnel.ConnectionName, place)
+		}
+	}
+	return 0
+}
+
+// configReferences lists where the config still names connection.
+func configReferences(cfg Config, connection string) []string {
+	var places []string
+	if strings.EqualFold(cfg.DefaultConnection, connection) {
+		places = append(places, "default_connection")
+	}
+	for name, group := range cfg.Groups {
+		if containsFold(group.Members, connection) {
+			places = append(places, "groups."+name)
+		}
+	}
+	sort.Strings(places)
+	if _, ok := cfg.Connections[connection]; ok {
+		places = append(places, "connections."+connection)
+	}
+	if cfg.Fallback != nil && strings.EqualFold(cfg.Fallback.Connection, connection) {
+		places = append(places, "fallback")
+	}
+	return places
+}
+
+// leadingArgument takes a positional argument given before the flags, as
+// in "connections remove NAME --yes".
+func leadingArgument(args []string) (string, []string) {
+	if len(args) > 0 && (args[0] == "-" || !strings.HasPrefix(args[0], "-")) {
+		return args[0], args[1:]
+	}
+	return "", args
+}
+
+func runConnectionsExport(args []string) int {
+	fs := flag.NewFlagSet("connections export", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	var connectionArgs stringList
+	fs.Var(&connectionArgs, "connection", "Export only this connection; repeat for several (default: all).")
+	output := fs.String("file", "", "Write to this file instead of stdout; a .json name selects JSON.")
+	asJSON := outputFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	tunnels, err := getConnections()
+	if err != nil {
+		return fail(err)
+	}
+	if len(connectionArgs) > 0 {
+		var selected []Tunnel
+		for _, name := range connectionArgs {
+			tunnel, err := resolveTunnel(name, tunnels)
+			if err != nil {
+				return fail(err)
+			}
+			selected = append(selected, tunnel)
+		}
+		tunnels = selected
+	}
+	file := profileFile{Version: profilesVersion, Connections: []ConnectionProfile{}}
+	profiles := readConnectionProfiles()
+	for _, tunnel := range tunnels {
+		detail := ConnectionDetail{ConnectionName: tunnel.ConnectionName, Type: tunnel.Type}
+		detail.fillProfile(profiles, cfg)
+		if detail.Gateway == "" {
+			warnf("connections.export_no_gateway", tunnel.ConnectionName)
+		}
+		file.Connections = append(file.Connections, ConnectionProfile{
+			Name:    detail.ConnectionName,
+			Type:    firstNonEmpty(detail.Type, "ssl"),
+			Gateway: detail.Gateway,
+			Port:    detail.Port,
+			SAML:    detail.SAML,
+		})
+	}
+
+	// YAML unless --json or --output json asks for JSON; without either,
+	// a .json file name does too.
+	var body []byte
+	if outputFormat != "yaml" && (*asJSON || strings.EqualFold(filepath.Ext(*output), ".json")) {
+		body, err = json.MarshalIndent(file, "", "  ")
+		body = append(body, '\n')
+	} else {
+		body, err = encodeYAML(file)
+		body = append([]byte("# FortiClient connection profiles; create them with `fortivpn connections import FILE`.\n"), body...)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if *output == "" {
+		os.Stdout.Write(body)
+		return 0
+	}
+	if err := writeFileAtomic(*output, body, 0o644); err != nil {
+		return fail(fmt.Errorf("failed to write %s: %w", *output, err))
+	}
+	fmt.Fprintln(os.Stderr, msg("connections.exported", len(file.Connections), *output))
+	return 0
+}
+
+func runConnectionsImport(args []string) int {
+	fs := flag.NewFlagSet("connections import", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	dryRun := fs.Bool("dry-run", false, "Print what would be created without creating anything.")
+	path, args := leadingArgument(args)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if path == "" && fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+	if path == "" || fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, msg("error", msg("connections.import_usage")))
+		return 2
+	}
+
+	var raw []byte
+	var err error
+	if path == "-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return fail(fmt.Errorf("failed to read %s: %w", path, err))
+	}
+	profiles, err := parseProfiles(raw)
+	if err != nil {
+		return fail(fmt.Errorf("failed to parse %s: %w", path, err))
+	}
+
+	tunnels, err := getConnections()
+	if err != nil {
+		return fail(err)
+	}
+	created, present := 0, 0
+	var lastErr error
+	for _, profile := range profiles {
+		if containsFold(tunnelNames(tunnels), profile.Name) {
+			fmt.Println(msg("connections.import_present", profile.Name))
+			present++
+			continue
+		}
+		if *dryRun {
+			if strings.TrimSpace(profile.Gateway) == "" {
+				warnf("connections.import_failed", profile.Name, "gateway is required")
+				continue
+			}
+			fmt.Println(msg("connections.import_would_create", profile.Name, profileLabel(profile)))
+			created++
+			continue
+		}
+		if err := addConnection(profile); err != nil {
+			warnf("connections.import_failed", profile.Name, err)
+			lastErr = err
+			continue
+		}
+		fmt.Println(msg("connections.import_created", profile.Name, profileLabel(profile)))
+		created++
+	}
+	if *dryRun {
+		fmt.Println(msg("connections.import_dry_summary", created, present))
+	} else {
+		fmt.Println(msg("connections.import_summary", created, present, len(profiles)-created-present))
+	}
+	if lastErr != nil {
+		return exitCodeFor(lastErr)
+	}
+	return 0
+}
+
+// parseProfiles reads an export in JSON or YAML, either the whole file or
+// just its list of connections, and checks every entry before anything is
+// created.
+func parseProfiles(raw []byte) ([]ConnectionProfile, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if !bytes.HasPrefix(trimmed, []byte("[")) && !bytes.HasPrefix(trimmed, []byte("{")) {
+		var doc any
+		if err := decodeYAML(raw, &doc); err != nil {
+			return nil, err
+		}
+		trimmed, _ = json.Marshal(doc)
+	}
+	var file profileFile
+	var err error
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		err = json.Unmarshal(trimmed, &file.Connections)
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		err = json.Unmarshal(trimmed, &file)
+	default:
+		err = errors.New(`expected a list of connections or a mapping with "connections"`)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if file.Version > profilesVersion {
+		return nil, fmt.Errorf("version %d is newer than this fortivpn understands (%d)", file.Version, profilesVersion)
+	}
+	if len(file.Connections) == 0 {
+		return nil, errors.New("no connections in it")
+	}
+	seen := map[string]bool{}
+	for i, profile := range file.Connections {
+		profile.Type = strings.ToLower(firstNonEmpty(strings.TrimSpace(profile.Type), "ssl"))
+		if err := profile.validate(); err != nil {
+			return nil, fmt.Errorf("connections[%d]: %w", i, err)
+		}
+		if seen[strings.ToLower(profile.Name)] {
+			return nil, fmt.Errorf("connections[%d]: duplicate name %q", i, profile.Name)
+		}
+		seen[strings.ToLower(profile.Name)] = true
+		file.Connections[i] = profile
+	}
+	return file.Connections, nil
+}
+
+func profileLabel(profile ConnectionProfile) string {
+	label := profile.Type + " " + profile.Gateway
+	if profile.Port != 0 {
+		label += fmt.Sprintf(":%d", profile.Port)
+	}
+	if profile.SAML {
+		label += " saml"
+	}
+	return label
+}
+
+func tunnelNames(tunnels []Tunnel) []string {
+	names := make([]string, 0, len(tunnels))
+	for _, tunnel := range tunnels {
+		names = append(names, tunnel.ConnectionName)
+	}
+	return names
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// progress is set by connect --json --progress. Its methods are safe on a
+// nil receiver so the connect path can report steps unconditionally.
+var progress *progressReporter
+
+type progressReporter struct {
+	enc       *json.Encoder
+	lastState string
+}
+
+type progressEvent struct {
+	Type      string `json:"type"`
+	Phase     string `json:"phase"`
+	Timestamp string `json:"timestamp"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+func newProgressReporter(w io.Writer) *progressReporter {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &progressReporter{enc: enc}
+}
+
+func (p *progressReporter) step(phase, format string, args ...any) {
+	if p == nil {
+		return
+	}
+	_ = p.enc.Encode(progressEvent{
+		Type:      "progress",
+		Phase:     phase,
+		Timestamp: time.Now().Format(time.RFC3339Nano),
+		Detail:    redact(fmt.Sprintf(format, args...)),
+	})
+}
+
+// observe reports tunnel state transitions seen while polling.
+func (p *progressReporter) observe(state TunnelState) {
+	if p == nil {
+		return
+	}
+	label := fmt.Sprintf("%s (%s)", connectedLabel(state.Connected()), emptyAsUnknown(state.CurrentConnection()))
+	if label == p.lastState {
+		return
+	}
+	p.lastState = label
+	p.step("state", "%s", label)
+}
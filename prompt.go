@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultPromptFormat = `{{if .Connected}}{{.Glyph}} {{.Connection}}{{end}}`
+	defaultPromptMaxAge = 5.0
+	promptStateUnknown  = "Unknown"
+)
+
+// PromptConfig is the "prompt" config section; flags of `fortivpn prompt`
+// override it.
+type PromptConfig struct {
+	Format string  `json:"format,omitempty"`
+	Glyphs bool    `json:"glyphs,omitempty"`
+	Color  bool    `json:"color,omitempty"`
+	Shell  string  `json:"shell,omitempty"`
+	MaxAge float64 `json:"max_age,omitempty"`
+}
+
+func (c PromptConfig) validate() error {
+	if c.MaxAge < 0 {
+		return errors.New("max_age must not be negative")
+	}
+	if _, err := parsePromptFormat(c.Format); err != nil {
+		return err
+	}
+	_, err := promptShellMarkers(c.Shell)
+	return err
+}
+
+// promptCache is what the last refresh saw; the prompt renders it as is
+// and never waits on FortiClient.
+type promptCache struct {
+	FetchedAt  time.Time `json:"fetched_at"`
+	State      string    `json:"state"`
+	Connection string    `json:"connection,omitempty"`
+}
+
+type promptData struct {
+	State      string
+	Connection string
+	Connected  bool
+	Glyph      string
+	Stale      bool
+}
+
+var promptGlyphs = map[bool]map[string]string{
+	false: {connectedLabel(true): "vpn", connectedLabel(false): "-", promptStateUnknown: "?"},
+	true:  {connectedLabel(true): "●", connectedLabel(false): "○", promptStateUnknown: "◌"},
+}
+
+var promptColors = map[string]string{
+	connectedLabel(true):  "32",
+	connectedLabel(false): "31",
+	promptStateUnknown:    "33",
+}
+
+func runPrompt(args []string) int {
+	fs := flag.NewFlagSet("prompt", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	format := fs.String("format", "", "Go template for the segment; fields .State, .Connection, .Connected, .Glyph, .Stale.")
+	glyphs := fs.Bool("glyphs", false, "Use Unicode glyphs instead of ASCII.")
+	color := fs.Bool("color", false, "Color the segment by state.")
+	shell := fs.String("shell", "", "Wrap colors for this shell's prompt: bash or zsh.")
+	maxAge := fs.Float64("max-age", defaultPromptMaxAge, "Refresh in the background when the cached state is older than this many seconds.")
+	refresh := fs.Bool("refresh", false, "Update the cached state and exit (run in the background by the prompt).")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadPlainConfig()
+	if err == nil {
+		if err = cfg.Prompt.validate(); err != nil {
+			err = fmt.Errorf("invalid config: prompt: %w", err)
+		}
+	}
+	if err != nil {
+		return fail(err)
+	}
+	prompt := cfg.Prompt
+	prompt.Format = firstNonEmpty(*format, prompt.Format)
+	prompt.Shell = firstNonEmpty(*shell, prompt.Shell)
+	prompt.Glyphs = prompt.Glyphs || *glyphs
+	prompt.Color = prompt.Color || *color
+	prompt.MaxAge = flagOrSetting(fs, "max-age", *maxAge, prompt.MaxAge)
+	if err := prompt.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, msg("error", err))
+		return 2
+	}
+	path, err := promptCachePath()
+	if err != nil {
+		return fail(err)
+	}
+	if *refresh {
+		return refreshPromptCache(path, seconds(prompt.MaxAge))
+	}
+
+	cache, err := readPromptCache(path)
+	stale := err != nil || time.Since(cache.FetchedAt) >= seconds(prompt.MaxAge)
+	if stale {
+		spawnPromptRefresh()
+	}
+	if err != nil {
+		cache = promptCache{State: promptStateUnknown}
+	}
+	segment, err := renderPrompt(prompt, promptData{
+		State:      cache.State,
+		Connection: cache.Connection,
+		Connected:  cache.State == connectedLabel(true),
+		Glyph:      promptGlyphs[prompt.Glyphs][cache.State],
+		Stale:      stale,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, msg("error", err))
+		return 2
+	}
+	fmt.Println(segment)
+	return 0
+}
+
+func parsePromptFormat(format string) (*template.Template, error) {
+	tmpl, err := template.New("prompt").Funcs(template.FuncMap{
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	}).Parse(firstNonEmpty(format, defaultPromptFormat))
+	if err != nil {
+		return nil, fmt.Errorf("prompt format: %w", err)
+	}
+	return tmpl, nil
+}
+
+// promptShellMarkers returns what encloses escape sequences so the shell
+// does not count them towards the prompt width.
+func promptShellMarkers(shell string) ([2]string, error) {
+	switch strings.ToLower(shell) {
+	case "":
+		return [2]string{}, nil
+	case "bash":
+		return [2]string{"\001", "\002"}, nil
+	case "zsh":
+		return [2]string{"%{", "%}"}, nil
+	default:
+		return [2]string{}, fmt.Errorf("prompt shell: unknown value %q (want bash or zsh)", shell)
+	}
+}
+
+func renderPrompt(prompt PromptConfig, data promptData) (string, error) {
+	tmpl, err := parsePromptFormat(prompt.Format)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("prompt format: %w", err)
+	}
+	segment := strings.TrimSpace(out.String())
+	if !prompt.Color || segment == "" {
+		return segment, nil
+	}
+	markers, err := promptShellMarkers(prompt.Shell)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s\033[%sm%s%s%s\033[0m%s", markers[0], promptColors[data.State], markers[1], segment, markers[0], markers[1]), nil
+}
+
+func promptCachePath() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cache", "prompt.json"), nil
+}
+
+func readPromptCache(path string) (promptCache, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return promptCache{}, err
+	}
+	var cache promptCache
+	if err := json.Unmarshal(raw, &cache); err != nil {
+		return promptCache{}, err
+	}
+	return cache, nil
+}
+
+// spawnPromptRefresh starts `prompt --refresh` in its own session and does
+// not wait for it; the next prompt shows what it found.
+func spawnPromptRefresh() {
+	self, err := os.Executable()
+	if err != nil {
+		return
+	}
+	cmd := exec.Command(self, "prompt", "--refresh")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if cmd.Start() == nil {
+		_ = cmd.Process.Release()
+	}
+}
+
+// refreshPromptCache asks the backend for the tunnel state and stores it.
+// Only one refresh runs at a time; the others exit at once. A failed query
+// is cached as Unknown so a broken bridge is not retried on every prompt.
+func refreshPromptCache(path string, maxAge time.Duration) int {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fail(err)
+	}
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return fail(err)
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		return 0
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	statusCacheTTL = maxAge
+	cache := promptCache{State: promptStateUnknown}
+	if state, err := getTunnelState(); err == nil {
+		cache.State = connectedLabel(state.Connected())
+		cache.Connection = state.CurrentConnection()
+	}
+	cache.FetchedAt = time.Now()
+	body, err := json.Marshal(cache)
+	if err != nil {
+		return fail(err)
+	}
+	if err := writeFileAtomic(path, body, 0o600); err != nil {
+		return fail(err)
+	}
+	return 0
+}
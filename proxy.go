@@ -0,0 +1,245 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	proxyCheckWarn = "warn"
+	proxyCheckFail = "fail"
+	proxyCheckOff  = "off"
+)
+
+// ProxySettings is what the system (scutil --proxy) and the environment
+// say about proxies. A proxy in front of the gateway is a common hidden
+// reason for a connect that just times out.
+type ProxySettings struct {
+	HTTP          string            `json:"http,omitempty"`
+	HTTPS         string            `json:"https,omitempty"`
+	SOCKS         string            `json:"socks,omitempty"`
+	PACURL        string            `json:"pac_url,omitempty"`
+	AutoDiscovery bool              `json:"auto_discovery,omitempty"`
+	Exceptions    []string          `json:"exceptions,omitempty"`
+	Environment   map[string]string `json:"environment,omitempty"`
+}
+
+func (p ProxySettings) configured() bool {
+	return p.HTTP != "" || p.HTTPS != "" || p.SOCKS != "" || p.PACURL != "" || p.AutoDiscovery || len(p.Environment) > 0
+}
+
+func detectProxies() ProxySettings {
+	settings := ProxySettings{}
+	if out, err := exec.Command("scutil", "--proxy").Output(); err == nil {
+		settings = parseScutilProxy(string(out))
+	}
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy", "ALL_PROXY", "all_proxy", "NO_PROXY", "no_proxy"} {
+		if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+			if settings.Environment == nil {
+				settings.Environment = map[string]string{}
+			}
+			if parsed, err := url.Parse(value); err == nil && parsed.User != nil {
+				value = parsed.Redacted()
+			}
+			settings.Environment[name] = redact(value)
+		}
+	}
+	return settings
+}
+
+// parseScutilProxy reads the dictionary printed by scutil --proxy.
+func parseScutilProxy(out string) ProxySettings {
+	values := map[string]string{}
+	var exceptions []string
+	inExceptions := false
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if inExceptions {
+			if line == "}" {
+				inExceptions = false
+				continue
+			}
+			if _, value, ok := strings.Cut(line, " : "); ok {
+				exceptions = append(exceptions, strings.TrimSpace(value))
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, " : ")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if key == "ExceptionsList" {
+			inExceptions = true
+			continue
+		}
+		values[key] = strings.TrimSpace(value)
+	}
+
+	settings := ProxySettings{Exceptions: exceptions}
+	hostPort := func(prefix string) string {
+		if values[prefix+"Enable"] != "1" || values[prefix+"Proxy"] == "" {
+			return ""
+		}
+		return net.JoinHostPort(values[prefix+"Proxy"], firstNonEmpty(values[prefix+"Port"], "0"))
+	}
+	settings.HTTP = hostPort("HTTP")
+	settings.HTTPS = hostPort("HTTPS")
+	settings.SOCKS = hostPort("SOCKS")
+	if values["ProxyAutoConfigEnable"] == "1" {
+		settings.PACURL = values["ProxyAutoConfigURLString"]
+	}
+	settings.AutoDiscovery = values["ProxyAutoDiscoveryEnable"] == "1"
+	return settings
+}
+
+// affectsGateway explains how the proxy settings may get in the way of
+// reaching gateway, or returns "" when the gateway is exempt or no proxy
+// applies.
+func (p ProxySettings) affectsGateway(gateway string) string {
+	host, _, err := net.SplitHostPort(gatewayAddress(gateway))
+	if err != nil {
+		host = gateway
+	}
+	if matchesProxyException(host, p.Exceptions) {
+		return ""
+	}
+	switch {
+	case p.HTTPS != "":
+		return fmt.Sprintf("HTTPS proxy %s is enabled and %s is not in its exceptions", p.HTTPS, host)
+	case p.SOCKS != "":
+		return fmt.Sprintf("SOCKS proxy %s is enabled and %s is not in its exceptions", p.SOCKS, host)
+	case p.PACURL != "":
+		return fmt.Sprintf("proxy auto-config %s may route %s through a proxy", p.PACURL, host)
+	case p.AutoDiscovery:
+		return fmt.Sprintf("proxy auto-discovery (WPAD) is on and may route %s through a proxy", host)
+	}
+	return ""
+}
+
+func matchesProxyException(host string, exceptions []string) bool {
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+	for _, exception := range exceptions {
+		exception = strings.ToLower(strings.TrimSpace(exception))
+		if exception == "" {
+			continue
+		}
+		if ip != nil {
+			if _, network, err := net.ParseCIDR(expandShortCIDR(exception)); err == nil && network.Contains(ip) {
+				return true
+			}
+		}
+		if ok, _ := path.Match(exception, host); ok {
+			return true
+		}
+		if host == strings.TrimPrefix(exception, ".") || strings.HasSuffix(host, "."+strings.TrimPrefix(strings.TrimPrefix(exception, "*"), ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandShortCIDR turns the macOS shorthand "169.254/16" into
+// "169.254.0.0/16".
+func expandShortCIDR(value string) string {
+	address, bits, ok := strings.Cut(value, "/")
+	if !ok || strings.Contains(address, ":") {
+		return value
+	}
+	for strings.Count(address, ".") < 3 {
+		address += ".0"
+	}
+	return address + "/" + bits
+}
+
+// checkProxy applies the configured proxy_check policy before a connect to
+// a connection with a known gateway.
+func checkProxy(settings Settings, policy string) error {
+	if settings.Gateway == "" || policy == proxyCheckOff {
+		return nil
+	}
+	problem := detectProxies().affectsGateway(settings.Gateway)
+	if problem == "" {
+		return nil
+	}
+	if policy == proxyCheckFail {
+		return fmt.Errorf("proxy may block the gateway: %s", problem)
+	}
+	warnf("proxy.affects_gateway", problem)
+	return nil
+}
+
+func runProxy(args []string) int {
+	fs := flag.NewFlagSet("proxy", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	connectionArg := fs.String("connection", "", "Also check whether the proxy applies to this connection's gateway.")
+	asJSON := outputFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	settings := detectProxies()
+	report := struct {
+		ProxySettings
+		Gateway       string `json:"gateway,omitempty"`
+		GatewayImpact string `json:"gateway_impact,omitempty"`
+	}{ProxySettings: settings}
+
+	if strings.TrimSpace(*connectionArg) != "" {
+		cfg, err := loadConfig()
+		if err != nil {
+			return fail(err)
+		}
+		_, gateway, err := configuredGateway(*connectionArg, cfg)
+		if err != nil {
+			return fail(err)
+		}
+		report.Gateway = gateway
+		report.GatewayImpact = settings.affectsGateway(gateway)
+	}
+
+	if *asJSON {
+		if code := printJSON(report); code != 0 {
+			return code
+		}
+	} else if !settings.configured() {
+		fmt.Println(msg("proxy.none"))
+	} else {
+		for _, line := range [][2]string{{"http", settings.HTTP}, {"https", settings.HTTPS}, {"socks", settings.SOCKS}, {"pac", settings.PACURL}} {
+			if line[1] != "" {
+				fmt.Println(msg("proxy.entry", line[0], line[1]))
+			}
+		}
+		if settings.AutoDiscovery {
+			fmt.Println(msg("proxy.entry", "auto-discovery", "on"))
+		}
+		if len(settings.Exceptions) > 0 {
+			fmt.Println(msg("proxy.entry", "exceptions", strings.Join(settings.Exceptions, ", ")))
+		}
+		names := slices.Sorted(maps.Keys(settings.Environment))
+		for _, name := range names {
+			fmt.Println(msg("proxy.entry", "$"+name, settings.Environment[name]))
+		}
+	}
+	if !*asJSON && report.Gateway != "" {
+		if report.GatewayImpact != "" {
+			warnf("proxy.affects_gateway", report.GatewayImpact)
+		} else {
+			fmt.Println(msg("proxy.gateway_clear", report.Gateway))
+		}
+	}
+
+	if report.GatewayImpact != "" {
+		return 1
+	}
+	return 0
+}
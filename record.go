@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// BridgeExchange is one bridge call in a --record file, one JSON object
+// per line.
+type BridgeExchange struct {
+	Action     string          `json:"action"`
+	Payload    json.RawMessage `json:"payload"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	ErrorCode  string          `json:"error_code,omitempty"`
+	DurationMS int64           `json:"duration_ms"`
+}
+
+var (
+	bridgeRecording *os.File
+	bridgeReplay    *replaySession
+)
+
+// openBridgeRecording appends every bridge call of this command to path.
+// Secrets are redacted, so the file can be attached to a bug report.
+func openBridgeRecording(path string) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the recording: %w", err)
+	}
+	bridgeRecording = file
+	return func() { file.Close() }, nil
+}
+
+func recordBridge(action string, payload any, start time.Time, result json.RawMessage, err error) {
+	body, _ := json.Marshal(payload)
+	exchange := BridgeExchange{Action: action, Payload: body, Result: result, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		exchange.Error = err.Error()
+		var bridgeErr *bridgeError
+		switch {
+		case errors.As(err, &bridgeErr):
+			exchange.ErrorCode = bridgeErr.Code
+		case errors.Is(err, errTimedOut):
+			exchange.ErrorCode = "timeout"
+		}
+	}
+	line, err := json.Marshal(exchange)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(bridgeRecording, redact(string(line)))
+}
+
+// replaySession answers bridge calls from a recording, in order, without
+// running a bridge. A call that does not match the next recorded one fails,
+// so a replay either reproduces the recorded session or says where it
+// diverged.
+type replaySession struct {
+	path      string
+	exchanges []BridgeExchange
+	next      int
+}
+
+func openBridgeReplay(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open the replay: %w", err)
+	}
+	defer file.Close()
+	session := &replaySession{path: path}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var exchange BridgeExchange
+		if err := json.Unmarshal(scanner.Bytes(), &exchange); err != nil {
+			return fmt.Errorf("invalid replay %s, exchange %d: %w", path, len(session.exchanges)+1, err)
+		}
+		session.exchanges = append(session.exchanges, exchange)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read the replay: %w", err)
+	}
+	bridgeReplay = session
+	return nil
+}
+
+func (s *replaySession) call(action string, payload any) (json.RawMessage, error) {
+	if s.next >= len(s.exchanges) {
+		return nil, fmt.Errorf("replay %s: no recorded call left for %s", s.path, action)
+	}
+	exchange := s.exchanges[s.next]
+	body, _ := json.Marshal(payload)
+	if exchange.Action != action || !jsonEqual(exchange.Payload, body) {
+		return nil, fmt.Errorf("replay %s diverged at call %d: recorded %s %s, got %s %s", s.path, s.next+1, exchange.Action, exchange.Payload, action, body)
+	}
+	s.next++
+	if exchange.Error == "" {
+		return exchange.Result, nil
+	}
+	if exchange.ErrorCode == "timeout" {
+		return nil, fmt.Errorf("%w (replayed): %s", errBridgeTimedOut, exchange.Error)
+	}
+	return nil, &bridgeError{Code: exchange.ErrorCode, Message: exchange.Error}
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return string(a) == string(b)
+	}
+	ca, _ := json.Marshal(va)
+	cb, _ := json.Marshal(vb)
+	return string(ca) == string(cb)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const redactedMarker = "[REDACTED]"
+
+type RedactionConfig struct {
+	Gateways bool     `json:"gateways,omitempty"`
+	Values   []string `json:"values,omitempty"`
+}
+
+var (
+	redactMu       sync.RWMutex
+	redactGateways bool
+	redactValues   []string
+
+	sensitiveKeys = `password|passwd|pass|otp|token|secret|cookie|svpncookie|username|user_name|user`
+
+	jsonSecretPattern   = regexp.MustCompile(`(?i)("(?:` + sensitiveKeys + `)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	paramSecretPattern  = regexp.MustCompile(`(?i)\b((?:` + sensitiveKeys + `)=)[^&\s;,"]+`)
+	headerSecretPattern = regexp.MustCompile(`(?i)\b((?:set-cookie|cookie|authorization|proxy-authorization):\s*)[^\r\n"]+`)
+	gatewayPattern      = regexp.MustCompile(`(?i)("?(?:gateway|server|remote_gateway|host)"?\s*[:=]\s*"?)([a-z0-9][a-z0-9.-]*[a-z0-9])`)
+)
+
+func configureRedaction(cfg RedactionConfig) {
+	redactMu.Lock()
+	redactGateways = cfg.Gateways
+	redactMu.Unlock()
+	for _, value := range cfg.Values {
+		addSensitiveValue(value)
+	}
+}
+
+// addSensitiveValue registers a literal (a gateway host, a username learned
+// from the bridge, ...) that must never appear in output.
+func addSensitiveValue(value string) {
+	value = strings.TrimSpace(value)
+	if len(value) < 3 {
+		return
+	}
+
+	redactMu.Lock()
+	defer redactMu.Unlock()
+	for _, existing := range redactValues {
+		if existing == value {
+			return
+		}
+	}
+	redactValues = append(redactValues, value)
+	// Longest first so a value containing another is masked as a whole.
+	sort.Slice(redactValues, func(i, j int) bool { return len(redactValues[i]) > len(redactValues[j]) })
+}
+
+func addSensitiveGateway(host string) {
+	redactMu.RLock()
+	enabled := redactGateways
+	redactMu.RUnlock()
+	if enabled {
+		addSensitiveValue(host)
+	}
+}
+
+func redact(s string) string {
+	if s == "" {
+		return s
+	}
+
+	s = jsonSecretPattern.ReplaceAllString(s, `${1}"`+redactedMarker+`"`)
+	s = paramSecretPattern.ReplaceAllString(s, "${1}"+redactedMarker)
+	s = headerSecretPattern.ReplaceAllString(s, "${1}"+redactedMarker)
+
+	redactMu.RLock()
+	defer redactMu.RUnlock()
+	if redactGateways {
+		s = gatewayPattern.ReplaceAllString(s, "${1}"+redactedMarker)
+	}
+	for _, value := range redactValues {
+		s = strings.ReplaceAll(s, value, redactedMarker)
+	}
+	return s
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const maxReportReasons = 10
+
+type reportReason struct {
+	Reason string
+	Count  int
+}
+
+type reportHour struct {
+	Hour  int
+	Drops int
+	Bar   string
+	Width int
+}
+
+type reliabilityReport struct {
+	Generated      string
+	Since          string
+	Until          string
+	Connection     string
+	Tag            string
+	Uptime         string
+	Observed       string
+	Sessions       int
+	Drops          int
+	Disconnects    int
+	FailedConnects int
+	Reconnects     int
+	ReconnectP50   string
+	ReconnectP95   string
+	ReconnectMax   string
+	Hours          []reportHour
+	Reasons        []reportReason
+	Annotations    []reportAnnotation
+}
+
+type reportAnnotation struct {
+	At         string
+	Connection string
+	Note       string
+	Tags       string
+}
+
+func runReport(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	sinceArg := fs.String("since", "30d", "Report window, e.g. 7d, 12h or 2024-05-01.")
+	outPath := fs.String("out", "", "Write the report to this file; .html renders HTML, anything else Markdown.")
+	format := fs.String("format", "", "Report format: md or html (default: from --out, else md).")
+	connection := fs.String("connection", "", "Only include events for this connection.")
+	tag := fs.String("tag", "", "Only include events of sessions tagged with this label.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	now := time.Now()
+	since, err := parseSince(*sinceArg, now)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, msg("error", err))
+		return 2
+	}
+
+	kind := strings.ToLower(*format)
+	if kind == "" {
+		kind = "md"
+		switch strings.ToLower(filepath.Ext(*outPath)) {
+		case ".html", ".htm":
+			kind = "html"
+		}
+	}
+	if kind != "md" && kind != "html" {
+		fmt.Fprintln(os.Stderr, msg("error", msg("report.unknown_format", *format)))
+		return 2
+	}
+
+	// Load everything so a session that started before the window still
+	// counts towards its uptime.
+	events, err := loadHistory(time.Time{})
+	if err != nil {
+		return fail(err)
+	}
+	if *connection != "" || *tag != "" {
+		filtered := events[:0]
+		for _, event := range events {
+			if (*connection == "" || strings.EqualFold(event.Connection, *connection)) && (*tag == "" || event.hasTag(*tag)) {
+				filtered = append(filtered, event)
+			}
+		}
+		events = filtered
+	}
+	report := buildReliabilityReport(events, since, now)
+	report.Connection = *connection
+	report.Tag = *tag
+
+	var buf bytes.Buffer
+	if kind == "html" {
+		err = reportHTMLTemplate.Execute(&buf, report)
+	} else {
+		err = reportMarkdownTemplate.Execute(&buf, report)
+	}
+	if err != nil {
+		return fail(fmt.Errorf("failed to render report: %w", err))
+	}
+
+	if *outPath == "" {
+		fmt.Print(buf.String())
+		return 0
+	}
+	if err := os.WriteFile(*outPath, buf.Bytes(), 0o644); err != nil {
+		return fail(fmt.Errorf("failed to write report: %w", err))
+	}
+	fmt.Println(msg("report.wrote", *outPath))
+	return 0
+}
+
+func buildReliabilityReport(events []HistoryEvent, since, until time.Time) reliabilityReport {
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At.Before(events[j].At) })
+
+	report := reliabilityReport{
+		Generated: until.Format(time.RFC3339),
+		Until:     until.Format("2006-01-02 15:04"),
+		Hours:     make([]reportHour, 24),
+	}
+
+	var up time.Duration
+	var upSince time.Time
+	observedFrom := since
+	if len(events) > 0 && (since.IsZero() || events[0].At.After(since)) {
+		observedFrom = events[0].At
+	}
+	endSession := func(at time.Time) {
+		if upSince.IsZero() {
+			return
+		}
+		from := upSince
+		if from.Before(observedFrom) {
+			from = observedFrom
+		}
+		if at.After(from) {
+			up += at.Sub(from)
+		}
+		upSince = time.Time{}
+	}
+
+	reasons := map[string]int{}
+	reconnects := make([]time.Duration, 0)
+	for _, event := range events {
+		inWindow := !event.At.Before(since)
+		switch event.Event {
+		case eventConnected, eventFailover:
+			if upSince.IsZero() {
+				upSince = event.At
+				if inWindow {
+					report.Sessions++
+				}
+			}
+			if inWindow && event.Source == "watch" && event.DurationMS > 0 {
+				reconnects = append(reconnects, time.Duration(event.DurationMS)*time.Millisecond)
+			}
+			continue
+		case eventDropped, eventDisconnected:
+			endSession(event.At)
+		}
+		if !inWindow {
+			continue
+		}
+		switch event.Event {
+		case eventDropped:
+			report.Drops++
+			report.Hours[event.At.Local().Hour()].Drops++
+		case eventDisconnected:
+			report.Disconnects++
+		case eventConnectFailed:
+			report.FailedConnects++
+		case eventAnnotation:
+			report.Annotations = append(report.Annotations, reportAnnotation{
+				At:         event.At.Local().Format("2006-01-02 15:04"),
+				Connection: event.Connection,
+				Note:       event.Note,
+				Tags:       strings.Join(event.Tags, ", "),
+			})
+			continue
+		default:
+			continue
+		}
+		reasons[firstNonEmpty(event.Reason, event.Event)]++
+	}
+	endSession(until)
+
+	observed := until.Sub(observedFrom)
+	report.Since = observedFrom.Format("2006-01-02 15:04")
+	report.Observed = observed.Round(time.Minute).String()
+	report.Uptime = "n/a"
+	if len(events) > 0 && observed > 0 {
+		report.Uptime = fmt.Sprintf("%.2f%%", 100*float64(up)/float64(observed))
+	}
+
+	peak := 0
+	for i := range report.Hours {
+		report.Hours[i].Hour = i
+		peak = max(peak, report.Hours[i].Drops)
+	}
+	for i := range report.Hours {
+		if peak > 0 {
+			report.Hours[i].Width = 100 * report.Hours[i].Drops / peak
+			report.Hours[i].Bar = strings.Repeat("#", 20*report.Hours[i].Drops/peak)
+		}
+	}
+
+	report.Reconnects = len(reconnects)
+	report.ReconnectP50, report.ReconnectP95, report.ReconnectMax = "n/a", "n/a", "n/a"
+	if len(reconnects) > 0 {
+		sort.Slice(reconnects, func(i, j int) bool { return reconnects[i] < reconnects[j] })
+		percentile := func(p float64) string {
+			return reconnects[int(p*float64(len(reconnects)-1))].Round(100 * time.Millisecond).String()
+		}
+		report.ReconnectP50 = percentile(0.5)
+		report.ReconnectP95 = percentile(0.95)
+		report.ReconnectMax = percentile(1)
+	}
+
+	for reason, count := range reasons {
+		report.Reasons = append(report.Reasons, reportReason{Reason: reason, Count: count})
+	}
+	sort.Slice(report.Reasons, func(i, j int) bool {
+		if report.Reasons[i].Count != report.Reasons[j].Count {
+			return report.Reasons[i].Count > report.Reasons[j].Count
+		}
+		return report.Reasons[i].Reason < report.Reasons[j].Reason
+	})
+	if len(report.Reasons) > maxReportReasons {
+		report.Reasons = report.Reasons[:maxReportReasons]
+	}
+	return report
+}
+
+// markdownCell keeps free-form text (error messages) from breaking a table row.
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
+
+var reportMarkdownTemplate = template.Must(template.New("md").Funcs(template.FuncMap{"cell": markdownCell}).Parse(`# FortiClient VPN reliability report
+
+Window: {{.Since}} to {{.Until}} ({{.Observed}}){{if .Connection}}, connection {{.Connection}}{{end}}{{if .Tag}}, tag {{.Tag}}{{end}}
+
+| Metric | Value |
+|---|---|
+| Uptime | {{.Uptime}} |
+| Sessions | {{.Sessions}} |
+| Drops | {{.Drops}} |
+| Manual disconnects | {{.Disconnects}} |
+| Failed connects | {{.FailedConnects}} |
+| Reconnects | {{.Reconnects}} |
+| Reconnect p50 / p95 / max | {{.ReconnectP50}} / {{.ReconnectP95}} / {{.ReconnectMax}} |
+
+## Drops by hour of day
+
+| Hour | Drops | |
+|---|---|---|
+{{range .Hours}}| {{printf "%02d:00" .Hour}} | {{.Drops}} | {{.Bar}} |
+{{end}}
+## Top disconnect reasons
+{{if .Reasons}}
+| Count | Reason |
+|---|---|
+{{range .Reasons}}| {{.Count}} | {{cell .Reason}} |
+{{end}}{{else}}
+No disconnects recorded.
+{{end}}{{if .Annotations}}
+## Annotations
+
+| Time | Connection | Note | Tags |
+|---|---|---|---|
+{{range .Annotations}}| {{.At}} | {{cell .Connection}} | {{cell .Note}} | {{cell .Tags}} |
+{{end}}{{end}}
+_Generated {{.Generated}} by fortivpn report._
+`))
+
+var reportHTMLTemplate = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>FortiClient VPN reliability report</title>
+<style>
+body { font-family: -apple-system, Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: left; }
+.bar { background: #d9534f; height: 10px; }
+</style>
+</head>
+<body>
+<h1>FortiClient VPN reliability report</h1>
+<p>Window: {{.Since}} to {{.Until}} ({{.Observed}}){{if .Connection}}, connection {{.Connection}}{{end}}{{if .Tag}}, tag {{.Tag}}{{end}}</p>
+<table>
+<tr><th>Metric</th><th>Value</th></tr>
+<tr><td>Uptime</td><td>{{.Uptime}}</td></tr>
+<tr><td>Sessions</td><td>{{.Sessions}}</td></tr>
+<tr><td>Drops</td><td>{{.Drops}}</td></tr>
+<tr><td>Manual disconnects</td><td>{{.Disconnects}}</td></tr>
+<tr><td>Failed connects</td><td>{{.FailedConnects}}</td></tr>
+<tr><td>Reconnects</td><td>{{.Reconnects}}</td></tr>
+<tr><td>Reconnect p50 / p95 / max</td><td>{{.ReconnectP50}} / {{.ReconnectP95}} / {{.ReconnectMax}}</td></tr>
+</table>
+<h2>Drops by hour of day</h2>
+<table>
+<tr><th>Hour</th><th>Drops</th><th style="width:240px"></th></tr>
+{{range .Hours}}<tr><td>{{printf "%02d:00" .Hour}}</td><td>{{.Drops}}</td><td><div class="bar" style="width: {{.Width}}%"></div></td></tr>
+{{end}}</table>
+<h2>Top disconnect reasons</h2>
+{{if .Reasons}}<table>
+<tr><th>Count</th><th>Reason</th></tr>
+{{range .Reasons}}<tr><td>{{.Count}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>
+{{else}}<p>No disconnects recorded.</p>
+{{end}}{{if .Annotations}}<h2>Annotations</h2>
+<table>
+<tr><th>Time</th><th>Connection</th><th>Note</th><th>Tags</th></tr>
+{{range .Annotations}}<tr><td>{{.At}}</td><td>{{.Connection}}</td><td>{{.Note}}</td><td>{{.Tags}}</td></tr>
+{{end}}</table>
+{{end}}<p><small>Generated {{.Generated}} by fortivpn report.</small></p>
+</body>
+</html>
+`))
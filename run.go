@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// runRun brings the VPN up, runs a command and passes its exit code
+// through, for one-off jobs that need the tunnel. With --disconnect-after
+// the tunnel goes down again afterwards, unless it was already up before.
+func runRun(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	connectionArg := fs.String("connection", "", "VPN connection or group name, e.g. prod/int.")
+	timeoutSec := fs.Float64("timeout", 20, "Connect timeout in seconds (0 waits indefinitely).")
+	disconnectAfter := fs.Bool("disconnect-after", false, "Disconnect when the command exits, unless the tunnel was already up.")
+	yes := fs.Bool("yes", false, "Disconnect a different active connection without asking.")
+	noInput := fs.Bool("no-input", false, "Never prompt; refuse to disconnect a different active connection unless --yes is given.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	command := fs.Args()
+	if len(command) == 0 {
+		fmt.Fprintln(os.Stderr, msg("error", msg("run.no_command")))
+		return 2
+	}
+
+	before, err := getTunnelState()
+	if err != nil {
+		return fail(err)
+	}
+	connectArgs := []string{"--timeout", strconv.FormatFloat(*timeoutSec, 'f', -1, 64)}
+	if *connectionArg != "" {
+		connectArgs = append(connectArgs, "--connection", *connectionArg)
+	}
+	if *yes {
+		connectArgs = append(connectArgs, "--yes")
+	}
+	if *noInput {
+		connectArgs = append(connectArgs, "--no-input")
+	}
+	// The command owns stdout; connect's status goes to stderr, or nowhere
+	// with -q.
+	stdout := os.Stdout
+	if !quiet {
+		os.Stdout = os.Stderr
+	}
+	code := runConnect(connectArgs)
+	os.Stdout = stdout
+	if code != 0 {
+		return code
+	}
+	after, err := freshTunnelState()
+	if err != nil {
+		return fail(err)
+	}
+	wasUp := before.Connected() && strings.EqualFold(before.CurrentConnection(), after.CurrentConnection())
+
+	code = runChild(command)
+
+	if *disconnectAfter && !wasUp {
+		if !quiet {
+			os.Stdout = os.Stderr
+		}
+		if disconnectCode := runDisconnect(nil); disconnectCode != 0 {
+			warnf("run.disconnect_failed", disconnectCode)
+		}
+		os.Stdout = stdout
+	}
+	return code
+}
+
+// runChild runs command with fortivpn's stdio and returns its exit code,
+// 128+N when a signal killed it, like a shell.
+func runChild(command []string) int {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, realStdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintln(os.Stderr, msg("error", err))
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			return 127
+		}
+		return 126
+	}
+	signalChild.Store(cmd.Process)
+	err := cmd.Wait()
+	signalChild.Store(nil)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, msg("error", err))
+		return 126
+	}
+	return 0
+}
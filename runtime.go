@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var configuredNodePath string
+
+const (
+	backendAuto     = "auto"
+	backendNode     = "node"
+	backendElectron = "electron"
+	backendForticli = "forticli"
+	backendMock     = "mock"
+
+	// fortiClientElectron is the Electron binary FortiClient's GUI runs on.
+	// With ELECTRON_RUN_AS_NODE it behaves like node, and the GUI module the
+	// bridge loads is built for exactly its ABI.
+	fortiClientElectron = "/Applications/FortiClient.app/Contents/MacOS/FortiClient"
+	// fortiClientModule is the GUI module the bridge loads by default.
+	fortiClientModule = "/Applications/FortiClient.app/Contents/Resources/app.asar.unpacked/assets/js/guimessenger_jyp.node"
+)
+
+// configuredBackend selects how FortiClient is reached: "node" (the bridge
+// on a Node.js install), "electron" (the bridge on FortiClient's own
+// Electron runtime, no Node needed), "forticli" (Fortinet's command-line client), "mock" (a
+// JSON fixture, for tests) or "auto" (default: the bridge when the GUI
+// module is installed, else forticli).
+var configuredBackend string
+
+func normalizeBackend(backend string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(backend)) {
+	case "", backendAuto:
+		return backendAuto, nil
+	case backendNode:
+		return backendNode, nil
+	case backendElectron:
+		return backendElectron, nil
+	case backendForticli:
+		return backendForticli, nil
+	case backendMock:
+		return backendMock, nil
+	default:
+		name := strings.ToLower(strings.TrimSpace(backend))
+		if _, err := findBackendPlugin(name); err == nil {
+			return name, nil
+		}
+		want := "auto, node, electron, forticli, mock"
+		if plugins := backendPlugins(); len(plugins) > 0 {
+			want += ", " + strings.Join(plugins, ", ")
+		}
+		return "", fmt.Errorf("unknown backend %q (want %s, or a %s<name> plugin on PATH)", backend, want, backendPluginPrefix)
+	}
+}
+
+// bridgeRuntime returns the program that runs the bridge script and the
+// extra environment it needs.
+func bridgeRuntime() (string, []string, error) {
+	backend, err := normalizeBackend(configuredBackend)
+	if err != nil {
+		return "", nil, err
+	}
+	electron := firstNonEmpty(os.Getenv("FORTIVPN_ELECTRON"), fortiClientElectron)
+	if backend == backendElectron {
+		if !isExecutableFile(electron) {
+			return "", nil, &runtimeNotFoundError{Runtime: "FortiClient (electron backend)", Looked: []string{electron}, Hint: "install FortiClient or use --backend node"}
+		}
+		return electron, electronRuntimeEnv, nil
+	}
+	node, err := findNodeRuntime()
+	// auto falls back to FortiClient's own Electron when no JavaScript
+	// runtime is installed.
+	if err != nil && backend == backendAuto {
+		if isExecutableFile(electron) {
+			return electron, electronRuntimeEnv, nil
+		}
+		var notFound *runtimeNotFoundError
+		if errors.As(err, &notFound) {
+			notFound.Looked = append(notFound.Looked, electron)
+		}
+	}
+	return node, nil, err
+}
+
+// electronRuntimeEnv makes FortiClient's Electron binary behave as node.
+var electronRuntimeEnv = []string{"ELECTRON_RUN_AS_NODE=1"}
+
+type runtimeNotFoundError struct {
+	Runtime string
+	Looked  []string
+	Hint    string
+}
+
+func (e *runtimeNotFoundError) Error() string {
+	hint := firstNonEmpty(e.Hint, "pass --node-path, set FORTIVPN_NODE or set node_path in the config file to point at one")
+	return fmt.Sprintf("%s runtime not found, looked in: %s; %s", e.Runtime, strings.Join(e.Looked, ", "), hint)
+}
+
+// jsRuntimes are the runtimes that can run the bridge, in order of
+// preference: node is what FortiClient's module is built against; bun and
+// deno load Node-API modules too.
+var jsRuntimes = []string{"node", "bun", "deno"}
+
+// findNodeRuntime locates a JavaScript runtime even when PATH is minimal, as
+// it is under launchd and cron, by also probing the usual Homebrew, nvm,
+// volta, asdf, fnm, bun and deno install locations.
+func findNodeRuntime() (string, error) {
+	looked := make([]string, 0)
+
+	if configured := strings.TrimSpace(configuredNodePath); configured != "" {
+		if isExecutableFile(configured) {
+			return configured, nil
+		}
+		if path, err := exec.LookPath(configured); err == nil && !strings.Contains(configured, "/") {
+			return path, nil
+		}
+		return "", &runtimeNotFoundError{Runtime: "node", Looked: []string{"node_path=" + configured}}
+	}
+
+	for _, name := range jsRuntimes {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	looked = append(looked, "$PATH")
+
+	for _, name := range jsRuntimes {
+		for _, candidate := range runtimeCandidates(name) {
+			looked = append(looked, candidate)
+			if isExecutableFile(candidate) {
+				return candidate, nil
+			}
+		}
+	}
+	return "", &runtimeNotFoundError{Runtime: "node, bun or deno", Looked: looked}
+}
+
+func runtimeCandidates(name string) []string {
+	candidates := []string{
+		"/opt/homebrew/bin/" + name,
+		"/usr/local/bin/" + name,
+		"/usr/bin/" + name,
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return candidates
+	}
+	switch name {
+	case "node":
+		candidates = append(candidates,
+			filepath.Join(home, ".volta", "bin", "node"),
+			filepath.Join(home, ".asdf", "shims", "node"),
+		)
+		candidates = append(candidates, newestVersionBinaries(filepath.Join(home, ".nvm", "versions", "node", "*", "bin", "node"))...)
+		candidates = append(candidates, newestVersionBinaries(filepath.Join(home, ".local", "share", "fnm", "node-versions", "*", "installation", "bin", "node"))...)
+	case "bun":
+		candidates = append(candidates, filepath.Join(home, ".bun", "bin", "bun"))
+	case "deno":
+		candidates = append(candidates, filepath.Join(home, ".deno", "bin", "deno"))
+	}
+	return candidates
+}
+
+// runtimeArgs returns what goes between the runtime and the script: deno
+// needs "run" and the permissions the bridge uses (files, the socket and
+// the native module); node and bun take the script directly.
+func runtimeArgs(runtime string) []string {
+	if strings.HasPrefix(filepath.Base(runtime), "deno") {
+		return []string{"run", "--allow-all"}
+	}
+	return nil
+}
+
+// newestVersionBinaries expands a glob over version directories and
+// returns the matches newest first.
+func newestVersionBinaries(pattern string) []string {
+	matches, err := filepath.Glob(pattern)
+	if err != nil || len(matches) == 0 {
+		return []string{pattern}
+	}
+	sort.Slice(matches, func(i, j int) bool { return compareVersionPaths(matches[i], matches[j]) > 0 })
+	return matches
+}
+
+func compareVersionPaths(a, b string) int {
+	va := versionNumbers(a)
+	vb := versionNumbers(b)
+	for i := 0; i < len(va) && i < len(vb); i++ {
+		if va[i] != vb[i] {
+			return va[i] - vb[i]
+		}
+	}
+	return len(va) - len(vb)
+}
+
+func versionNumbers(path string) []int {
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		part = strings.TrimPrefix(part, "v")
+		fields := strings.Split(part, ".")
+		if len(fields) < 2 {
+			continue
+		}
+		numbers := make([]int, 0, len(fields))
+		for _, field := range fields {
+			n := 0
+			if _, err := fmt.Sscanf(field, "%d", &n); err != nil {
+				numbers = nil
+				break
+			}
+			numbers = append(numbers, n)
+		}
+		if numbers != nil {
+			return numbers
+		}
+	}
+	return nil
+}
+
+func isExecutableFile(path string) bool {
+	stat, err := os.Stat(path)
+	return err == nil && !stat.IsDir() && stat.Mode()&0o111 != 0
+}
+
+// bridgeTimeout bounds every bridge call so a hung FortiClient module cannot
+// hang the CLI; 0 disables it.
+var bridgeTimeout = 30 * time.Second
+
+func bridgeContext() (context.Context, context.CancelFunc) {
+	if bridgeTimeout <= 0 {
+		return context.WithCancel(interrupted)
+	}
+	return context.WithTimeout(interrupted, bridgeTimeout)
+}
+
+func bridgeTimeoutError(action string) error {
+	return fmt.Errorf("%w after %s running %s", errBridgeTimedOut, bridgeTimeout, action)
+}
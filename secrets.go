@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	secretPrefix        = "enc:"
+	keychainService     = "fortivpn-config-key"
+	keychainSecretTag   = "keychain"
+	ageSecretTag        = "age"
+	configKeyEnv        = "FORTIVPN_CONFIG_KEY"
+	ageIdentityEnv      = "FORTIVPN_AGE_IDENTITY"
+	configKeySize       = 32
+	defaultAgeIdentity  = "age-identity.txt"
+	secretEncodingError = "encrypted value must look like enc:keychain:... or enc:age:..."
+)
+
+func isEncryptedValue(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+func encryptSecret(method, recipient, plaintext string) (string, error) {
+	switch method {
+	case keychainSecretTag:
+		key, err := configKey(true)
+		if err != nil {
+			return "", err
+		}
+		sealed, err := sealAESGCM(key, []byte(plaintext))
+		if err != nil {
+			return "", err
+		}
+		return secretPrefix + keychainSecretTag + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+	case ageSecretTag:
+		if strings.TrimSpace(recipient) == "" {
+			return "", errors.New("age encryption needs --recipient")
+		}
+		cmd := exec.Command("age", "--encrypt", "--recipient", recipient)
+		cmd.Stdin = strings.NewReader(plaintext)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("age encryption failed: %s", strings.TrimSpace(firstNonEmpty(stderr.String(), err.Error())))
+		}
+		return secretPrefix + ageSecretTag + ":" + base64.StdEncoding.EncodeToString(out), nil
+	default:
+		return "", fmt.Errorf("unknown encryption method %q (want keychain or age)", method)
+	}
+}
+
+func decryptSecret(value string) (string, error) {
+	method, encoded, ok := strings.Cut(strings.TrimPrefix(value, secretPrefix), ":")
+	if !ok || !isEncryptedValue(value) {
+		return "", errors.New(secretEncodingError)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("encrypted value is not valid base64: %w", err)
+	}
+
+	switch method {
+	case keychainSecretTag:
+		key, err := configKey(false)
+		if err != nil {
+			return "", err
+		}
+		plain, err := openAESGCM(key, sealed)
+		if err != nil {
+			return "", err
+		}
+		return string(plain), nil
+	case ageSecretTag:
+		identity, err := ageIdentityPath()
+		if err != nil {
+			return "", err
+		}
+		cmd := exec.Command("age", "--decrypt", "--identity", identity)
+		cmd.Stdin = bytes.NewReader(sealed)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("age decryption failed: %s", strings.TrimSpace(firstNonEmpty(stderr.String(), err.Error())))
+		}
+		return string(out), nil
+	default:
+		return "", errors.New(secretEncodingError)
+	}
+}
+
+var (
+	revealMu sync.Mutex
+	revealed = map[string]string{}
+)
+
+// revealSecret decrypts value once per process, however many times the
+// config is loaded, and registers the plaintext for redaction.
+func revealSecret(value string) (string, error) {
+	revealMu.Lock()
+	defer revealMu.Unlock()
+	if plain, ok := revealed[value]; ok {
+		return plain, nil
+	}
+	plain, err := decryptSecret(value)
+	if err != nil {
+		return "", err
+	}
+	addSensitiveValue(plain)
+	revealed[value] = plain
+	return plain, nil
+}
+
+// revealSetting is a startup setting read from the plain config, decrypted
+// if it was stored encrypted. It is "" when it cannot be decrypted.
+func revealSetting(value string) string {
+	if !isEncryptedValue(value) {
+		return value
+	}
+	plain, err := revealSecret(value)
+	if err != nil {
+		warnf("config.setting_undecryptable", err)
+		return ""
+	}
+	return plain
+}
+
+// decryptConfigValues replaces every encrypted string in a decoded JSON
+// document with its plaintext.
+func decryptConfigValues(node any) (any, error) {
+	switch v := node.(type) {
+	case string:
+		if !isEncryptedValue(v) {
+			return v, nil
+		}
+		return revealSecret(v)
+	case []any:
+		for i, item := range v {
+			decrypted, err := decryptConfigValues(item)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			v[i] = decrypted
+		}
+		return v, nil
+	case map[string]any:
+		for key, item := range v {
+			decrypted, err := decryptConfigValues(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			v[key] = decrypted
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
+
+// cachedConfigKey keeps the keychain from being asked for every value.
+var cachedConfigKey []byte
+
+func configKey(create bool) ([]byte, error) {
+	if fromEnv := strings.TrimSpace(os.Getenv(configKeyEnv)); fromEnv != "" {
+		return decodeConfigKey(fromEnv)
+	}
+
+	if cachedConfigKey != nil {
+		return cachedConfigKey, nil
+	}
+	out, err := exec.Command("security", "find-generic-password", "-s", keychainService, "-w").Output()
+	if err == nil {
+		key, err := decodeConfigKey(strings.TrimSpace(string(out)))
+		if err == nil {
+			cachedConfigKey = key
+		}
+		return key, err
+	}
+	if !create {
+		return nil, fmt.Errorf("config encryption key not found in keychain (service %q) and %s is not set", keychainService, configKeyEnv)
+	}
+
+	key := make([]byte, configKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	user := firstNonEmpty(os.Getenv("USER"), "fortivpn")
+	encoded := hex.EncodeToString(key)
+	// security -i reads the command from stdin, so the key stays out of
+	// argv where ps would show it, and never prompts on the terminal.
+	add := exec.Command("security", "-i")
+	add.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -s %s -a %q -w %s\n", keychainService, user, encoded))
+	out, err = add.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to store config encryption key in keychain: %s", strings.TrimSpace(firstNonEmpty(string(out), err.Error())))
+	}
+	// Only hand out the key once the keychain is known to hold it, or
+	// everything encrypted with it could never be decrypted again.
+	stored, err := exec.Command("security", "find-generic-password", "-s", keychainService, "-w").Output()
+	if err != nil || strings.TrimSpace(string(stored)) != encoded {
+		exec.Command("security", "delete-generic-password", "-s", keychainService, "-a", user).Run()
+		return nil, errors.New("failed to store config encryption key in keychain: the key read back does not match")
+	}
+	cachedConfigKey = key
+	return key, nil
+}
+
+func decodeConfigKey(encoded string) ([]byte, error) {
+	if key, err := hex.DecodeString(encoded); err == nil && len(key) == configKeySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(encoded); err == nil && len(key) == configKeySize {
+		return key, nil
+	}
+	return nil, fmt.Errorf("config encryption key must be %d bytes, hex or base64 encoded", configKeySize)
+}
+
+func sealAESGCM(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openAESGCM(key, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("encrypted value is too short")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("failed to decrypt value: wrong key or corrupted data")
+	}
+	return plain, nil
+}
+
+func ageIdentityPath() (string, error) {
+	if fromEnv := strings.TrimSpace(os.Getenv(ageIdentityEnv)); fromEnv != "" {
+		return fromEnv, nil
+	}
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), defaultAgeIdentity), nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
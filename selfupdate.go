@@ -0,0 +1,435 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultUpdateRepository = "SimonKaran13/forticlient-cli"
+	defaultUpdateAPI        = "https://api.github.com"
+	updateChecksumsAsset    = "checksums.txt"
+	maxUpdateDownload       = 256 << 20
+)
+
+// releasePublicKey is the base64 ed25519 key release checksums are signed
+// with. Release builds set it with -ldflags "-X main.releasePublicKey=...";
+// "self_update": {"public_key": ...} in the config is only used by builds
+// without one.
+var releasePublicKey = ""
+
+// SelfUpdateConfig is the "self_update" config section, for forks and
+// mirrors of the release page.
+type SelfUpdateConfig struct {
+	Repository string `json:"repository,omitempty"`
+	APIURL     string `json:"api_url,omitempty"`
+	PublicKey  string `json:"public_key,omitempty"`
+}
+
+func (c SelfUpdateConfig) validate() error {
+	if c.Repository != "" && strings.Count(c.Repository, "/") != 1 {
+		return fmt.Errorf("repository %q must look like owner/name", c.Repository)
+	}
+	if c.PublicKey != "" {
+		if _, err := decodeReleaseKey(c.PublicKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type githubRelease struct {
+	TagName string        `json:"tag_name"`
+	HTMLURL string        `json:"html_url"`
+	Assets  []githubAsset `json:"assets"`
+}
+
+type githubAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+	Size int64  `json:"size"`
+}
+
+type UpdateCheck struct {
+	Current         string `json:"current"`
+	Latest          string `json:"latest"`
+	UpdateAvailable bool   `json:"update_available"`
+	Asset           string `json:"asset,omitempty"`
+	URL             string `json:"url,omitempty"`
+}
+
+func runSelfUpdate(args []string) int {
+	fs := flag.NewFlagSet("self-update", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	checkOnly := fs.Bool("check-only", false, "Only report whether a newer release exists (exit 1 when one does).")
+	versionArg := fs.String("version", "", "Install this release tag instead of the latest, e.g. v1.4.0.")
+	force := fs.Bool("force", false, "Reinstall even when this build is as new as the release, or is a dev build.")
+	timeoutSec := fs.Float64("timeout", 120, "Timeout in seconds for the release lookup and downloads (0 waits indefinitely).")
+	skipSignature := fs.Bool("insecure-skip-signature", false, "Install with only the checksum verified when no release key is built in or configured.")
+	asJSON := outputFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	ctx, cancel := context.WithCancel(interrupted)
+	if *timeoutSec > 0 {
+		ctx, cancel = context.WithTimeout(interrupted, seconds(*timeoutSec))
+	}
+	defer cancel()
+
+	release, err := fetchRelease(ctx, cfg.SelfUpdate, *versionArg)
+	if err != nil {
+		return fail(err)
+	}
+	asset, assetErr := releaseAsset(release, runtime.GOOS, runtime.GOARCH)
+	current := buildMetadata().Version
+	check := UpdateCheck{
+		Current:         current,
+		Latest:          strings.TrimPrefix(release.TagName, "v"),
+		UpdateAvailable: current != "dev" && compareVersions(strings.TrimPrefix(release.TagName, "v"), current) > 0,
+		Asset:           asset.Name,
+		URL:             release.HTMLURL,
+	}
+
+	if *checkOnly {
+		if *asJSON {
+			if code := printJSON(check); code != 0 {
+				return code
+			}
+		} else if check.UpdateAvailable {
+			fmt.Println(msg("self_update.available", check.Latest, check.Current, check.URL))
+		} else {
+			fmt.Println(msg("self_update.current", check.Current, check.Latest))
+		}
+		if check.UpdateAvailable {
+			return 1
+		}
+		return 0
+	}
+	if !check.UpdateAvailable && *versionArg == "" && !*force {
+		if current == "dev" {
+			fmt.Println(msg("self_update.dev_build", check.Latest))
+		} else {
+			fmt.Println(msg("self_update.current", check.Current, check.Latest))
+		}
+		return 0
+	}
+	if assetErr != nil {
+		return fail(assetErr)
+	}
+
+	target, err := os.Executable()
+	if err == nil {
+		target, err = filepath.EvalSymlinks(target)
+	}
+	if err != nil {
+		return fail(fmt.Errorf("failed to locate the running binary: %w", err))
+	}
+	if strings.Contains(target, "/Cellar/") {
+		return fail(fmt.Errorf("%s is managed by Homebrew; update it with `brew upgrade` instead", target))
+	}
+
+	publicKey := releaseKey(cfg.SelfUpdate)
+	if publicKey == "" && !*skipSignature {
+		return fail(errors.New("no release public key is built in or configured; refusing to install a release whose signature cannot be checked (set self_update.public_key, or pass --insecure-skip-signature to trust the checksum alone)"))
+	}
+	fmt.Println(msg("self_update.downloading", asset.Name, release.TagName))
+	binary, err := downloadVerifiedRelease(ctx, release, asset, publicKey)
+	if err != nil {
+		return fail(err)
+	}
+	installed, err := replaceBinary(target, binary)
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Println(msg("self_update.updated", target, check.Current, installed))
+
+	// An installed bridge copy wins over the embedded one, so bring it to
+	// the new binary's version too.
+	for _, dir := range bridgeInstallDirs() {
+		if _, err := os.Stat(filepath.Join(dir, bridgeScriptName)); err != nil {
+			continue
+		}
+		if out, err := exec.Command(target, "bridge", "install", "--dir", dir).CombinedOutput(); err != nil {
+			warnf("self_update.bridge_failed", dir, strings.TrimSpace(string(out)))
+		} else {
+			fmt.Println(strings.TrimSpace(string(out)))
+		}
+	}
+	return 0
+}
+
+// releaseKey is the key release signatures are checked with. A key built
+// into the binary cannot be swapped out by editing the config.
+func releaseKey(cfg SelfUpdateConfig) string {
+	if releasePublicKey == "" {
+		return cfg.PublicKey
+	}
+	if cfg.PublicKey != "" && cfg.PublicKey != releasePublicKey {
+		warnf("self_update.key_ignored")
+	}
+	return releasePublicKey
+}
+
+func fetchRelease(ctx context.Context, cfg SelfUpdateConfig, tag string) (githubRelease, error) {
+	api := strings.TrimSuffix(firstNonEmpty(cfg.APIURL, defaultUpdateAPI), "/")
+	url := fmt.Sprintf("%s/repos/%s/releases/latest", api, firstNonEmpty(cfg.Repository, defaultUpdateRepository))
+	if tag != "" {
+		if !strings.HasPrefix(tag, "v") && !strings.HasPrefix(tag, "V") {
+			tag = "v" + tag
+		}
+		url = fmt.Sprintf("%s/repos/%s/releases/tags/%s", api, firstNonEmpty(cfg.Repository, defaultUpdateRepository), tag)
+	}
+	body, err := updateDownload(ctx, url, "application/vnd.github+json")
+	if err != nil {
+		return githubRelease{}, fmt.Errorf("failed to look up the release: %w", err)
+	}
+	var release githubRelease
+	if err := json.Unmarshal(body, &release); err != nil || release.TagName == "" {
+		return githubRelease{}, fmt.Errorf("unexpected release answer from %s", url)
+	}
+	return release, nil
+}
+
+// releaseAsset picks the archive or bare binary built for this platform,
+// named like fortivpn_1.4.0_darwin_arm64.tar.gz.
+func releaseAsset(release githubRelease, goos, goarch string) (githubAsset, error) {
+	for _, asset := range release.Assets {
+		name := strings.ToLower(asset.Name)
+		if strings.HasSuffix(name, ".sig") || strings.HasSuffix(name, ".txt") {
+			continue
+		}
+		base := strings.TrimSuffix(strings.TrimSuffix(name, ".tar.gz"), ".tgz")
+		if strings.HasSuffix(base, "_"+goos+"_"+goarch) || strings.HasSuffix(base, "-"+goos+"-"+goarch) {
+			return asset, nil
+		}
+	}
+	return githubAsset{}, fmt.Errorf("release %s has no build for %s/%s", release.TagName, goos, goarch)
+}
+
+// downloadVerifiedRelease fetches the asset and checks it against the
+// release's checksums.txt; with a public key the checksums must also carry
+// a valid checksums.txt.sig. It returns the binary itself.
+func downloadVerifiedRelease(ctx context.Context, release githubRelease, asset githubAsset, publicKey string) ([]byte, error) {
+	assetURL := func(name string) string {
+		for _, a := range release.Assets {
+			if a.Name == name {
+				return a.URL
+			}
+		}
+		return ""
+	}
+	checksumsURL := assetURL(updateChecksumsAsset)
+	if checksumsURL == "" {
+		return nil, fmt.Errorf("release %s has no %s; refusing to install an unverified binary", release.TagName, updateChecksumsAsset)
+	}
+	checksums, err := updateDownload(ctx, checksumsURL, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", updateChecksumsAsset, err)
+	}
+	if publicKey != "" {
+		key, err := decodeReleaseKey(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		sigURL := assetURL(updateChecksumsAsset + ".sig")
+		if sigURL == "" {
+			return nil, fmt.Errorf("release %s has no %s.sig", release.TagName, updateChecksumsAsset)
+		}
+		sig, err := updateDownload(ctx, sigURL, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to download the signature: %w", err)
+		}
+		if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig))); err == nil {
+			sig = decoded
+		}
+		if !ed25519.Verify(key, checksums, sig) {
+			return nil, fmt.Errorf("the signature of %s in release %s does not match the release key", updateChecksumsAsset, release.TagName)
+		}
+	} else {
+		warnf("self_update.unsigned")
+	}
+
+	want, err := releaseChecksum(checksums, asset.Name)
+	if err != nil {
+		return nil, err
+	}
+	body, err := updateDownload(ctx, asset.URL, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", asset.Name, err)
+	}
+	sum := sha256.Sum256(body)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return nil, fmt.Errorf("checksum mismatch for %s: got %s, want %s", asset.Name, got, want)
+	}
+	name := strings.ToLower(asset.Name)
+	if strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz") {
+		return binaryFromArchive(body)
+	}
+	return body, nil
+}
+
+// releaseChecksum finds name in sha256sum-style output.
+func releaseChecksum(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("%s does not list %s", updateChecksumsAsset, name)
+}
+
+func binaryFromArchive(archive []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the release archive: %w", err)
+	}
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("the release archive contains no fortivpn binary")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the release archive: %w", err)
+		}
+		if header.Typeflag == tar.TypeReg && path.Base(header.Name) == "fortivpn" {
+			return io.ReadAll(io.LimitReader(reader, maxUpdateDownload))
+		}
+	}
+}
+
+// replaceBinary writes the new binary next to target, makes sure it runs
+// on this machine and renames it over target. It returns the version the
+// new binary reports.
+func replaceBinary(target string, binary []byte) (string, error) {
+	dir := filepath.Dir(target)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(target)+".update-*")
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return "", fmt.Errorf("cannot write to %s; re-run with sudo or reinstall where you can write", dir)
+		}
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Chmod(0o755); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	out, err := exec.Command(tmp.Name(), "version", "--no-bridge", "--json").Output()
+	var info VersionInfo
+	if err == nil {
+		err = json.Unmarshal(out, &info)
+	}
+	if err != nil {
+		return "", fmt.Errorf("the downloaded binary does not run on this machine: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", fmt.Errorf("failed to replace %s: %w", target, err)
+	}
+	return info.Version, nil
+}
+
+func updateDownload(ctx context.Context, url, accept string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if token := strings.TrimSpace(os.Getenv("GITHUB_TOKEN")); token != "" && strings.HasPrefix(url, defaultUpdateAPI) {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("User-Agent", "fortivpn/"+buildMetadata().Version)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxUpdateDownload+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxUpdateDownload {
+		return nil, fmt.Errorf("%s: larger than %d MB", url, maxUpdateDownload>>20)
+	}
+	return body, nil
+}
+
+func decodeReleaseKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("public_key must be a base64 ed25519 public key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// compareVersions compares dotted numeric versions such as 1.10.2; a
+// pre-release suffix (1.2.0-rc1) sorts before the release.
+func compareVersions(a, b string) int {
+	aCore, aPre, _ := strings.Cut(a, "-")
+	bCore, bPre, _ := strings.Cut(b, "-")
+	aParts, bParts := strings.Split(aCore, "."), strings.Split(bCore, ".")
+	for i := range max(len(aParts), len(bParts)) {
+		var x, y int
+		if i < len(aParts) {
+			x, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			y, _ = strconv.Atoi(bParts[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return strings.Compare(aPre, bPre)
+}
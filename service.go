@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	serviceLabel    = "com.github.simonkaran13.fortivpn.watch"
+	serviceThrottle = 30
+)
+
+// ServiceStatus is what `service status` reports.
+type ServiceStatus struct {
+	Installed  bool     `json:"installed"`
+	Plist      string   `json:"plist"`
+	Loaded     bool     `json:"loaded"`
+	Running    bool     `json:"running"`
+	PID        int      `json:"pid,omitempty"`
+	LastExit   *int     `json:"last_exit_code,omitempty"`
+	Connection string   `json:"connection,omitempty"`
+	Command    []string `json:"command,omitempty"`
+	Log        string   `json:"log,omitempty"`
+}
+
+func runService(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, msg("error", msg("service.no_subcommand")))
+		return 2
+	}
+	switch args[0] {
+	case "install":
+		return runServiceInstall(args[1:])
+	case "uninstall":
+		return runServiceUninstall(args[1:])
+	case "start":
+		return runServiceStart(args[1:])
+	case "stop":
+		return runServiceStop(args[1:])
+	case "status":
+		return runServiceStatus(args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, msg("error", msg("service.unknown", args[0])))
+		return 2
+	}
+}
+
+// runServiceInstall writes a LaunchAgent that runs `fortivpn watch` from
+// login on and restarts it if it exits. Flags after "--" are passed to
+// watch as they are.
+func runServiceInstall(args []string) int {
+	fs := flag.NewFlagSet("service install", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	connectionArg := fs.String("connection", "", "VPN connection or group to keep up (default: the default connection when watch starts).")
+	logPath := fs.String("log", "", "File for the watch output (default: ~/Library/Logs/fortivpn/watch.log).")
+	noStart := fs.Bool("no-start", false, "Write the LaunchAgent without loading it; it starts at the next login.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	plist, err := servicePlistPath()
+	if err != nil {
+		return fail(err)
+	}
+	if !*noStart {
+		if err := requireLaunchctl(); err != nil {
+			return fail(err)
+		}
+	}
+
+	connection := strings.TrimSpace(*connectionArg)
+	if connection != "" {
+		// Catch a typo now rather than in a log nobody reads; when FortiClient
+		// cannot be asked, trust the name.
+		if tunnels, err := getConnections(); err == nil {
+			cfg, cfgErr := loadConfig()
+			if cfgErr != nil {
+				return fail(cfgErr)
+			}
+			if _, err := resolveSelection(connection, tunnels, cfg); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	program, err := serviceProgram()
+	if err != nil {
+		return fail(err)
+	}
+	log := *logPath
+	if log == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return fail(fmt.Errorf("failed to locate home directory: %w", err))
+		}
+		log = filepath.Join(home, "Library", "Logs", "fortivpn", "watch.log")
+	}
+	if log, err = filepath.Abs(log); err != nil {
+		return fail(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(log), 0o755); err != nil {
+		return fail(fmt.Errorf("failed to create the log directory: %w", err))
+	}
+
+	command := []string{program, "watch"}
+	if connection != "" {
+		command = append(command, "--connection", connection)
+	}
+	command = append(command, fs.Args()...)
+	body := servicePlist(command, log, serviceEnvironment())
+	if err := os.MkdirAll(filepath.Dir(plist), 0o755); err != nil {
+		return fail(err)
+	}
+	loaded := !*noStart && serviceLoaded()
+	if loaded {
+		// launchd keeps the old definition until the job is unloaded.
+		if err := launchctl("bootout", serviceTarget()); err != nil {
+			return fail(err)
+		}
+	}
+	if err := writeFileAtomic(plist, body, 0o600); err != nil {
+		return fail(fmt.Errorf("failed to write %s: %w", plist, err))
+	}
+	fmt.Println(msg("service.installed", plist, strings.Join(command[1:], " "), log))
+	if *noStart {
+		return 0
+	}
+	if err := launchctl("bootstrap", serviceDomain(), plist); err != nil {
+		return fail(err)
+	}
+	fmt.Println(msg("service.started"))
+	return 0
+}
+
+func runServiceUninstall(args []string) int {
+	fs := flag.NewFlagSet("service uninstall", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	plist, err := servicePlistPath()
+	if err != nil {
+		return fail(err)
+	}
+	if _, err := os.Stat(plist); errors.Is(err, os.ErrNotExist) {
+		fmt.Println(msg("service.not_installed"))
+		return 0
+	}
+	if requireLaunchctl() == nil && serviceLoaded() {
+		if err := launchctl("bootout", serviceTarget()); err != nil {
+			return fail(err)
+		}
+	}
+	if err := os.Remove(plist); err != nil {
+		return fail(err)
+	}
+	fmt.Println(msg("service.uninstalled", plist))
+	return 0
+}
+
+func runServiceStart(args []string) int {
+	fs := flag.NewFlagSet("service start", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	plist, err := servicePlistPath()
+	if err != nil {
+		return fail(err)
+	}
+	if _, err := os.Stat(plist); err != nil {
+		return fail(fmt.Errorf("%w: %s", errNotFound, plist))
+	}
+	if err := requireLaunchctl(); err != nil {
+		return fail(err)
+	}
+	if serviceLoaded() {
+		err = launchctl("kickstart", serviceTarget())
+	} else {
+		err = launchctl("bootstrap", serviceDomain(), plist)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Println(msg("service.started"))
+	return 0
+}
+
+// runServiceStop unloads the job, since launchd would restart a killed
+// watch right away. It loads again at the next login.
+func runServiceStop(args []string) int {
+	fs := flag.NewFlagSet("service stop", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := requireLaunchctl(); err != nil {
+		return fail(err)
+	}
+	if !serviceLoaded() {
+		fmt.Println(msg("service.not_running"))
+		return 0
+	}
+	if err := launchctl("bootout", serviceTarget()); err != nil {
+		return fail(err)
+	}
+	fmt.Println(msg("service.stopped"))
+	return 0
+}
+
+func runServiceStatus(args []string) int {
+	fs := flag.NewFlagSet("service status", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	jsonOut := outputFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	plist, err := servicePlistPath()
+	if err != nil {
+		return fail(err)
+	}
+	status := ServiceStatus{Plist: plist}
+	if root, err := readPlist(plist); err == nil {
+		status.Installed = true
+		if program := root.get("ProgramArguments"); program != nil {
+			for _, arg := range program.Values {
+				status.Command = append(status.Command, arg.Text)
+			}
+		}
+		for i, arg := range status.Command {
+			if arg == "--connection" && i+1 < len(status.Command) {
+				status.Connection = status.Command[i+1]
+			}
+		}
+		if log := root.get("StandardOutPath"); log != nil {
+			status.Log = log.Text
+		}
+	}
+	if requireLaunchctl() == nil {
+		if out, err := exec.Command("launchctl", "print", serviceTarget()).Output(); err == nil {
+			status.Loaded = true
+			status.Running = launchctlField(out, "state") == "running"
+			status.PID, _ = strconv.Atoi(launchctlField(out, "pid"))
+			if code, err := strconv.Atoi(launchctlField(out, "last exit code")); err == nil {
+				status.LastExit = &code
+			}
+		}
+	}
+
+	if *jsonOut {
+		printJSON(status)
+	} else {
+		printServiceStatus(status)
+	}
+	if !status.Running {
+		return 1
+	}
+	return 0
+}
+
+func printServiceStatus(status ServiceStatus) {
+	if !status.Installed {
+		fmt.Println(msg("service.not_installed"))
+		return
+	}
+	state := msg("service.state_unloaded")
+	switch {
+	case status.Running:
+		state = msg("service.state_running", status.PID)
+	case status.Loaded:
+		state = msg("service.state_loaded")
+	}
+	fmt.Println(msg("service.status_plist", status.Plist))
+	fmt.Println(msg("service.status_state", state))
+	fmt.Println(msg("service.status_connection", firstNonEmpty(status.Connection, msg("service.default_connection"))))
+	if status.LastExit != nil {
+		fmt.Println(msg("service.status_last_exit", *status.LastExit))
+	}
+	if status.Log != "" {
+		fmt.Println(msg("service.status_log", status.Log))
+	}
+}
+
+func servicePlistPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate home directory: %w", err)
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", serviceLabel+".plist"), nil
+}
+
+func serviceDomain() string {
+	return fmt.Sprintf("gui/%d", os.Getuid())
+}
+
+func serviceTarget() string {
+	return serviceDomain() + "/" + serviceLabel
+}
+
+func requireLaunchctl() error {
+	if _, err := exec.LookPath("launchctl"); err != nil {
+		return errors.New(msg("service.unsupported"))
+	}
+	return nil
+}
+
+func serviceLoaded() bool {
+	return exec.Command("launchctl", "print", serviceTarget()).Run() == nil
+}
+
+func launchctl(args ...string) error {
+	out, err := exec.Command("launchctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("launchctl %s failed: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+var launchctlFieldPattern = regexp.MustCompile(`(?m)^\s*([a-z ]+?) = (.*)$`)
+
+// launchctlField picks a top-level "key = value" line out of `launchctl
+// print`; the output is meant for people and has no stable format.
+func launchctlField(out []byte, key string) string {
+	for _, match := range launchctlFieldPattern.FindAllSubmatch(out, -1) {
+		if string(match[1]) == key {
+			return strings.TrimSpace(string(match[2]))
+		}
+	}
+	return ""
+}
+
+// serviceProgram is the binary the LaunchAgent runs. A Homebrew install is
+// referred to by its bin symlink, which survives upgrades, rather than the
+// versioned Cellar path.
+func serviceProgram() (string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(self, "/Cellar/") {
+		if linked, err := exec.LookPath(filepath.Base(self)); err == nil {
+			if abs, err := filepath.Abs(linked); err == nil {
+				return abs, nil
+			}
+		}
+	}
+	return self, nil
+}
+
+// serviceEnvVars are the settings copied into the plist. Secrets such as
+// FORTIVPN_CONFIG_KEY and FORTIVPN_AGE_IDENTITY are left out on purpose:
+// the plist is a file on disk, and the service finds them in the keychain.
+var serviceEnvVars = []string{
+	"FORTIVPN_BACKEND", "FORTIVPN_BRIDGE", "FORTIVPN_BRIDGE_DAEMON", "FORTIVPN_BRIDGE_GRPC",
+	"FORTIVPN_CLIENT_CONFIG", "FORTIVPN_CONFIG", "FORTIVPN_ELECTRON", "FORTIVPN_HEADLESS",
+	"FORTIVPN_LANG", "FORTIVPN_LOG_DIR", "FORTIVPN_MODULE_PATH", "FORTIVPN_NODE",
+}
+
+// serviceEnvironment carries PATH and the FORTIVPN_* settings of the shell
+// that installed the service over to launchd, which starts jobs with
+// neither.
+func serviceEnvironment() [][2]string {
+	env := [][2]string{{"PATH", os.Getenv("PATH")}}
+	for _, name := range serviceEnvVars {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, [2]string{name, value})
+		}
+	}
+	return env
+}
+
+func servicePlist(command []string, log string, env [][2]string) []byte {
+	var b bytes.Buffer
+	text := func(s string) string {
+		var escaped bytes.Buffer
+		_ = xml.EscapeText(&escaped, []byte(s))
+		return escaped.String()
+	}
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString("<plist version=\"1.0\">\n<dict>\n")
+	fmt.Fprintf(&b, "\t<key>Label</key>\n\t<string>%s</string>\n", serviceLabel)
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, arg := range command {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", text(arg))
+	}
+	b.WriteString("\t</array>\n")
+	b.WriteString("\t<key>EnvironmentVariables</key>\n\t<dict>\n")
+	for _, kv := range env {
+		fmt.Fprintf(&b, "\t\t<key>%s</key>\n\t\t<string>%s</string>\n", text(kv[0]), text(kv[1]))
+	}
+	b.WriteString("\t</dict>\n")
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	b.WriteString("\t<key>KeepAlive</key>\n\t<true/>\n")
+	fmt.Fprintf(&b, "\t<key>ThrottleInterval</key>\n\t<integer>%d</integer>\n", serviceThrottle)
+	fmt.Fprintf(&b, "\t<key>StandardOutPath</key>\n\t<string>%s</string>\n", text(log))
+	fmt.Fprintf(&b, "\t<key>StandardErrorPath</key>\n\t<string>%s</string>\n", text(log))
+	b.WriteString("</dict>\n</plist>\n")
+	return b.Bytes()
+}
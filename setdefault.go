@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runSetDefault stores the connection or group commands use when given
+// none, in the config file's default_connection. Without a NAME it prints
+// the current default.
+func runSetDefault(args []string) int {
+	fs := flag.NewFlagSet("set-default", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	clearDefault := fs.Bool("clear", false, "Remove the default, so the first connection is used again.")
+	var name string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if name == "" && fs.NArg() > 0 {
+		name = fs.Arg(0)
+	}
+	if fs.NArg() > 1 || (*clearDefault && name != "") {
+		fmt.Fprintln(os.Stderr, msg("error", msg("set_default.usage")))
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	if *clearDefault {
+		path, err := setConfigValue("default_connection", nil)
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Println(msg("set_default.cleared", path))
+		return 0
+	}
+	if name == "" {
+		if cfg.DefaultConnection == "" {
+			fmt.Println(msg("set_default.none"))
+			return 1
+		}
+		fmt.Println(cfg.DefaultConnection)
+		return 0
+	}
+
+	// Store the name FortiClient uses, not the alias that matched it, so the
+	// default keeps pointing at one connection when others are added.
+	if group, _, ok := cfg.group(name); ok {
+		name = group
+	} else {
+		tunnels, err := getConnections()
+		if err != nil {
+			return fail(err)
+		}
+		tunnel, err := resolveTunnel(name, tunnels)
+		if err != nil {
+			return fail(err)
+		}
+		name = tunnel.ConnectionName
+	}
+	path, err := setConfigValue("default_connection", name)
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Println(msg("set_default.set", name, path))
+	return 0
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ConnectionDetail is everything known about one connection, from the
+// backend's connection list, FortiClient's profile and the config file.
+type ConnectionDetail struct {
+	ConnectionName string `json:"connection_name"`
+	Type           string `json:"type"`
+	Gateway        string `json:"gateway,omitempty"`
+	Port           int    `json:"port,omitempty"`
+	GatewaySource  string `json:"gateway_source,omitempty"`
+	SAML           bool   `json:"saml"`
+	Corporate      bool   `json:"corporate"`
+	CloudVPN       bool   `json:"cloud_vpn"`
+	Default        bool   `json:"default"`
+	Active         bool   `json:"active"`
+}
+
+var (
+	profileGatewayKey = regexp.MustCompile(`(?i)^(server|servers|remote_?gateway|gateway|host|server_?address)$`)
+	profilePortKey    = regexp.MustCompile(`(?i)^(port|server_?port)$`)
+	profileSAMLKey    = regexp.MustCompile(`(?i)(saml|sso)`)
+)
+
+func runShow(args []string) int {
+	fs := flag.NewFlagSet("show", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	asJSON := outputFlags(fs)
+	var name string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if name == "" && fs.NArg() > 0 {
+		name = fs.Arg(0)
+	}
+	if name == "" || fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, msg("error", msg("show.usage")))
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	tunnels, err := getConnections()
+	if err != nil {
+		return fail(err)
+	}
+	tunnel, err := resolveTunnel(name, tunnels)
+	if err != nil {
+		return fail(err)
+	}
+	detail := newConnectionDetail(tunnel, tunnels, cfg)
+	if state, err := getTunnelState(); err == nil {
+		detail.Active = state.Connected() && strings.EqualFold(state.CurrentConnection(), tunnel.ConnectionName)
+	}
+
+	if *asJSON {
+		return printJSON(detail)
+	}
+	gateway := msg("none")
+	if detail.Gateway != "" {
+		gateway = net.JoinHostPort(detail.Gateway, strconv.Itoa(detail.Port)) + " (" + detail.GatewaySource + ")"
+	}
+	fmt.Println(msg("show.name", detail.ConnectionName))
+	fmt.Println(msg("show.type", detail.Type))
+	fmt.Println(msg("show.gateway", gateway))
+	fmt.Println(msg("show.saml", yesNo(detail.SAML)))
+	fmt.Println(msg("show.corporate", yesNo(detail.Corporate)))
+	fmt.Println(msg("show.cloud", yesNo(detail.CloudVPN)))
+	fmt.Println(msg("show.default", yesNo(detail.Default)))
+	fmt.Println(msg("show.active", yesNo(detail.Active)))
+	return 0
+}
+
+// newConnectionDetail describes tunnel, leaving out whether it is active.
+func newConnectionDetail(tunnel Tunnel, tunnels []Tunnel, cfg Config) ConnectionDetail {
+	return newConnectionDetails([]Tunnel{tunnel}, tunnels, cfg)[0]
+}
+
+// newConnectionDetails describes each of list, resolving the default and
+// reading the profiles once for all of them.
+func newConnectionDetails(list, tunnels []Tunnel, cfg Config) []ConnectionDetail {
+	var defaults []string
+	if fallback, err := resolveSelection("", tunnels, cfg); err == nil {
+		defaults = fallback.Names()
+	}
+	profiles := readConnectionProfiles()
+	details := make([]ConnectionDetail, len(list))
+	for i, tunnel := range list {
+		details[i] = ConnectionDetail{
+			ConnectionName: tunnel.ConnectionName,
+			Type:           tunnel.Type,
+			Corporate:      tunnel.Corporate != 0,
+			CloudVPN:       tunnel.CloudVPN != 0,
+			Default:        slices.Contains(defaults, tunnel.ConnectionName),
+		}
+		details[i].fillProfile(profiles, cfg)
+	}
+	return details
+}
+
+// fillProfile sets the gateway and SAML flag from the backend's connection
+// list and FortiClient's profile; a gateway in the config file wins.
+func (d *ConnectionDetail) fillProfile(profiles connectionProfiles, cfg Config) {
+	for key, value := range profiles.fields(d.ConnectionName) {
+		switch {
+		case profileGatewayKey.MatchString(key) && d.Gateway == "":
+			d.Gateway, d.GatewaySource = value, "forticlient"
+		case profilePortKey.MatchString(key):
+			d.Port, _ = strconv.Atoi(value)
+		case profileSAMLKey.MatchString(key):
+			d.SAML = d.SAML || value == "1" || strings.EqualFold(value, "true") || strings.EqualFold(value, "yes")
+		}
+	}
+	if gateway := cfg.forConnection(d.ConnectionName).Gateway; gateway != "" {
+		d.Gateway, d.Port, d.GatewaySource = gateway, 0, "config"
+	}
+	if host, port, err := net.SplitHostPort(gatewayAddress(d.Gateway)); err == nil && d.Gateway != "" {
+		d.Gateway = host
+		if d.Port == 0 {
+			d.Port, _ = strconv.Atoi(port)
+		}
+	}
+}
+
+// connectionProfiles holds the scalar profile fields of every connection,
+// keyed by lower-cased name, so that describing several connections reads
+// the backend's connection list and FortiClient's vpn.plist only once.
+type connectionProfiles struct {
+	backend map[string]map[string]string
+	client  map[string]map[string]string
+}
+
+// readConnectionProfiles collects the fields of the connection list the
+// backend last sent and of FortiClient's profiles, when they can be read.
+func readConnectionProfiles() connectionProfiles {
+	profiles := connectionProfiles{backend: map[string]map[string]string{}, client: map[string]map[string]string{}}
+	var entries []map[string]any
+	if json.Unmarshal(lastConnectionList, &entries) == nil {
+		for _, entry := range entries {
+			name, _ := entry["connection_name"].(string)
+			key := strings.ToLower(name)
+			if profiles.backend[key] == nil {
+				profiles.backend[key] = map[string]string{}
+			}
+			flattenJSON(entry, profiles.backend[key])
+		}
+	}
+	path := firstNonEmpty(strings.TrimSpace(os.Getenv("FORTIVPN_CLIENT_CONFIG")), fortiClientVPNPlist)
+	root, err := readPlist(path)
+	if err != nil {
+		return profiles
+	}
+	for _, section := range []string{"Tunnels", "Profiles"} {
+		node := root.get(section)
+		if node == nil {
+			continue
+		}
+		seen := map[string]bool{}
+		for i, name := range node.Keys {
+			key := strings.ToLower(name)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if profiles.client[key] == nil {
+				profiles.client[key] = map[string]string{}
+			}
+			flattenPlist(node.Values[i], profiles.client[key])
+		}
+	}
+	return profiles
+}
+
+// fields returns connection's profile fields; the backend's win over
+// FortiClient's.
+func (p connectionProfiles) fields(connection string) map[string]string {
+	key := strings.ToLower(connection)
+	fields := map[string]string{}
+	for k, v := range p.client[key] {
+		fields[k] = v
+	}
+	for k, v := range p.backend[key] {
+		fields[k] = v
+	}
+	return fields
+}
+
+func flattenJSON(node map[string]any, fields map[string]string) {
+	for key, value := range node {
+		switch v := value.(type) {
+		case map[string]any:
+			flattenJSON(v, fields)
+		case string:
+			fields[key] = strings.TrimSpace(v)
+		case float64:
+			fields[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			fields[key] = strconv.FormatBool(v)
+		}
+	}
+}
+
+func flattenPlist(node *plistNode, fields map[string]string) {
+	for i, key := range node.Keys {
+		value := node.Values[i]
+		switch value.Kind {
+		case "dict":
+			flattenPlist(value, fields)
+		case "true", "false":
+			fields[key] = value.Kind
+		case "array":
+		default:
+			fields[key] = value.Text
+		}
+	}
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
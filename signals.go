@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var errCanceled = errors.New("canceled")
+
+// interrupted is canceled by SIGINT or SIGTERM. Bridge calls run under it,
+// so the runtime they started is killed along with the CLI instead of
+// being left running.
+var interrupted, interrupt = context.WithCancel(context.Background())
+
+// bridgesInFlight counts running bridge calls; with none, a signal can exit
+// straight away.
+var bridgesInFlight atomic.Int32
+
+// signalCleanup, while set, runs before a signal exits fortivpn; tui uses
+// it to give the terminal back.
+var signalCleanup atomic.Pointer[func()]
+
+// signalChild, while set, receives SIGINT/SIGTERM instead of fortivpn
+// exiting, so `fortivpn run` can wait for its command and clean up.
+var signalChild atomic.Pointer[os.Process]
+
+// handleSignals cancels in-flight bridge calls on SIGINT/SIGTERM and exits
+// with 130: right away when no bridge call is running, otherwise through
+// the failing command or after a short grace period.
+func handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range signals {
+			if child := signalChild.Load(); child != nil {
+				_ = child.Signal(sig)
+				continue
+			}
+			break
+		}
+		interrupt()
+		if bridgesInFlight.Load() > 0 {
+			// The canceled call makes the command fail with errCanceled
+			// and exit on its own; this is only the fallback.
+			time.Sleep(2 * time.Second)
+		}
+		if cleanup := signalCleanup.Load(); cleanup != nil {
+			(*cleanup)()
+		}
+		fmt.Fprintln(os.Stderr, msg("error", errCanceled))
+		os.Exit(130)
+	}()
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SimulationStep changes the mock backend At seconds into the simulation.
+type SimulationStep struct {
+	At             float64 `json:"at"`
+	Drop           bool    `json:"drop,omitempty"`
+	FailConnects   *bool   `json:"fail_connects,omitempty"`
+	ConnectDelayMS *int64  `json:"connect_delay_ms,omitempty"`
+}
+
+type SimulationScenario struct {
+	Connections []string         `json:"connections,omitempty"`
+	Steps       []SimulationStep `json:"steps"`
+	Start       int64            `json:"start_ms,omitempty"`
+}
+
+func (s SimulationScenario) end() time.Duration {
+	var end float64
+	for _, step := range s.Steps {
+		end = max(end, step.At)
+	}
+	return seconds(end)
+}
+
+var (
+	simulationTrue  = true
+	simulationFalse = false
+	simulationSlow  = int64(8000)
+)
+
+var simulationScenarios = map[string]SimulationScenario{
+	// The tunnel drops every 15 seconds and always comes back.
+	"flap": {Steps: []SimulationStep{{At: 15, Drop: true}, {At: 30, Drop: true}, {At: 45, Drop: true}}},
+	// The gateway goes away for 30 seconds: the tunnel drops and every
+	// reconnect fails until it returns.
+	"outage": {Steps: []SimulationStep{{At: 10, Drop: true, FailConnects: &simulationTrue}, {At: 40, FailConnects: &simulationFalse}}},
+	// Reconnects succeed but take 8 seconds to come up.
+	"slow": {Steps: []SimulationStep{{At: 10, Drop: true, ConnectDelayMS: &simulationSlow}, {At: 25, Drop: true}}},
+}
+
+// simulationModule stands in for FortiClient's GUI module. It keeps the
+// tunnel in a state file and applies the scenario steps as they come due.
+const simulationModule = `const fs = require('fs');
+const path = require('path');
+const dir = __dirname;
+const scenario = JSON.parse(fs.readFileSync(path.join(dir, 'scenario.json'), 'utf8'));
+const stateFile = path.join(dir, 'state.json');
+function load() {
+  let s;
+  try { s = JSON.parse(fs.readFileSync(stateFile, 'utf8')); } catch { s = { name: '', up_at: 0, applied: 0, fail: false, delay: 0 }; }
+  const elapsed = (Date.now() - scenario.start_ms) / 1000;
+  while (s.applied < scenario.steps.length && scenario.steps[s.applied].at <= elapsed) {
+    const step = scenario.steps[s.applied++];
+    if (step.drop) { s.name = ''; s.up_at = 0; }
+    if (step.fail_connects !== undefined) { s.fail = step.fail_connects; }
+    if (step.connect_delay_ms !== undefined) { s.delay = step.connect_delay_ms; }
+  }
+  fs.writeFileSync(stateFile, JSON.stringify(s));
+  return s;
+}
+function save(s) { fs.writeFileSync(stateFile, JSON.stringify(s)); }
+module.exports = {
+  GetVPNConnectionList() {
+    return JSON.stringify(scenario.connections.map((name) => ({ connection_name: name, type: 'ssl' })));
+  },
+  getConnectionState() {
+    const s = load();
+    const up = s.name !== '' && Date.now() >= s.up_at;
+    return JSON.stringify({ ipsec_state: 0, ssl_state: up ? 1 : 0, connection_name: up ? s.name : '', saml_vpn_name: '' });
+  },
+  ConnectTunnel(req) {
+    const s = load();
+    if (s.fail) { throw new Error('simulated: gateway unreachable'); }
+    s.name = JSON.parse(req).connection_name;
+    s.up_at = Date.now() + s.delay;
+    save(s);
+    return '';
+  },
+  DisconnectTunnel() {
+    const s = load();
+    s.name = '';
+    s.up_at = 0;
+    save(s);
+    return '';
+  },
+};
+`
+
+func loadSimulationScenario(name string) (SimulationScenario, error) {
+	if scenario, ok := simulationScenarios[name]; ok {
+		return scenario, nil
+	}
+	raw, err := os.ReadFile(name)
+	if err != nil {
+		return SimulationScenario{}, fmt.Errorf("unknown scenario %q (want flap, outage, slow or a JSON file): %w", name, err)
+	}
+	var scenario SimulationScenario
+	if err := json.Unmarshal(raw, &scenario); err != nil {
+		return SimulationScenario{}, fmt.Errorf("invalid scenario %s: %w", name, err)
+	}
+	if len(scenario.Steps) == 0 {
+		return SimulationScenario{}, fmt.Errorf("scenario %s has no steps", name)
+	}
+	return scenario, nil
+}
+
+func runSimulate(args []string) int {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	scenarioArg := fs.String("scenario", "flap", "Built-in scenario (flap, outage, slow) or a JSON scenario file.")
+	connectionArg := fs.String("connection", "Simulated VPN", "Connection or configured group to watch; its names make up the simulated connection list.")
+	durationSec := fs.Float64("duration", 0, "Stop after this many seconds (default: 20 seconds after the last step).")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	scenario, err := loadSimulationScenario(*scenarioArg)
+	if err != nil {
+		return fail(err)
+	}
+	if len(scenario.Connections) == 0 {
+		if _, group, ok := cfg.group(*connectionArg); ok {
+			scenario.Connections = group.Members
+		} else {
+			scenario.Connections = []string{*connectionArg}
+		}
+	}
+	duration := seconds(*durationSec)
+	if duration <= 0 {
+		duration = scenario.end() + 20*time.Second
+	}
+
+	dir, err := os.MkdirTemp("", "fortivpn-simulate-")
+	if err != nil {
+		return fail(err)
+	}
+	defer os.RemoveAll(dir)
+	scenario.Start = time.Now().UnixMilli()
+	body, err := json.Marshal(scenario)
+	if err != nil {
+		return fail(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "scenario.json"), body, 0o600); err != nil {
+		return fail(err)
+	}
+	modulePath := filepath.Join(dir, "module.js")
+	if err := os.WriteFile(modulePath, []byte(simulationModule), 0o600); err != nil {
+		return fail(err)
+	}
+	// The simulated tunnel starts up on the first connection.
+	initial, _ := json.Marshal(map[string]any{"name": scenario.Connections[0], "up_at": 0, "applied": 0, "fail": false, "delay": 0})
+	if err := os.WriteFile(filepath.Join(dir, "state.json"), initial, 0o600); err != nil {
+		return fail(err)
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Println(msg("simulate.start", *scenarioArg, strings.Join(scenario.Connections, ", "), duration))
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, self, append([]string{"watch", "--connection", *connectionArg}, fs.Args()...)...)
+	// History, locks and the status cache go to the scratch directory so a
+	// simulation never touches the real state.
+	cmd.Env = append(os.Environ(), "FORTIVPN_MODULE_PATH="+modulePath, "XDG_STATE_HOME="+dir)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		fmt.Println(msg("simulate.done", duration))
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return 0
+}
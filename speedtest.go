@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultSpeedtestDuration = 10 * time.Second
+
+// SpeedtestConfig is the internal endpoint `fortivpn speedtest` measures
+// against: URL serves a large download, UploadURL accepts a POST body.
+type SpeedtestConfig struct {
+	URL       string  `json:"url"`
+	UploadURL string  `json:"upload_url,omitempty"`
+	Duration  float64 `json:"duration,omitempty"`
+}
+
+func (c SpeedtestConfig) validate() error {
+	for _, u := range []string{c.URL, c.UploadURL} {
+		if u != "" && !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+			return fmt.Errorf("%q is not an http(s) url", u)
+		}
+	}
+	if c.URL == "" && c.UploadURL == "" {
+		return errors.New("url or upload_url is required")
+	}
+	if c.Duration < 0 {
+		return errors.New("duration must not be negative")
+	}
+	return nil
+}
+
+// Throughput is one direction of a speed test.
+type Throughput struct {
+	Bytes      int64   `json:"bytes"`
+	DurationMS int64   `json:"duration_ms"`
+	Mbps       float64 `json:"mbps"`
+	Error      string  `json:"error,omitempty"`
+}
+
+type SpeedtestResult struct {
+	Connection string        `json:"connection"`
+	Type       string        `json:"type,omitempty"`
+	Endpoint   string        `json:"endpoint"`
+	Interface  string        `json:"interface,omitempty"`
+	ViaTunnel  bool          `json:"via_tunnel"`
+	Latency    LatencySample `json:"latency"`
+	Download   *Throughput   `json:"download,omitempty"`
+	Upload     *Throughput   `json:"upload,omitempty"`
+}
+
+func runSpeedtest(args []string) int {
+	fs := flag.NewFlagSet("speedtest", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	downloadURL := fs.String("url", "", "Download from this URL instead of the configured speedtest url.")
+	uploadURL := fs.String("upload-url", "", "POST to this URL instead of the configured speedtest upload_url.")
+	durationSec := fs.Float64("duration", 0, "Seconds to spend on each direction (default 10).")
+	samples := fs.Int("samples", 5, "TCP handshakes to time for the latency.")
+	noUpload := fs.Bool("no-upload", false, "Only measure latency and download.")
+	asJSON := outputFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	state, err := getTunnelState()
+	if err != nil {
+		return fail(err)
+	}
+	if !state.Connected() {
+		fmt.Fprintln(os.Stderr, msg("error", msg("speedtest.not_connected")))
+		return 1
+	}
+	result := SpeedtestResult{Connection: state.CurrentConnection()}
+	if tunnels, err := getConnections(); err == nil {
+		if tunnel, err := resolveTunnel(result.Connection, tunnels); err == nil {
+			result.Type = tunnel.Type
+		}
+	}
+
+	endpoint := SpeedtestConfig{}
+	if configured := cfg.forConnection(result.Connection).Speedtest; configured != nil {
+		endpoint = *configured
+	}
+	endpoint.URL = firstNonEmpty(*downloadURL, endpoint.URL)
+	endpoint.UploadURL = firstNonEmpty(*uploadURL, endpoint.UploadURL)
+	if *noUpload {
+		endpoint.UploadURL = ""
+	}
+	if endpoint.URL == "" && endpoint.UploadURL == "" {
+		return fail(errors.New("no speedtest endpoint configured (set \"speedtest\": {\"url\": ...} or pass --url)"))
+	}
+	if err := endpoint.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, msg("error", err))
+		return 2
+	}
+	duration := seconds(flagOrSetting(fs, "duration", *durationSec, endpoint.Duration))
+	if duration <= 0 {
+		duration = defaultSpeedtestDuration
+	}
+
+	target, err := url.Parse(firstNonEmpty(endpoint.URL, endpoint.UploadURL))
+	if err != nil {
+		return fail(err)
+	}
+	result.Endpoint = target.Host
+	port := target.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[target.Scheme]
+	}
+	if ips, err := net.LookupIP(target.Hostname()); err == nil && len(ips) > 0 {
+		if iface, err := routeInterface(ips[0]); err == nil {
+			result.Interface = iface
+			if tunnel, err := detectTunnel(); err == nil && tunnel != nil {
+				result.ViaTunnel = iface == tunnel.Interface
+			}
+		}
+	}
+	if !result.ViaTunnel && !*asJSON {
+		warnf("speedtest.outside_tunnel", result.Endpoint)
+	}
+
+	progress.step("latency", "timing %d handshakes to %s", *samples, result.Endpoint)
+	result.Latency = measureLatency(LatencyConfig{Target: net.JoinHostPort(target.Hostname(), port), Samples: *samples})
+	if endpoint.URL != "" {
+		progress.step("download", "downloading from %s for up to %s", endpoint.URL, duration)
+		result.Download = measureDownload(endpoint.URL, duration)
+	}
+	if endpoint.UploadURL != "" {
+		progress.step("upload", "uploading to %s for %s", endpoint.UploadURL, duration)
+		result.Upload = measureUpload(endpoint.UploadURL, duration)
+	}
+
+	failed := result.Latency.LossPercent == 100 ||
+		(result.Download != nil && result.Download.Error != "") ||
+		(result.Upload != nil && result.Upload.Error != "")
+	if *asJSON {
+		if code := printJSON(result); code != 0 {
+			return code
+		}
+	} else {
+		fmt.Println(msg("speedtest.header", result.Connection, emptyAsUnknown(result.Type), result.Endpoint))
+		fmt.Println(msg("speedtest.latency", result.Latency.AvgMS, result.Latency.MaxMS, result.Latency.LossPercent))
+		for _, phase := range []struct {
+			name string
+			tp   *Throughput
+		}{{"download", result.Download}, {"upload", result.Upload}} {
+			switch {
+			case phase.tp == nil:
+			case phase.tp.Error != "":
+				fmt.Println(msg("speedtest.failed", phase.name, phase.tp.Error))
+			default:
+				fmt.Println(msg("speedtest.throughput", phase.name, phase.tp.Mbps, float64(phase.tp.Bytes)/1e6, float64(phase.tp.DurationMS)/1000))
+			}
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func (t *Throughput) finish(bytes int64, elapsed time.Duration, err error) *Throughput {
+	t.Bytes, t.DurationMS = bytes, elapsed.Milliseconds()
+	if elapsed > 0 {
+		t.Mbps = float64(bytes) * 8 / elapsed.Seconds() / 1e6
+	}
+	if err != nil {
+		t.Error = redact(err.Error())
+	}
+	return t
+}
+
+// measureDownload reads from url until it ends or duration is up; a
+// download cut short by the deadline is the normal case.
+func measureDownload(url string, duration time.Duration) *Throughput {
+	ctx, cancel := context.WithTimeout(interrupted, duration)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return (&Throughput{}).finish(0, 0, err)
+	}
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return (&Throughput{}).finish(0, time.Since(start), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return (&Throughput{}).finish(0, time.Since(start), fmt.Errorf("unexpected status %d", resp.StatusCode))
+	}
+	n, err := io.Copy(io.Discard, resp.Body)
+	if ctx.Err() == context.DeadlineExceeded {
+		err = nil
+	}
+	return (&Throughput{}).finish(n, time.Since(start), err)
+}
+
+// measureUpload streams zeros to url for duration.
+func measureUpload(url string, duration time.Duration) *Throughput {
+	body := &timedZeros{until: time.Now().Add(duration)}
+	req, err := http.NewRequestWithContext(interrupted, http.MethodPost, url, body)
+	if err != nil {
+		return (&Throughput{}).finish(0, 0, err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	start := time.Now()
+	resp, err := (&http.Client{Timeout: duration + 30*time.Second}).Do(req)
+	elapsed := time.Since(start)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			err = fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+	}
+	return (&Throughput{}).finish(body.sent, elapsed, err)
+}
+
+// timedZeros is a request body of zeros that ends at until.
+type timedZeros struct {
+	until time.Time
+	sent  int64
+}
+
+func (z *timedZeros) Read(p []byte) (int, error) {
+	if time.Now().After(z.until) {
+		return 0, io.EOF
+	}
+	clear(p)
+	z.sent += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	splitModeFull  = "full"
+	splitModeSplit = "split"
+)
+
+type SplitEntry struct {
+	Destination string `json:"destination"`
+	Kind        string `json:"kind"`
+	Source      string `json:"source"`
+}
+
+type SplitTunnel struct {
+	Connection string       `json:"connection"`
+	Interface  string       `json:"interface"`
+	Mode       string       `json:"mode"`
+	Included   []SplitEntry `json:"included"`
+	Excluded   []SplitEntry `json:"excluded"`
+	Lookup     *SplitLookup `json:"lookup,omitempty"`
+}
+
+// SplitLookup answers "does this destination go through the VPN?".
+type SplitLookup struct {
+	Destination string `json:"destination"`
+	Address     string `json:"address"`
+	Interface   string `json:"interface"`
+	ViaTunnel   bool   `json:"via_tunnel"`
+}
+
+// tunnelRoutes lists the destinations of the routes that point at iface.
+func tunnelRoutes(family, iface string) []string {
+	out, err := exec.Command("netstat", "-rn", "-f", family).Output()
+	if err != nil {
+		return nil
+	}
+	var routes []string
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || (fields[3] != iface && fields[len(fields)-1] != iface) {
+			continue
+		}
+		destination := fields[0]
+		if strings.HasPrefix(destination, "fe80") || strings.HasPrefix(destination, "ff0") ||
+			strings.HasPrefix(destination, "224.0.0") || destination == "255.255.255.255/32" {
+			continue
+		}
+		if destination != "default" {
+			destination = expandShortCIDR(destination)
+		}
+		routes = append(routes, destination)
+	}
+	return routes
+}
+
+// bridgeSplitConfig collects the include/exclude lists from whatever the
+// bridge reports about the connection's split-tunnel configuration. Keys
+// differ between FortiClient builds, so entries are classified by the name
+// of the nearest key that holds them.
+func bridgeSplitConfig(connection string) (included, excluded []SplitEntry) {
+	raw, err := bridgeDetails("get-split-tunnel", connection)
+	if err != nil {
+		return nil, nil
+	}
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, nil
+	}
+	collectSplitValues(doc, "", func(key, value string) {
+		lower := strings.ToLower(key)
+		kind := "destination"
+		if strings.Contains(lower, "app") {
+			kind = "app"
+		} else if net.ParseIP(value) == nil && !strings.Contains(value, "/") && !strings.Contains(value, ".") {
+			return
+		}
+		entry := SplitEntry{Destination: value, Kind: kind, Source: "config"}
+		switch {
+		case strings.Contains(lower, "exclu"), strings.Contains(lower, "bypass"):
+			excluded = append(excluded, entry)
+		case strings.Contains(lower, "inclu"), strings.Contains(lower, "split"), strings.Contains(lower, "subnet"), strings.Contains(lower, "route"):
+			included = append(included, entry)
+		}
+	})
+	return included, excluded
+}
+
+func collectSplitValues(v any, key string, visit func(key, value string)) {
+	switch node := v.(type) {
+	case map[string]any:
+		for _, child := range slices.Sorted(maps.Keys(node)) {
+			name := child
+			if key != "" {
+				name = key + "." + child
+			}
+			collectSplitValues(node[child], name, visit)
+		}
+	case []any:
+		for _, item := range node {
+			collectSplitValues(item, key, visit)
+		}
+	case string:
+		for _, value := range strings.FieldsFunc(node, func(r rune) bool { return r == ',' || r == ';' || r == ' ' }) {
+			visit(key, value)
+		}
+	}
+}
+
+func lookupSplitDestination(destination, tunnelInterface string) (*SplitLookup, error) {
+	ip := net.ParseIP(destination)
+	if ip == nil {
+		ips, err := net.LookupIP(destination)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", destination, err)
+		}
+		ip = ips[0]
+	}
+	iface, err := routeInterface(ip)
+	if err != nil {
+		return nil, err
+	}
+	return &SplitLookup{Destination: destination, Address: ip.String(), Interface: iface, ViaTunnel: iface == tunnelInterface}, nil
+}
+
+func runSplitTunnel(args []string) int {
+	fs := flag.NewFlagSet("split-tunnel", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	asJSON := outputFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, msg("error", msg("split.one_destination")))
+		return 2
+	}
+
+	state, err := getTunnelState()
+	if err != nil {
+		return fail(err)
+	}
+	if !state.Connected() {
+		fmt.Fprintln(os.Stderr, msg("error", msg("split.not_connected")))
+		return 1
+	}
+	tunnel, err := detectTunnel()
+	if err != nil {
+		return fail(err)
+	}
+	if tunnel == nil {
+		return fail(fmt.Errorf("connected, but no tunnel interface was found"))
+	}
+
+	report := SplitTunnel{Connection: state.CurrentConnection(), Interface: tunnel.Interface, Mode: splitModeSplit}
+	for _, family := range []string{"inet", "inet6"} {
+		for _, route := range tunnelRoutes(family, tunnel.Interface) {
+			if route == "default" || route == "0.0.0.0/1" || route == "::/1" {
+				report.Mode = splitModeFull
+			}
+			report.Included = append(report.Included, SplitEntry{Destination: route, Kind: "destination", Source: "route"})
+		}
+	}
+	included, excluded := bridgeSplitConfig(report.Connection)
+	report.Included = append(report.Included, included...)
+	report.Excluded = append(report.Excluded, excluded...)
+	if report.Excluded == nil {
+		report.Excluded = []SplitEntry{}
+	}
+
+	if fs.NArg() == 1 {
+		if report.Lookup, err = lookupSplitDestination(fs.Arg(0), tunnel.Interface); err != nil {
+			return fail(err)
+		}
+	}
+
+	if *asJSON {
+		if code := printJSON(report); code != 0 {
+			return code
+		}
+	} else {
+		fmt.Println(msg("tunnel.interface", report.Interface))
+		fmt.Println(msg("split.mode", report.Mode))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, msg("split.header"))
+		for _, entry := range report.Included {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", "include", entry.Kind, entry.Destination, entry.Source)
+		}
+		for _, entry := range report.Excluded {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", "exclude", entry.Kind, entry.Destination, entry.Source)
+		}
+		w.Flush()
+		if report.Lookup != nil {
+			if report.Lookup.ViaTunnel {
+				fmt.Println(msg("split.via_tunnel", report.Lookup.Destination, report.Lookup.Address, report.Lookup.Interface))
+			} else {
+				fmt.Println(msg("split.outside_tunnel", report.Lookup.Destination, report.Lookup.Address, report.Lookup.Interface))
+			}
+		}
+	}
+
+	if report.Lookup != nil && !report.Lookup.ViaTunnel {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type State struct {
+	Groups   map[string]GroupState      `json:"groups,omitempty"`
+	Gateways map[string]GatewayPinState `json:"gateways,omitempty"`
+	Lock     *DisconnectLock            `json:"lock,omitempty"`
+	Session  *SessionTags               `json:"session,omitempty"`
+}
+
+type GroupState struct {
+	LastMember string           `json:"last_member,omitempty"`
+	LastUsed   map[string]int64 `json:"last_used,omitempty"`
+}
+
+func stateDir() (string, error) {
+	if xdg := strings.TrimSpace(os.Getenv("XDG_STATE_HOME")); xdg != "" {
+		return filepath.Join(xdg, "fortivpn"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "fortivpn"), nil
+}
+
+func loadState() (State, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return State{}, err
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, "state.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, fmt.Errorf("failed to read state: %w", err)
+	}
+
+	var state State
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return State{}, fmt.Errorf("failed to parse state: %w", err)
+	}
+	return state, nil
+}
+
+func saveState(state State) error {
+	dir, err := stateDir()
+	if err != nil {
+		return err
+	}
+	body, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, "state.json"), body, 0o600)
+}
+
+func writeFileAtomic(path string, body []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
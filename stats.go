@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// StatsPeriod aggregates the sessions and drops in one window of the
+// session journal. A session still up counts until now.
+type StatsPeriod struct {
+	Period                      string    `json:"period"`
+	Since                       time.Time `json:"since"`
+	ConnectedMS                 int64     `json:"connected_ms"`
+	Sessions                    int       `json:"sessions"`
+	Drops                       int       `json:"drops"`
+	Reconnects                  int       `json:"reconnects"`
+	MeanTimeBetweenReconnectsMS int64     `json:"mean_time_between_reconnects_ms,omitempty"`
+	LongestSessionMS            int64     `json:"longest_session_ms,omitempty"`
+	LongestSessionConnection    string    `json:"longest_session_connection,omitempty"`
+}
+
+// historySession is one stretch of the tunnel being up, from a connect to
+// the disconnect or drop that ended it.
+type historySession struct {
+	Connection string
+	Start, End time.Time
+}
+
+func runStats(args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	sinceArg := fs.String("since", "30d", "Window of the last column, e.g. 90d or 2024-05-01; empty for all history.")
+	connection := fs.String("connection", "", "Only connections whose name contains this.")
+	asJSON := outputFlags(fs, "csv", "tsv")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	now := time.Now()
+	since, err := parseSince(*sinceArg, now)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, msg("error", err))
+		return 2
+	}
+
+	events, err := loadHistory(time.Time{})
+	if err != nil {
+		return fail(err)
+	}
+	if *connection != "" {
+		filtered := events[:0]
+		for _, event := range events {
+			if strings.Contains(strings.ToLower(event.Connection), strings.ToLower(*connection)) {
+				filtered = append(filtered, event)
+			}
+		}
+		events = filtered
+	}
+	sessions := historySessions(events, now)
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	week := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	windowName := "since " + *sinceArg
+	if since.IsZero() {
+		windowName = "all"
+		if len(events) > 0 {
+			since = events[0].At
+		}
+	}
+	periods := []StatsPeriod{
+		statsPeriod("today", today, now, events, sessions),
+		statsPeriod("this week", week, now, events, sessions),
+		statsPeriod(windowName, since, now, events, sessions),
+	}
+
+	if *asJSON {
+		return printJSON(periods)
+	}
+	if csvOutput() {
+		return printCSV(periods)
+	}
+	rows := [][]string{
+		{""}, {"connected"}, {"sessions"}, {"drops"}, {"reconnects"}, {"mean time between reconnects"}, {"longest session"},
+	}
+	for _, period := range periods {
+		longest := "n/a"
+		if period.LongestSessionMS > 0 {
+			longest = fmt.Sprintf("%s (%s)", statsDuration(period.LongestSessionMS), period.LongestSessionConnection)
+		}
+		between := "n/a"
+		if period.MeanTimeBetweenReconnectsMS > 0 {
+			between = statsDuration(period.MeanTimeBetweenReconnectsMS)
+		}
+		rows[0] = append(rows[0], strings.ToUpper(period.Period))
+		rows[1] = append(rows[1], statsDuration(period.ConnectedMS))
+		rows[2] = append(rows[2], fmt.Sprint(period.Sessions))
+		rows[3] = append(rows[3], fmt.Sprint(period.Drops))
+		rows[4] = append(rows[4], fmt.Sprint(period.Reconnects))
+		rows[5] = append(rows[5], between)
+		rows[6] = append(rows[6], longest)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+	return 0
+}
+
+// historySessions pairs each connect with the disconnect or drop after it,
+// the way report counts uptime.
+func historySessions(events []HistoryEvent, now time.Time) []historySession {
+	var sessions []historySession
+	var current *historySession
+	for _, event := range events {
+		switch event.Event {
+		case eventConnected, eventFailover:
+			if current == nil {
+				current = &historySession{Connection: event.Connection, Start: event.At}
+			}
+		case eventDropped, eventDisconnected:
+			if current != nil {
+				current.End = event.At
+				sessions = append(sessions, *current)
+				current = nil
+			}
+		}
+	}
+	if current != nil {
+		current.End = now
+		sessions = append(sessions, *current)
+	}
+	return sessions
+}
+
+func statsPeriod(name string, since, now time.Time, events []HistoryEvent, sessions []historySession) StatsPeriod {
+	period := StatsPeriod{Period: name, Since: since}
+	var connected time.Duration
+	for _, session := range sessions {
+		if !session.End.After(since) {
+			continue
+		}
+		connected += session.End.Sub(later(session.Start, since))
+		if !session.Start.Before(since) {
+			period.Sessions++
+		}
+		if length := session.End.Sub(session.Start); length.Milliseconds() > period.LongestSessionMS {
+			period.LongestSessionMS = length.Milliseconds()
+			period.LongestSessionConnection = session.Connection
+		}
+	}
+	period.ConnectedMS = connected.Milliseconds()
+	for _, event := range events {
+		if event.At.Before(since) || event.At.After(now) {
+			continue
+		}
+		switch {
+		case event.Event == eventDropped:
+			period.Drops++
+		case event.Event == eventFailover, event.Event == eventConnected && event.Source == "watch":
+			period.Reconnects++
+		}
+	}
+	if period.Reconnects > 0 {
+		period.MeanTimeBetweenReconnectsMS = period.ConnectedMS / int64(period.Reconnects)
+	}
+	return period
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func statsDuration(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	return d.Round(time.Minute).String()
+}
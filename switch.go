@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// SwitchPhase is one half of a switch: taking the old tunnel down or
+// bringing the new one up.
+type SwitchPhase struct {
+	Connection string `json:"connection,omitempty"`
+	OK         bool   `json:"ok"`
+	Skipped    bool   `json:"skipped,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+type SwitchResult struct {
+	From       string      `json:"from"`
+	To         string      `json:"to"`
+	Disconnect SwitchPhase `json:"disconnect"`
+	Connect    SwitchPhase `json:"connect"`
+	Status     *Status     `json:"status,omitempty"`
+}
+
+// runSwitch moves from whatever is connected to NAME under one operation
+// lock, so nothing can connect in between. Unlike connect it always reports
+// both phases, and it retries the connect once when FortiClient refuses it
+// because a tunnel is still, or again, active.
+func runSwitch(args []string) int {
+	fs := flag.NewFlagSet("switch", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	asJSON := outputFlags(fs)
+	timeoutSec := fs.Float64("timeout", 30, "Wait timeout in seconds for each phase (0 waits indefinitely).")
+	intervalSec := fs.Float64("interval", 1, "Polling interval in seconds.")
+	force := fs.Bool("force", false, "Switch even while the disconnect lock is armed.")
+	yes := fs.Bool("yes", false, "Disconnect the active connection without asking.")
+	noInput := fs.Bool("no-input", false, "Never prompt; refuse to disconnect the active connection unless --yes is given.")
+	noWait := fs.Bool("no-wait", false, "Fail instead of waiting when another connect or disconnect is in progress.")
+	var name string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if name == "" && fs.NArg() > 0 {
+		name = fs.Arg(0)
+	}
+	if name == "" || fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, msg("error", msg("switch.usage")))
+		return 2
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	operationNoWait = *noWait
+	release, err := acquireOperationLock("switch " + name)
+	if err != nil {
+		return fail(err)
+	}
+	defer release()
+	if err := ensureFortiClientRunning(5 * time.Second); err != nil {
+		return fail(err)
+	}
+
+	tunnels, err := getConnections()
+	if err != nil {
+		return fail(err)
+	}
+	target, err := resolveTunnel(name, tunnels)
+	if err != nil {
+		return fail(err)
+	}
+	current, err := getTunnelState()
+	if err != nil {
+		return fail(err)
+	}
+	settings := cfg.forConnection(target.ConnectionName)
+	interval := seconds(flagOrSetting(fs, "interval", *intervalSec, settings.PollInterval))
+	result := SwitchResult{From: current.CurrentConnection(), To: target.ConnectionName}
+
+	result.Disconnect = SwitchPhase{Connection: current.CurrentConnection(), OK: true, Skipped: true}
+	if current.Connected() && !strings.EqualFold(current.CurrentConnection(), target.ConnectionName) {
+		if err := checkLock(fmt.Sprintf("switch away from %q", current.CurrentConnection()), *force); err != nil {
+			return fail(err)
+		}
+		if err := confirmDisplace(current.CurrentConnection(), target.ConnectionName, *yes, *noInput); err != nil {
+			return fail(err)
+		}
+		deadline := deadlineAfter(time.Now(), seconds(flagOrSetting(fs, "timeout", *timeoutSec, cfg.forConnection(current.CurrentConnection()).DisconnectTimeout)))
+		result.Disconnect, err = switchDisconnect(current, target, cfg, deadline, interval)
+		if err != nil {
+			result.Connect = SwitchPhase{Connection: target.ConnectionName, Skipped: true}
+			return printSwitchResult(result, *asJSON, err)
+		}
+	}
+
+	start := time.Now()
+	result.Connect = SwitchPhase{Connection: target.ConnectionName}
+	deadline := deadlineAfter(start, seconds(flagOrSetting(fs, "timeout", *timeoutSec, settings.ConnectTimeout)))
+	alreadyUp := current.Connected() && strings.EqualFold(current.CurrentConnection(), target.ConnectionName)
+	before := TunnelState{}
+	if alreadyUp {
+		before = current
+	}
+	final, err := connectTunnel(target, before, cfg, deadline, interval)
+	if err != nil {
+		// FortiClient refuses a connect while it still considers a tunnel
+		// up, and may bring the old one back on its own; take that down
+		// and try once more.
+		if state, stateErr := freshTunnelState(); stateErr == nil && state.Connected() && !strings.EqualFold(state.CurrentConnection(), target.ConnectionName) {
+			progress.step("retry", "%q is active again; disconnecting it and retrying %q", state.CurrentConnection(), target.ConnectionName)
+			final, err = connectTunnel(target, state, cfg, deadlineAfter(time.Now(), seconds(flagOrSetting(fs, "timeout", *timeoutSec, settings.ConnectTimeout))), interval)
+		}
+	}
+	result.Connect.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		err = withUpgradeReason(err, cfg.Upgrade.Markers)
+		recordEvent(HistoryEvent{Event: eventConnectFailed, Connection: target.ConnectionName, Source: "switch", Reason: err.Error()})
+		result.Connect.Error = redact(err.Error())
+		return printSwitchResult(result, *asJSON, err)
+	}
+	result.Connect.OK = true
+	if alreadyUp {
+		result.Connect.Skipped = true
+	} else {
+		startSession(target.ConnectionName, nil)
+		recordEvent(HistoryEvent{Event: eventConnected, Connection: target.ConnectionName, Source: "switch", DurationMS: result.Connect.DurationMS})
+	}
+	status := buildStatus(final, target.ConnectionName)
+	result.Status = &status
+	return printSwitchResult(result, *asJSON, nil)
+}
+
+// switchDisconnect is the first phase of a switch: current goes down and
+// stays down until the deadline says otherwise.
+func switchDisconnect(current TunnelState, target Tunnel, cfg Config, deadline time.Time, interval time.Duration) (SwitchPhase, error) {
+	start := time.Now()
+	phase := SwitchPhase{Connection: current.CurrentConnection()}
+	progress.step("disconnect", "disconnecting %q before switching to %q", current.CurrentConnection(), target.ConnectionName)
+	err := disconnectTunnel(current)
+	if err == nil {
+		var after TunnelState
+		if after, err = waitForTunnelState("", false, deadline, interval); err == nil && after.Connected() {
+			err = errors.New("still connected")
+		}
+	}
+	phase.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		err = fmt.Errorf("failed to disconnect %q before switching to %q: %w", current.CurrentConnection(), target.ConnectionName, err)
+		phase.Error = redact(err.Error())
+		return phase, err
+	}
+	phase.OK = true
+	recordEvent(HistoryEvent{Event: eventDisconnected, Connection: current.CurrentConnection(), Source: "switch", Reason: "switched to " + target.ConnectionName})
+	runHooks("post_disconnect", current.CurrentConnection(), cfg.forConnection(current.CurrentConnection()).Hooks.PostDisconnect)
+	return phase, nil
+}
+
+func printSwitchResult(result SwitchResult, asJSON bool, err error) int {
+	if asJSON {
+		if code := printJSON(result); code != 0 {
+			return code
+		}
+	} else {
+		for _, phase := range []struct {
+			name  string
+			phase SwitchPhase
+		}{{"disconnect", result.Disconnect}, {"connect", result.Connect}} {
+			switch {
+			case phase.phase.Skipped && phase.phase.OK:
+				fmt.Println(msg("switch.phase_skipped", phase.name, emptyAsUnknown(phase.phase.Connection)))
+			case phase.phase.OK:
+				fmt.Println(msg("switch.phase_ok", phase.name, phase.phase.Connection, phase.phase.DurationMS))
+			case phase.phase.Error != "":
+				fmt.Println(msg("switch.phase_failed", phase.name, phase.phase.Connection, phase.phase.DurationMS))
+			}
+		}
+		if result.Status != nil {
+			fmt.Println(msg("status.state", result.Status.State))
+			fmt.Println(msg("status.current", emptyAsUnknown(result.Status.CurrentConnection)))
+		}
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return 0
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// tableMinWidth is as narrow as printTable cuts a column.
+const tableMinWidth = 8
+
+// printTable writes rows in aligned columns under header, which is split on
+// tabs like the *.header messages. When stdout is a terminal narrower than
+// the table, the columns listed in shrink are cut down, widest first, and
+// end in "…"; piped output is never cut.
+func printTable(header string, rows [][]string, showHeader bool, shrink ...int) {
+	if showHeader {
+		rows = append([][]string{strings.Split(header, "\t")}, rows...)
+	}
+	if width := terminalWidth(); width > 0 {
+		fitTable(rows, width, shrink)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
+
+// fitTable truncates cells in place until the rows fit in width columns,
+// counting the two spaces between columns.
+func fitTable(rows [][]string, width int, shrink []int) {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	total := 2 * (len(widths) - 1)
+	for _, w := range widths {
+		total += w
+	}
+	for total > width {
+		widest := -1
+		for _, i := range shrink {
+			if i < len(widths) && widths[i] > tableMinWidth && (widest < 0 || widths[i] > widths[widest]) {
+				widest = i
+			}
+		}
+		if widest < 0 {
+			break
+		}
+		cut := min(total-width, widths[widest]-tableMinWidth)
+		widths[widest] -= cut
+		total -= cut
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			if utf8.RuneCountInString(cell) > widths[i] {
+				row[i] = string([]rune(cell)[:widths[i]-1]) + "…"
+			}
+		}
+	}
+}
+
+// terminalWidth returns the width of the terminal stdout is, or 0 when it
+// is not one or the width is unknown. $COLUMNS wins over asking stty.
+func terminalWidth() int {
+	info, err := os.Stdout.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return 0
+	}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stdout
+	out, err := cmd.Output()
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return 0
+	}
+	columns, _ := strconv.Atoi(fields[1])
+	return columns
+}
@@ -0,0 +1,32 @@
+package main
+
+import "time"
+
+// Timings breaks down where a command spent its time. bridge_ms counts
+// every bridge call, including the state polls made while waiting, so it
+// overlaps wait_ms.
+type Timings struct {
+	BridgeMS int64 `json:"bridge_ms"`
+	WaitMS   int64 `json:"wait_ms"`
+	VerifyMS int64 `json:"verify_ms"`
+	TotalMS  int64 `json:"total_ms"`
+}
+
+// timing accumulates the phases of the current command from process start.
+var timing = struct {
+	start                time.Time
+	bridge, wait, verify time.Duration
+}{start: time.Now()}
+
+func timeBridge(since time.Time) { timing.bridge += time.Since(since) }
+func timeWait(since time.Time)   { timing.wait += time.Since(since) }
+func timeVerify(since time.Time) { timing.verify += time.Since(since) }
+
+func currentTimings() *Timings {
+	return &Timings{
+		BridgeMS: timing.bridge.Milliseconds(),
+		WaitMS:   timing.wait.Milliseconds(),
+		VerifyMS: timing.verify.Milliseconds(),
+		TotalMS:  time.Since(timing.start).Milliseconds(),
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const tuiRecentEvents = 8
+
+// tuiSnapshot is one poll of the tunnel and the history.
+type tuiSnapshot struct {
+	Status Status
+	Err    error
+	Events []HistoryEvent
+	Uptime time.Duration
+}
+
+// tuiResult is the outcome of a connect, disconnect or reconnect run as a
+// child fortivpn, so its output does not scribble over the screen.
+type tuiResult struct {
+	Action string
+	Code   int
+	Output string
+}
+
+type tuiModel struct {
+	tunnels  []Tunnel
+	cursor   int
+	snapshot tuiSnapshot
+	polled   bool
+	busy     string
+	message  string
+	auto     string
+}
+
+func runTUI(args []string) int {
+	fs := flag.NewFlagSet("tui", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	intervalSec := fs.Float64("interval", 2, "Polling interval in seconds.")
+	auto := fs.Bool("auto", false, "Start with auto-reconnect on for the selected connection.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if !stdinIsTerminal() {
+		fmt.Fprintln(os.Stderr, msg("error", msg("tui.needs_terminal")))
+		return 2
+	}
+	interval := seconds(*intervalSec)
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	tunnels, err := getConnections()
+	if err != nil {
+		return fail(err)
+	}
+	model := &tuiModel{tunnels: tunnels}
+	if selection, err := resolveSelection("", tunnels, cfg); err == nil {
+		model.selectConnection(selection.Primary().ConnectionName)
+	}
+	if *auto {
+		model.auto = model.selected()
+	}
+
+	restore, err := enterTUIMode()
+	if err != nil {
+		return fail(err)
+	}
+	defer restore()
+	signalCleanup.Store(&restore)
+	defer signalCleanup.Store(nil)
+
+	keys := make(chan string)
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			for _, key := range splitKeys(buf[:n]) {
+				keys <- key
+			}
+		}
+	}()
+	polls := make(chan tuiSnapshot, 1)
+	results := make(chan tuiResult, 1)
+	polling := false
+	poll := func() {
+		if !polling {
+			polling = true
+			go func() { polls <- tuiPoll() }()
+		}
+	}
+	start := func(action string, args ...string) {
+		if model.busy != "" {
+			model.message = msg("tui.busy", model.busy)
+			return
+		}
+		model.busy, model.message = action, ""
+		go func() { results <- tuiRun(action, args...) }()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	poll()
+	for {
+		model.render()
+		select {
+		case <-ticker.C:
+			poll()
+		case snapshot := <-polls:
+			polling = false
+			model.snapshot, model.polled = snapshot, true
+			if model.auto != "" && model.busy == "" && snapshot.Err == nil && !snapshot.Status.Connected {
+				start("reconnect "+model.auto, "watch", "--once", "--connection", model.auto)
+			}
+		case result := <-results:
+			model.busy = ""
+			if result.Code == 0 {
+				model.message = msg("tui.done", result.Action)
+			} else {
+				model.message = msg("tui.failed", result.Action, result.Code, result.Output)
+			}
+			poll()
+		case key, ok := <-keys:
+			if !ok {
+				return 0
+			}
+			switch key {
+			case "q", "\x03", "\x04":
+				return 0
+			case "k", "\x1b[A", "\x1bOA":
+				model.cursor = max(model.cursor-1, 0)
+			case "j", "\x1b[B", "\x1bOB":
+				model.cursor = min(model.cursor+1, len(model.tunnels)-1)
+			case "\r", "\n", "c":
+				if name := model.selected(); name != "" {
+					start("connect "+name, "connect", "--connection", name, "--yes")
+				}
+			case "d":
+				// Auto-reconnect would undo the disconnect right away.
+				model.auto = ""
+				start("disconnect", "disconnect")
+			case "a":
+				if model.auto != "" {
+					model.auto = ""
+				} else {
+					model.auto = model.selected()
+				}
+				poll()
+			case "r":
+				if tunnels, err := getConnections(); err == nil {
+					current := model.selected()
+					model.tunnels = tunnels
+					model.selectConnection(current)
+				}
+				poll()
+			}
+		}
+	}
+}
+
+// enterTUIMode switches the terminal to unbuffered input without echo or
+// signal keys (Ctrl-C is read as a key, so the terminal is always restored)
+// and to the alternate screen. The returned func undoes both.
+func enterTUIMode() (func(), error) {
+	stty := func(args ...string) ([]byte, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = os.Stdin
+		return cmd.Output()
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read terminal settings: %w", err)
+	}
+	if _, err := stty("-icanon", "-echo", "-isig", "min", "1", "time", "0"); err != nil {
+		return nil, fmt.Errorf("failed to set terminal mode: %w", err)
+	}
+	fmt.Print("\033[?1049h\033[?25l")
+	return func() {
+		fmt.Print("\033[?25h\033[?1049l")
+		_, _ = stty(strings.TrimSpace(string(saved)))
+	}, nil
+}
+
+// splitKeys separates what one read returned into keys; arrow keys arrive
+// as three-byte escape sequences.
+func splitKeys(input []byte) []string {
+	var keys []string
+	for len(input) > 0 {
+		n := 1
+		if input[0] == 0x1b && len(input) >= 3 && (input[1] == '[' || input[1] == 'O') {
+			n = 3
+		}
+		keys = append(keys, string(input[:n]))
+		input = input[n:]
+	}
+	return keys
+}
+
+func tuiPoll() tuiSnapshot {
+	var snapshot tuiSnapshot
+	state, err := freshTunnelState()
+	if err != nil {
+		snapshot.Err = err
+	} else {
+		snapshot.Status = buildStatus(state, "")
+		if snapshot.Status.Connected {
+			snapshot.Status.Tunnel, _ = detectTunnel()
+		}
+	}
+	now := time.Now()
+	events, _ := loadHistory(now.AddDate(0, 0, -30))
+	if sessions := historySessions(events, now); len(sessions) > 0 {
+		last := sessions[len(sessions)-1]
+		if snapshot.Status.Connected && last.End.Equal(now) && strings.EqualFold(last.Connection, snapshot.Status.CurrentConnection) {
+			snapshot.Uptime = now.Sub(last.Start)
+		}
+	}
+	if len(events) > tuiRecentEvents {
+		events = events[len(events)-tuiRecentEvents:]
+	}
+	snapshot.Events = events
+	return snapshot
+}
+
+func tuiRun(action string, args ...string) tuiResult {
+	self, err := os.Executable()
+	if err != nil {
+		return tuiResult{Action: action, Code: exitCodeFor(err), Output: err.Error()}
+	}
+	out, err := exec.Command(self, args...).CombinedOutput()
+	result := tuiResult{Action: action}
+	if err != nil {
+		result.Code = 3
+		if exit, ok := err.(*exec.ExitError); ok {
+			result.Code = exit.ExitCode()
+		}
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		result.Output = strings.TrimPrefix(lines[len(lines)-1], "error: ")
+	}
+	return result
+}
+
+func (m *tuiModel) selected() string {
+	if m.cursor < 0 || m.cursor >= len(m.tunnels) {
+		return ""
+	}
+	return m.tunnels[m.cursor].ConnectionName
+}
+
+func (m *tuiModel) selectConnection(name string) {
+	for i, tunnel := range m.tunnels {
+		if strings.EqualFold(tunnel.ConnectionName, name) {
+			m.cursor = i
+			return
+		}
+	}
+	m.cursor = min(m.cursor, max(len(m.tunnels)-1, 0))
+}
+
+func (m *tuiModel) render() {
+	var out bytes.Buffer
+	out.WriteString("\033[H\033[2J")
+	fmt.Fprintf(&out, "fortivpn  %s\n\n", time.Now().Format("15:04:05"))
+
+	status := m.snapshot.Status
+	switch {
+	case !m.polled:
+		fmt.Fprintln(&out, msg("status.state", "..."))
+	case m.snapshot.Err != nil:
+		fmt.Fprintln(&out, msg("error", redact(m.snapshot.Err.Error())))
+	default:
+		fmt.Fprintln(&out, msg("status.state", status.State))
+		fmt.Fprintln(&out, msg("status.current", emptyAsUnknown(status.CurrentConnection)))
+		if m.snapshot.Uptime > 0 {
+			fmt.Fprintln(&out, msg("tui.uptime", historyDuration(m.snapshot.Uptime.Milliseconds())))
+		}
+		if status.Tunnel != nil {
+			fmt.Fprintln(&out, msg("tui.tunnel", status.Tunnel.Interface, strings.Join(append(status.Tunnel.IPv4, status.Tunnel.IPv6...), " ")))
+		}
+	}
+	fmt.Fprintln(&out, msg("tui.auto", firstNonEmpty(m.auto, "off")))
+
+	fmt.Fprintf(&out, "\n%s\n", msg("tui.connections"))
+	for i, tunnel := range m.tunnels {
+		marker, active := "  ", ""
+		if i == m.cursor {
+			marker = "> "
+		}
+		if status.Connected && strings.EqualFold(status.CurrentConnection, tunnel.ConnectionName) {
+			active = "  " + msg("tui.active")
+		}
+		fmt.Fprintf(&out, "%s%s%s\n", marker, tunnel.ConnectionName, active)
+	}
+
+	fmt.Fprintf(&out, "\n%s\n", msg("tui.events"))
+	if len(m.snapshot.Events) == 0 {
+		fmt.Fprintln(&out, "  "+msg("history.none"))
+	}
+	w := tabwriter.NewWriter(&out, 0, 0, 2, ' ', 0)
+	for _, event := range m.snapshot.Events {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", event.At.Local().Format("01-02 15:04:05"), event.Event, emptyAsUnknown(event.Connection), firstNonEmpty(event.Reason, event.Note, event.Source))
+	}
+	w.Flush()
+
+	fmt.Fprintln(&out)
+	if m.busy != "" {
+		fmt.Fprintln(&out, msg("tui.busy", m.busy))
+	} else if m.message != "" {
+		fmt.Fprintln(&out, redact(m.message))
+	}
+	fmt.Fprintln(&out, msg("tui.keys"))
+	os.Stdout.Write(out.Bytes())
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const fortiClientInfoPlist = "/Applications/FortiClient.app/Contents/Info.plist"
+
+var errUpgradePending = errors.New("FortiClient has a pending upgrade and must be restarted")
+
+// Texts FortiClient shows when an EMS-pushed upgrade is waiting for a
+// restart and new tunnels are refused. A bare "upgrade" would also match
+// fortivpn's own advice to upgrade itself.
+var upgradeErrorPatterns = []string{
+	"upgrade pending",
+	"pending upgrade",
+	"new version",
+	"restart forticlient",
+	"please restart",
+}
+
+// minRestartGap keeps watch from restarting the app in a loop when the
+// upgrade does not clear.
+const minRestartGap = 10 * time.Minute
+
+// appRestartGrace is how long watch waits for FortiClient to come back on
+// its own (EMS restarts, upgrades) before launching it.
+const appRestartGrace = 30 * time.Second
+
+type UpgradeConfig struct {
+	Markers    []string `json:"markers,omitempty"`
+	RestartApp bool     `json:"restart_app,omitempty"`
+}
+
+type upgradePendingError struct {
+	err    error
+	Reason string
+}
+
+func (e *upgradePendingError) Error() string {
+	return fmt.Sprintf("%v (%s): %v", errUpgradePending, e.Reason, e.err)
+}
+
+func (e *upgradePendingError) Unwrap() []error {
+	return []error{errUpgradePending, e.err}
+}
+
+// pendingUpgrade reports why FortiClient looks like it is waiting for a
+// restart after an upgrade: the app bundle changed after the running app
+// started, a configured marker file exists, or FortiClient's own text in
+// cause carries one of the characteristic messages.
+func pendingUpgrade(cause error, markers []string) (string, bool) {
+	if text := fortiClientMessage(cause); text != "" {
+		text = strings.ToLower(text)
+		for _, pattern := range upgradeErrorPatterns {
+			if strings.Contains(text, pattern) {
+				return fmt.Sprintf("FortiClient reported %q", pattern), true
+			}
+		}
+	}
+	for _, marker := range markers {
+		if _, err := os.Stat(marker); err == nil {
+			return "upgrade marker " + marker + " exists", true
+		}
+	}
+	started, err := fortiClientStartTime()
+	if err != nil {
+		return "", false
+	}
+	info, err := os.Stat(fortiClientInfoPlist)
+	if err != nil || !info.ModTime().After(started) {
+		return "", false
+	}
+	return fmt.Sprintf("FortiClient.app %s was installed at %s, after the running app started at %s",
+		firstNonEmpty(installedFortiClientVersion(), "(unknown version)"), info.ModTime().Format("2006-01-02 15:04"), started.Format("2006-01-02 15:04")), true
+}
+
+// fortiClientMessage returns the text FortiClient itself put in err, through
+// the bridge or an error dialog, and "" for errors fortivpn made up.
+func fortiClientMessage(err error) string {
+	var fromBridge *bridgeError
+	if errors.As(err, &fromBridge) {
+		return fromBridge.Message
+	}
+	var fromDialog *dialogError
+	if errors.As(err, &fromDialog) {
+		return fromDialog.Message
+	}
+	return ""
+}
+
+// withUpgradeReason marks a failed operation as caused by a pending upgrade
+// when one is detected, so it gets its own error and exit code.
+func withUpgradeReason(err error, markers []string) error {
+	if err == nil || errors.Is(err, errUpgradePending) {
+		return err
+	}
+	if reason, pending := pendingUpgrade(err, markers); pending {
+		return &upgradePendingError{err: err, Reason: reason}
+	}
+	return err
+}
+
+func fortiClientStartTime() (time.Time, error) {
+	out, err := exec.Command("pgrep", "-x", "FortiClient").Output()
+	if err != nil {
+		return time.Time{}, err
+	}
+	pid := strings.Fields(string(out))
+	if len(pid) == 0 {
+		return time.Time{}, errors.New("FortiClient is not running")
+	}
+	out, err = exec.Command("ps", "-o", "lstart=", "-p", pid[0]).Output()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.ParseInLocation("Mon Jan 2 15:04:05 2006", strings.Join(strings.Fields(string(out)), " "), time.Local)
+}
+
+func installedFortiClientVersion() string {
+	out, err := exec.Command("defaults", "read", strings.TrimSuffix(fortiClientInfoPlist, ".plist"), "CFBundleShortVersionString").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// restartFortiClient quits the app and starts it again, waiting up to wait
+// for it to come back.
+func restartFortiClient(wait time.Duration) error {
+	deadline := time.Now().Add(wait)
+	if err := quitFortiClient(wait, false); err != nil && !errors.Is(err, errTimedOut) {
+		return err
+	}
+	return ensureFortiClientRunning(time.Until(deadline))
+}
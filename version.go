@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Release builds set these with
+// -ldflags "-X main.version=1.2.3 -X main.commit=abc123 -X main.buildDate=2026-01-02T03:04:05Z".
+// Otherwise they are filled in from the module and VCS information Go
+// embeds, so a plain `go build` in a checkout still says where it came from.
+var (
+	version   = ""
+	commit    = ""
+	buildDate = ""
+)
+
+type VersionInfo struct {
+	Version        string `json:"version"`
+	Commit         string `json:"commit"`
+	BuildDate      string `json:"build_date"`
+	Modified       bool   `json:"modified,omitempty"`
+	GoVersion      string `json:"go_version"`
+	Platform       string `json:"platform"`
+	Backend        string `json:"backend"`
+	BridgeProtocol int    `json:"bridge_protocol,omitempty"`
+	BridgeError    string `json:"bridge_error,omitempty"`
+	Protocols      string `json:"supported_bridge_protocols"`
+}
+
+func buildMetadata() VersionInfo {
+	info := VersionInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Protocols: fmt.Sprintf("%d-%d", bridgeProtocolMin, bridgeProtocolMax),
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && build.Main.Version != "(devel)" {
+			info.Version = build.Main.Version
+		}
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit = firstNonEmpty(info.Commit, setting.Value)
+			case "vcs.time":
+				info.BuildDate = firstNonEmpty(info.BuildDate, setting.Value)
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	info.Version = firstNonEmpty(strings.TrimPrefix(info.Version, "v"), "dev")
+	info.Commit = firstNonEmpty(info.Commit, "unknown")
+	info.BuildDate = firstNonEmpty(info.BuildDate, "unknown")
+	return info
+}
+
+func buildVersion() string {
+	info := buildMetadata()
+	if info.Modified {
+		return info.Version + " " + info.Commit + "-dirty"
+	}
+	return info.Version + " " + info.Commit
+}
+
+func runVersion(args []string) int {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	asJSON := outputFlags(fs)
+	noBridge := fs.Bool("no-bridge", false, "Do not ask the bridge for its protocol version.")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	info := buildMetadata()
+	backend := activeBackend()
+	info.Backend = backendName(backend)
+	if _, ok := backend.(bridgeBackend); ok && !*noBridge {
+		if bridge, err := bridgeVersion(); err != nil {
+			info.BridgeError = redact(err.Error())
+		} else {
+			info.BridgeProtocol = bridge.Protocol
+		}
+	}
+	if *asJSON {
+		return printJSON(info)
+	}
+	commitText := info.Commit
+	if info.Modified {
+		commitText += " (modified)"
+	}
+	fmt.Println(msg("version.version", info.Version))
+	fmt.Println(msg("version.commit", commitText))
+	fmt.Println(msg("version.date", info.BuildDate))
+	fmt.Println(msg("version.go", info.GoVersion, info.Platform))
+	fmt.Println(msg("version.backend", info.Backend))
+	switch {
+	case info.BridgeError != "":
+		fmt.Println(msg("version.bridge_error", info.BridgeError, info.Protocols))
+	case info.BridgeProtocol > 0:
+		fmt.Println(msg("version.bridge", info.BridgeProtocol, info.Protocols))
+	}
+	return 0
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// WatchEvent is one line of `watch --json`. Log shippers depend on these
+// names: fields may be added, but not renamed or removed.
+type WatchEvent struct {
+	Time         time.Time           `json:"time"`
+	Type         string              `json:"type"`
+	Connection   string              `json:"connection,omitempty"`
+	Group        string              `json:"group,omitempty"`
+	State        string              `json:"state,omitempty"`
+	Result       string              `json:"result,omitempty"`
+	Action       string              `json:"action,omitempty"`
+	Failures     int                 `json:"failures,omitempty"`
+	Error        string              `json:"error,omitempty"`
+	Message      string              `json:"message"`
+	Checks       []CheckResult       `json:"checks,omitempty"`
+	Expectations []ExpectationResult `json:"expectations,omitempty"`
+}
+
+// watchJSON makes watch write WatchEvents instead of log lines.
+var watchJSON bool
+
+// watchLog reports one thing watch saw or did: a timestamped line, or with
+// --json the event on one line with the same text as its message.
+func watchLog(event WatchEvent, format string, args ...any) {
+	if !watchJSON {
+		logf(format, args...)
+		return
+	}
+	event.Time = time.Now()
+	event.Message = redact(fmt.Sprintf(format, args...))
+	event.Error = redact(event.Error)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(event); err != nil {
+		logf(format, args...)
+	}
+}
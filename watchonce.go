@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// watchOnce is a single pass of the watch loop for cron and launchd: check
+// the tunnel, reconnect it when it is down and exit. What the long-running
+// loop keeps in memory (the connection it last saw, consecutive failures,
+// when it failed over) is read back from the history journal instead, so
+// successive runs log drops, fail over and fail back like watch does. The
+// latency monitor needs a sustained window and is not run.
+//
+// Exit code: 0 when the tunnel is up at the end, 1 when it is up but a
+// check (--verify) or expectation failed, otherwise the code of the last
+// failed reconnect.
+func watchOnce(selection Selection, cfg Config, settings Settings, backup Tunnel, timeout, interval time.Duration, verify, strict bool) int {
+	state, err := getTunnelState()
+	if err != nil && !fortiClientRunning() {
+		watchLog(WatchEvent{Type: "app_starting"}, "FortiClient is not running; starting it")
+		if err := ensureFortiClientRunning(max(timeout, 30*time.Second)); err != nil {
+			return fail(err)
+		}
+		state, err = getTunnelState()
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	status := selection.Status(state)
+	watchLog(WatchEvent{Type: "state", State: status.State, Connection: status.CurrentConnection}, "state=%s connection=%s", status.State, emptyAsUnknown(status.CurrentConnection))
+	watched := selection.Names()
+	if backup.ConnectionName != "" {
+		watched = append(watched, backup.ConnectionName)
+	}
+	events, _ := loadHistory(time.Time{})
+	last, sessionOpen := lastWatchedSession(events, watched)
+	if sessionOpen && !(state.Connected() && strings.EqualFold(state.CurrentConnection(), last.Connection)) {
+		watchLog(WatchEvent{Type: "dropped", Connection: last.Connection}, "%q dropped since the last run", last.Connection)
+		recordEvent(HistoryEvent{Event: eventDropped, Connection: last.Connection, Source: "watch", Reason: "tunnel lost"})
+		runHooks("post_disconnect", last.Connection, cfg.forConnection(last.Connection).Hooks.PostDisconnect)
+	}
+
+	if active, ok := selection.ActiveMember(state); ok {
+		return watchOnceHealthy(active.ConnectionName, cfg.forConnection(active.ConnectionName), verify)
+	}
+	if backup.ConnectionName != "" && state.Connected() && strings.EqualFold(state.CurrentConnection(), backup.ConnectionName) {
+		if sessionOpen && last.Event == eventFailover && time.Since(last.At) < settings.Fallback.failbackInterval() {
+			watchLog(WatchEvent{Type: "on_backup", Connection: backup.ConnectionName}, "on backup %q; failback due in %s", backup.ConnectionName, (settings.Fallback.failbackInterval() - time.Since(last.At)).Round(time.Second))
+			return watchOnceHealthy(backup.ConnectionName, cfg.forConnection(backup.ConnectionName), verify)
+		}
+		watchLog(WatchEvent{Type: "failback", Connection: backup.ConnectionName}, "failback: disconnecting backup %q to retry %s", backup.ConnectionName, selection.Label())
+		recordEvent(HistoryEvent{Event: eventDisconnected, Connection: backup.ConnectionName, Source: "watch", Reason: "failback to " + selection.Label()})
+		if err := disconnectTunnel(state); err != nil {
+			watchLog(WatchEvent{Type: "failback_failed", Connection: backup.ConnectionName, Error: err.Error()}, "failback failed: %v", err)
+			return fail(err)
+		}
+		if _, err := waitForTunnelState("", false, deadlineAfter(time.Now(), timeout), interval); err != nil {
+			watchLog(WatchEvent{Type: "failback_failed", Connection: backup.ConnectionName, Error: err.Error()}, "failback failed: %v", err)
+		}
+	}
+
+	var lastErr error
+	for _, member := range selection.AttemptOrder() {
+		memberSettings := cfg.forConnection(member.ConnectionName)
+		if err := checkGatewayPin(memberSettings); err != nil {
+			if pinRefuses(err, memberSettings, strict) {
+				watchLog(WatchEvent{Type: "pin_refused", Connection: member.ConnectionName, Error: err.Error()}, "refusing to connect %q: %v", member.ConnectionName, err)
+				lastErr = err
+				continue
+			}
+			watchLog(WatchEvent{Type: "pin_mismatch", Connection: member.ConnectionName, Error: err.Error()}, "warning: %v", err)
+		}
+		watchLog(WatchEvent{Type: "reconnect_attempt", Connection: member.ConnectionName}, "reconnecting to %q...", member.ConnectionName)
+		attemptStart := time.Now()
+		outcome, err := startConnect(member, deadlineAfter(attemptStart, timeout), interval)
+		if err != nil {
+			watchLog(WatchEvent{Type: "reconnect_failed", Connection: member.ConnectionName, Error: err.Error()}, "reconnect failed: %v", err)
+			recordEvent(HistoryEvent{Event: eventConnectFailed, Connection: member.ConnectionName, Source: "watch", Reason: err.Error()})
+			lastErr = err
+			if dismissTransientDialog(err, cfg.Dialogs) {
+				watchLog(WatchEvent{Type: "dialog_dismissed", Connection: member.ConnectionName}, "dismissed FortiClient error dialog before the next attempt")
+			}
+			if reason, pending := pendingUpgrade(err, cfg.Upgrade.Markers); pending {
+				watchLog(WatchEvent{Type: "upgrade_pending", Error: reason}, "FortiClient upgrade pending: %s", reason)
+				started, startErr := fortiClientStartTime()
+				if cfg.Upgrade.RestartApp && (startErr != nil || time.Since(started) >= minRestartGap) {
+					watchLog(WatchEvent{Type: "app_restarting"}, "restarting FortiClient to apply the upgrade")
+					if err := restartFortiClient(max(timeout, 30*time.Second)); err != nil {
+						watchLog(WatchEvent{Type: "app_restart_failed", Error: err.Error()}, "restart failed: %v", err)
+					}
+				}
+				break
+			}
+			continue
+		}
+		watchLog(WatchEvent{Type: "reconnect_result", Connection: outcome.CurrentConnection(), Result: connectedLabel(outcome.Connected())}, "reconnect result=%s connection=%s", connectedLabel(outcome.Connected()), emptyAsUnknown(outcome.CurrentConnection()))
+		recordEvent(HistoryEvent{Event: eventConnected, Connection: member.ConnectionName, Source: "watch", DurationMS: time.Since(attemptStart).Milliseconds()})
+		runHooks("post_connect", member.ConnectionName, memberSettings.Hooks.PostConnect)
+		selection.RecordUse(member)
+		return watchOnceHealthy(member.ConnectionName, memberSettings, verify)
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no connection could be attempted")
+	}
+
+	if settings.Fallback != nil {
+		events, _ = loadHistory(time.Time{})
+		if failures := consecutiveWatchFailures(events, selection.Names()); failures >= settings.Fallback.after() {
+			watchLog(WatchEvent{Type: "failover", Connection: backup.ConnectionName, Failures: failures}, "failover: %d consecutive reconnects of %s failed; connecting backup %q", failures, selection.Label(), backup.ConnectionName)
+			attemptStart := time.Now()
+			if _, err := startConnect(backup, deadlineAfter(attemptStart, timeout), interval); err != nil {
+				watchLog(WatchEvent{Type: "failover_failed", Connection: backup.ConnectionName, Error: err.Error()}, "failover failed: %v", err)
+				recordEvent(HistoryEvent{Event: eventConnectFailed, Connection: backup.ConnectionName, Source: "watch", Reason: err.Error()})
+				return fail(err)
+			}
+			recordEvent(HistoryEvent{Event: eventFailover, Connection: backup.ConnectionName, Source: "watch", DurationMS: time.Since(attemptStart).Milliseconds(),
+				Reason: fmt.Sprintf("%d consecutive reconnect failures of %s", failures, selection.Label())})
+			runHooks("post_connect", backup.ConnectionName, cfg.forConnection(backup.ConnectionName).Hooks.PostConnect)
+			return watchOnceHealthy(backup.ConnectionName, cfg.forConnection(backup.ConnectionName), verify)
+		}
+	}
+	return fail(lastErr)
+}
+
+// watchOnceHealthy evaluates expectations and, with --verify, the checks
+// of the connection that is up.
+func watchOnceHealthy(connection string, settings Settings, verify bool) int {
+	code := 0
+	if len(settings.Expectations) > 0 {
+		results := evaluateExpectations(settings.Expectations)
+		watchLog(WatchEvent{Type: "expectations", Connection: connection, Result: expectationsLabel(results), Expectations: results}, "expectations=%s", expectationsLabel(results))
+		reportExpectationViolations(results)
+		if expectationsFailed(results) {
+			code = 1
+		}
+	}
+	checks, err := verifyChecks(verify, settings)
+	if err != nil {
+		watchLog(WatchEvent{Type: "checks", Connection: connection, Result: "error", Error: err.Error()}, "checks=error: %v", err)
+		code = 1
+	}
+	if len(checks) > 0 {
+		results := runChecks(checks)
+		watchLog(WatchEvent{Type: "checks", Connection: connection, Result: checksLabel(results), Checks: results}, "checks=%s", checksLabel(results))
+		if !checksPassed(results) {
+			if !watchJSON {
+				printCheckResults(results)
+			}
+			code = 1
+		}
+	}
+	return code
+}
+
+// lastWatchedSession returns the latest tunnel event of the watched
+// connections and whether it left a session open.
+func lastWatchedSession(events []HistoryEvent, names []string) (HistoryEvent, bool) {
+	for i := len(events) - 1; i >= 0; i-- {
+		event := events[i]
+		if !containsFold(names, event.Connection) {
+			continue
+		}
+		switch event.Event {
+		case eventConnected, eventFailover:
+			return event, true
+		case eventDisconnected, eventDropped:
+			return event, false
+		}
+	}
+	return HistoryEvent{}, false
+}
+
+// consecutiveWatchFailures counts the runs whose reconnects all failed
+// since one of the watched connections last came up. Every run tries each
+// member once, so that is the most failures of any one member.
+func consecutiveWatchFailures(events []HistoryEvent, names []string) int {
+	failures := map[string]int{}
+	most := 0
+	for i := len(events) - 1; i >= 0; i-- {
+		event := events[i]
+		if !containsFold(names, event.Connection) {
+			continue
+		}
+		if event.Event == eventConnected {
+			break
+		}
+		if event.Event == eventConnectFailed && event.Source == "watch" {
+			key := strings.ToLower(event.Connection)
+			failures[key]++
+			most = max(most, failures[key])
+		}
+	}
+	return most
+}
+
+func containsFold(values []string, value string) bool {
+	return slices.ContainsFunc(values, func(v string) bool { return strings.EqualFold(v, value) })
+}
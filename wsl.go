@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const wslProxyEnv = "FORTIVPN_WSL_PROXY"
+
+var configuredWindowsBinary string
+
+func runningInWSL() bool {
+	if strings.TrimSpace(os.Getenv("WSL_DISTRO_NAME")) != "" {
+		return true
+	}
+	if _, err := os.Stat("/proc/sys/fs/binfmt_misc/WSLInterop"); err == nil {
+		return true
+	}
+	raw, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	return err == nil && strings.Contains(strings.ToLower(string(raw)), "microsoft")
+}
+
+func findWindowsBinary() (string, error) {
+	if configured := strings.TrimSpace(configuredWindowsBinary); configured != "" {
+		return configured, nil
+	}
+	if path, err := exec.LookPath("fortivpn.exe"); err == nil {
+		return path, nil
+	}
+	return "", errors.New("fortivpn.exe not found on PATH; install the Windows build on the Windows side or set wsl_windows_binary in the config file")
+}
+
+// proxyToWindows re-runs the command with the Windows-side fortivpn.exe
+// through WSL interop, since FortiClient runs on the Windows host. It
+// reports false when not in WSL, when disabled with FORTIVPN_WSL_PROXY=0,
+// or when no Windows binary is available.
+func proxyToWindows(args []string) (int, bool) {
+	if os.Getenv(wslProxyEnv) == "0" || !runningInWSL() {
+		return 0, false
+	}
+	binary, err := findWindowsBinary()
+	if err != nil {
+		if os.Getenv(wslProxyEnv) == "1" {
+			return fail(fmt.Errorf("running inside WSL: %w", err)), true
+		}
+		return 0, false
+	}
+
+	cmd := exec.Command(binary, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), wslProxyEnv+"=0")
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), true
+		}
+		return fail(fmt.Errorf("failed to run %s through WSL interop: %w", binary, err)), true
+	}
+	return 0, true
+}
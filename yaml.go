@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// encodeYAML writes v as block-style YAML. It goes through v's JSON
+// encoding, so the json tags name the keys and order them.
+func encodeYAML(v any) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	node, err := readYAMLNode(decoder)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if node.scalar() {
+		out.WriteString(node.inline() + "\n")
+	} else {
+		node.write(&out, 0)
+	}
+	return out.Bytes(), nil
+}
+
+// yamlNode keeps a JSON value in document order; Go maps would sort it.
+type yamlNode struct {
+	kind   byte // '{', '[' or 0 for a scalar
+	text   string
+	keys   []string
+	values []yamlNode
+}
+
+func readYAMLNode(decoder *json.Decoder) (yamlNode, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return yamlNode{}, err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return yamlNode{text: yamlScalar(token)}, nil
+	}
+	node := yamlNode{kind: byte(delim)}
+	for decoder.More() {
+		if node.kind == '{' {
+			key, err := decoder.Token()
+			if err != nil {
+				return yamlNode{}, err
+			}
+			node.keys = append(node.keys, yamlString(key.(string)))
+		}
+		value, err := readYAMLNode(decoder)
+		if err != nil {
+			return yamlNode{}, err
+		}
+		node.values = append(node.values, value)
+	}
+	_, err = decoder.Token()
+	return node, err
+}
+
+// scalar reports whether n is written on its key's line: scalars and
+// empty collections.
+func (n yamlNode) scalar() bool {
+	return n.kind == 0 || len(n.values) == 0
+}
+
+func (n yamlNode) inline() string {
+	switch {
+	case n.kind == '{':
+		return "{}"
+	case n.kind == '[':
+		return "[]"
+	}
+	return n.text
+}
+
+// write puts a collection on lines indented by indent levels. Sequences
+// under a key sit at the key's indentation, the usual style.
+func (n yamlNode) write(out *bytes.Buffer, indent int) {
+	pad := strings.Repeat("  ", indent)
+	for i, value := range n.values {
+		prefix := pad + "- "
+		if n.kind == '{' {
+			prefix = pad + n.keys[i] + ":"
+		}
+		switch {
+		case value.scalar():
+			if n.kind == '{' {
+				prefix += " "
+			}
+			out.WriteString(prefix + value.inline() + "\n")
+		case n.kind == '{' && value.kind == '[':
+			out.WriteString(prefix + "\n")
+			value.write(out, indent)
+		case n.kind == '{':
+			out.WriteString(prefix + "\n")
+			value.write(out, indent+1)
+		default:
+			// The item's first line takes the dash in place of its indentation.
+			var item bytes.Buffer
+			value.write(&item, indent+1)
+			out.WriteString(prefix + strings.TrimPrefix(item.String(), pad+"  "))
+		}
+	}
+}
+
+func yamlScalar(token json.Token) string {
+	switch v := token.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case string:
+		return yamlString(v)
+	}
+	return fmt.Sprint(token)
+}
+
+var yamlPlainUnsafe = regexp.MustCompile(`^[-?:,\[\]{}#&*!|>'"%@` + "`" + `\s]|: |\s#|:$|\s$|[\x00-\x1f\x7f]`)
+
+// yamlString leaves s unquoted when a YAML reader would read it back as the
+// same string, and otherwise quotes it (a JSON string is a valid YAML
+// double-quoted one).
+func yamlString(s string) string {
+	if s == "" || yamlPlainUnsafe.MatchString(s) || yamlPlainScalar(s) != any(s) {
+		quoted, _ := json.Marshal(s)
+		return string(quoted)
+	}
+	return s
+}
+
+// decodeYAML reads the subset of YAML that encodeYAML writes and people
+// write by hand for config-like files: block mappings and sequences,
+// plain, single- and double-quoted scalars, comments, and flow
+// collections on one line. Anchors, tags, block scalars and multiple
+// documents are rejected. The result is decoded into v as JSON would be.
+func decodeYAML(data []byte, v any) error {
+	parser := &yamlParser{}
+	for i, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		text := strings.TrimRight(stripYAMLComment(line), " \t")
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || i == 0 && trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "---") || strings.HasPrefix(trimmed, "...") {
+			return fmt.Errorf("yaml: line %d: only a single document is supported", i+1)
+		}
+		if strings.HasPrefix(strings.TrimLeft(text, " "), "\t") {
+			return fmt.Errorf("yaml: line %d: tabs cannot indent", i+1)
+		}
+		parser.lines = append(parser.lines, yamlLine{number: i + 1, indent: len(text) - len(strings.TrimLeft(text, " ")), text: trimmed})
+	}
+	var doc any
+	if len(parser.lines) > 0 {
+		var err error
+		if doc, err = parser.node(parser.lines[0].indent); err != nil {
+			return err
+		}
+		if parser.pos < len(parser.lines) {
+			return parser.errorf("unexpected indentation")
+		}
+	}
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	line := p.lines[min(p.pos, len(p.lines)-1)]
+	return fmt.Errorf("yaml: line %d: %s", line.number, fmt.Sprintf(format, args...))
+}
+
+// node parses the mapping, sequence or scalar whose lines start at indent.
+func (p *yamlParser) node(indent int) (any, error) {
+	line := p.lines[p.pos]
+	switch {
+	case line.text == "-" || strings.HasPrefix(line.text, "- "):
+		return p.sequence(indent)
+	case yamlKey(line.text) != "":
+		return p.mapping(indent)
+	}
+	value, err := parseYAMLScalar(line.text)
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	p.pos++
+	return value, nil
+}
+
+func (p *yamlParser) sequence(indent int) (any, error) {
+	items := []any{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		line := p.lines[p.pos]
+		if line.text != "-" && !strings.HasPrefix(line.text, "- ") {
+			break
+		}
+		rest := strings.TrimSpace(strings.TrimPrefix(line.text, "-"))
+		if rest == "" {
+			p.pos++
+			if p.pos >= len(p.lines) || p.lines[p.pos].indent <= indent {
+				items = append(items, nil)
+				continue
+			}
+			item, err := p.node(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+		// "- key: value" opens a mapping whose keys line up with "key".
+		p.lines[p.pos] = yamlLine{number: line.number, indent: indent + len(line.text) - len(rest), text: rest}
+		item, err := p.node(p.lines[p.pos].indent)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (p *yamlParser) mapping(indent int) (any, error) {
+	fields := map[string]any{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		line := p.lines[p.pos]
+		key := yamlKey(line.text)
+		if key == "" {
+			return nil, p.errorf("expected a key")
+		}
+		name, err := parseYAMLScalar(key)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		nameText := fmt.Sprint(name)
+		if _, dup := fields[nameText]; dup {
+			return nil, p.errorf("duplicate key %q", nameText)
+		}
+		rest := strings.TrimSpace(line.text[len(key)+1:])
+		if rest != "" {
+			if fields[nameText], err = parseYAMLScalar(rest); err != nil {
+				return nil, p.errorf("%v", err)
+			}
+			p.pos++
+			continue
+		}
+		p.pos++
+		next := yamlLine{indent: -1}
+		if p.pos < len(p.lines) {
+			next = p.lines[p.pos]
+		}
+		// A sequence may sit at its key's own indentation.
+		switch {
+		case next.indent > indent, next.indent == indent && (next.text == "-" || strings.HasPrefix(next.text, "- ")):
+			if fields[nameText], err = p.node(next.indent); err != nil {
+				return nil, err
+			}
+		default:
+			fields[nameText] = nil
+		}
+	}
+	return fields, nil
+}
+
+// yamlKey returns the key part of a "key: value" or "key:" line, or "".
+func yamlKey(text string) string {
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'") {
+		end := closingQuote(text)
+		if end < 0 || !strings.HasPrefix(text[end+1:], ":") {
+			return ""
+		}
+		if rest := text[end+2:]; rest != "" && rest[0] != ' ' {
+			return ""
+		}
+		return text[:end+1]
+	}
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		return ""
+	}
+	if i := strings.Index(text, ": "); i > 0 {
+		return text[:i]
+	}
+	if strings.HasSuffix(text, ":") && len(text) > 1 {
+		return text[:len(text)-1]
+	}
+	return ""
+}
+
+func closingQuote(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case quote == '\'' && text[i] == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// stripYAMLComment drops a "#" comment that is not inside quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case (c == '"' || c == '\'') && (i == 0 || strings.ContainsRune(" :-[{,", rune(line[i-1]))):
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func parseYAMLScalar(text string) (any, error) {
+	switch {
+	case strings.HasPrefix(text, `"`):
+		if closingQuote(text) != len(text)-1 {
+			return nil, fmt.Errorf("unterminated string %s", text)
+		}
+		var s string
+		if err := json.Unmarshal([]byte(text), &s); err != nil {
+			return nil, fmt.Errorf("invalid string %s", text)
+		}
+		return s, nil
+	case strings.HasPrefix(text, "'"):
+		if closingQuote(text) != len(text)-1 {
+			return nil, fmt.Errorf("unterminated string %s", text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{"):
+		return parseYAMLFlow(text)
+	case strings.HasPrefix(text, "|") || strings.HasPrefix(text, ">"):
+		return nil, errors.New("block scalars are not supported; use a quoted string")
+	case strings.HasPrefix(text, "&") || strings.HasPrefix(text, "*") || strings.HasPrefix(text, "!"):
+		return nil, errors.New("anchors, aliases and tags are not supported")
+	}
+	return yamlPlainScalar(text), nil
+}
+
+var yamlNumber = regexp.MustCompile(`^[-+]?(\d+|\d*\.\d+|\d+\.\d*)([eE][-+]?\d+)?$`)
+
+// yamlPlainScalar types an unquoted value the YAML 1.2 core schema way.
+func yamlPlainScalar(text string) any {
+	switch text {
+	case "null", "Null", "NULL", "~":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if yamlNumber.MatchString(text) {
+		return json.Number(strings.TrimPrefix(text, "+"))
+	}
+	return text
+}
+
+// parseYAMLFlow reads a one-line flow collection such as [a, "b"] or
+// {name: x, port: 443}.
+func parseYAMLFlow(text string) (any, error) {
+	flow := &yamlFlow{text: text}
+	value, err := flow.value()
+	if err == nil && flow.skipSpace() < len(text) {
+		err = errors.New("trailing characters")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid flow collection %s: %w", text, err)
+	}
+	return value, nil
+}
+
+type yamlFlow struct {
+	text string
+	pos  int
+}
+
+func (f *yamlFlow) skipSpace() int {
+	for f.pos < len(f.text) && (f.text[f.pos] == ' ' || f.text[f.pos] == '\t') {
+		f.pos++
+	}
+	return f.pos
+}
+
+func (f *yamlFlow) value() (any, error) {
+	if f.skipSpace() >= len(f.text) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	switch f.text[f.pos] {
+	case '[':
+		return f.collection(']')
+	case '{':
+		return f.collection('}')
+	}
+	return f.scalar(",]}")
+}
+
+// scalar reads a quoted scalar, or a plain one up to one of stops.
+func (f *yamlFlow) scalar(stops string) (any, error) {
+	rest := f.text[f.pos:]
+	if rest[0] == '"' || rest[0] == '\'' {
+		end := closingQuote(rest)
+		if end < 0 {
+			return nil, errors.New("unterminated string")
+		}
+		f.pos += end + 1
+		return parseYAMLScalar(rest[:end+1])
+	}
+	end := strings.IndexAny(rest, stops)
+	if end < 0 {
+		end = len(rest)
+	}
+	f.pos += end
+	return yamlPlainScalar(strings.TrimSpace(rest[:end])), nil
+}
+
+func (f *yamlFlow) collection(closing byte) (any, error) {
+	f.pos++
+	items := []any{}
+	fields := map[string]any{}
+	for {
+		if f.skipSpace() >= len(f.text) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if f.text[f.pos] == closing {
+			f.pos++
+			break
+		}
+		if closing == ']' {
+			item, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		} else {
+			key, err := f.scalar(":,}")
+			if err != nil {
+				return nil, err
+			}
+			if f.skipSpace() >= len(f.text) || f.text[f.pos] != ':' {
+				return nil, errors.New("expected \":\" after a key")
+			}
+			f.pos++
+			if fields[fmt.Sprint(key)], err = f.value(); err != nil {
+				return nil, err
+			}
+		}
+		if f.skipSpace() < len(f.text) && f.text[f.pos] == ',' {
+			f.pos++
+		} else if f.pos >= len(f.text) || f.text[f.pos] != closing {
+			return nil, fmt.Errorf("expected \",\" or %q", closing)
+		}
+	}
+	if closing == ']' {
+		return items, nil
+	}
+	return fields, nil
+}